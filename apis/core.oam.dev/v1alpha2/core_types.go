@@ -28,6 +28,20 @@ type CUE struct {
 	// Template defines the abstraction template data of the capability, it will replace the old CUE template in extension field.
 	// Template is a required field if CUE is defined in Capability Definition.
 	Template string `json:"template"`
+
+	// Files are the other files of the template, they are compiled together with Template as one CUE instance,
+	// so that a complex template can be split into files, e.g. the parameter and the outputs.
+	// +optional
+	Files []CUEFile `json:"files,omitempty"`
+}
+
+// CUEFile is a file of a CUE template split into files
+type CUEFile struct {
+	// Name is the name of the file, it must be unique in the template and is used to report errors
+	Name string `json:"name"`
+
+	// Content is the CUE source of the file
+	Content string `json:"content"`
 }
 
 // Schematic defines the encapsulation of this capability(workload/trait/scope),
@@ -37,6 +51,8 @@ type Schematic struct {
 
 	HELM *Helm `json:"helm,omitempty"`
 
+	KUSTOMIZE *Kustomize `json:"kustomize,omitempty"`
+
 	// TODO(wonderflow): support HCL(terraform)/KUBE(K8s Object) here.
 }
 
@@ -246,6 +262,14 @@ type ScopeDefinitionSpec struct {
 	// multiple instances of this kind of scope.
 	AllowComponentOverlap bool `json:"allowComponentOverlap"`
 
+	// Schematic defines the data format and template of the encapsulation of the scope
+	// +optional
+	Schematic *Schematic `json:"schematic,omitempty"`
+
+	// Status defines the custom health policy and status message for scope
+	// +optional
+	Status *Status `json:"status,omitempty"`
+
 	// Extension is used for extension needs by OAM platform builders
 	// +optional
 	// +kubebuilder:pruning:PreserveUnknownFields
@@ -332,6 +356,13 @@ type Helm struct {
 	Repository runtime.RawExtension `json:"repository"`
 }
 
+// A Kustomize represents resources used by a Kustomize module
+type Kustomize struct {
+	// Spec records the Kustomization used by a Kustomize module workload, e.g. the source and the path of the overlay.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Spec runtime.RawExtension `json:"spec"`
+}
+
 // A ComponentStatus represents the observed state of a Component.
 type ComponentStatus struct {
 	// The generation observed by the component controller.
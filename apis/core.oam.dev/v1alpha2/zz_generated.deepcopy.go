@@ -654,6 +654,11 @@ func (in *CPUResources) DeepCopy() *CPUResources {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CUE) DeepCopyInto(out *CUE) {
 	*out = *in
+	if in.Files != nil {
+		in, out := &in.Files, &out.Files
+		*out = make([]CUEFile, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CUE.
@@ -666,6 +671,21 @@ func (in *CUE) DeepCopy() *CUE {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CUEFile) DeepCopyInto(out *CUEFile) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CUEFile.
+func (in *CUEFile) DeepCopy() *CUEFile {
+	if in == nil {
+		return nil
+	}
+	out := new(CUEFile)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ChildResourceKind) DeepCopyInto(out *ChildResourceKind) {
 	*out = *in
@@ -1775,6 +1795,22 @@ func (in *HistoryWorkload) DeepCopy() *HistoryWorkload {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Kustomize) DeepCopyInto(out *Kustomize) {
+	*out = *in
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Kustomize.
+func (in *Kustomize) DeepCopy() *Kustomize {
+	if in == nil {
+		return nil
+	}
+	out := new(Kustomize)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ManualScalerTrait) DeepCopyInto(out *ManualScalerTrait) {
 	*out = *in
@@ -1923,13 +1959,18 @@ func (in *Schematic) DeepCopyInto(out *Schematic) {
 	if in.CUE != nil {
 		in, out := &in.CUE, &out.CUE
 		*out = new(CUE)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.HELM != nil {
 		in, out := &in.HELM, &out.HELM
 		*out = new(Helm)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.KUSTOMIZE != nil {
+		in, out := &in.KUSTOMIZE, &out.KUSTOMIZE
+		*out = new(Kustomize)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Schematic.
@@ -2004,6 +2045,16 @@ func (in *ScopeDefinitionList) DeepCopyObject() runtime.Object {
 func (in *ScopeDefinitionSpec) DeepCopyInto(out *ScopeDefinitionSpec) {
 	*out = *in
 	out.Reference = in.Reference
+	if in.Schematic != nil {
+		in, out := &in.Schematic, &out.Schematic
+		*out = new(Schematic)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Status != nil {
+		in, out := &in.Status, &out.Status
+		*out = new(Status)
+		**out = **in
+	}
 	if in.Extension != nil {
 		in, out := &in.Extension, &out.Extension
 		*out = new(runtime.RawExtension)
@@ -58,6 +58,12 @@ type Capability struct {
 	Source  *Source       `json:"source,omitempty"`
 	Install *Installation `json:"install,omitempty"`
 	CrdInfo *CRDInfo      `json:"crdInfo,omitempty"`
+
+	// Helm is the chart rendered by a Helm capability
+	Helm *Chart `json:"helm,omitempty"`
+
+	// Category is the category of the template of the capability, it's empty for CUE capabilities loaded from extension
+	Category CapabilityCategory `json:"category,omitempty"`
 }
 
 // Chart defines all necessary information to install a whole chart
@@ -102,10 +108,14 @@ const (
 type CapabilityCategory string
 
 const (
+	// CUECategory means the capability is in CUE format
+	CUECategory CapabilityCategory = "cue"
 	// TerraformCategory means the capability is in Terraform format
 	TerraformCategory CapabilityCategory = "terraform"
 	// HelmCategory means the capability is a helm capability
 	HelmCategory CapabilityCategory = "helm"
+	// KustomizeCategory means the capability is a Kustomize capability
+	KustomizeCategory CapabilityCategory = "kustomize"
 )
 
 // Parameter defines a parameter for cli from capability template
@@ -28,6 +28,7 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	oamcore "github.com/oam-dev/kubevela/apis/core.oam.dev"
 	velacore "github.com/oam-dev/kubevela/apis/standard.oam.dev/v1alpha1"
@@ -36,6 +37,7 @@ import (
 	oamv1alpha2 "github.com/oam-dev/kubevela/pkg/controller/core.oam.dev/v1alpha2"
 	"github.com/oam-dev/kubevela/pkg/controller/utils"
 	"github.com/oam-dev/kubevela/pkg/oam"
+	"github.com/oam-dev/kubevela/pkg/oam/util"
 	"github.com/oam-dev/kubevela/pkg/utils/system"
 	oamwebhook "github.com/oam-dev/kubevela/pkg/webhook/core.oam.dev"
 	velawebhook "github.com/oam-dev/kubevela/pkg/webhook/standard.oam.dev"
@@ -77,6 +79,7 @@ func main() {
 	var storageDriver string
 	var syncPeriod time.Duration
 	var applyOnceOnly string
+	var definitionFeatureGates string
 
 	flag.BoolVar(&useWebhook, "use-webhook", false, "Enable Admission Webhook")
 	flag.BoolVar(&useTraitInjector, "use-trait-injector", false, "Enable TraitInjector")
@@ -101,6 +104,8 @@ func main() {
 	flag.StringVar(&storageDriver, "storage-driver", "Local", "Application file save to the storage driver")
 	flag.DurationVar(&syncPeriod, "informer-re-sync-interval", 5*time.Minute,
 		"controller shared informer lister full re-sync period")
+	flag.StringVar(&definitionFeatureGates, "definition-feature-gates", "",
+		"The feature gates enabled for definitions separated by comma, the components and traits of applications whose definitions require other feature gates are skipped.")
 	flag.StringVar(&oam.SystemDefinitonNamespace, "system-definition-namespace", "vela-system", "define the namespace of the system-level definition")
 	flag.Parse()
 
@@ -150,6 +155,11 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err := util.RegisterTemplateMetrics(metrics.Registry); err != nil {
+		setupLog.Error(err, "unable to register template metrics")
+		os.Exit(1)
+	}
+
 	if err := utils.CheckDisabledCapabilities(disableCaps); err != nil {
 		setupLog.Error(err, "unable to get enabled capabilities")
 		os.Exit(1)
@@ -168,6 +178,12 @@ func main() {
 		}
 	}
 
+	for _, gate := range strings.Split(definitionFeatureGates, ",") {
+		if gate = strings.TrimSpace(gate); gate != "" {
+			controllerArgs.DefinitionFeatureGates = append(controllerArgs.DefinitionFeatureGates, gate)
+		}
+	}
+
 	switch strings.ToLower(applyOnceOnly) {
 	case "", "false", string(oamcontroller.ApplyOnceOnlyOff):
 		controllerArgs.ApplyMode = oamcontroller.ApplyOnceOnlyOff
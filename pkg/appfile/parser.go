@@ -115,6 +115,8 @@ type Appfile struct {
 	Name         string
 	RevisionName string
 	Workloads    []*Workload
+	// Warnings tells the components and traits skipped as the feature gates of their definitions aren't enabled
+	Warnings []string
 }
 
 // TemplateValidate validate Template format
@@ -122,18 +124,49 @@ func (af *Appfile) TemplateValidate() error {
 	return nil
 }
 
+// TemplateLoader loads the templates of capabilities with the same contract as util.LoadTemplate,
+// e.g. util.CachingTemplateLoader
+type TemplateLoader interface {
+	LoadTemplate(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper, key string, kd util.TemplateKind) (*util.Template, error)
+}
+
+// loadTemplateFunc adapts util.LoadTemplate to TemplateLoader
+type loadTemplateFunc func(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper, key string, kd util.TemplateKind) (*util.Template, error)
+
+func (f loadTemplateFunc) LoadTemplate(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper, key string, kd util.TemplateKind) (*util.Template, error) {
+	return f(ctx, cli, dm, key, kd)
+}
+
 // Parser is an application parser
 type Parser struct {
 	client client.Client
 	dm     discoverymapper.DiscoveryMapper
+	loader TemplateLoader
+}
+
+// ParserOption customizes the application parser
+type ParserOption func(*Parser)
+
+// WithTemplateLoader makes the parser load templates by the loader instead of reading the definitions on every parse
+func WithTemplateLoader(loader TemplateLoader) ParserOption {
+	return func(p *Parser) {
+		p.loader = loader
+	}
 }
 
 // NewApplicationParser create appfile parser
-func NewApplicationParser(cli client.Client, dm discoverymapper.DiscoveryMapper) *Parser {
-	return &Parser{
+func NewApplicationParser(cli client.Client, dm discoverymapper.DiscoveryMapper, opts ...ParserOption) *Parser {
+	p := &Parser{
 		client: cli,
 		dm:     dm,
+		loader: loadTemplateFunc(func(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper, key string, kd util.TemplateKind) (*util.Template, error) {
+			return util.LoadTemplateOfKind(ctx, cli, dm, key, kd)
+		}),
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
+	return p
 }
 
 // GenerateAppFile converts an application to an Appfile
@@ -142,7 +175,11 @@ func (p *Parser) GenerateAppFile(ctx context.Context, name string, app *v1alpha2
 	appfile.Name = name
 	var wds []*Workload
 	for _, comp := range app.Spec.Components {
-		wd, err := p.parseWorkload(ctx, comp)
+		wd, err := p.parseWorkload(ctx, comp, appfile)
+		if util.IsFeatureGated(err) {
+			appfile.Warnings = append(appfile.Warnings, fmt.Sprintf("skip component %s: %s", comp.Name, err.Error()))
+			continue
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -153,12 +190,14 @@ func (p *Parser) GenerateAppFile(ctx context.Context, name string, app *v1alpha2
 	return appfile, nil
 }
 
-func (p *Parser) parseWorkload(ctx context.Context, comp v1alpha2.ApplicationComponent) (*Workload, error) {
+// parseWorkload parses the component, the traits whose feature gates aren't enabled are skipped
+// with warnings added to the appfile
+func (p *Parser) parseWorkload(ctx context.Context, comp v1alpha2.ApplicationComponent, appfile *Appfile) (*Workload, error) {
 	workload := new(Workload)
 	workload.Traits = []*Trait{}
 	workload.Name = comp.Name
 	workload.Type = comp.WorkloadType
-	templ, err := util.LoadTemplate(ctx, p.client, workload.Type, types.TypeComponentDefinition)
+	templ, err := p.loader.LoadTemplate(ctx, p.client, p.dm, workload.Type, util.ComponentTemplateKind)
 	if err != nil && !kerrors.IsNotFound(err) {
 		return nil, errors.WithMessagef(err, "fetch type of %s", comp.Name)
 	}
@@ -178,12 +217,16 @@ func (p *Parser) parseWorkload(ctx context.Context, comp v1alpha2.ApplicationCom
 		if err != nil {
 			return nil, errors.Errorf("fail to parse properties of %s for %s", traitValue.Name, comp.Name)
 		}
-		trait, err := p.parseTrait(ctx, traitValue.Name, properties)
+		traits, err := p.parseTrait(ctx, traitValue.Name, properties)
+		if util.IsFeatureGated(err) {
+			appfile.Warnings = append(appfile.Warnings, fmt.Sprintf("skip trait %s of component %s: %s", traitValue.Name, comp.Name, err.Error()))
+			continue
+		}
 		if err != nil {
 			return nil, errors.WithMessagef(err, "component(%s) parse trait(%s)", comp.Name, traitValue.Name)
 		}
 
-		workload.Traits = append(workload.Traits, trait)
+		workload.Traits = append(workload.Traits, traits...)
 	}
 	for scopeType, instanceName := range comp.Scopes {
 		gvk, err := util.GetScopeGVK(ctx, p.client, p.dm, scopeType)
@@ -198,23 +241,37 @@ func (p *Parser) parseWorkload(ctx context.Context, comp v1alpha2.ApplicationCom
 	return workload, nil
 }
 
-func (p *Parser) parseTrait(ctx context.Context, name string, properties map[string]interface{}) (*Trait, error) {
-	templ, err := util.LoadTemplate(ctx, p.client, name, types.TypeTrait)
+// parseTrait parses the trait, a composite trait is expanded into the traits of its constituents
+func (p *Parser) parseTrait(ctx context.Context, name string, properties map[string]interface{}) ([]*Trait, error) {
+	templ, err := p.loader.LoadTemplate(ctx, p.client, p.dm, name, util.TraitTemplateKind)
 	if kerrors.IsNotFound(err) {
 		return nil, errors.Errorf("trait definition of %s not found", name)
 	}
 	if err != nil {
 		return nil, err
 	}
+	return traitsOfTemplate(name, templ, properties), nil
+}
 
-	return &Trait{
-		Name:               name,
-		CapabilityCategory: templ.CapabilityCategory,
-		Params:             properties,
-		Template:           templ.TemplateStr,
-		HealthCheckPolicy:  templ.Health,
-		CustomStatusFormat: templ.CustomStatus,
-	}, nil
+// traitsOfTemplate returns the trait of the template, or the traits of its constituents in order if it's
+// a composite trait, which are given the same properties. Composite constituents are expanded in turn, and
+// a composite trait having a template of its own is kept before its constituents.
+func traitsOfTemplate(name string, templ *util.Template, properties map[string]interface{}) []*Trait {
+	var traits []*Trait
+	if len(templ.Constituents) == 0 || templ.TemplateStr != "" {
+		traits = append(traits, &Trait{
+			Name:               name,
+			CapabilityCategory: templ.CapabilityCategory,
+			Params:             properties,
+			Template:           templ.TemplateStr,
+			HealthCheckPolicy:  templ.Health,
+			CustomStatusFormat: templ.CustomStatus,
+		})
+	}
+	for _, constituent := range templ.Constituents {
+		traits = append(traits, traitsOfTemplate(constituent.Name, constituent, properties)...)
+	}
+	return traits
 }
 
 // GenerateApplicationConfiguration converts an appFile to applicationConfig & Components
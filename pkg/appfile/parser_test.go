@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"testing"
 
 	"github.com/crossplane/crossplane-runtime/apis/core/v1alpha1"
 	"github.com/crossplane/crossplane-runtime/pkg/test"
@@ -27,17 +28,21 @@ import (
 	"github.com/google/go-cmp/cmp"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
 	oamtypes "github.com/oam-dev/kubevela/apis/types"
 	"github.com/oam-dev/kubevela/pkg/oam"
+	"github.com/oam-dev/kubevela/pkg/oam/discoverymapper"
 	"github.com/oam-dev/kubevela/pkg/oam/util"
 )
 
@@ -250,6 +255,75 @@ var _ = Describe("Test application parser", func() {
 	})
 })
 
+// mockTemplateLoader serves the templates by kind and name, and counts the loads
+type mockTemplateLoader struct {
+	templates map[util.TemplateKind]map[string]*util.Template
+	gated     map[string]bool
+	loads     int
+}
+
+func (l *mockTemplateLoader) LoadTemplate(_ context.Context, _ client.Reader, _ discoverymapper.DiscoveryMapper, key string, kd util.TemplateKind) (*util.Template, error) {
+	l.loads++
+	if l.gated[key] {
+		return nil, errors.WithMessagef(&util.ErrFeatureGated{Kind: string(kd), Name: key, Gates: []string{"alpha"}}, "LoadTemplate [%s] ", key)
+	}
+	if tmpl, ok := l.templates[kd][key]; ok {
+		return tmpl, nil
+	}
+	return nil, kerrors.NewNotFound(schema.GroupResource{}, key)
+}
+
+func TestParserWithTemplateLoader(t *testing.T) {
+	app := v1alpha2.Application{}
+	assert.NoError(t, yaml.Unmarshal([]byte(appfileYaml), &app))
+	loader := &mockTemplateLoader{templates: map[util.TemplateKind]map[string]*util.Template{
+		util.ComponentTemplateKind: {"worker": {TemplateStr: "output: {}", CapabilityCategory: oamtypes.CUECategory}},
+		util.TraitTemplateKind:     {"scaler": {TemplateStr: "outputs: {}", CapabilityCategory: oamtypes.CUECategory}},
+	}}
+
+	af, err := NewApplicationParser(&test.MockClient{}, nil, WithTemplateLoader(loader)).GenerateAppFile(context.TODO(), "test", &app)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, loader.loads)
+	assert.Equal(t, "output: {}", af.Workloads[0].Template)
+	assert.Equal(t, "outputs: {}", af.Workloads[0].Traits[0].Template)
+	assert.Empty(t, af.Warnings)
+
+	loader.gated = map[string]bool{"scaler": true}
+	af, err = NewApplicationParser(&test.MockClient{}, nil, WithTemplateLoader(loader)).GenerateAppFile(context.TODO(), "test", &app)
+	assert.NoError(t, err, "a feature gated trait should be skipped")
+	assert.Len(t, af.Workloads, 1)
+	assert.Empty(t, af.Workloads[0].Traits)
+	assert.Len(t, af.Warnings, 1)
+	assert.Contains(t, af.Warnings[0], "skip trait scaler of component")
+
+	loader.gated = map[string]bool{"worker": true}
+	af, err = NewApplicationParser(&test.MockClient{}, nil, WithTemplateLoader(loader)).GenerateAppFile(context.TODO(), "test", &app)
+	assert.NoError(t, err, "a feature gated component should be skipped")
+	assert.Empty(t, af.Workloads)
+	assert.Len(t, af.Warnings, 1)
+	assert.Contains(t, af.Warnings[0], "skip component")
+
+	// a composite trait is expanded into its constituents, nested ones in turn
+	loader.gated = nil
+	loader.templates[util.TraitTemplateKind]["scaler"] = &util.Template{Name: "scaler", Constituents: []*util.Template{
+		{Name: "hpa", TemplateStr: "outputs: hpa: {}", CapabilityCategory: oamtypes.CUECategory},
+		{Name: "exposure", Constituents: []*util.Template{
+			{Name: "ingress", TemplateStr: "outputs: ingress: {}", CapabilityCategory: oamtypes.CUECategory},
+			{Name: "service", TemplateStr: "outputs: service: {}", CapabilityCategory: oamtypes.CUECategory},
+		}},
+	}}
+	af, err = NewApplicationParser(&test.MockClient{}, nil, WithTemplateLoader(loader)).GenerateAppFile(context.TODO(), "test", &app)
+	assert.NoError(t, err)
+	traits := af.Workloads[0].Traits
+	var names []string
+	for _, trait := range traits {
+		names = append(names, trait.Name)
+		assert.Equal(t, map[string]interface{}{"replicas": float64(10)}, trait.Params)
+	}
+	assert.Equal(t, []string{"hpa", "ingress", "service"}, names)
+	assert.Equal(t, "outputs: ingress: {}", traits[1].Template)
+}
+
 func equal(af, dest *Appfile) bool {
 	if af.Name != dest.Name || len(af.Workloads) != len(dest.Workloads) {
 		return false
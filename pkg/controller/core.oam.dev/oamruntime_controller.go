@@ -47,4 +47,8 @@ type Args struct {
 	// CustomRevisionHookURL is a webhook which will let oam-runtime to call with AC+Component info
 	// The webhook server will return a customized component revision for oam-runtime
 	CustomRevisionHookURL string
+
+	// DefinitionFeatureGates are the feature gates enabled for definitions, the components and traits of
+	// applications whose definitions require other feature gates are skipped.
+	DefinitionFeatureGates []string
 }
@@ -31,6 +31,7 @@ import (
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 
 	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
 	"github.com/oam-dev/kubevela/pkg/appfile"
@@ -50,6 +51,7 @@ type Reconciler struct {
 	Log        logr.Logger
 	Scheme     *runtime.Scheme
 	applicator apply.Applicator
+	templates  *oamutil.CachingTemplateLoader
 }
 
 // +kubebuilder:rbac:groups=core.oam.dev,resources=applications,verbs=get;list;watch;create;update;patch;delete
@@ -82,7 +84,11 @@ func (r *Reconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 
 	applog.Info("parse template")
 	// parse template
-	appParser := appfile.NewApplicationParser(r.Client, r.dm)
+	var parserOpts []appfile.ParserOption
+	if r.templates != nil {
+		parserOpts = append(parserOpts, appfile.WithTemplateLoader(r.templates))
+	}
+	appParser := appfile.NewApplicationParser(r.Client, r.dm, parserOpts...)
 
 	ctx = oamutil.SetNamespaceInCtx(ctx, app.Namespace)
 	appfile, err := appParser.GenerateAppFile(ctx, app.Name, app)
@@ -91,6 +97,9 @@ func (r *Reconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		app.Status.SetConditions(errorCondition("Parsed", err))
 		return handler.handleErr(err)
 	}
+	for _, warning := range appfile.Warnings {
+		applog.Info("[Handle Parse] " + warning)
+	}
 
 	app.Status.SetConditions(readyCondition("Parsed"))
 
@@ -168,17 +177,41 @@ func (r *Reconciler) UpdateStatus(ctx context.Context, app *v1alpha2.Application
 }
 
 // Setup adds a controller that reconciles AppRollout.
-func Setup(mgr ctrl.Manager, _ core.Args, _ logging.Logger) error {
+func Setup(mgr ctrl.Manager, args core.Args, _ logging.Logger) error {
 	dm, err := discoverymapper.New(mgr.GetConfig())
 	if err != nil {
 		return fmt.Errorf("create discovery dm fail %w", err)
 	}
+	templates := oamutil.NewCachingTemplateLoader(oamutil.LoadWithFeatureGates(args.DefinitionFeatureGates...))
+	// keep the cached templates up to date with the definitions
+	for _, def := range []runtime.Object{&v1alpha2.ComponentDefinition{}, &v1alpha2.WorkloadDefinition{}, &v1alpha2.TraitDefinition{}} {
+		informer, err := mgr.GetCache().GetInformer(context.Background(), def)
+		if err != nil {
+			return fmt.Errorf("get informer of %T fail %w", def, err)
+		}
+		informer.AddEventHandler(templates.EventHandler())
+	}
 	reconciler := Reconciler{
 		Client:     mgr.GetClient(),
 		Log:        ctrl.Log.WithName("Application"),
 		Scheme:     mgr.GetScheme(),
 		dm:         dm,
 		applicator: apply.NewAPIApplicator(mgr.GetClient()),
+		templates:  templates,
+	}
+	// warm the cache once the informers of definitions are synced, so that the first reconciles don't read definitions
+	err = mgr.Add(manager.RunnableFunc(func(stop <-chan struct{}) error {
+		if !mgr.GetCache().WaitForCacheSync(stop) {
+			return nil
+		}
+		if err := oamutil.WarmCache(context.Background(), mgr.GetClient(), dm, templates); err != nil {
+			// the templates which fail to warm are loaded on demand
+			reconciler.Log.Error(err, "Failed to warm the cache of templates")
+		}
+		return nil
+	}))
+	if err != nil {
+		return fmt.Errorf("add the runnable warming templates fail %w", err)
 	}
 	return reconciler.SetupWithManager(mgr)
 }
@@ -20,11 +20,7 @@ package utils
 import (
 	"context"
 	"fmt"
-	"regexp"
-	"strings"
 
-	"cuelang.org/go/cue"
-	"github.com/getkin/kin-openapi/openapi3"
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -33,16 +29,14 @@ import (
 
 	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
 	"github.com/oam-dev/kubevela/apis/types"
-	mycue "github.com/oam-dev/kubevela/pkg/cue"
 	"github.com/oam-dev/kubevela/pkg/oam/util"
-	"github.com/oam-dev/kubevela/pkg/utils/common"
 )
 
 const (
 	// UsageTag is usage comment annotation
-	UsageTag = "+usage="
+	UsageTag = util.UsageTag
 	// ShortTag is the short alias annotation
-	ShortTag = "+short"
+	ShortTag = util.ShortTag
 )
 
 // CapabilityDefinitionInterface is the interface for Capability (WorkloadDefinition and TraitDefinition)
@@ -231,93 +225,13 @@ func (def *CapabilityBaseDefinition) CreateOrUpdateConfigMap(ctx context.Context
 	return cmName, nil
 }
 
-// getDefinition is the main function for GetDefinition API
-func getOpenAPISchema(capability types.Capability) ([]byte, error) {
-	openAPISchema, err := generateOpenAPISchemaFromCapabilityParameter(capability)
-	if err != nil {
-		return nil, err
-	}
-	swagger, err := openapi3.NewSwaggerLoader().LoadSwaggerFromData(openAPISchema)
-	if err != nil {
-		return nil, err
-	}
-	schemaRef := swagger.Components.Schemas["parameter"]
-	if schemaRef == nil {
-		return nil, fmt.Errorf(util.ErrGenerateOpenAPIV2JSONSchemaForCapability, capability.Name, nil)
-	}
-	schema := schemaRef.Value
-	fixOpenAPISchema("", schema)
-
-	parameter, err := schema.MarshalJSON()
-	if err != nil {
-		return nil, err
-	}
-	return parameter, nil
-}
-
-// generateOpenAPISchemaFromCapabilityParameter returns the parameter of a definition in cue.Value format
-func generateOpenAPISchemaFromCapabilityParameter(capability types.Capability) ([]byte, error) {
-	name := capability.Name
-	template, err := prepareParameterCue(name, capability.CueTemplate)
-	if err != nil {
-		return nil, err
-	}
-
-	// append context section in CUE string
-	template += mycue.BaseTemplate
-
-	var r cue.Runtime
-	cueInst, err := r.Compile("-", template)
-	if err != nil {
-		return nil, err
-	}
-	return common.GenOpenAPI(cueInst)
+// GenerateOpenAPISchema generates the OpenAPI v3 schema of the inputs of tmpl, see util.Template.InputSchema,
+// it's an empty object schema if the template has no parameters.
+func GenerateOpenAPISchema(tmpl *util.Template) ([]byte, error) {
+	return tmpl.InputSchema()
 }
 
-// prepareParameterCue cuts `parameter` section form definition .cue file
-func prepareParameterCue(capabilityName, capabilityTemplate string) (string, error) {
-	var template string
-	var withParameterFlag bool
-	r := regexp.MustCompile("[[:space:]]*parameter:[[:space:]]*{.*")
-
-	for _, text := range strings.Split(capabilityTemplate, "\n") {
-		if r.MatchString(text) {
-			// a variable has to be refined as a definition which starts with "#"
-			text = fmt.Sprintf("parameter: #parameter\n#%s", text)
-			withParameterFlag = true
-		}
-		template += fmt.Sprintf("%s\n", text)
-	}
-
-	if !withParameterFlag {
-		return "", fmt.Errorf("capability %s doesn't contain section `parmeter`", capabilityName)
-	}
-	return template, nil
-}
-
-// fixOpenAPISchema fixes tainted `description` filed, missing of title `field`.
-func fixOpenAPISchema(name string, schema *openapi3.Schema) {
-	t := schema.Type
-	switch t {
-	case "object":
-		for k, v := range schema.Properties {
-			s := v.Value
-			fixOpenAPISchema(k, s)
-		}
-	case "array":
-		fixOpenAPISchema("", schema.Items.Value)
-	}
-	if name != "" {
-		schema.Title = name
-	}
-
-	description := schema.Description
-	if strings.Contains(description, UsageTag) {
-		description = strings.Split(description, UsageTag)[1]
-	}
-	if strings.Contains(description, ShortTag) {
-		description = strings.Split(description, ShortTag)[0]
-		description = strings.TrimSpace(description)
-	}
-	schema.Description = description
+// getDefinition is the main function for GetDefinition API
+func getOpenAPISchema(capability types.Capability) ([]byte, error) {
+	return util.GenerateParameterSchema(capability.Name, capability.CueTemplate)
 }
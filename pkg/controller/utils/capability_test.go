@@ -20,19 +20,15 @@ package utils
 import (
 	"fmt"
 	"io/ioutil"
-	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/crossplane/crossplane-runtime/pkg/test"
-	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/google/go-cmp/cmp"
 	"gotest.tools/assert"
 
 	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
-	"github.com/oam-dev/kubevela/apis/types"
 	"github.com/oam-dev/kubevela/pkg/oam/util"
-	"github.com/oam-dev/kubevela/pkg/utils/system"
 )
 
 const TestDir = "testdata/definition"
@@ -85,65 +81,24 @@ func TestGetOpenAPISchema(t *testing.T) {
 	}
 }
 
-func TestFixOpenAPISchema(t *testing.T) {
-	cases := map[string]struct {
-		inputFile string
-		fixedFile string
-	}{
-		"StandardWorkload": {
-			inputFile: "webservice.json",
-			fixedFile: "webserviceFixed.json",
-		},
-		"ShortTagJson": {
-			inputFile: "shortTagSchema.json",
-			fixedFile: "shortTagSchemaFixed.json",
-		},
-	}
-
-	for name, tc := range cases {
-		t.Run(name, func(t *testing.T) {
-			swagger, _ := openapi3.NewSwaggerLoader().LoadSwaggerFromFile(filepath.Join(TestDir, tc.inputFile))
-			schema := swagger.Components.Schemas["parameter"].Value
-			fixOpenAPISchema("", schema)
-			fixedSchema, _ := schema.MarshalJSON()
-			expectedSchema, _ := ioutil.ReadFile(filepath.Join(TestDir, tc.fixedFile))
-			assert.Equal(t, string(fixedSchema), string(expectedSchema))
-		})
-	}
-}
-
-func TestGenerateOpenAPISchemaFromCapabilityParameter(t *testing.T) {
-	var invalidWorkloadName = "IAmAnInvalidWorkloadDefinition"
-	capabilityDir, _ := system.GetCapabilityDir()
-	if _, err := os.Stat(capabilityDir); err != nil && os.IsNotExist(err) {
-		os.MkdirAll(capabilityDir, 0755)
-	}
-
-	type want struct {
-		data []byte
-		err  error
-	}
-
-	cases := map[string]struct {
-		reason     string
-		capability types.Capability
-		want       want
-	}{
-		"GenerateOpenAPISchemaFromInvalidCapability": {
-			reason:     "generate OpenAPI schema for an invalid Workload/Trait",
-			capability: types.Capability{Name: invalidWorkloadName},
-			want:       want{data: nil, err: fmt.Errorf("capability IAmAnInvalidWorkloadDefinition doesn't contain section `parmeter`")},
-		},
-	}
-	for name, tc := range cases {
-		t.Run(name, func(t *testing.T) {
-			got, err := generateOpenAPISchemaFromCapabilityParameter(tc.capability)
-			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
-				t.Errorf("\n%s\ngetDefinition(...): -want error, +got error:\n%s", tc.reason, diff)
-			}
-			if diff := cmp.Diff(tc.want.data, got); diff != "" {
-				t.Errorf("\n%s\ngetDefinition(...): -want, +got:\n%s", tc.reason, diff)
-			}
-		})
-	}
+func TestGenerateOpenAPISchema(t *testing.T) {
+	data, _ := ioutil.ReadFile(filepath.Join(TestDir, "webserviceParameter.cue"))
+	schema, err := GenerateOpenAPISchema(&util.Template{Name: "webservice", TemplateStr: string(data)})
+	assert.NilError(t, err)
+	expectedSchema, _ := ioutil.ReadFile(filepath.Join(TestDir, "webserviceParameterSchema.json"))
+	assert.Equal(t, string(schema), string(expectedSchema))
+
+	data, _ = ioutil.ReadFile(filepath.Join(TestDir, "workloadNoParameter.cue"))
+	schema, err = GenerateOpenAPISchema(&util.Template{Name: "noParameterWorkload", TemplateStr: string(data)})
+	assert.NilError(t, err)
+	assert.Equal(t, string(schema), `{"type":"object"}`)
+
+	schema, err = GenerateOpenAPISchema(&util.Template{Name: "annotations", TemplateStr: "patch: metadata: annotations: \"oam.dev/managed\": \"true\"\nparameter: {}\n"})
+	assert.NilError(t, err)
+	assert.Equal(t, string(schema), `{"type":"object"}`)
+
+	// the schema of a Helm template is inferred from its chart values
+	schema, err = GenerateOpenAPISchema(&util.Template{Name: "chart", Helm: &v1alpha2.Helm{}, HelmValues: map[string]interface{}{"image": "nginx"}})
+	assert.NilError(t, err)
+	assert.Equal(t, string(schema), `{"properties":{"image":{"default":"nginx","title":"image","type":"string"}},"type":"object"}`)
 }
@@ -0,0 +1,143 @@
+/*
+ Copyright 2021 The KubeVela Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+
+package utils
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam/util"
+)
+
+// LintSeverity is the severity of a LintIssue
+type LintSeverity string
+
+const (
+	// LintError is an issue which breaks the definition
+	LintError LintSeverity = "error"
+	// LintWarning is an issue which doesn't break the definition, e.g. a deprecated field
+	LintWarning LintSeverity = "warning"
+)
+
+// LintIssue is an issue of a definition found by LintDefinitions
+type LintIssue struct {
+	File string
+	// Line is the line of the issue in the file, or of the definition if the issue can't be located more precisely
+	Line int
+	// Definition is the kind and name of the definition, e.g. "TraitDefinition/scaler"
+	Definition string
+	Severity   LintSeverity
+	Message    string
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s: %s", i.File, i.Line, i.Severity, i.Definition, i.Message)
+}
+
+// LintIssues sorts issues by file and line, and errors before warnings on the same line
+type LintIssues []LintIssue
+
+func (s LintIssues) Len() int      { return len(s) }
+func (s LintIssues) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s LintIssues) Less(i, j int) bool {
+	if s[i].File != s[j].File {
+		return s[i].File < s[j].File
+	}
+	if s[i].Line != s[j].Line {
+		return s[i].Line < s[j].Line
+	}
+	if s[i].Severity != s[j].Severity {
+		return s[i].Severity == LintError
+	}
+	return s[i].Message < s[j].Message
+}
+
+// LintDefinitions loads the definitions in the YAML or JSON files of dir like util.NewFileTemplateLoader, and checks
+// their CUE templates, health policies, custom status and the OpenAPI schema of the parameters. The issues are sorted
+// as LintIssues. An error is returned only if the definitions can't be loaded, e.g. a file isn't valid YAML.
+func LintDefinitions(dir string) ([]LintIssue, error) {
+	loader, err := util.NewFileTemplateLoader(dir)
+	if err != nil {
+		return nil, err
+	}
+	var issues LintIssues
+	for _, def := range loader.Definitions() {
+		issues = append(issues, lintDefinition(def)...)
+	}
+	sort.Sort(issues)
+	return issues, nil
+}
+
+func lintDefinition(def util.FileDefinition) []LintIssue {
+	var issues []LintIssue
+	report := func(line int, severity LintSeverity, msg string) {
+		issues = append(issues, LintIssue{File: def.File, Line: line, Definition: def.Kind + "/" + def.Name, Severity: severity, Message: msg})
+	}
+
+	schematic, status, extension := definitionTemplateSource(def.Object)
+	tmpl, err := util.NewTemplate(schematic, status, extension)
+	if err != nil {
+		report(def.Line, LintError, err.Error())
+		return issues
+	}
+	for _, deprecated := range tmpl.Deprecations {
+		report(def.Line, LintWarning, fmt.Sprintf("%s is deprecated, use %s instead", deprecated.Field, deprecated.Replacement))
+	}
+
+	if err := util.ValidateTemplate(tmpl); err != nil {
+		parseErr, ok := errors.Cause(err).(*util.TemplateParseError)
+		if !ok {
+			report(def.Line, LintError, err.Error())
+			return issues
+		}
+		for _, pos := range parseErr.Errors {
+			line := def.Line
+			if pos.Line > 0 && def.TemplateLine > 0 {
+				line = def.TemplateLine + pos.Line
+			}
+			report(line, LintError, pos.Message)
+		}
+		return issues
+	}
+	if tmpl.IsCUE() {
+		tmpl.Name = def.Name
+		if _, err := GenerateOpenAPISchema(tmpl); err != nil {
+			report(def.Line, LintError, fmt.Sprintf("cannot generate OpenAPI schema of parameter: %v", err))
+		}
+	}
+	return issues
+}
+
+// definitionTemplateSource returns the fields of a definition which its template is created from
+func definitionTemplateSource(obj runtime.Object) (*v1alpha2.Schematic, *v1alpha2.Status, *runtime.RawExtension) {
+	switch def := obj.(type) {
+	case *v1alpha2.ComponentDefinition:
+		return def.Spec.Schematic, def.Spec.Status, def.Spec.Extension
+	case *v1alpha2.WorkloadDefinition:
+		return def.Spec.Schematic, def.Spec.Status, def.Spec.Extension
+	case *v1alpha2.TraitDefinition:
+		return def.Spec.Schematic, def.Spec.Status, def.Spec.Extension
+	case *v1alpha2.ScopeDefinition:
+		return def.Spec.Schematic, def.Spec.Status, def.Spec.Extension
+	}
+	return nil, nil, nil
+}
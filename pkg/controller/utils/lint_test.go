@@ -0,0 +1,61 @@
+/*
+ Copyright 2021 The KubeVela Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+
+package utils
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestLintDefinitions(t *testing.T) {
+	dir := filepath.Join("testdata", "lint")
+	issues, err := LintDefinitions(dir)
+	assert.NilError(t, err)
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.String())
+	}
+	assert.DeepEqual(t, got, []string{
+		filepath.Join(dir, "traits.yaml") + ":1: error: TraitDefinition/scaler: invalid health policy: isHealth is not defined",
+		filepath.Join(dir, "traits.yaml") + ":1: warning: TraitDefinition/scaler: spec.extension.template is deprecated, use spec.schematic.cue.template instead",
+		filepath.Join(dir, "worker.yaml") + ":17: error: ComponentDefinition/worker: expected operand, found '}'",
+		filepath.Join(dir, "worker.yaml") + ":18: error: ComponentDefinition/worker: expected '}', found 'EOF'",
+	})
+
+	_, err = LintDefinitions(filepath.Join(dir, "not-exist"))
+	assert.Assert(t, err != nil)
+}
+
+func TestSortLintIssues(t *testing.T) {
+	issues := LintIssues{
+		{File: "b.yaml", Line: 1, Severity: LintError, Message: "b"},
+		{File: "a.yaml", Line: 9, Severity: LintWarning, Message: "w"},
+		{File: "a.yaml", Line: 9, Severity: LintError, Message: "e"},
+		{File: "a.yaml", Line: 2, Severity: LintWarning, Message: "w"},
+	}
+	sort.Sort(issues)
+	assert.DeepEqual(t, issues, LintIssues{
+		{File: "a.yaml", Line: 2, Severity: LintWarning, Message: "w"},
+		{File: "a.yaml", Line: 9, Severity: LintError, Message: "e"},
+		{File: "a.yaml", Line: 9, Severity: LintWarning, Message: "w"},
+		{File: "b.yaml", Line: 1, Severity: LintError, Message: "b"},
+	})
+}
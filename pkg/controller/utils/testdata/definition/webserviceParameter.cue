@@ -0,0 +1,18 @@
+output: {
+	apiVersion: "apps/v1"
+	kind:       "Deployment"
+	spec: template: spec: containers: [{
+		name:  context.name
+		image: parameter.image
+	}]
+}
+parameter: {
+	// +usage=Which image would you like to use for your service
+	// +short=i
+	image: string
+	// +usage=Number of replicas
+	replicas: *1 | int
+	// +usage=Which protocol to expose the port with
+	protocol: *"TCP" | "UDP"
+	cmd?: [...string]
+}
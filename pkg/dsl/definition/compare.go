@@ -0,0 +1,222 @@
+package definition
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/oam-dev/kubevela/pkg/oam"
+	"github.com/oam-dev/kubevela/pkg/oam/util"
+)
+
+// serverPopulatedMetadata are the fields of metadata populated by the API server, they are never compared
+var serverPopulatedMetadata = []string{"uid", "resourceVersion", "generation", "creationTimestamp", "deletionTimestamp",
+	"deletionGracePeriodSeconds", "managedFields", "selfLink"}
+
+// ResourceDiff is a difference between a rendered object and the live one
+type ResourceDiff struct {
+	// Object identifies the object, e.g. "apps/v1, Kind=Deployment prod/frontend"
+	Object string
+	// Path is the path of the field separated by dot, e.g. "spec.template.spec.containers[0].image",
+	// it's empty if there's no live object
+	Path string
+	// Live is the live value, nil if the field or object is missing
+	Live interface{}
+	// Rendered is the rendered value, nil if the field is removed from the rendered object
+	Rendered interface{}
+}
+
+func (d ResourceDiff) String() string {
+	if d.Path == "" {
+		return fmt.Sprintf("%s: not found", d.Object)
+	}
+	return fmt.Sprintf("%s: %s: %v -> %v", d.Object, d.Path, d.Live, d.Rendered)
+}
+
+// RenderAndCompare renders the objects of the template like RenderStream, and compares them with the live objects,
+// so that callers can skip applying them if nothing changes. It returns true if there's no difference.
+// A rendered object is matched with the live one by apiVersion, kind, name and namespace if it's set.
+// Fields populated by the API server or defaulted, i.e. the fields of the live object which are not rendered,
+// and the status are ignored, numbers are compared by value as they're compared in JSON. If the live object records the last applied
+// configuration in oam.AnnotationLastAppliedConfig, the fields applied last time but not rendered now are reported
+// as removed, since applying would delete them.
+func RenderAndCompare(ctx context.Context, tmpl *util.Template, params, templateContext map[string]interface{},
+	live []*unstructured.Unstructured) (bool, []ResourceDiff, error) {
+	var diffs []ResourceDiff
+	err := RenderStream(ctx, tmpl, params, templateContext, func(rendered *unstructured.Unstructured) error {
+		id := objectID(rendered)
+		liveObj := findLiveObject(rendered, live)
+		if liveObj == nil {
+			diffs = append(diffs, ResourceDiff{Object: id, Rendered: rendered.Object})
+			return nil
+		}
+		renderedFields, err := comparableFields(rendered.Object)
+		if err != nil {
+			return errors.WithMessagef(err, "compare %s", id)
+		}
+		liveFields, err := comparableFields(liveObj.Object)
+		if err != nil {
+			return errors.WithMessagef(err, "compare %s", id)
+		}
+		for _, d := range compareValues("", renderedFields, liveFields) {
+			d.Object = id
+			diffs = append(diffs, d)
+		}
+		lastApplied, err := lastAppliedFields(liveObj)
+		if err != nil {
+			return errors.WithMessagef(err, "compare %s", id)
+		}
+		for _, path := range removedFields("", lastApplied, renderedFields) {
+			diffs = append(diffs, ResourceDiff{Object: id, Path: path.path, Live: path.value})
+		}
+		return nil
+	})
+	if err != nil {
+		return false, nil, err
+	}
+	return len(diffs) == 0, diffs, nil
+}
+
+// objectID returns the identity of the object in ResourceDiff
+func objectID(obj *unstructured.Unstructured) string {
+	name := obj.GetName()
+	if obj.GetNamespace() != "" {
+		name = obj.GetNamespace() + "/" + name
+	}
+	return fmt.Sprintf("%s %s", obj.GroupVersionKind().String(), name)
+}
+
+// findLiveObject returns the live object of the rendered one, it's nil if not found
+func findLiveObject(rendered *unstructured.Unstructured, live []*unstructured.Unstructured) *unstructured.Unstructured {
+	for _, obj := range live {
+		if obj.GetAPIVersion() != rendered.GetAPIVersion() || obj.GetKind() != rendered.GetKind() || obj.GetName() != rendered.GetName() {
+			continue
+		}
+		if rendered.GetNamespace() != "" && obj.GetNamespace() != rendered.GetNamespace() {
+			continue
+		}
+		return obj
+	}
+	return nil
+}
+
+// comparableFields returns a copy of the fields of an object without the status, the fields of metadata populated
+// by the API server and the annotation of the last applied configuration
+func comparableFields(obj map[string]interface{}) (map[string]interface{}, error) {
+	// copy by JSON since the rendered values may be of any type, numbers become float64
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "status")
+	if metadata, ok := fields["metadata"].(map[string]interface{}); ok {
+		for _, f := range serverPopulatedMetadata {
+			delete(metadata, f)
+		}
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			delete(annotations, oam.AnnotationLastAppliedConfig)
+			if len(annotations) == 0 {
+				delete(metadata, "annotations")
+			}
+		}
+	}
+	return fields, nil
+}
+
+// lastAppliedFields returns the comparable fields of the last applied configuration of the live object,
+// it's nil if the configuration isn't recorded
+func lastAppliedFields(liveObj *unstructured.Unstructured) (map[string]interface{}, error) {
+	config, ok := liveObj.GetAnnotations()[oam.AnnotationLastAppliedConfig]
+	if !ok || config == "" {
+		return nil, nil
+	}
+	lastApplied := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(config), &lastApplied); err != nil {
+		return nil, errors.Wrapf(err, "invalid annotation %s", oam.AnnotationLastAppliedConfig)
+	}
+	return comparableFields(lastApplied)
+}
+
+// compareValues returns the differences of the rendered value from the live one at the path, only the fields of
+// maps which are rendered are compared, lists are compared element by element
+func compareValues(path string, rendered, live interface{}) []ResourceDiff {
+	switch r := rendered.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return []ResourceDiff{{Path: path, Live: live, Rendered: rendered}}
+		}
+		var diffs []ResourceDiff
+		for _, k := range sortedKeys(r) {
+			diffs = append(diffs, compareValues(joinFieldPath(path, k), r[k], l[k])...)
+		}
+		return diffs
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(r) {
+			return []ResourceDiff{{Path: path, Live: live, Rendered: rendered}}
+		}
+		var diffs []ResourceDiff
+		for i := range r {
+			diffs = append(diffs, compareValues(path+"["+strconv.Itoa(i)+"]", r[i], l[i])...)
+		}
+		return diffs
+	}
+	if reflect.DeepEqual(rendered, live) {
+		return nil
+	}
+	return []ResourceDiff{{Path: path, Live: live, Rendered: rendered}}
+}
+
+type fieldValue struct {
+	path  string
+	value interface{}
+}
+
+// removedFields returns the fields of the maps in the last applied value which are not rendered anymore
+func removedFields(path string, lastApplied, rendered interface{}) []fieldValue {
+	l, ok := lastApplied.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	r, ok := rendered.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var removed []fieldValue
+	for _, k := range sortedKeys(l) {
+		p := joinFieldPath(path, k)
+		if _, ok := r[k]; !ok {
+			removed = append(removed, fieldValue{path: p, value: l[k]})
+			continue
+		}
+		removed = append(removed, removedFields(p, l[k], r[k])...)
+	}
+	return removed
+}
+
+func joinFieldPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,89 @@
+package definition
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/oam-dev/kubevela/pkg/oam"
+	"github.com/oam-dev/kubevela/pkg/oam/util"
+)
+
+func TestRenderAndCompare(t *testing.T) {
+	tmpl := &util.Template{Name: "webservice", TemplateStr: `
+output: {
+	apiVersion: "apps/v1"
+	kind:       "Deployment"
+	metadata: name: context.name
+	spec: {
+		replicas: parameter.replicas
+		template: spec: containers: [{name: context.name, image: parameter.image}]
+	}
+}
+parameter: {
+	replicas: *1 | int
+	image:    string
+}
+`}
+	templateContext := map[string]interface{}{"name": "frontend", "appName": "myapp", "namespace": "prod"}
+	live := func() *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":              "frontend",
+				"namespace":         "prod",
+				"uid":               "9a6f4c4e",
+				"resourceVersion":   "1024",
+				"generation":        int64(2),
+				"creationTimestamp": "2020-12-01T00:00:00Z",
+			},
+			"spec": map[string]interface{}{
+				"replicas":             int64(3),
+				"revisionHistoryLimit": int64(10),
+				"template": map[string]interface{}{"spec": map[string]interface{}{
+					"containers": []interface{}{map[string]interface{}{
+						"name": "frontend", "image": "nginx:1.19", "imagePullPolicy": "IfNotPresent",
+					}},
+				}},
+			},
+			"status": map[string]interface{}{"replicas": int64(3)},
+		}}
+	}
+
+	// no change, the fields populated by the server are ignored
+	unchanged, diffs, err := RenderAndCompare(context.TODO(), tmpl, map[string]interface{}{"replicas": 3, "image": "nginx:1.19"},
+		templateContext, []*unstructured.Unstructured{live()})
+	assert.NoError(t, err)
+	assert.True(t, unchanged)
+	assert.Empty(t, diffs)
+
+	// changed parameters
+	unchanged, diffs, err = RenderAndCompare(context.TODO(), tmpl, map[string]interface{}{"replicas": 5, "image": "nginx:1.20"},
+		templateContext, []*unstructured.Unstructured{live()})
+	assert.NoError(t, err)
+	assert.False(t, unchanged)
+	assert.Equal(t, []ResourceDiff{
+		{Object: "apps/v1, Kind=Deployment frontend", Path: "spec.replicas", Live: float64(3), Rendered: float64(5)},
+		{Object: "apps/v1, Kind=Deployment frontend", Path: "spec.template.spec.containers[0].image", Live: "nginx:1.19", Rendered: "nginx:1.20"},
+	}, diffs)
+
+	// a field applied last time is removed
+	withLastApplied := live()
+	withLastApplied.SetAnnotations(map[string]string{oam.AnnotationLastAppliedConfig: `{"apiVersion":"apps/v1","kind":"Deployment",` +
+		`"metadata":{"name":"frontend"},"spec":{"replicas":3,"paused":false}}`})
+	unchanged, diffs, err = RenderAndCompare(context.TODO(), tmpl, map[string]interface{}{"replicas": 3, "image": "nginx:1.19"},
+		templateContext, []*unstructured.Unstructured{withLastApplied})
+	assert.NoError(t, err)
+	assert.False(t, unchanged)
+	assert.Equal(t, []ResourceDiff{{Object: "apps/v1, Kind=Deployment frontend", Path: "spec.paused", Live: false}}, diffs)
+
+	// no live object
+	unchanged, diffs, err = RenderAndCompare(context.TODO(), tmpl, map[string]interface{}{"image": "nginx:1.19"}, templateContext, nil)
+	assert.NoError(t, err)
+	assert.False(t, unchanged)
+	assert.Len(t, diffs, 1)
+	assert.Equal(t, "apps/v1, Kind=Deployment frontend: not found", diffs[0].String())
+}
@@ -0,0 +1,111 @@
+package definition
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/oam-dev/kubevela/pkg/dsl/process"
+	"github.com/oam-dev/kubevela/pkg/oam/util"
+)
+
+// ContextNamespace is the namespace of the application in the context of templates
+const ContextNamespace = "namespace"
+
+// standardContextFields are the string fields which are always present in the context of templates
+var standardContextFields = []string{process.ContextName, process.ContextAppName, process.ContextAppRevision, ContextNamespace}
+
+// BuildRenderContext builds the context to render the templates of a component of app, see RenderWithContext.
+// The standard fields of the context are:
+//
+//	context.name        string, the name of the component
+//	context.appName     string, the name of the application
+//	context.appRevision string, the revision name of the application, empty if unknown
+//	context.namespace   string, the namespace of the application
+//	context.config      [...{name: string, value: string}], the config of the component, empty by default
+func BuildRenderContext(app metav1.Object, componentName, appRevision string) map[string]interface{} {
+	return map[string]interface{}{
+		process.ContextName:        componentName,
+		process.ContextAppName:     app.GetName(),
+		process.ContextAppRevision: appRevision,
+		ContextNamespace:           app.GetNamespace(),
+		process.ConfigFieldName:    []map[string]string{},
+	}
+}
+
+// RenderedTemplate is the result of rendering a CUE template, fields the template doesn't define are nil
+type RenderedTemplate struct {
+	// Output is the workload, or the main resource of a trait
+	Output map[string]interface{}
+	// Outputs are the auxiliary resources by name
+	Outputs map[string]interface{}
+	// Patch is the patch of a trait to the workload
+	Patch map[string]interface{}
+}
+
+// RenderWithContext renders the CUE template with the parameter values and the context, usually built by
+// BuildRenderContext. The standard context fields missing in templateContext are filled with empty values,
+// so that templates can always reference them, and an error is returned if any of them isn't a string.
+func RenderWithContext(ctx context.Context, tmpl *util.Template, params map[string]interface{}, templateContext map[string]interface{}) (*RenderedTemplate, error) {
+	if !tmpl.IsCUE() {
+		return nil, withCapabilityName(tmpl, errors.New("only CUE templates can be rendered"))
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	normalized, err := normalizeRenderContext(templateContext)
+	if err != nil {
+		return nil, withCapabilityName(tmpl, err)
+	}
+	inst, err := fillTemplate(tmpl, normalized, params)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := &RenderedTemplate{}
+	for name, field := range map[string]*map[string]interface{}{
+		OutputFieldName:  &rendered.Output,
+		OutputsFieldName: &rendered.Outputs,
+		PatchFieldName:   &rendered.Patch,
+	} {
+		v := inst.Lookup(name)
+		if !v.Exists() {
+			continue
+		}
+		if err := v.Decode(field); err != nil {
+			return nil, withCapabilityName(tmpl, errors.WithMessagef(err, "render %s", name))
+		}
+	}
+	return rendered, nil
+}
+
+// normalizeRenderContext returns a copy of the context with the standard fields filled and type checked
+func normalizeRenderContext(templateContext map[string]interface{}) (map[string]interface{}, error) {
+	normalized := make(map[string]interface{}, len(templateContext)+len(standardContextFields)+1)
+	for k, v := range templateContext {
+		normalized[k] = v
+	}
+	for _, field := range standardContextFields {
+		v, ok := normalized[field]
+		if !ok || v == nil {
+			normalized[field] = ""
+			continue
+		}
+		if _, ok := v.(string); !ok {
+			return nil, errors.Errorf("context.%s must be a string, got %T", field, v)
+		}
+	}
+	if normalized[process.ConfigFieldName] == nil {
+		normalized[process.ConfigFieldName] = []map[string]string{}
+	}
+	return normalized, nil
+}
+
+// withCapabilityName prefixes err with the name of the capability of the template, if it's named
+func withCapabilityName(tmpl *util.Template, err error) error {
+	if tmpl.Name == "" {
+		return err
+	}
+	return errors.WithMessagef(err, "capability %s", tmpl.Name)
+}
@@ -0,0 +1,67 @@
+package definition
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam/util"
+)
+
+func TestRenderWithContext(t *testing.T) {
+	tmpl := &util.Template{Name: "webservice", TemplateStr: `
+output: {
+	kind: "Deployment"
+	metadata: {
+		name:      context.name
+		namespace: context.namespace
+		labels: {
+			"app.oam.dev/name":     context.appName
+			"app.oam.dev/revision": context.appRevision
+		}
+	}
+	spec: {
+		replicas: parameter.replicas
+		configs:  len(context.config)
+	}
+}
+outputs: service: kind: "Service"
+parameter: replicas: *1 | int
+`}
+	app := &v1alpha2.Application{ObjectMeta: metav1.ObjectMeta{Name: "myapp", Namespace: "prod"}}
+
+	rendered, err := RenderWithContext(context.TODO(), tmpl, map[string]interface{}{"replicas": 3}, BuildRenderContext(app, "frontend", "myapp-v1"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"kind": "Deployment",
+		"metadata": map[string]interface{}{
+			"name":      "frontend",
+			"namespace": "prod",
+			"labels": map[string]interface{}{
+				"app.oam.dev/name":     "myapp",
+				"app.oam.dev/revision": "myapp-v1",
+			},
+		},
+		"spec": map[string]interface{}{"replicas": float64(3), "configs": float64(0)},
+	}, rendered.Output)
+	assert.Equal(t, map[string]interface{}{"service": map[string]interface{}{"kind": "Service"}}, rendered.Outputs)
+	assert.Nil(t, rendered.Patch)
+
+	// missing standard fields are filled with empty values
+	rendered, err = RenderWithContext(context.TODO(), tmpl, nil, map[string]interface{}{"name": "frontend"})
+	assert.NoError(t, err)
+	assert.Equal(t, "", rendered.Output["metadata"].(map[string]interface{})["namespace"])
+	assert.Equal(t, float64(1), rendered.Output["spec"].(map[string]interface{})["replicas"])
+
+	_, err = RenderWithContext(context.TODO(), tmpl, nil, map[string]interface{}{"appName": 1})
+	assert.EqualError(t, err, "capability webservice: context.appName must be a string, got int")
+
+	_, err = RenderWithContext(context.TODO(), tmpl, map[string]interface{}{"replicas": "3"}, nil)
+	assert.Error(t, err)
+
+	_, err = RenderWithContext(context.TODO(), &util.Template{CapabilityCategory: "helm", Helm: &v1alpha2.Helm{}}, nil, nil)
+	assert.EqualError(t, err, "only CUE templates can be rendered")
+}
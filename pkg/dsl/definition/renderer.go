@@ -0,0 +1,147 @@
+package definition
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/oam-dev/kubevela/apis/types"
+	"github.com/oam-dev/kubevela/pkg/oam/util"
+)
+
+// Renderer renders the objects of templates of a capability category
+type Renderer interface {
+	Render(tmpl *util.Template, params map[string]interface{}) ([]*unstructured.Unstructured, error)
+}
+
+// RendererFactory creates the renderer of a category which renders templates in the context, usually built by
+// BuildRenderContext
+type RendererFactory func(templateContext map[string]interface{}) Renderer
+
+var (
+	renderersMu sync.RWMutex
+	renderers   = DefaultRenderers()
+)
+
+// DefaultRenderers returns the built-in renderers by category: CUE templates, including the ones of the empty
+// category, Helm templates and Terraform templates.
+func DefaultRenderers() map[types.CapabilityCategory]RendererFactory {
+	newCUERenderer := func(templateContext map[string]interface{}) Renderer {
+		return &CUERenderer{TemplateContext: templateContext}
+	}
+	return map[types.CapabilityCategory]RendererFactory{
+		"":                newCUERenderer,
+		types.CUECategory: newCUERenderer,
+		types.HelmCategory: func(templateContext map[string]interface{}) Renderer {
+			return &HelmRenderer{TemplateContext: templateContext}
+		},
+		types.TerraformCategory: func(templateContext map[string]interface{}) Renderer {
+			return &TerraformRenderer{TemplateContext: templateContext}
+		},
+	}
+}
+
+// RegisterRenderer registers the renderer of the category, replacing the registered one, so that templates of
+// out-of-tree capability categories can be rendered, see util.RegisterCategoryDetector.
+func RegisterRenderer(category types.CapabilityCategory, factory RendererFactory) {
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+	renderers[category] = factory
+}
+
+// ResetRenderers restores the default renderers, unregistering the others
+func ResetRenderers() {
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+	renderers = DefaultRenderers()
+}
+
+// RendererFor returns the renderer of the CapabilityCategory of the template, which renders it in the context.
+// It returns an error if no renderer is registered for the category, e.g. Kustomize.
+func RendererFor(tmpl *util.Template, templateContext map[string]interface{}) (Renderer, error) {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+	factory, ok := renderers[tmpl.CapabilityCategory]
+	if !ok {
+		return nil, withCapabilityName(tmpl, errors.Errorf("no renderer for category %q", tmpl.CapabilityCategory))
+	}
+	return factory(templateContext), nil
+}
+
+// collectStream collects the objects rendered by a stream
+func collectStream(render func(fn func(obj *unstructured.Unstructured) error) error) ([]*unstructured.Unstructured, error) {
+	var objs []*unstructured.Unstructured
+	if err := render(func(obj *unstructured.Unstructured) error {
+		objs = append(objs, obj)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return objs, nil
+}
+
+// CUERenderer renders the output and then the outputs of CUE templates, like RenderStream
+type CUERenderer struct {
+	TemplateContext map[string]interface{}
+}
+
+// Render renders the objects of the CUE template with the parameter values
+func (r *CUERenderer) Render(tmpl *util.Template, params map[string]interface{}) ([]*unstructured.Unstructured, error) {
+	if !tmpl.IsCUE() {
+		return nil, withCapabilityName(tmpl, errors.New("not a CUE template"))
+	}
+	templateContext, err := normalizeRenderContext(r.TemplateContext)
+	if err != nil {
+		return nil, withCapabilityName(tmpl, err)
+	}
+	return collectStream(func(fn func(obj *unstructured.Unstructured) error) error {
+		return renderCUEStream(context.Background(), tmpl, templateContext, params, fn)
+	})
+}
+
+// HelmRenderer renders the HelmRepository and the HelmRelease of Helm templates, like RenderStream
+type HelmRenderer struct {
+	TemplateContext map[string]interface{}
+}
+
+// Render renders the objects of the Helm template with the parameter values overriding the chart values
+func (r *HelmRenderer) Render(tmpl *util.Template, params map[string]interface{}) ([]*unstructured.Unstructured, error) {
+	if !tmpl.IsHelm() {
+		return nil, withCapabilityName(tmpl, errors.New("not a Helm template"))
+	}
+	templateContext, err := normalizeRenderContext(r.TemplateContext)
+	if err != nil {
+		return nil, withCapabilityName(tmpl, err)
+	}
+	return collectStream(func(fn func(obj *unstructured.Unstructured) error) error {
+		return renderHelmStream(tmpl, templateContext, params, fn)
+	})
+}
+
+// TerraformRenderer renders the Terraform JSON configuration in the output of Terraform templates.
+// The configuration isn't a Kubernetes object, it's returned as the only object for callers to hand to Terraform.
+type TerraformRenderer struct {
+	TemplateContext map[string]interface{}
+}
+
+// Render renders the Terraform configuration of the template with the parameter values
+func (r *TerraformRenderer) Render(tmpl *util.Template, params map[string]interface{}) ([]*unstructured.Unstructured, error) {
+	if !tmpl.IsTerraform() {
+		return nil, withCapabilityName(tmpl, errors.New("not a Terraform template"))
+	}
+	templateContext, err := normalizeRenderContext(r.TemplateContext)
+	if err != nil {
+		return nil, withCapabilityName(tmpl, err)
+	}
+	inst, err := fillTemplate(tmpl, templateContext, params)
+	if err != nil {
+		return nil, err
+	}
+	conf := &unstructured.Unstructured{}
+	if err := inst.Lookup(OutputFieldName).Decode(&conf.Object); err != nil {
+		return nil, withCapabilityName(tmpl, errors.WithMessage(err, "render Terraform configuration"))
+	}
+	return []*unstructured.Unstructured{conf}, nil
+}
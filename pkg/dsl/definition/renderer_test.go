@@ -0,0 +1,112 @@
+package definition
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/apis/types"
+	"github.com/oam-dev/kubevela/pkg/oam/util"
+)
+
+type fakeRenderer struct{}
+
+func (fakeRenderer) Render(*util.Template, map[string]interface{}) ([]*unstructured.Unstructured, error) {
+	return nil, nil
+}
+
+func TestRendererFor(t *testing.T) {
+	defer ResetRenderers()
+	templateContext := map[string]interface{}{"name": "frontend", "appName": "myapp", "namespace": "prod"}
+	testCases := map[string]struct {
+		tmpl *util.Template
+		exp  Renderer
+		err  string
+	}{
+		"cue": {
+			tmpl: &util.Template{Name: "webservice", CapabilityCategory: types.CUECategory, TemplateStr: "output: {}"},
+			exp:  &CUERenderer{TemplateContext: templateContext},
+		},
+		"cue without category": {
+			tmpl: &util.Template{Name: "webservice", TemplateStr: "output: {}"},
+			exp:  &CUERenderer{TemplateContext: templateContext},
+		},
+		"helm": {
+			tmpl: &util.Template{Name: "podinfo", CapabilityCategory: types.HelmCategory, Helm: &v1alpha2.Helm{}},
+			exp:  &HelmRenderer{TemplateContext: templateContext},
+		},
+		"terraform": {
+			tmpl: &util.Template{Name: "rds", CapabilityCategory: types.TerraformCategory, TemplateStr: "output: {}", Terraform: &util.TerraformConfiguration{}},
+			exp:  &TerraformRenderer{TemplateContext: templateContext},
+		},
+		"kustomize": {
+			tmpl: &util.Template{Name: "overlay", CapabilityCategory: types.KustomizeCategory, Kustomize: &v1alpha2.Kustomize{}},
+			err:  `capability overlay: no renderer for category "kustomize"`,
+		},
+	}
+	for name, tc := range testCases {
+		r, err := RendererFor(tc.tmpl, templateContext)
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err, name)
+			continue
+		}
+		assert.NoError(t, err, name)
+		assert.Equal(t, tc.exp, r, name)
+	}
+
+	RegisterRenderer(types.KustomizeCategory, func(map[string]interface{}) Renderer { return fakeRenderer{} })
+	r, err := RendererFor(testCases["kustomize"].tmpl, templateContext)
+	assert.NoError(t, err)
+	assert.Equal(t, fakeRenderer{}, r)
+}
+
+func TestRenderers(t *testing.T) {
+	templateContext := map[string]interface{}{"name": "frontend", "appName": "myapp", "namespace": "prod"}
+
+	objs, err := (&CUERenderer{TemplateContext: templateContext}).Render(&util.Template{Name: "webservice", TemplateStr: `
+output: {
+	kind: "Deployment"
+	metadata: name: context.name
+	spec: replicas: parameter.replicas
+}
+outputs: service: {
+	kind: "Service"
+	metadata: name: context.name
+}
+parameter: replicas: *1 | int
+`}, map[string]interface{}{"replicas": 3})
+	assert.NoError(t, err)
+	assert.Len(t, objs, 2)
+	assert.Equal(t, "Deployment", objs[0].GetKind())
+	assert.Equal(t, float64(3), objs[0].Object["spec"].(map[string]interface{})["replicas"])
+	assert.Equal(t, "Service", objs[1].GetKind())
+
+	objs, err = (&HelmRenderer{TemplateContext: templateContext}).Render(&util.Template{Name: "podinfo", CapabilityCategory: types.HelmCategory, Helm: &v1alpha2.Helm{
+		Release:    runtime.RawExtension{Raw: []byte(`{"chart":{"spec":{"chart":"podinfo","version":"5.1.4"}}}`)},
+		Repository: runtime.RawExtension{Raw: []byte(`{"url":"http://oam.dev/catalog/"}`)},
+	}}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, objs, 2)
+	assert.Equal(t, "HelmRepository", objs[0].GetKind())
+	assert.Equal(t, "HelmRelease", objs[1].GetKind())
+
+	objs, err = (&TerraformRenderer{TemplateContext: templateContext}).Render(&util.Template{Name: "rds", CapabilityCategory: types.TerraformCategory,
+		Terraform: &util.TerraformConfiguration{}, TemplateStr: `
+output: module: rds: {
+	source: "terraform-aws-modules/rds/aws"
+	identifier: context.name
+	engine: parameter.engine
+}
+parameter: engine: *"mysql" | string
+`}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []*unstructured.Unstructured{{Object: map[string]interface{}{"module": map[string]interface{}{"rds": map[string]interface{}{
+		"source": "terraform-aws-modules/rds/aws", "identifier": "frontend", "engine": "mysql",
+	}}}}}, objs)
+
+	_, err = (&CUERenderer{}).Render(&util.Template{Name: "podinfo", Helm: &v1alpha2.Helm{}}, nil)
+	assert.EqualError(t, err, "capability podinfo: not a CUE template")
+}
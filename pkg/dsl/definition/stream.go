@@ -0,0 +1,116 @@
+package definition
+
+import (
+	"context"
+	"sort"
+
+	"cuelang.org/go/cue"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/oam-dev/kubevela/pkg/appfile/helm"
+	"github.com/oam-dev/kubevela/pkg/dsl/process"
+	"github.com/oam-dev/kubevela/pkg/oam/util"
+)
+
+// RenderStream renders the objects of the template with the parameter values and the context like RenderWithContext,
+// but hands them to fn one by one instead of collecting them, so that callers can apply the objects of large
+// templates incrementally. The objects of a CUE template are the output and then the outputs in the order of their
+// names, the patch of a trait is not an object. The objects of a Helm template are its HelmRepository and HelmRelease,
+// with the chart values of the release overridden by the parameter values.
+// Rendering stops at the first error returned by fn, which is returned as is.
+func RenderStream(ctx context.Context, tmpl *util.Template, params map[string]interface{}, templateContext map[string]interface{},
+	fn func(obj *unstructured.Unstructured) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	normalized, err := normalizeRenderContext(templateContext)
+	if err != nil {
+		return withCapabilityName(tmpl, err)
+	}
+	switch {
+	case tmpl.IsHelm():
+		return renderHelmStream(tmpl, normalized, params, fn)
+	case tmpl.IsCUE():
+		return renderCUEStream(ctx, tmpl, normalized, params, fn)
+	default:
+		return withCapabilityName(tmpl, errors.New("only CUE and Helm templates can be rendered"))
+	}
+}
+
+// fillTemplate compiles the CUE template and fills it with the normalized context and the parameter values
+func fillTemplate(tmpl *util.Template, templateContext, params map[string]interface{}) (*cue.Instance, error) {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	inst, err := tmpl.BuildCUEInstance()
+	if err != nil {
+		return nil, withCapabilityName(tmpl, errors.WithMessage(err, "compile template"))
+	}
+	if inst, err = inst.Fill(templateContext, "context"); err != nil {
+		return nil, withCapabilityName(tmpl, errors.WithMessage(err, "fill context"))
+	}
+	if inst, err = inst.Fill(params, ParameterFieldName); err != nil {
+		return nil, withCapabilityName(tmpl, errors.WithMessage(err, "fill parameter"))
+	}
+	return inst, nil
+}
+
+// renderCUEStream renders the output and the outputs of the CUE template, each object is decoded right before
+// it's handed to fn
+func renderCUEStream(ctx context.Context, tmpl *util.Template, templateContext, params map[string]interface{},
+	fn func(obj *unstructured.Unstructured) error) error {
+	inst, err := fillTemplate(tmpl, templateContext, params)
+	if err != nil {
+		return err
+	}
+
+	emit := func(name string, v cue.Value) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		obj := &unstructured.Unstructured{}
+		if err := v.Decode(&obj.Object); err != nil {
+			return withCapabilityName(tmpl, errors.WithMessagef(err, "render %s", name))
+		}
+		return fn(obj)
+	}
+	if output := inst.Lookup(OutputFieldName); output.Exists() {
+		if err := emit(OutputFieldName, output); err != nil {
+			return err
+		}
+	}
+	outputs := inst.Lookup(OutputsFieldName)
+	if !outputs.Exists() {
+		return nil
+	}
+	it, err := outputs.Fields()
+	if err != nil {
+		return withCapabilityName(tmpl, errors.WithMessage(err, "render outputs"))
+	}
+	var names []string
+	for it.Next() {
+		names = append(names, it.Label())
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := emit(OutputsFieldName+"."+name, outputs.Lookup(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderHelmStream renders the HelmRepository and the HelmRelease of the Helm template, they are named after
+// the application and the component in the context
+func renderHelmStream(tmpl *util.Template, templateContext, params map[string]interface{}, fn func(obj *unstructured.Unstructured) error) error {
+	release, repo, err := helm.RenderHelmReleaseAndHelmRepo(tmpl.Helm, templateContext[process.ContextName].(string),
+		templateContext[process.ContextAppName].(string), templateContext[ContextNamespace].(string), params)
+	if err != nil {
+		return withCapabilityName(tmpl, errors.WithMessage(err, "render Helm release"))
+	}
+	if err := fn(repo); err != nil {
+		return err
+	}
+	return fn(release)
+}
@@ -0,0 +1,103 @@
+package definition
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/apis/types"
+	"github.com/oam-dev/kubevela/pkg/oam/util"
+)
+
+func TestRenderStream(t *testing.T) {
+	tmpl := &util.Template{Name: "webservice", TemplateStr: `
+output: {
+	kind: "Deployment"
+	metadata: name: context.name
+	spec: replicas: parameter.replicas
+}
+outputs: {
+	service: {
+		kind: "Service"
+		metadata: name: context.name
+	}
+	ingress: {
+		kind: "Ingress"
+		metadata: name: context.name
+	}
+}
+parameter: replicas: *1 | int
+`}
+	templateContext := map[string]interface{}{"name": "frontend", "appName": "myapp", "namespace": "prod"}
+
+	var kinds []string
+	err := RenderStream(context.TODO(), tmpl, map[string]interface{}{"replicas": 3}, templateContext, func(obj *unstructured.Unstructured) error {
+		assert.Equal(t, "frontend", obj.GetName())
+		kinds = append(kinds, obj.GetKind())
+		if obj.GetKind() == "Deployment" {
+			replicas, _, _ := unstructured.NestedFloat64(obj.Object, "spec", "replicas")
+			assert.Equal(t, float64(3), replicas)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Deployment", "Ingress", "Service"}, kinds)
+
+	// the error of the callback aborts rendering
+	errAbort := errors.New("abort")
+	kinds = nil
+	err = RenderStream(context.TODO(), tmpl, nil, templateContext, func(obj *unstructured.Unstructured) error {
+		kinds = append(kinds, obj.GetKind())
+		if obj.GetKind() == "Ingress" {
+			return errAbort
+		}
+		return nil
+	})
+	assert.Equal(t, errAbort, err)
+	assert.Equal(t, []string{"Deployment", "Ingress"}, kinds)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	err = RenderStream(ctx, tmpl, nil, templateContext, func(obj *unstructured.Unstructured) error { return nil })
+	assert.Equal(t, context.Canceled, err)
+
+	err = RenderStream(context.TODO(), &util.Template{Name: "kustomize", Kustomize: &v1alpha2.Kustomize{}, CapabilityCategory: types.KustomizeCategory},
+		nil, templateContext, func(obj *unstructured.Unstructured) error { return nil })
+	assert.EqualError(t, err, "capability kustomize: only CUE and Helm templates can be rendered")
+}
+
+func TestRenderHelmStream(t *testing.T) {
+	tmpl := &util.Template{Name: "podinfo", CapabilityCategory: types.HelmCategory, Helm: &v1alpha2.Helm{
+		Release:    runtime.RawExtension{Raw: []byte(`{"chart":{"spec":{"chart":"podinfo","version":"5.1.4"}},"values":{"replicaCount":1,"image":"podinfo"}}`)},
+		Repository: runtime.RawExtension{Raw: []byte(`{"url":"http://oam.dev/catalog/"}`)},
+	}}
+	var objs []*unstructured.Unstructured
+	err := RenderStream(context.TODO(), tmpl, map[string]interface{}{"replicaCount": 3},
+		map[string]interface{}{"name": "frontend", "appName": "myapp", "namespace": "prod"},
+		func(obj *unstructured.Unstructured) error {
+			objs = append(objs, obj)
+			return nil
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(objs))
+	assert.Equal(t, "HelmRepository", objs[0].GetKind())
+	assert.Equal(t, "HelmRelease", objs[1].GetKind())
+	assert.Equal(t, "myapp-frontend", objs[1].GetName())
+	assert.Equal(t, "prod", objs[1].GetNamespace())
+	values, _, _ := unstructured.NestedMap(objs[1].Object, "spec", "values")
+	assert.Equal(t, map[string]interface{}{"replicaCount": float64(3), "image": "podinfo"}, values)
+
+	errAbort := errors.New("abort")
+	objs = nil
+	err = RenderStream(context.TODO(), tmpl, nil, nil, func(obj *unstructured.Unstructured) error {
+		objs = append(objs, obj)
+		return errAbort
+	})
+	assert.Equal(t, errAbort, err)
+	assert.Equal(t, 1, len(objs))
+}
@@ -25,6 +25,8 @@ const (
 	OutputsFieldName = process.OutputsFieldName
 	// PatchFieldName is the name of the struct contains the patch of CR data
 	PatchFieldName = "patch"
+	// ParameterFieldName is the name of the struct contains the parameters of the template
+	ParameterFieldName = "parameter"
 	// CustomMessage defines the custom message in definition template
 	CustomMessage = "message"
 	// HealthCheckPolicy defines the health check policy in definition template
@@ -52,6 +54,8 @@ type def struct {
 
 type workloadDef struct {
 	def
+	// imports are the CUE packages imported by the template, see util.Template.Imports
+	imports map[string]map[string]string
 }
 
 // NewWorkloadAbstractEngine create Workload Definition AbstractEngine
@@ -72,7 +76,7 @@ func (wd *workloadDef) Params(params interface{}) AbstractEngine {
 
 // Complete do workload definition's rendering
 func (wd *workloadDef) Complete(ctx process.Context, abstractTemplate string) error {
-	bi := build.NewContext().NewInstance("", nil)
+	bi := util.NewBuildInstance(wd.imports)
 	if err := bi.AddFile("-", abstractTemplate); err != nil {
 		return errors.WithMessagef(err, "invalid cue template of workload %s", wd.name)
 	}
@@ -183,22 +187,8 @@ func (wd *workloadDef) HealthCheck(ctx process.Context, cli client.Client, ns st
 }
 
 func checkHealth(templateContext map[string]interface{}, healthPolicyTemplate string) (bool, error) {
-	bt, err := json.Marshal(templateContext)
-	if err != nil {
-		return false, errors.WithMessage(err, "json marshal template context")
-	}
-
-	var buff = "context: " + string(bt) + "\n" + healthPolicyTemplate
-	var r cue.Runtime
-	inst, err := r.Compile("-", buff)
-	if err != nil {
-		return false, errors.WithMessage(err, "compile health template")
-	}
-	healthy, err := inst.Lookup(HealthCheckPolicy).Bool()
-	if err != nil {
-		return false, errors.WithMessage(err, "evaluate health status")
-	}
-	return healthy, nil
+	tmpl := &util.Template{Health: healthPolicyTemplate}
+	return tmpl.EvaluateHealth(context.Background(), templateContext)
 }
 
 // Status get workload status by customStatusTemplate
@@ -214,23 +204,50 @@ func (wd *workloadDef) Status(ctx process.Context, cli client.Client, ns string,
 }
 
 func getStatusMessage(templateContext map[string]interface{}, customStatusTemplate string) (string, error) {
-	bt, err := json.Marshal(templateContext)
-	if err != nil {
-		return "", errors.WithMessage(err, "json marshal template context")
+	tmpl := &util.Template{CustomStatus: customStatusTemplate}
+	return tmpl.RenderCustomStatus(context.Background(), templateContext)
+}
+
+// RenderDryRun renders the output and outputs of a workload template with the parameters without applying anything,
+// the template is rendered with the same engine and context as the application controller. It returns an error if
+// the number of outputs differs from the ExpectedOutputs of the template.
+func RenderDryRun(tmpl *util.Template, parameters map[string]interface{}) ([]*unstructured.Unstructured, error) {
+	if tmpl.TemplateStr == "" {
+		return nil, errors.Errorf("capability %s has no CUE template to render", tmpl.Name)
 	}
-	var buff = "context: " + string(bt) + "\n" + customStatusTemplate
-	var r cue.Runtime
-	inst, err := r.Compile("-", buff)
-	if err != nil {
-		return "", errors.WithMessage(err, "compile customStatus template")
+	if err := util.ValidateParameters(tmpl, parameters); err != nil {
+		return nil, err
+	}
+	ctx := process.NewContext(tmpl.Name, dryRunAppName, dryRunAppName+"-v1")
+	engine := &workloadDef{def: def{name: tmpl.Name}, imports: tmpl.Imports}
+	if parameters != nil {
+		engine.Params(parameters)
+	}
+	if err := engine.Complete(ctx, tmpl.TemplateStr); err != nil {
+		return nil, err
 	}
-	message, err := inst.Lookup(CustomMessage).String()
+	base, assists := ctx.Output()
+	output, err := base.Unstructured()
 	if err != nil {
-		return "", errors.WithMessage(err, "evaluate customStatus.message")
+		return nil, errors.WithMessagef(err, "render output of workload %s, check if all required parameters are set", tmpl.Name)
+	}
+	objs := []*unstructured.Unstructured{output}
+	for _, assist := range assists {
+		obj, err := assist.Ins.Unstructured()
+		if err != nil {
+			return nil, errors.WithMessagef(err, "render outputs(%s) of workload %s", assist.Name, tmpl.Name)
+		}
+		objs = append(objs, obj)
 	}
-	return message, nil
+	if err := tmpl.ValidateOutputCount(len(assists)); err != nil {
+		return nil, err
+	}
+	return objs, nil
 }
 
+// dryRunAppName is the application name in the context of templates rendered by RenderDryRun
+const dryRunAppName = "dry-run"
+
 type traitDef struct {
 	def
 }
@@ -8,6 +8,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 
 	"github.com/oam-dev/kubevela/pkg/dsl/process"
+	"github.com/oam-dev/kubevela/pkg/oam/util"
 )
 
 func TestWorkloadTemplateComplete(t *testing.T) {
@@ -638,3 +639,70 @@ if len(context.outputs.ingress.status.loadBalancer.ingress) == 0 {
 		assert.Equal(t, ca.expMessage, gotMessage, message)
 	}
 }
+
+func TestRenderDryRun(t *testing.T) {
+	tmpl := &util.Template{Name: "webservice", TemplateStr: `
+output: {
+	apiVersion: "apps/v1"
+	kind:       "Deployment"
+	metadata: name: context.name
+	spec: replicas: parameter.replicas
+}
+outputs: service: {
+	apiVersion: "v1"
+	kind:       "Service"
+	metadata: labels: app: context.appName
+}
+parameter: {
+	replicas: *1 | int
+	image:    string
+}
+`}
+	objs, err := RenderDryRun(tmpl, map[string]interface{}{"replicas": 3, "image": "nginx"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(objs))
+	assert.Equal(t, "Deployment", objs[0].GetKind())
+	assert.Equal(t, "webservice", objs[0].GetName())
+	assert.Equal(t, int64(3), objs[0].Object["spec"].(map[string]interface{})["replicas"])
+	assert.Equal(t, "Service", objs[1].GetKind())
+	assert.Equal(t, map[string]string{"app": "dry-run"}, objs[1].GetLabels())
+
+	_, err = RenderDryRun(tmpl, map[string]interface{}{"replicas": "3", "image": "nginx"})
+	assert.Error(t, err, "parameter type mismatch")
+	assert.Contains(t, err.Error(), "capability webservice: invalid parameters: replicas: conflicting values")
+
+	_, err = RenderDryRun(tmpl, map[string]interface{}{"replicas": 3})
+	assert.Error(t, err, "missing required parameter")
+	assert.Contains(t, err.Error(), "capability webservice: invalid parameters: image: missing required value")
+
+	_, err = RenderDryRun(&util.Template{Name: "empty"}, nil)
+	assert.EqualError(t, err, "capability empty has no CUE template to render")
+
+	expected := 1
+	tmpl.ExpectedOutputs = &expected
+	objs, err = RenderDryRun(tmpl, map[string]interface{}{"image": "nginx"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(objs))
+
+	expected = 2
+	_, err = RenderDryRun(tmpl, map[string]interface{}{"image": "nginx"})
+	assert.EqualError(t, err, "capability webservice: expect 2 objects in outputs, got 1")
+
+	imported := &util.Template{Name: "worker", TemplateStr: `import "vela.dev/naming"
+
+output: {
+	apiVersion: "apps/v1"
+	kind:       "Deployment"
+	metadata: name: naming.#Prefix + context.name
+	spec: template: spec: containers: [{image: parameter.image}]
+}
+parameter: image: naming.#Image
+`, Imports: map[string]map[string]string{
+		"vela.dev/naming": {"naming.cue": "package naming\n\n#Prefix: \"vela-\"\n#Image: =~\"^[a-z]+$\"\n"},
+	}}
+	objs, err = RenderDryRun(imported, map[string]interface{}{"image": "nginx"})
+	assert.NoError(t, err)
+	assert.Equal(t, "vela-worker", objs[0].GetName())
+	_, err = RenderDryRun(imported, map[string]interface{}{"image": "NGINX"})
+	assert.Contains(t, err.Error(), "capability worker: invalid parameters: image: ")
+}
@@ -419,6 +419,9 @@ func GetGVKFromDefinition(dm discoverymapper.DiscoveryMapper, definitionRef v1al
 		return schema.EmptyObjectKind.GroupVersionKind(), nil
 	}
 	var gvk schema.GroupVersionKind
+	if dm == nil {
+		return gvk, errors.WithMessagef(ErrNilDiscoveryMapper, "get GVK of %s", definitionRef.Name)
+	}
 	groupResource := schema.ParseGroupResource(definitionRef.Name)
 	gvr := schema.GroupVersionResource{Group: groupResource.Group, Resource: groupResource.Resource, Version: definitionRef.Version}
 	kinds, err := dm.KindsFor(gvr)
@@ -436,6 +439,9 @@ func GetGVKFromDefinition(dm discoverymapper.DiscoveryMapper, definitionRef v1al
 // ConvertWorkloadGVK2Definition help convert a GVK to DefinitionReference
 func ConvertWorkloadGVK2Definition(dm discoverymapper.DiscoveryMapper, def v1alpha2.WorkloadGVK) (v1alpha2.DefinitionReference, error) {
 	var reference v1alpha2.DefinitionReference
+	if dm == nil {
+		return reference, errors.WithMessagef(ErrNilDiscoveryMapper, "convert %s %s to definition reference", def.APIVersion, def.Kind)
+	}
 	gv, err := schema.ParseGroupVersion(def.APIVersion)
 	if err != nil {
 		return reference, err
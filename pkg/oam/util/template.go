@@ -1,121 +1,1363 @@
 package util
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/build"
+	cueerrors "cuelang.org/go/cue/errors"
+	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/rand"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
 
 	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
 	"github.com/oam-dev/kubevela/apis/types"
+	helmapi "github.com/oam-dev/kubevela/pkg/appfile/helm/flux2apis"
+	"github.com/oam-dev/kubevela/pkg/controller/common"
+	mycue "github.com/oam-dev/kubevela/pkg/cue"
 	"github.com/oam-dev/kubevela/pkg/oam/discoverymapper"
 )
 
+// DefinitionReadTimeout bounds each read of a definition when loading templates,
+// so that a slow API server surfaces a timeout error instead of stalling the reconcile.
+var DefinitionReadTimeout = 15 * time.Second
+
+// DefinitionReadBackoff is the default backoff of retrying the reads of definitions when loading templates
+// on transient errors of the API server, e.g. throttling or connection resets. See LoadWithRetry.
+var DefinitionReadBackoff = wait.Backoff{Steps: 3, Duration: 100 * time.Millisecond, Factor: 2, Jitter: 0.1}
+
 // Template includes its string, health and its category
 type Template struct {
+	// Name is the name of the capability which the template is loaded for
+	Name string
+	// Alias is the name the template is requested by if it's an alias of the definition named Name,
+	// callers may warn that the alias is deprecated.
+	Alias string
+	// Namespace is the namespace of the definition which the template is loaded from
+	Namespace          string
 	TemplateStr        string
 	Health             string
 	CustomStatus       string
 	CapabilityCategory types.CapabilityCategory
 	Reference          v1alpha2.WorkloadGVK
 	Helm               *v1alpha2.Helm
+	// HelmValues are the chart values set in the HelmRelease of a Helm schematic,
+	// they are the default values which will be overridden by the settings of application.
+	HelmValues map[string]interface{}
+	// Kustomize is the Kustomize schematic of the definition, it's rendered by the Kustomize renderer
+	Kustomize *v1alpha2.Kustomize
+	// Imports are the files of the CUE packages imported by the template, by import path and then file name
+	Imports map[string]map[string]string
+	// Terraform is the Terraform configuration rendered by the template, it's only set for Terraform definitions
+	Terraform *TerraformConfiguration
+	// Deprecations are the deprecated fields of the definition which the template is created from,
+	// callers may warn that the definition should be migrated.
+	Deprecations []DeprecatedField
+	// Order is the order of a trait template to be rendered in, read from AnnotationTraitOrder of the TraitDefinition.
+	// Traits with lower orders are rendered first, it's 0 if unspecified.
+	Order int
+	// TemplateAPIVersion is the version of the template context which the template expects, e.g. "v1.2",
+	// read from AnnotationTemplateAPIVersion of the definition. It's empty if undeclared.
+	TemplateAPIVersion string
+	// RequiredTraits are the types of traits which a component of the template must have,
+	// read from AnnotationRequiredTraits of the ComponentDefinition or WorkloadDefinition.
+	RequiredTraits []string
+	// StatusDetails is the `details` block of the custom status, which renders structured status of the
+	// component by RenderStatusDetails. It's empty if the custom status has no details.
+	StatusDetails string
+	// Dependencies are the capabilities referenced by the AnnotationDependsOn of a ScopeDefinition
+	Dependencies []TemplateDependency
+	// DependencyWarnings are the problems of the dependencies found by LoadWithDependencies and their own ones,
+	// e.g. missing references and cycles, which don't fail loading the template.
+	DependencyWarnings []string
+	// Variant is the name of the definition which the template is loaded from instead of the one named Name,
+	// because it's the variant for Environment, see LoadForEnvironment. Both are empty for the default definition.
+	Variant     string
+	Environment string
+	// FallbackAttempts are the lookups of the definition made by the fallback chain of LoadTemplate,
+	// the last one found the definition, see LoadWithFallbackChain
+	FallbackAttempts []FallbackAttempt
+	// Limits are the resource bounds declared by the AnnotationResourceBounds of the ComponentDefinition or
+	// WorkloadDefinition, see ResourceBounds. It's nil if undeclared.
+	Limits *ResourceBounds
+	// AppliesToWorkloads are the workloads which a trait applies to, read from the TraitDefinition as is, see AppliesTo
+	AppliesToWorkloads []string
+	// Constituents are the templates of the traits which a composite trait expands into, in the order of its
+	// AnnotationComposedOf, controllers apply each of them. It's nil for other templates.
+	Constituents []*Template
+	// ExpectedOutputs is the number of auxiliary objects in the outputs of the template declared by the
+	// AnnotationExpectedOutputs of the definition, see ValidateOutputCount. It's nil if undeclared.
+	ExpectedOutputs *int
+	// Source is the addon which installed the definition, read from its LabelAddonName and LabelAddonVersion.
+	// It's nil for definitions created otherwise, e.g. manually.
+	Source *TemplateSource
+}
+
+// AnnotationRequiredTraits lists the types of traits required by the components of a definition, separated by comma
+const AnnotationRequiredTraits = "definition.oam.dev/required-traits"
+
+// AnnotationTemplateAPIVersion declares the version of the template context, e.g. the fields of context,
+// which the template of a definition is written for, in the form of "vMAJOR.MINOR".
+const AnnotationTemplateAPIVersion = "definition.oam.dev/template-api-version"
+
+// TemplateContextVersion is the version of the template context provided by this version of KubeVela
+const TemplateContextVersion = "v1.0"
+
+// CompatibleWith returns true if the template can be rendered with the template context of the version,
+// i.e. the template expects the same major version and a minor version no newer than the provided one.
+// Templates without a declared version are compatible with any version.
+func (t *Template) CompatibleWith(version string) bool {
+	if t.TemplateAPIVersion == "" {
+		return true
+	}
+	expected, err := utilversion.ParseGeneric(t.TemplateAPIVersion)
+	if err != nil {
+		return false
+	}
+	provided, err := utilversion.ParseGeneric(version)
+	if err != nil {
+		return false
+	}
+	return expected.Major() == provided.Major() && provided.AtLeast(expected)
+}
+
+// setTemplateAPIVersion sets the template API version declared by the annotations of the definition
+func setTemplateAPIVersion(tmpl *Template, annotations map[string]string) error {
+	declared, ok := annotations[AnnotationTemplateAPIVersion]
+	if !ok {
+		return nil
+	}
+	if _, err := utilversion.ParseGeneric(declared); err != nil {
+		return errors.Wrapf(err, "invalid annotation %s", AnnotationTemplateAPIVersion)
+	}
+	tmpl.TemplateAPIVersion = strings.TrimSpace(declared)
+	return nil
+}
+
+// AnnotationTraitOrder is the order of a trait to be rendered in among the traits of a component, e.g. "-10" or "10"
+const AnnotationTraitOrder = "trait.oam.dev/order"
+
+// SortTraitTemplates sorts the trait templates by their orders, traits with the same order are sorted by name,
+// so that their patches are rendered deterministically.
+func SortTraitTemplates(templates []*Template) {
+	sort.SliceStable(templates, func(i, j int) bool {
+		if templates[i].Order != templates[j].Order {
+			return templates[i].Order < templates[j].Order
+		}
+		return templates[i].Name < templates[j].Name
+	})
+}
+
+// DeprecatedField is a deprecated field of definition and the field which replaces it
+type DeprecatedField struct {
+	Field       string `json:"field"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// DefaultExtensionTemplateKey is the key of the template in the legacy spec.extension of a definition
+const DefaultExtensionTemplateKey = "template"
+
+// deprecatedExtensionTemplate is used when the template is in spec.extension.template of a definition
+var deprecatedExtensionTemplate = DeprecatedField{Field: "spec.extension." + DefaultExtensionTemplateKey, Replacement: "spec.schematic.cue.template"}
+
+// TerraformConfiguration describes the modules, variables and outputs of a Terraform configuration
+type TerraformConfiguration struct {
+	// ModuleSources maps the module names to their sources
+	ModuleSources map[string]string   `json:"moduleSources,omitempty"`
+	Variables     []TerraformVariable `json:"variables,omitempty"`
+	Outputs       []string            `json:"outputs,omitempty"`
+	// Backend is the backend storing the state, it's nil if the configuration doesn't declare one
+	Backend *TerraformBackend `json:"backend,omitempty"`
+}
+
+// TerraformBackend is the state backend of a Terraform configuration, e.g. `terraform: backend: s3: {...}`
+type TerraformBackend struct {
+	// Type is the type of the backend, e.g. "s3" or "gcs"
+	Type string `json:"type"`
+	// Config is the configuration of the backend, settings which depend on parameters are omitted
+	Config map[string]interface{} `json:"config,omitempty"`
+}
+
+// TerraformVariable is an input variable of a Terraform configuration
+type TerraformVariable struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Required is true if the variable has no default value
+	Required bool `json:"required,omitempty"`
+}
+
+// ErrNilDiscoveryMapper is returned by the functions resolving GVKs if the discovery mapper is nil
+var ErrNilDiscoveryMapper = errors.New("discovery mapper is nil, cannot resolve GVK")
+
+// GetScopeGVK Get ScopeDefinition
+func GetScopeGVK(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper,
+	name string) (gvk schema.GroupVersionKind, err error) {
+	ctx, endSpan := startTemplateSpan(ctx, "GetScopeGVK", ScopeTemplateKind, name)
+	defer func() { endSpan(err) }()
+	if dm == nil {
+		return gvk, errors.WithMessagef(ErrNilDiscoveryMapper, "get GVK of ScopeDefinition %s", name)
+	}
+	sd := new(v1alpha2.ScopeDefinition)
+	if err = getDefinitionWithTimeout(ctx, cli, sd, name); err != nil {
+		return gvk, err
+	}
+	return scopeGVKOfDefinition(dm, sd, name)
+}
+
+// GetComponentWorkloadGVK gets the GVK of the workload produced by the ComponentDefinition without loading its template,
+// the workload is either defined by its apiVersion and kind, or typed by the name of a WorkloadDefinition.
+// Like LoadTemplate, the WorkloadDefinition with the same name is used if the ComponentDefinition is not found.
+func GetComponentWorkloadGVK(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper, name string) (schema.GroupVersionKind, error) {
+	if dm == nil {
+		return schema.GroupVersionKind{}, errors.WithMessagef(ErrNilDiscoveryMapper, "get workload GVK of component %s", name)
+	}
+	cd := new(v1alpha2.ComponentDefinition)
+	err := getDefinitionWithTimeout(ctx, cli, cd, name)
+	switch {
+	case kerrors.IsNotFound(err):
+		return getWorkloadDefinitionGVK(ctx, cli, dm, name)
+	case err != nil:
+		return schema.GroupVersionKind{}, err
+	case cd.Spec.Workload.Type != "":
+		gvk, err := getWorkloadDefinitionGVK(ctx, cli, dm, cd.Spec.Workload.Type)
+		if err != nil {
+			return gvk, errors.WithMessagef(err, "cannot resolve the workload type of ComponentDefinition %s", name)
+		}
+		return gvk, nil
+	}
+	gv, err := schema.ParseGroupVersion(cd.Spec.Workload.Definition.APIVersion)
+	if err != nil {
+		return schema.GroupVersionKind{}, errors.Wrapf(err, "invalid workload apiVersion of ComponentDefinition %s", name)
+	}
+	gvk := gv.WithKind(cd.Spec.Workload.Definition.Kind)
+	// make sure the kind is registered, otherwise creating the workload will fail later
+	if _, err = dm.RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+		return gvk, errors.WithMessagef(err, "kind %s of the workload of ComponentDefinition %s is not registered", gvk.String(), name)
+	}
+	return gvk, nil
+}
+
+// getWorkloadDefinitionGVK gets the GVK referenced by the WorkloadDefinition
+func getWorkloadDefinitionGVK(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper, name string) (schema.GroupVersionKind, error) {
+	wd := new(v1alpha2.WorkloadDefinition)
+	if err := getDefinitionWithTimeout(ctx, cli, wd, name); err != nil {
+		return schema.GroupVersionKind{}, err
+	}
+	gvk, err := GetGVKFromDefinition(dm, wd.Spec.Reference)
+	if err != nil {
+		return gvk, errors.WithMessagef(err, "cannot resolve the reference %q of WorkloadDefinition %s", wd.Spec.Reference.Name, name)
+	}
+	return gvk, nil
+}
+
+// scopeGVKOfDefinition resolves the GVK referenced by the ScopeDefinition and makes sure it's registered
+func scopeGVKOfDefinition(dm discoverymapper.DiscoveryMapper, sd *v1alpha2.ScopeDefinition, name string) (schema.GroupVersionKind, error) {
+	gvk, err := GetGVKFromDefinition(dm, sd.Spec.Reference)
+	if err != nil {
+		return gvk, errors.WithMessagef(err, "cannot resolve the reference %q of ScopeDefinition %s", sd.Spec.Reference.Name, name)
+	}
+	if gvk.Kind == "" {
+		return gvk, nil
+	}
+	// make sure the kind is registered, otherwise creating the scope will fail later
+	if _, err = dm.RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+		return gvk, errors.WithMessagef(err, "kind %s referenced by ScopeDefinition %s is not registered", gvk.String(), name)
+	}
+	return gvk, nil
+}
+
+// CapabilityCategoryFromAnnotations gets the capability category from the "type" annotation of a definition,
+// the value is case-insensitive, an empty or unknown value returns the default empty category.
+func CapabilityCategoryFromAnnotations(annotations map[string]string) types.CapabilityCategory {
+	category := types.CapabilityCategory(strings.ToLower(strings.TrimSpace(annotations["type"])))
+	switch category {
+	case types.CUECategory, types.HelmCategory, types.TerraformCategory:
+		return category
+	default:
+		return ""
+	}
+}
+
+// getDefinitionWithTimeout calls GetDefinition in a sub-context bounded by DefinitionReadTimeout
+func getDefinitionWithTimeout(ctx context.Context, cli client.Reader, definition runtime.Object, definitionName string) error {
+	return readDefinitionWithTimeout(ctx, definitionName, func(readCtx context.Context) error {
+		return GetDefinition(readCtx, cli, definition, definitionName)
+	})
+}
+
+// getDefinitionInNamespaces gets the definition from the first namespace which has it, in a sub-context bounded by DefinitionReadTimeout
+func getDefinitionInNamespaces(ctx context.Context, cli client.Reader, definition runtime.Object, definitionName string, namespaces []string) error {
+	return readDefinitionWithTimeout(ctx, definitionName, func(readCtx context.Context) error {
+		var err error
+		for _, ns := range namespaces {
+			if err = cli.Get(readCtx, ktypes.NamespacedName{Namespace: ns, Name: definitionName}, definition); !kerrors.IsNotFound(err) {
+				return err
+			}
+		}
+		return err
+	})
+}
+
+func readDefinitionWithTimeout(ctx context.Context, definitionName string, read func(readCtx context.Context) error) error {
+	readCtx, cancel := context.WithTimeout(ctx, DefinitionReadTimeout)
+	defer cancel()
+	err := read(readCtx)
+	if err != nil && ctx.Err() == nil && readCtx.Err() == context.DeadlineExceeded {
+		return errors.Wrapf(err, "timed out after %s reading definition %s", DefinitionReadTimeout, definitionName)
+	}
+	return err
+}
+
+// ResolvedDefinition describes the definition which a template is actually loaded from
+type ResolvedDefinition struct {
+	Kind            string
+	Namespace       string
+	Name            string
+	ResourceVersion string
+	// Dependencies are the other definitions which the template is built from, i.e. the parent definition it extends
+	// and the constituents of a composite trait
+	Dependencies []*ResolvedDefinition
+}
+
+func newResolvedDefinition(kind string, def metav1.Object) *ResolvedDefinition {
+	return &ResolvedDefinition{
+		Kind:            kind,
+		Namespace:       def.GetNamespace(),
+		Name:            def.GetName(),
+		ResourceVersion: def.GetResourceVersion(),
+	}
+}
+
+// TemplateKind is the kind of definition which a template is loaded from
+type TemplateKind string
+
+const (
+	// ComponentTemplateKind loads the template from ComponentDefinition, or WorkloadDefinition if not found
+	ComponentTemplateKind TemplateKind = TemplateKind(types.TypeComponentDefinition)
+	// TraitTemplateKind loads the template from TraitDefinition
+	TraitTemplateKind TemplateKind = TemplateKind(types.TypeTrait)
+	// ScopeTemplateKind loads the template from ScopeDefinition
+	ScopeTemplateKind TemplateKind = TemplateKind(types.TypeScope)
+)
+
+// ParseTemplateKind parses the kind of template, it returns an error for unknown kinds
+func ParseTemplateKind(kind string) (TemplateKind, error) {
+	k := TemplateKind(kind)
+	if err := k.Validate(); err != nil {
+		return "", err
+	}
+	return k, nil
+}
+
+// String returns the kind as string
+func (k TemplateKind) String() string {
+	return string(k)
+}
+
+// Validate returns an error if the kind is not supported
+func (k TemplateKind) Validate() error {
+	switch k {
+	case ComponentTemplateKind, TraitTemplateKind, ScopeTemplateKind:
+		return nil
+	default:
+		return errors.Errorf("unsupported template kind %q", string(k))
+	}
+}
+
+// LoadTemplateOption customizes how LoadTemplate loads a template
+type LoadTemplateOption func(*loadTemplateOptions)
+
+type loadTemplateOptions struct {
+	disableWorkloadFallback bool
+	validateCUE             bool
+	requireTemplate         bool
+	namespaces              []string
+	featureGates            map[string]bool
+	logger                  logr.Logger
+	backoff                 *wait.Backoff
+	resolveDependencies     bool
+	environment             string
+	platform                map[string]string
+	fallbackChains          map[TemplateKind][]FallbackStep
+	// inheritance is the chain of definitions being extended, to detect cycles
+	inheritance []string
+	// composition is the chain of composite traits being expanded, to detect cycles
+	composition []string
+}
+
+// debug returns the logger for the debug events of loading, it discards the events if no logger is set
+func (o *loadTemplateOptions) debug() logr.InfoLogger {
+	if o.logger == nil {
+		return ctrllog.NullLogger{}
+	}
+	return o.logger.V(int(common.LogDebug))
+}
+
+// getDefinition gets the definition from the namespaces to search if set, otherwise by GetDefinition.
+// The read is retried with the backoff on transient errors.
+func (o *loadTemplateOptions) getDefinition(ctx context.Context, cli client.Reader, definition runtime.Object, definitionName string) error {
+	return o.getDefinitionFrom(ctx, cli, definition, definitionName, nil)
+}
+
+// getDefinitionFrom gets the definition like getDefinition, but from the namespaces if they are set
+func (o *loadTemplateOptions) getDefinitionFrom(ctx context.Context, cli client.Reader, definition runtime.Object, definitionName string, namespaces []string) error {
+	if len(namespaces) == 0 {
+		namespaces = o.namespaces
+	}
+	backoff := DefinitionReadBackoff
+	if o.backoff != nil {
+		backoff = *o.backoff
+	}
+	if backoff.Steps < 1 {
+		backoff.Steps = 1
+	}
+	retriable := func(err error) bool {
+		return ctx.Err() == nil && isTransientError(err)
+	}
+	return retry.OnError(backoff, retriable, func() error {
+		if len(namespaces) == 0 {
+			return getDefinitionWithTimeout(ctx, cli, definition, definitionName)
+		}
+		return getDefinitionInNamespaces(ctx, cli, definition, definitionName, namespaces)
+	})
+}
+
+// isTransientError returns true if the error of reading from the API server may go away by retrying
+func isTransientError(err error) bool {
+	err = errors.Cause(err)
+	return kerrors.IsServerTimeout(err) || kerrors.IsTimeout(err) || kerrors.IsTooManyRequests(err) ||
+		kerrors.IsServiceUnavailable(err) || kerrors.IsInternalError(err) || utilnet.IsConnectionReset(err)
+}
+
+// searchNamespaces returns the namespaces to find definitions in
+func (o *loadTemplateOptions) searchNamespaces(ctx context.Context) []string {
+	if len(o.namespaces) == 0 {
+		return definitionNamespaces(ctx)
+	}
+	return o.namespaces
+}
+
+// DisableWorkloadFallback makes LoadTemplate return the not found error of ComponentDefinition
+// instead of loading the template from the WorkloadDefinition with the same name.
+func DisableWorkloadFallback() LoadTemplateOption {
+	return func(o *loadTemplateOptions) {
+		o.disableWorkloadFallback = true
+	}
+}
+
+// LoadFromNamespaces makes LoadTemplate search the definition in the namespaces in order instead of the namespaces of
+// GetDefinition, e.g. the namespace of a tenant before the system namespace, so that the definitions of the tenant
+// shadow the ones of the system. The namespace which the definition is found in is recorded in Template.Namespace.
+func LoadFromNamespaces(namespaces ...string) LoadTemplateOption {
+	return func(o *loadTemplateOptions) {
+		o.namespaces = namespaces
+	}
+}
+
+// LoadWithCUEValidation makes LoadTemplate validate the CUE template of the definition,
+// an invalid template is reported as a *TemplateParseError with the key of the definition.
+func LoadWithCUEValidation() LoadTemplateOption {
+	return func(o *loadTemplateOptions) {
+		o.validateCUE = true
+	}
+}
+
+// RequireNonEmptyTemplate makes LoadTemplate return an error if the definition has no usable template,
+// i.e. neither a CUE template nor a Helm or Kustomize schematic, instead of a template which renders nothing.
+func RequireNonEmptyTemplate() LoadTemplateOption {
+	return func(o *loadTemplateOptions) {
+		o.requireTemplate = true
+	}
+}
+
+// LoadWithLogger makes LoadTemplate log each step of resolving the definition at debug level, e.g. whether the
+// ComponentDefinition is found and the template is loaded from the WorkloadDefinition instead.
+func LoadWithLogger(logger logr.Logger) LoadTemplateOption {
+	return func(o *loadTemplateOptions) {
+		o.logger = logger
+	}
+}
+
+// LoadWithRetry makes LoadTemplate retry the reads of definitions with the backoff instead of DefinitionReadBackoff
+// on transient errors, e.g. server timeouts or throttling. Other errors, e.g. not found, are returned immediately.
+// A backoff with Steps less than 2 disables retry.
+func LoadWithRetry(backoff wait.Backoff) LoadTemplateOption {
+	return func(o *loadTemplateOptions) {
+		o.backoff = &backoff
+	}
+}
+
+// LoadTemplate Get template according to key.
+// Components backed by WorkloadDefinitions are loaded without the resolved workload reference, and scopes can't be
+// loaded, since both need a discovery mapper, see LoadTemplateOfKind.
+func LoadTemplate(ctx context.Context, cli client.Reader, key string, kd types.CapType, opts ...LoadTemplateOption) (*Template, error) {
+	kind, err := ParseTemplateKind(string(kd))
+	if err != nil {
+		return nil, err
+	}
+	return LoadTemplateOfKind(ctx, cli, nil, key, kind, opts...)
+}
+
+// LoadTemplateOfKind gets the template of kind kd according to key, the discovery mapper resolves the GVK of
+// the workload of WorkloadDefinitions and of scopes
+func LoadTemplateOfKind(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper, key string, kd TemplateKind, opts ...LoadTemplateOption) (*Template, error) {
+	tmpl, _, err := LoadTemplateWithSource(ctx, cli, dm, key, kd, opts...)
+	return tmpl, err
+}
+
+// LoadTemplateWithSource Get template according to key, it also returns the definition which the template is loaded from,
+// e.g. a WorkloadDefinition if no ComponentDefinition is found by the key.
+func LoadTemplateWithSource(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper, key string, kd TemplateKind, opts ...LoadTemplateOption) (*Template, *ResolvedDefinition, error) {
+	start := time.Now()
+	ctx, endSpan := startTemplateSpan(ctx, "LoadTemplate", kd, key)
+	tmpl, source, err := loadTemplateWithAlias(ctx, cli, dm, key, kd, opts...)
+	endSpan(err)
+	observeTemplateLoad(kd, start, err)
+	return tmpl, source, err
+}
+
+// loadTemplateWithAlias loads the template by key, if no definition is named key,
+// the template is loaded from the definition which has key as its alias.
+func loadTemplateWithAlias(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper, key string, kd TemplateKind, opts ...LoadTemplateOption) (*Template, *ResolvedDefinition, error) {
+	options := &loadTemplateOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	options.debug().Info("Load template", "kind", kd, "name", key)
+	tmpl, source, err := loadEnvironmentVariant(ctx, cli, dm, key, kd, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tmpl == nil {
+		tmpl, source, err = loadTemplateWithSource(ctx, cli, dm, key, kd, options)
+	}
+	if err == nil {
+		tmpl.Namespace = source.Namespace
+		logTemplateLoaded(options, tmpl, source)
+		if err := options.withDependencies(ctx, cli, dm, kd, tmpl); err != nil {
+			return nil, nil, err
+		}
+		return tmpl, source, nil
+	}
+	if !kerrors.IsNotFound(errors.Cause(err)) {
+		return nil, nil, err
+	}
+	name, aerr := resolveDefinitionAlias(ctx, cli, key, kd, options)
+	if aerr != nil {
+		return nil, nil, errors.WithMessagef(aerr, "LoadTemplate [%s] resolve alias", key)
+	}
+	if name == "" {
+		options.debug().Info("Definition not found", "kind", kd, "name", key)
+		return nil, nil, err
+	}
+	options.debug().Info("Resolve definition by alias", "kind", kd, "alias", key, "name", name)
+	tmpl, source, err = loadTemplateWithSource(ctx, cli, dm, name, kd, options)
+	if err != nil {
+		return nil, nil, errors.WithMessagef(err, "LoadTemplate [%s] aliased by definition %s", key, name)
+	}
+	tmpl.Alias = key
+	tmpl.Namespace = source.Namespace
+	logTemplateLoaded(options, tmpl, source)
+	if err := options.withDependencies(ctx, cli, dm, kd, tmpl); err != nil {
+		return nil, nil, err
+	}
+	return tmpl, source, nil
+}
+
+func logTemplateLoaded(options *loadTemplateOptions, tmpl *Template, source *ResolvedDefinition) {
+	options.debug().Info("Loaded template", "name", tmpl.Name, "definition", source.Kind,
+		"namespace", source.Namespace, "category", tmpl.CapabilityCategory)
+}
+
+func loadTemplateWithSource(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper, key string, kd TemplateKind, options *loadTemplateOptions) (*Template, *ResolvedDefinition, error) {
+	if err := kd.Validate(); err != nil {
+		return nil, nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	steps, err := options.fallbackChain(kd)
+	if err != nil {
+		return nil, nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	attempts := make([]FallbackAttempt, 0, len(steps))
+	for i, step := range steps {
+		def := newDefinitionObject(step.Kind)
+		err := options.getDefinitionFrom(ctx, cli, def, key, step.Namespaces)
+		attempts = append(attempts, FallbackAttempt{Step: step, Err: err})
+		if kerrors.IsNotFound(err) && i < len(steps)-1 {
+			options.debug().Info(fmt.Sprintf("%s not found, fall back to %s", step, steps[i+1]), "name", key)
+			continue
+		}
+		if err != nil {
+			return nil, nil, errors.WithMessagef(err, loadErrorFormatOfKind(step.Kind), key)
+		}
+		if step.Kind == v1alpha2.WorkloadDefinitionKind && i > 0 {
+			observeWorkloadFallback()
+		}
+		tmpl, source, err := templateOfDefinitionObject(ctx, cli, dm, key, kd, step.Kind, def, options)
+		if err != nil {
+			return nil, nil, err
+		}
+		tmpl.FallbackAttempts = attempts
+		return tmpl, source, nil
+	}
+	return nil, nil, fmt.Errorf("kind(%s) of %s not supported", kd, key)
+}
+
+// templateOfDefinitionObject creates the template of the definition of the kind read by key
+func templateOfDefinitionObject(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper, key string, kd TemplateKind,
+	kind string, def runtime.Object, options *loadTemplateOptions) (*Template, *ResolvedDefinition, error) {
+	obj, err := meta.Accessor(def)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := options.checkFeatureGates(kind, obj); err != nil {
+		return nil, nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	var tmpl *Template
+	switch d := def.(type) {
+	case *v1alpha2.ComponentDefinition:
+		tmpl, err = templateOfComponentDefinition(key, d, options)
+	case *v1alpha2.WorkloadDefinition:
+		tmpl, err = templateOfWorkloadDefinition(dm, key, d, options)
+	case *v1alpha2.TraitDefinition:
+		tmpl, err = templateOfTraitDefinition(key, d, options)
+	case *v1alpha2.ScopeDefinition:
+		tmpl, err = templateOfScopeDefinition(dm, key, d, options)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if tmpl.ExpectedOutputs, err = expectedOutputs(obj.GetAnnotations()); err != nil {
+		return nil, nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	tmpl.Source = templateSourceOf(obj.GetLabels())
+	source := newResolvedDefinition(kind, obj)
+	parent, err := options.inheritTemplate(ctx, cli, dm, key, kd, tmpl, obj)
+	if err != nil {
+		return nil, nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	if parent != nil {
+		source.Dependencies = append(source.Dependencies, parent)
+	}
+	constituents, err := options.expandCompositeTrait(ctx, cli, dm, key, kd, tmpl, obj)
+	if err != nil {
+		return nil, nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	source.Dependencies = append(source.Dependencies, constituents...)
+	return tmpl, source, nil
+}
+
+// templateOfComponentDefinition creates the template of a ComponentDefinition named key
+func templateOfComponentDefinition(key string, cd *v1alpha2.ComponentDefinition, options *loadTemplateOptions) (*Template, error) {
+	schematic, err := options.selectSchematic(cd, cd.Spec.Schematic)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	tmpl, err := newTemplateOfDefinition(key, schematic, cd.Spec.Status, cd.Spec.Extension, options)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	tmpl.Reference = cd.Spec.Workload.Definition
+	if err := setCapabilityCategory(tmpl, cd, schematic); err != nil {
+		return nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	if err := setTemplateAPIVersion(tmpl, cd.Annotations); err != nil {
+		return nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	tmpl.RequiredTraits = requiredTraits(cd.Annotations)
+	if tmpl.Limits, err = resourceBoundsOf(cd.Annotations); err != nil {
+		return nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	tmpl.Name = key
+	return tmpl, nil
+}
+
+// templateOfWorkloadDefinition creates the template of a WorkloadDefinition named key
+func templateOfWorkloadDefinition(dm discoverymapper.DiscoveryMapper, key string, wd *v1alpha2.WorkloadDefinition, options *loadTemplateOptions) (*Template, error) {
+	schematic, err := options.selectSchematic(wd, wd.Spec.Schematic)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	tmpl, err := newTemplateOfDefinition(key, schematic, wd.Spec.Status, wd.Spec.Extension, options)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	// the workload may not be installed yet, e.g. its CRD is applied after the definition, the template is still
+	// usable without the reference
+	if gvk, err := GetGVKFromDefinition(dm, wd.Spec.Reference); err == nil {
+		tmpl.Reference = v1alpha2.WorkloadGVK{APIVersion: gvk.GroupVersion().String(), Kind: gvk.Kind}
+	} else {
+		options.debug().Info("Cannot resolve the workload of WorkloadDefinition, leave the reference empty",
+			"name", key, "workload", wd.Spec.Reference.Name, "error", err.Error())
+	}
+	if err := setCapabilityCategory(tmpl, wd, schematic); err != nil {
+		return nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	if err := setTemplateAPIVersion(tmpl, wd.Annotations); err != nil {
+		return nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	tmpl.RequiredTraits = requiredTraits(wd.Annotations)
+	if tmpl.Limits, err = resourceBoundsOf(wd.Annotations); err != nil {
+		return nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	tmpl.Name = key
+	return tmpl, nil
+}
+
+// templateOfTraitDefinition creates the template of a TraitDefinition named key
+func templateOfTraitDefinition(key string, td *v1alpha2.TraitDefinition, options *loadTemplateOptions) (*Template, error) {
+	schematic, err := options.selectSchematic(td, td.Spec.Schematic)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	tmpl, err := newTemplateOfDefinition(key, schematic, td.Spec.Status, td.Spec.Extension, options)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	if err := setCapabilityCategory(tmpl, td, schematic); err != nil {
+		return nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	if order, ok := td.Annotations[AnnotationTraitOrder]; ok {
+		if tmpl.Order, err = strconv.Atoi(strings.TrimSpace(order)); err != nil {
+			return nil, errors.Wrapf(err, "LoadTemplate [%s] invalid annotation %s", key, AnnotationTraitOrder)
+		}
+	}
+	if err := setTemplateAPIVersion(tmpl, td.Annotations); err != nil {
+		return nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	tmpl.AppliesToWorkloads = td.Spec.AppliesToWorkloads
+	tmpl.Name = key
+	return tmpl, nil
+}
+
+// templateOfScopeDefinition creates the template of a ScopeDefinition named key
+func templateOfScopeDefinition(dm discoverymapper.DiscoveryMapper, key string, sd *v1alpha2.ScopeDefinition, options *loadTemplateOptions) (*Template, error) {
+	schematic, err := options.selectSchematic(sd, sd.Spec.Schematic)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	tmpl, err := newTemplateOfDefinition(key, schematic, sd.Spec.Status, sd.Spec.Extension, options)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	gvk, err := GetGVKFromDefinition(dm, sd.Spec.Reference)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	tmpl.Reference = v1alpha2.WorkloadGVK{APIVersion: gvk.GroupVersion().String(), Kind: gvk.Kind}
+	if err := setTemplateAPIVersion(tmpl, sd.Annotations); err != nil {
+		return nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+	}
+	tmpl.Dependencies, tmpl.DependencyWarnings = templateDependencies(sd.Annotations)
+	tmpl.Name = key
+	return tmpl, nil
+}
+
+// setCapabilityCategory sets the category of the template of the definition detected by the registered
+// CategoryDetector, and the Terraform configuration of a Terraform definition. The configuration is left unset
+// rather than failing the load if the template imports CUE packages which aren't resolved.
+func setCapabilityCategory(tmpl *Template, def metav1.Object, schematic *v1alpha2.Schematic) error {
+	tmpl.CapabilityCategory = DetectCapabilityCategory(def, schematic)
+	if tmpl.CapabilityCategory != types.TerraformCategory {
+		return nil
+	}
+	if checkImportsResolved(tmpl.TemplateStr, tmpl.Imports) != nil {
+		return nil
+	}
+	var err error
+	tmpl.Terraform, err = parseTerraformConfiguration(tmpl.TemplateStr, tmpl.Imports)
+	return err
+}
+
+// DefinitionExists checks whether the definition of a template exists without building the template,
+// a component template also exists if there's a WorkloadDefinition or a definition aliased by the key, like LoadTemplate.
+// The definition is read with cli, which is backed by the informer cache for the client of a manager.
+func DefinitionExists(ctx context.Context, cli client.Reader, kd TemplateKind, key string) (bool, error) {
+	if err := kd.Validate(); err != nil {
+		return false, err
+	}
+	var definitions []runtime.Object
+	switch kd {
+	case ComponentTemplateKind:
+		definitions = []runtime.Object{new(v1alpha2.ComponentDefinition), new(v1alpha2.WorkloadDefinition)}
+	case TraitTemplateKind:
+		definitions = []runtime.Object{new(v1alpha2.TraitDefinition)}
+	case ScopeTemplateKind:
+		definitions = []runtime.Object{new(v1alpha2.ScopeDefinition)}
+	}
+	for _, def := range definitions {
+		err := getDefinitionWithTimeout(ctx, cli, def, key)
+		if err == nil {
+			return true, nil
+		}
+		if !kerrors.IsNotFound(err) {
+			return false, errors.WithMessagef(err, "check definition [%s] ", key)
+		}
+	}
+	name, err := resolveDefinitionAlias(ctx, cli, key, kd, &loadTemplateOptions{})
+	if err != nil {
+		return false, errors.WithMessagef(err, "check definition [%s] resolve alias", key)
+	}
+	return name != "", nil
+}
+
+// LoadTemplatesConcurrency is the max number of templates LoadTemplates loads at the same time,
+// values less than 1 are taken as 1
+var LoadTemplatesConcurrency = 8
+
+// TemplateKey identifies a template to load by LoadTemplates
+type TemplateKey struct {
+	Name string
+	Kind TemplateKind
+}
+
+// LoadTemplates loads the templates of the keys concurrently, it returns the loaded templates and the errors by key.
+// Canceling the context stops loading the templates not yet started, their errors are the error of context.
+func LoadTemplates(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper, keys []TemplateKey) (map[TemplateKey]*Template, map[TemplateKey]error) {
+	templates := make(map[TemplateKey]*Template, len(keys))
+	errs := make(map[TemplateKey]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	concurrency := LoadTemplatesConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	workers := make(chan struct{}, concurrency)
+	for _, key := range keys {
+		select {
+		case workers <- struct{}{}:
+		case <-ctx.Done():
+			mu.Lock()
+			errs[key] = ctx.Err()
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(key TemplateKey) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			err := ctx.Err()
+			var tmpl *Template
+			if err == nil {
+				tmpl, err = LoadTemplateOfKind(ctx, cli, dm, key.Name, key.Kind)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[key] = err
+				return
+			}
+			templates[key] = tmpl
+		}(key)
+	}
+	wg.Wait()
+	return templates, errs
+}
+
+// ListTemplates lists the definitions of the template kind matching the label selector and creates their templates,
+// e.g. all the Terraform traits of a capability catalog. Definitions found in the definition namespaces of the context
+// shadow the ones with the same name in the system namespace, like LoadTemplate. Definitions without template are skipped,
+// a definition whose template can't be created doesn't fail the others, the templates created are returned with
+// the aggregated errors of the failed ones.
+func ListTemplates(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper, kd TemplateKind, selector labels.Selector) ([]*Template, error) {
+	if err := kd.Validate(); err != nil {
+		return nil, err
+	}
+	options := &loadTemplateOptions{}
+	var lists []runtime.Object
+	switch kd {
+	case ComponentTemplateKind:
+		lists = []runtime.Object{&v1alpha2.ComponentDefinitionList{}, &v1alpha2.WorkloadDefinitionList{}}
+	case TraitTemplateKind:
+		lists = []runtime.Object{&v1alpha2.TraitDefinitionList{}}
+	case ScopeTemplateKind:
+		lists = []runtime.Object{&v1alpha2.ScopeDefinitionList{}}
+	}
+
+	var templates []*Template
+	var errs []error
+	seen := map[string]bool{}
+	for _, list := range lists {
+		for _, ns := range definitionNamespaces(ctx) {
+			if err := cli.List(ctx, list, client.InNamespace(ns), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+				return nil, errors.Wrapf(err, "list definitions in namespace %s", ns)
+			}
+			items, err := meta.ExtractList(list)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				def, err := meta.Accessor(item)
+				if err != nil {
+					return nil, err
+				}
+				if seen[def.GetName()] {
+					continue
+				}
+				seen[def.GetName()] = true
+				var tmpl *Template
+				switch d := item.(type) {
+				case *v1alpha2.ComponentDefinition:
+					tmpl, err = templateOfComponentDefinition(d.Name, d, options)
+				case *v1alpha2.WorkloadDefinition:
+					tmpl, err = templateOfWorkloadDefinition(dm, d.Name, d, options)
+				case *v1alpha2.TraitDefinition:
+					tmpl, err = templateOfTraitDefinition(d.Name, d, options)
+				case *v1alpha2.ScopeDefinition:
+					tmpl, err = templateOfScopeDefinition(dm, d.Name, d, options)
+				}
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				if !tmpl.IsCUE() && !tmpl.IsHelm() && !tmpl.IsKustomize() && !tmpl.IsTerraform() {
+					continue
+				}
+				tmpl.Namespace = def.GetNamespace()
+				templates = append(templates, tmpl)
+			}
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates, utilerrors.NewAggregate(errs)
+}
+
+// newTemplateOfDefinition creates the template of the definition with the key according to the load options
+func newTemplateOfDefinition(key string, schematic *v1alpha2.Schematic, status *v1alpha2.Status, raw *runtime.RawExtension, options *loadTemplateOptions) (*Template, error) {
+	var opts []TemplateOption
+	if options.validateCUE {
+		opts = append(opts, WithCUEValidation())
+	}
+	tmpl, err := NewTemplateWithOptions(schematic, status, raw, opts...)
+	if parseErr, ok := err.(*TemplateParseError); ok {
+		parseErr.Key = key
+	}
+	if err == nil && options.requireTemplate && tmpl.TemplateStr == "" && tmpl.Helm == nil && tmpl.Kustomize == nil {
+		return tmpl, errors.New("no template found in definition")
+	}
+	return tmpl, err
+}
+
+// TemplateOption customizes how NewTemplateWithOptions creates a template
+type TemplateOption func(*templateOptions)
+
+type templateOptions struct {
+	validateCUE             bool
+	allowMultipleSchematics bool
+	importResolver          ImportResolver
+	runtime                 *cue.Runtime
+	extensionTemplateKey    string
+	schematicSelectors      SchematicSelectors
+	platform                labels.Labels
+}
+
+// WithCUEValidation makes NewTemplateWithOptions compile the CUE template and return an error if it's invalid
+func WithCUEValidation() TemplateOption {
+	return func(o *templateOptions) {
+		o.validateCUE = true
+	}
+}
+
+// AllowMultipleSchematics makes NewTemplateWithOptions accept a schematic with more than one type set,
+// the CUE one takes precedence over the Helm one, which takes precedence over the Kustomize one.
+func AllowMultipleSchematics() TemplateOption {
+	return func(o *templateOptions) {
+		o.allowMultipleSchematics = true
+	}
+}
+
+// WithImportResolver makes NewTemplateWithOptions resolve the CUE packages imported by the template with the resolver,
+// the resolved packages are kept in Template.Imports and compiled together with the template when it's validated.
+func WithImportResolver(resolver ImportResolver) TemplateOption {
+	return func(o *templateOptions) {
+		o.importResolver = resolver
+	}
+}
+
+// WithCUERuntime makes NewTemplateWithOptions compile the CUE template with the given runtime, so that callers
+// can share a runtime and the values compiled by it. A nil runtime falls back to the default, which is a new
+// runtime for each compilation. The runtime of CUE isn't safe for concurrent use, a shared runtime must not be
+// used by multiple goroutines at the same time, e.g. keep one runtime per worker instead of one per process.
+func WithCUERuntime(r *cue.Runtime) TemplateOption {
+	return func(o *templateOptions) {
+		o.runtime = r
+	}
+}
+
+// WithExtensionTemplateKey makes NewTemplateWithOptions read the legacy template in spec.extension of a definition
+// by the key instead of DefaultExtensionTemplateKey, for definitions storing it under a nonstandard key.
+func WithExtensionTemplateKey(key string) TemplateOption {
+	return func(o *templateOptions) {
+		o.extensionTemplateKey = key
+	}
+}
+
+// NewTemplate will create template for inner AbstractEngine using.
+// If the template can't be created, the fields populated so far, e.g. Health, CustomStatus and CapabilityCategory,
+// are still returned with the error for diagnostics, callers need the template to be valid must check the error.
+func NewTemplate(schematic *v1alpha2.Schematic, status *v1alpha2.Status, raw *runtime.RawExtension) (*Template, error) {
+	return NewTemplateWithOptions(schematic, status, raw)
+}
+
+// NewTemplateWithOptions will create template like NewTemplate, the creation can be customized by options.
+func NewTemplateWithOptions(schematic *v1alpha2.Schematic, status *v1alpha2.Status, raw *runtime.RawExtension, opts ...TemplateOption) (*Template, error) {
+	options := &templateOptions{extensionTemplateKey: DefaultExtensionTemplateKey}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.schematicSelectors != nil {
+		schematic = options.schematicSelectors.Select(schematic, options.platform)
+	}
+	if !options.allowMultipleSchematics {
+		if err := checkMultipleSchematics(schematic); err != nil {
+			return newStatusTemplate(status), err
+		}
+	}
+	tmp, err := newTemplate(schematic, status, raw, options.extensionTemplateKey)
+	if err != nil {
+		return tmp, err
+	}
+	if options.importResolver != nil && tmp.TemplateStr != "" {
+		if tmp.Imports, err = resolveImports(tmp.TemplateStr, options.importResolver); err != nil {
+			return tmp, err
+		}
+	}
+	if options.validateCUE && schematic != nil && schematic.CUE != nil && len(schematic.CUE.Files) > 0 {
+		// compile the files separately to locate the errors in them
+		files, err := cueTemplateFiles(schematic.CUE)
+		if err != nil {
+			return tmp, err
+		}
+		if err := validateCUEFiles(options.runtime, files, tmp.Imports); err != nil {
+			return tmp, err
+		}
+	} else if options.validateCUE && tmp.TemplateStr != "" {
+		if err := validateCUETemplate(options.runtime, tmp.TemplateStr, tmp.Imports); err != nil {
+			return tmp, err
+		}
+	}
+	return tmp, nil
 }
 
-// GetScopeGVK Get ScopeDefinition
-func GetScopeGVK(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper,
-	name string) (schema.GroupVersionKind, error) {
-	var gvk schema.GroupVersionKind
-	sd := new(v1alpha2.ScopeDefinition)
-	err := GetDefinition(ctx, cli, sd, name)
-	if err != nil {
-		return gvk, err
+// checkMultipleSchematics returns an error naming the conflicting fields if more than one schematic type is set
+func checkMultipleSchematics(schematic *v1alpha2.Schematic) error {
+	if schematic == nil {
+		return nil
+	}
+	var fields []string
+	if schematic.CUE != nil {
+		fields = append(fields, "cue")
 	}
+	if schematic.HELM != nil {
+		fields = append(fields, "helm")
+	}
+	if schematic.KUSTOMIZE != nil {
+		fields = append(fields, "kustomize")
+	}
+	if len(fields) > 1 {
+		return errors.Errorf("only one schematic can be set, but got %s", strings.Join(fields, ", "))
+	}
+	return nil
+}
 
-	return GetGVKFromDefinition(dm, sd.Spec.Reference)
+// TemplateParseError is the error of an invalid CUE template, it carries the positions of the CUE errors
+// and snippets of the offending lines, so that callers can type-assert it to print the errors nicely.
+type TemplateParseError struct {
+	// Key is the name of the definition which the template belongs to, it's empty if unknown
+	Key    string
+	Errors []TemplateErrorPosition
 }
 
-// LoadTemplate Get template according to key
-func LoadTemplate(ctx context.Context, cli client.Reader, key string, kd types.CapType) (*Template, error) {
-	// Application Controller only load template from ComponentDefinition and TraitDefinition
-	// nolint:exhaustive
-	switch kd {
-	case types.TypeComponentDefinition:
-		var schematic *v1alpha2.Schematic
-		var status *v1alpha2.Status
-		var extension *runtime.RawExtension
-
-		cd := new(v1alpha2.ComponentDefinition)
-		err := GetDefinition(ctx, cli, cd, key)
-
-		switch kerrors.IsNotFound(err) {
-		// If ComponentDefinition is not found, find the workloadDefinition with the same name.
-		case true:
-			wd := new(v1alpha2.WorkloadDefinition)
-			if err := GetDefinition(ctx, cli, wd, key); err != nil {
-				return nil, errors.WithMessagef(err, "LoadTemplate from WorkloadDefinition [%s] ", key)
-			}
-			schematic, status, extension = wd.Spec.Schematic, wd.Spec.Status, wd.Spec.Extension
-		case false:
-			if err != nil {
-				return nil, errors.WithMessagef(err, "LoadTemplate from ComponentDefinition [%s] ", key)
-			}
-			schematic, status, extension = cd.Spec.Schematic, cd.Spec.Status, cd.Spec.Extension
-		}
+// TemplateErrorPosition is a CUE error in the template
+type TemplateErrorPosition struct {
+	// File is the name of the file of the error if the template is split into files, see v1alpha2.CUEFile.
+	// It's empty for errors in schematic.cue.template.
+	File string
+	// Line and Column are 1-based, they are 0 if the error has no position in the template
+	Line    int
+	Column  int
+	Message string
+	// Snippet is the offending line of the template with a caret under the column
+	Snippet string
+}
 
-		tmpl, err := NewTemplate(schematic, status, extension)
-		if err != nil {
-			return nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
-		}
-		if tmpl == nil {
-			return nil, errors.New("no template found in definition")
+func (e *TemplateParseError) Error() string {
+	var msgs []string
+	for _, pos := range e.Errors {
+		switch {
+		case pos.Line == 0:
+			msgs = append(msgs, pos.Message)
+		case pos.File != "":
+			msgs = append(msgs, fmt.Sprintf("file %s, line %d, column %d: %s", pos.File, pos.Line, pos.Column, pos.Message))
+		default:
+			msgs = append(msgs, fmt.Sprintf("line %d, column %d: %s", pos.Line, pos.Column, pos.Message))
 		}
-		tmpl.Reference = cd.Spec.Workload.Definition
-		if cd.Annotations["type"] == string(types.TerraformCategory) {
-			tmpl.CapabilityCategory = types.TerraformCategory
-		}
-		return tmpl, nil
+	}
+	return fmt.Sprintf("invalid CUE template: %s", strings.Join(msgs, "; "))
+}
 
-	case types.TypeTrait:
-		td := new(v1alpha2.TraitDefinition)
-		err := GetDefinition(ctx, cli, td, key)
-		if err != nil {
-			return nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+// newTemplateParseError converts the CUE errors of the template to a TemplateParseError
+func newTemplateParseError(templateStr string, err error) *TemplateParseError {
+	return newTemplateFilesParseError(map[string]string{mainTemplateFile: templateStr}, err)
+}
+
+// newTemplateFilesParseError converts the CUE errors of the files of a template by name to a TemplateParseError
+func newTemplateFilesParseError(files map[string]string, err error) *TemplateParseError {
+	parseErr := &TemplateParseError{}
+	for _, e := range cueerrors.Errors(err) {
+		position := TemplateErrorPosition{Message: e.Error()}
+		// errors may also be located in the base context added to the template
+		if pos := e.Position(); pos.IsValid() {
+			if src, ok := files[pos.Filename()]; ok {
+				if pos.Filename() != mainTemplateFile {
+					position.File = pos.Filename()
+				}
+				position.Line, position.Column = pos.Line(), pos.Column()
+				if lines := strings.Split(src, "\n"); position.Line <= len(lines) {
+					position.Snippet = renderSnippet(lines[position.Line-1], position.Line, position.Column)
+				}
+			}
 		}
-		var capabilityCategory types.CapabilityCategory
-		if td.Annotations["type"] == string(types.TerraformCategory) {
-			capabilityCategory = types.TerraformCategory
+		parseErr.Errors = append(parseErr.Errors, position)
+	}
+	return parseErr
+}
+
+// renderSnippet renders the line with its number, and a caret under the column
+func renderSnippet(line string, lineNum, column int) string {
+	prefix := fmt.Sprintf("%d | ", lineNum)
+	caret := []rune(strings.Repeat(" ", len(prefix)-2) + "| ")
+	for i, r := range line {
+		if i >= column-1 {
+			break
 		}
-		tmpl, err := NewTemplate(td.Spec.Schematic, td.Spec.Status, td.Spec.Extension)
-		if err != nil {
-			return nil, errors.WithMessagef(err, "LoadTemplate [%s] ", key)
+		// keep tabs to align the caret with the column
+		if r == '\t' {
+			caret = append(caret, '\t')
+		} else {
+			caret = append(caret, ' ')
 		}
-		if tmpl == nil {
-			return nil, errors.New("no template found in definition")
+	}
+	return prefix + line + "\n" + string(caret) + "^"
+}
+
+// ValidateTemplate compiles the CUE template, the health policy and the custom status of the template,
+// so that broken ones are reported before they're evaluated, e.g. by an admission webhook.
+// Empty ones are valid. The health policy must define isHealth and the custom status must define message.
+func ValidateTemplate(tmpl *Template) error {
+	if tmpl.TemplateStr != "" {
+		if err := validateCUETemplate(nil, tmpl.TemplateStr, tmpl.Imports); err != nil {
+			return tmpl.withCapabilityName(err)
 		}
-		tmpl.CapabilityCategory = capabilityCategory
-		return tmpl, nil
-	case types.TypeScope:
-		// TODO: add scope template support
 	}
-	return nil, fmt.Errorf("kind(%s) of %s not supported", kd, key)
+	if err := validateStatusTemplate(tmpl.Health, "isHealth"); err != nil {
+		return tmpl.withCapabilityName(errors.WithMessage(err, "invalid health policy"))
+	}
+	if err := validateStatusTemplate(tmpl.CustomStatus, "message"); err != nil {
+		return tmpl.withCapabilityName(errors.WithMessage(err, "invalid custom status"))
+	}
+	return nil
 }
 
-// NewTemplate will create template for inner AbstractEngine using.
-func NewTemplate(schematic *v1alpha2.Schematic, status *v1alpha2.Status, raw *runtime.RawExtension) (*Template, error) {
-	tmp := &Template{}
+// validateStatusTemplate compiles the health policy or custom status which must define the field,
+// the context is left open since it's only filled in when the status is evaluated.
+func validateStatusTemplate(templateStr, field string) error {
+	if templateStr == "" {
+		return nil
+	}
+	bi := build.NewContext().NewInstance("", nil)
+	if err := bi.AddFile("-", templateStr); err != nil {
+		return newTemplateParseError(templateStr, err)
+	}
+	if err := bi.AddFile("context", "context: _\n"); err != nil {
+		return err
+	}
+	var r cue.Runtime
+	inst, err := r.Build(bi)
+	if err != nil {
+		return newTemplateParseError(templateStr, err)
+	}
+	if !inst.Lookup(field).Exists() {
+		return errors.Errorf("%s is not defined", field)
+	}
+	return nil
+}
+
+// validateCUETemplate compiles the template with the base context provided by KubeVela, it returns
+// an *ErrImportUnresolved if an imported package isn't resolved, or a *TemplateParseError with the positions of the CUE errors.
+func validateCUETemplate(r *cue.Runtime, templateStr string, imports map[string]map[string]string) error {
+	if err := checkImportsResolved(templateStr, imports); err != nil {
+		return err
+	}
+	if _, err := buildCUETemplate(r, templateStr, imports); err != nil {
+		return newTemplateParseError(templateStr, err)
+	}
+	return nil
+}
+
+// buildCUETemplate builds the template with the base context provided by KubeVela,
+// the template and the context are added as separate files to keep the positions of errors.
+// A nil runtime builds the template with a new runtime.
+func buildCUETemplate(r *cue.Runtime, templateStr string, imports map[string]map[string]string) (*cue.Instance, error) {
+	bctx := build.NewContext()
+	bi := bctx.NewInstance("", importLoader(bctx, imports))
+	if err := bi.AddFile("-", templateStr); err != nil {
+		return nil, err
+	}
+	if err := bi.AddFile("context", mycue.BaseTemplate); err != nil {
+		return nil, err
+	}
+	if r == nil {
+		r = &cue.Runtime{}
+	}
+	return r.Build(bi)
+}
+
+// BuildCUEInstance compiles the CUE template with its imports and the base template of the context,
+// so that it can be filled and rendered outside of this package
+func (t *Template) BuildCUEInstance() (*cue.Instance, error) {
+	return buildCUETemplate(nil, t.TemplateStr, t.Imports)
+}
+
+// ParseTerraformConfiguration parses the Terraform JSON configuration in the output of a CUE template.
+// Values which depend on parameters are not required to be concrete.
+func ParseTerraformConfiguration(templateStr string) (*TerraformConfiguration, error) {
+	return parseTerraformConfiguration(templateStr, nil)
+}
+
+// parseTerraformConfiguration parses the Terraform configuration of a CUE template with the imported packages
+func parseTerraformConfiguration(templateStr string, imports map[string]map[string]string) (*TerraformConfiguration, error) {
+	inst, err := buildCUETemplate(nil, templateStr, imports)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse terraform configuration")
+	}
+	output := inst.Lookup("output")
+	conf := &TerraformConfiguration{ModuleSources: map[string]string{}}
+
+	if err := iterateFields(output.Lookup("module"), func(name string, v cue.Value) {
+		conf.ModuleSources[name], _ = v.Lookup("source").String()
+	}); err != nil {
+		return nil, errors.Wrap(err, "parse terraform modules")
+	}
+	if err := iterateFields(output.Lookup("variable"), func(name string, v cue.Value) {
+		variable := TerraformVariable{Name: name, Required: !v.Lookup("default").Exists()}
+		variable.Description, _ = v.Lookup("description").String()
+		conf.Variables = append(conf.Variables, variable)
+	}); err != nil {
+		return nil, errors.Wrap(err, "parse terraform variables")
+	}
+	if err := iterateFields(output.Lookup("output"), func(name string, _ cue.Value) {
+		conf.Outputs = append(conf.Outputs, name)
+	}); err != nil {
+		return nil, errors.Wrap(err, "parse terraform outputs")
+	}
+	if conf.Backend, err = parseTerraformBackend(output.Lookup("terraform", "backend")); err != nil {
+		return nil, errors.WithMessage(err, "parse terraform backend")
+	}
+	return conf, nil
+}
+
+// parseTerraformBackend parses the backend block of a Terraform configuration, it returns nil if there's no backend
+func parseTerraformBackend(v cue.Value) (*TerraformBackend, error) {
+	var backends []*TerraformBackend
+	var ierr error
+	if err := iterateFields(v, func(name string, settings cue.Value) {
+		backend := &TerraformBackend{Type: name}
+		ierr = iterateFields(settings, func(key string, setting cue.Value) {
+			var value interface{}
+			if setting.IsConcrete() && setting.Decode(&value) == nil {
+				if backend.Config == nil {
+					backend.Config = map[string]interface{}{}
+				}
+				backend.Config[key] = value
+			}
+		})
+		backends = append(backends, backend)
+	}); err != nil {
+		return nil, err
+	}
+	if ierr != nil {
+		return nil, ierr
+	}
+	switch len(backends) {
+	case 0:
+		return nil, nil
+	case 1:
+		return backends[0], nil
+	}
+	return nil, errors.Errorf("only one backend can be declared, but got %d", len(backends))
+}
+
+// iterateFields calls fn for each field of a struct value, it does nothing if the value doesn't exist
+func iterateFields(v cue.Value, fn func(name string, v cue.Value)) error {
+	if !v.Exists() {
+		return nil
+	}
+	it, err := v.Fields()
+	if err != nil {
+		return err
+	}
+	for it.Next() {
+		fn(it.Label(), it.Value())
+	}
+	return nil
+}
 
+// newStatusTemplate creates a template with only the health policy and custom status
+func newStatusTemplate(status *v1alpha2.Status) *Template {
+	tmp := &Template{}
 	if status != nil {
 		tmp.CustomStatus = status.CustomStatus
 		tmp.Health = status.HealthPolicy
+		tmp.StatusDetails = statusDetailsOf(status.CustomStatus)
 	}
+	return tmp
+}
+
+// newTemplate returns the partially populated template with the error if the schematic can't be parsed
+func newTemplate(schematic *v1alpha2.Schematic, status *v1alpha2.Status, raw *runtime.RawExtension, extensionKey string) (*Template, error) {
+	tmp := newStatusTemplate(status)
 	if schematic != nil {
 		if schematic.CUE != nil {
-			tmp.TemplateStr = schematic.CUE.Template
+			var templateStr string
+			var err error
+			if len(schematic.CUE.Files) > 0 {
+				templateStr, err = cueTemplateOfFiles(schematic.CUE)
+			} else {
+				templateStr, err = DecodeTemplate(schematic.CUE.Template)
+			}
+			if err != nil {
+				return tmp, err
+			}
+			tmp.TemplateStr = templateStr
 			// CUE module has highest priority
 			// no need to check other schematic types
 			return tmp, nil
@@ -123,6 +1365,12 @@ func NewTemplate(schematic *v1alpha2.Schematic, status *v1alpha2.Status, raw *ru
 		if schematic.HELM != nil {
 			tmp.Helm = schematic.HELM
 			tmp.CapabilityCategory = types.HelmCategory
+			tmp.HelmValues = getHelmReleaseValues(schematic.HELM)
+			return tmp, nil
+		}
+		if schematic.KUSTOMIZE != nil {
+			tmp.Kustomize = schematic.KUSTOMIZE
+			tmp.CapabilityCategory = types.KustomizeCategory
 			return tmp, nil
 		}
 	}
@@ -130,34 +1378,531 @@ func NewTemplate(schematic *v1alpha2.Schematic, status *v1alpha2.Status, raw *ru
 	extension := map[string]interface{}{}
 	if tmp.TemplateStr == "" && raw != nil {
 		if err := json.Unmarshal(raw.Raw, &extension); err != nil {
-			return nil, err
+			return tmp, err
 		}
-		if extTemplate, ok := extension["template"]; ok {
+		if extTemplate, ok := extension[extensionKey]; ok {
 			if tmpStr, ok := extTemplate.(string); ok {
 				tmp.TemplateStr = tmpStr
+				deprecated := deprecatedExtensionTemplate
+				deprecated.Field = "spec.extension." + extensionKey
+				tmp.Deprecations = append(tmp.Deprecations, deprecated)
 			}
 		}
 	}
 	return tmp, nil
 }
 
+// getHelmReleaseValues gets the chart values from the HelmRelease of a Helm schematic. It returns nil if the release
+// has no values or they can't be parsed, the release is left to be validated when it's rendered and applied,
+// so that loading the template never fails on it.
+func getHelmReleaseValues(helm *v1alpha2.Helm) map[string]interface{} {
+	if len(helm.Release.Raw) == 0 {
+		return nil
+	}
+	releaseSpec := &helmapi.HelmReleaseSpec{}
+	if err := json.Unmarshal(helm.Release.Raw, releaseSpec); err != nil || releaseSpec.Values == nil {
+		return nil
+	}
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(releaseSpec.Values.Raw, &values); err != nil {
+		return nil
+	}
+	return values
+}
+
+// EvaluateHealth evaluates the health policy of the template, templateContext is filled in as the context
+// which the policy checks, e.g. the observed resources with status under "output" and "outputs".
+// A template without health policy is assumed to be healthy.
+func (t *Template) EvaluateHealth(ctx context.Context, templateContext map[string]interface{}) (bool, error) {
+	if t.Health == "" {
+		return true, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	bt, err := json.Marshal(templateContext)
+	if err != nil {
+		return false, errors.WithMessage(err, "json marshal template context")
+	}
+	var r cue.Runtime
+	inst, err := r.Compile("-", "context: "+string(bt)+"\n"+t.Health)
+	if err != nil {
+		return false, errors.WithMessage(err, "compile health template")
+	}
+	healthy, err := inst.Lookup("isHealth").Bool()
+	if err != nil {
+		return false, errors.WithMessage(err, "evaluate health status")
+	}
+	return healthy, nil
+}
+
+// RenderCustomStatus renders the message of the custom status of the template with the given template context,
+// it returns an empty message if the template has no custom status.
+func (t *Template) RenderCustomStatus(ctx context.Context, templateContext map[string]interface{}) (string, error) {
+	if t.CustomStatus == "" {
+		return "", nil
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	bt, err := json.Marshal(templateContext)
+	if err != nil {
+		return "", t.withCapabilityName(errors.WithMessage(err, "json marshal template context"))
+	}
+	var r cue.Runtime
+	inst, err := r.Compile("-", "context: "+string(bt)+"\n"+t.CustomStatus)
+	if err != nil {
+		return "", t.withCapabilityName(errors.WithMessage(err, "compile customStatus template"))
+	}
+	message, err := inst.Lookup("message").String()
+	if err != nil {
+		return "", t.withCapabilityName(errors.WithMessage(err, "evaluate customStatus.message"))
+	}
+	return message, nil
+}
+
+// ParameterDefaults returns the default values of the parameter of the template, e.g. `replicas: *1 | int`,
+// nested parameters are returned as nested maps. It returns an empty map if the template has no parameter.
+func (t *Template) ParameterDefaults() (map[string]interface{}, error) {
+	defaults := map[string]interface{}{}
+	if t.TemplateStr == "" {
+		return defaults, nil
+	}
+	inst, err := buildCUETemplate(nil, t.TemplateStr, t.Imports)
+	if err != nil {
+		return nil, t.withCapabilityName(errors.WithMessage(err, "compile template"))
+	}
+	if err := collectDefaults(inst.Lookup("parameter"), defaults); err != nil {
+		return nil, t.withCapabilityName(errors.WithMessage(err, "evaluate parameter defaults"))
+	}
+	return defaults, nil
+}
+
+// HasParameters returns true if the CUE template has a parameter with at least one field, templates which render
+// fixed resources have no parameters. It returns false if the template can't be compiled.
+func (t *Template) HasParameters() bool {
+	if !t.IsCUE() {
+		return false
+	}
+	inst, err := buildCUETemplate(nil, t.TemplateStr, t.Imports)
+	if err != nil {
+		return false
+	}
+	var fields int
+	if err := iterateFields(inst.Lookup("parameter"), func(string, cue.Value) { fields++ }); err != nil {
+		return false
+	}
+	return fields > 0
+}
+
+// DefaultedFields returns the paths of the parameter fields with defaults in the template, e.g. "env.debug" for
+// `env: debug: *false | bool`, sorted. Controllers may leave these fields unset if the server defaults them anyway,
+// so that server-side apply doesn't see spurious differences. It returns nil if the template has no parameter.
+func (t *Template) DefaultedFields() ([]string, error) {
+	if t.TemplateStr == "" {
+		return nil, nil
+	}
+	inst, err := buildCUETemplate(nil, t.TemplateStr, t.Imports)
+	if err != nil {
+		return nil, t.withCapabilityName(errors.WithMessage(err, "compile template"))
+	}
+	var paths []string
+	if err := collectDefaultedFields(inst.Lookup("parameter"), "", &paths); err != nil {
+		return nil, t.withCapabilityName(errors.WithMessage(err, "evaluate parameter defaults"))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// collectDefaultedFields collects the paths of the fields of a struct with defaults, like collectDefaults
+func collectDefaultedFields(v cue.Value, prefix string, paths *[]string) error {
+	var ierr error
+	err := iterateFields(v, func(name string, field cue.Value) {
+		if ierr != nil {
+			return
+		}
+		if _, ok := field.Default(); ok {
+			*paths = append(*paths, prefix+name)
+			return
+		}
+		if field.IncompleteKind() == cue.StructKind {
+			ierr = collectDefaultedFields(field, prefix+name+".", paths)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return ierr
+}
+
+// collectDefaults collects the default values of the fields of a struct into defaults
+func collectDefaults(v cue.Value, defaults map[string]interface{}) error {
+	var ierr error
+	err := iterateFields(v, func(name string, field cue.Value) {
+		if ierr != nil {
+			return
+		}
+		if d, ok := field.Default(); ok {
+			var value interface{}
+			if ierr = d.Decode(&value); ierr != nil {
+				ierr = errors.WithMessagef(ierr, "decode default of %s", name)
+			}
+			defaults[name] = value
+			return
+		}
+		if field.IncompleteKind() == cue.StructKind {
+			nested := map[string]interface{}{}
+			if ierr = collectDefaults(field, nested); ierr == nil && len(nested) > 0 {
+				defaults[name] = nested
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return ierr
+}
+
+// pinnedChartVersion matches an exact semantic version, rather than a range like "1.x" or ">=1.0.0"
+var pinnedChartVersion = regexp.MustCompile(`^v?\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// ParameterValidationError reports the invalid values of the parameter of a template
+type ParameterValidationError struct {
+	Errors []ParameterError
+}
+
+// ParameterError is an invalid parameter value, Path is the path of the field separated by dot, e.g. "env.name"
+type ParameterError struct {
+	Path    string
+	Message string
+}
+
+func (e *ParameterValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, pe := range e.Errors {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", pe.Path, pe.Message))
+	}
+	return fmt.Sprintf("invalid parameters: %s", strings.Join(msgs, "; "))
+}
+
+// ValidateParameters unifies the parameter values set by user with the parameter of the template, and reports
+// missing required fields, type mismatches and constraint violations as a *ParameterValidationError,
+// which is wrapped with the name of the capability if it's known. Values of the fields not defined in the parameter are not validated.
+func ValidateParameters(tmpl *Template, params map[string]interface{}) error {
+	if tmpl.TemplateStr == "" {
+		return nil
+	}
+	inst, err := buildCUETemplate(nil, tmpl.TemplateStr, tmpl.Imports)
+	if err != nil {
+		return tmpl.withCapabilityName(errors.WithMessage(err, "compile template"))
+	}
+	parameter := inst.Lookup("parameter")
+	if !parameter.Exists() {
+		return nil
+	}
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	err = parameter.Fill(params).Validate(cue.Concrete(true))
+	if err == nil {
+		return nil
+	}
+	return tmpl.withCapabilityName(newParameterValidationError(err))
+}
+
+// newParameterValidationError converts the CUE errors of validating the parameter to a *ParameterValidationError
+// sorted by the paths of the fields
+func newParameterValidationError(err error) *ParameterValidationError {
+	validationErr := &ParameterValidationError{}
+	for _, e := range cueerrors.Errors(err) {
+		path := e.Path()
+		if len(path) > 0 && path[0] == "parameter" {
+			path = path[1:]
+		}
+		format, args := e.Msg()
+		msg := fmt.Sprintf(format, args...)
+		if strings.HasPrefix(msg, "incomplete value ") {
+			msg = "missing required value " + strings.TrimPrefix(msg, "incomplete value ")
+		}
+		validationErr.Errors = append(validationErr.Errors, ParameterError{Path: strings.Join(path, "."), Message: msg})
+	}
+	sort.SliceStable(validationErr.Errors, func(i, j int) bool {
+		return validationErr.Errors[i].Path < validationErr.Errors[j].Path
+	})
+	return validationErr
+}
+
+// requiredTraits returns the trait types listed in AnnotationRequiredTraits, it's nil if none is listed
+func requiredTraits(annotations map[string]string) []string {
+	var traits []string
+	for _, trait := range strings.Split(annotations[AnnotationRequiredTraits], ",") {
+		if trait = strings.TrimSpace(trait); trait != "" {
+			traits = append(traits, trait)
+		}
+	}
+	return traits
+}
+
+// ValidateRequiredTraits returns an error listing the required traits of the template which aren't
+// in traitTypes, the types of traits of a component, it's wrapped with the name of the capability if it's known.
+func ValidateRequiredTraits(tmpl *Template, traitTypes []string) error {
+	present := make(map[string]bool, len(traitTypes))
+	for _, t := range traitTypes {
+		present[t] = true
+	}
+	var missing []string
+	for _, t := range tmpl.RequiredTraits {
+		if !present[t] {
+			missing = append(missing, t)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return tmpl.withCapabilityName(errors.Errorf("missing required traits: %s", strings.Join(missing, ", ")))
+}
+
+// AppliesTo returns true if the trait template applies to the workload of the type, i.e. the name of its definition,
+// and the resource, e.g. "deployments.apps" returned by WorkloadTypeName. A trait applies to any workload if
+// AppliesToWorkloads is empty or has "*", and to the workloads of a group by "*.<group>", e.g. "*.apps".
+func (t *Template) AppliesTo(workloadType, resource string) bool {
+	if len(t.AppliesToWorkloads) == 0 {
+		return true
+	}
+	group := schema.ParseGroupResource(resource).Group
+	for _, applyTo := range t.AppliesToWorkloads {
+		switch {
+		case applyTo == "*":
+			return true
+		case strings.HasPrefix(applyTo, "*."):
+			if group == applyTo[2:] {
+				return true
+			}
+		case applyTo == workloadType || applyTo == resource:
+			return true
+		}
+	}
+	return false
+}
+
+// ErrNoWorkloadType is returned by WorkloadTypeName if the template has no workload reference, e.g. of Helm or Terraform
+var ErrNoWorkloadType = errors.New("template has no workload type")
+
+// WorkloadTypeName resolves the workload reference of the template by the discovery mapper and returns it as
+// resource.group for display, e.g. "deployments.apps" for apps/v1 Deployment. It returns ErrNoWorkloadType if
+// the template has no workload reference.
+func (t *Template) WorkloadTypeName(dm discoverymapper.DiscoveryMapper) (string, error) {
+	if t.Reference.APIVersion == "" || t.Reference.Kind == "" {
+		return "", ErrNoWorkloadType
+	}
+	definition, err := ConvertWorkloadGVK2Definition(dm, t.Reference)
+	if err != nil {
+		return "", t.withCapabilityName(errors.WithMessagef(err, "resolve workload %s %s", t.Reference.APIVersion, t.Reference.Kind))
+	}
+	return definition.Name, nil
+}
+
+// IsCUE returns true if the template is rendered from its CUE template, i.e. it has no Helm, Kustomize or Terraform schematic
+func (t *Template) IsCUE() bool {
+	return t.TemplateStr != "" && !t.IsHelm() && !t.IsKustomize() && !t.IsTerraform()
+}
+
+// IsHelm returns true if the template has a Helm schematic
+func (t *Template) IsHelm() bool {
+	return t.Helm != nil
+}
+
+// IsKustomize returns true if the template has a Kustomize schematic
+func (t *Template) IsKustomize() bool {
+	return t.Kustomize != nil
+}
+
+// IsTerraform returns true if the template is of a Terraform definition and its Terraform configuration is parsed
+func (t *Template) IsTerraform() bool {
+	return t.CapabilityCategory == types.TerraformCategory && t.Terraform != nil
+}
+
+// HelmChartPinned returns true if the chart in the HelmRelease of the template is pinned to an exact version,
+// a chart without version or with a version range is resolved to the latest matching version when rendering.
+// It returns false for templates without Helm schematic.
+func (t *Template) HelmChartPinned() bool {
+	if !t.IsHelm() {
+		return false
+	}
+	chart, err := getHelmChart(t.Helm)
+	if err != nil {
+		return false
+	}
+	return pinnedChartVersion.MatchString(strings.TrimSpace(chart.Version))
+}
+
+// templateHashContent are the fields of a template which the rendered resources depend on
+type templateHashContent struct {
+	TemplateStr        string
+	Health             string
+	CustomStatus       string
+	CapabilityCategory types.CapabilityCategory
+	Reference          v1alpha2.WorkloadGVK
+	Helm               v1alpha2.Helm
+	Terraform          TerraformConfiguration
+	Imports            map[string]map[string]string
+}
+
+// Hash returns a hash of the content of the template, including the template, health policy, custom status,
+// category, workload reference, Helm, Kustomize and Terraform specifics and imports. It's deterministic for the same content,
+// so it can be stored in status and compared on reconcile to find out if a component needs to be rendered again.
+func (t *Template) Hash() string {
+	hasher := fnv.New64a()
+	content := templateHashContent{
+		TemplateStr:        t.TemplateStr,
+		Health:             t.Health,
+		CustomStatus:       t.CustomStatus,
+		CapabilityCategory: t.CapabilityCategory,
+		Reference:          t.Reference,
+		Imports:            t.Imports,
+	}
+	// pointers are dereferenced, spew prints their addresses
+	if t.Helm != nil {
+		content.Helm = *t.Helm
+	}
+	if t.Terraform != nil {
+		content.Terraform = *t.Terraform
+	}
+	DeepHashObject(hasher, content)
+	// written separately to keep the hashes of the other templates unchanged
+	if t.Kustomize != nil {
+		_, _ = hasher.Write([]byte("kustomize:"))
+		_, _ = hasher.Write(t.Kustomize.Spec.Raw)
+	}
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum64()))
+}
+
+// withCapabilityName adds the capability name to the error if the template has one
+func (t *Template) withCapabilityName(err error) error {
+	if t.Name == "" {
+		return err
+	}
+	return errors.WithMessagef(err, "capability %s", t.Name)
+}
+
+// ToCapability converts the loaded template to the capability named name for listing, it's the inverse of
+// ConvertTemplateJSON2Object without reading the definition again. The CUE template of a Terraform capability is its
+// Terraform configuration. The chart of a Helm capability is omitted if its repository can't be parsed.
+func (t *Template) ToCapability(name string) types.Capability {
+	c := types.Capability{
+		Name:        name,
+		Namespace:   t.Namespace,
+		Category:    t.CapabilityCategory,
+		CueTemplate: t.TemplateStr,
+	}
+	if t.IsHelm() {
+		if chart, err := getHelmChart(t.Helm); err == nil {
+			chart.Values = t.HelmValues
+			c.Helm = chart
+		}
+	}
+	return c
+}
+
+// MaxExtensionSize is the max size in bytes of the spec.extension parsed by ConvertTemplateJSON2Object
+const MaxExtensionSize = 1 << 20
+
+// ConvertOption customizes how ConvertTemplateJSON2Object parses spec.extension
+type ConvertOption func(*convertOptions)
+
+type convertOptions struct {
+	disallowUnknownFields bool
+}
+
+// DisallowUnknownExtensionFields makes ConvertTemplateJSON2Object return an error if spec.extension has fields
+// which aren't fields of the capability, they are ignored by default.
+func DisallowUnknownExtensionFields() ConvertOption {
+	return func(o *convertOptions) {
+		o.disallowUnknownFields = true
+	}
+}
+
 // ConvertTemplateJSON2Object convert spec.extension to object
-func ConvertTemplateJSON2Object(capabilityName string, in *runtime.RawExtension, schematic *v1alpha2.Schematic) (types.Capability, error) {
+// The extension may come from untrusted definitions, it's rejected if it's larger than MaxExtensionSize or
+// isn't a single JSON object, and errors are reported with the name of the capability and the offset in the extension.
+func ConvertTemplateJSON2Object(capabilityName string, in *runtime.RawExtension, schematic *v1alpha2.Schematic, opts ...ConvertOption) (types.Capability, error) {
+	options := &convertOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
 	var t types.Capability
 	t.Name = capabilityName
+	if in != nil && in.Raw != nil {
+		if err := decodeExtension(in.Raw, &t, options); err != nil {
+			return t, errors.WithMessagef(err, "parse extension of capability %s", capabilityName)
+		}
+	}
 	capTemplate, err := NewTemplate(schematic, nil, in)
 
 	if err != nil {
 		return t, errors.Wrapf(err, "parse cue template")
 	}
-	if in != nil && in.Raw != nil {
-		err := json.Unmarshal(in.Raw, &t)
-		if err != nil {
-			return t, errors.Wrapf(err, "parse extension fail")
-		}
-	}
 	if capTemplate.TemplateStr != "" {
 		t.CueTemplate = capTemplate.TemplateStr
 	}
+	if capTemplate.IsHelm() {
+		chart, err := getHelmChart(capTemplate.Helm)
+		if err != nil {
+			return t, err
+		}
+		chart.Values = capTemplate.HelmValues
+		t.Helm = chart
+	}
 	return t, err
 }
+
+// decodeExtension decodes the raw extension, which must be a single JSON object, into the capability.
+// A null extension, e.g. an omitted one serialized by some clients, is taken as empty.
+func decodeExtension(raw []byte, c *types.Capability, options *convertOptions) error {
+	if len(raw) > MaxExtensionSize {
+		return errors.Errorf("extension of %d bytes exceeds the limit of %d bytes", len(raw), MaxExtensionSize)
+	}
+	trimmed := bytes.TrimSpace(raw)
+	if bytes.Equal(trimmed, []byte("null")) {
+		return nil
+	}
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return errors.New("extension is not a JSON object")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	if options.disallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(c); err != nil {
+		switch e := err.(type) {
+		case *json.SyntaxError:
+			return errors.Wrapf(err, "invalid JSON at offset %d", e.Offset)
+		case *json.UnmarshalTypeError:
+			return errors.Wrapf(err, "invalid value at offset %d", e.Offset)
+		}
+		return errors.Wrap(err, "invalid extension")
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("unexpected data after the extension object")
+	}
+	return nil
+}
+
+// getHelmChart gets the repository URL, name and version of the chart from a Helm schematic
+func getHelmChart(helm *v1alpha2.Helm) (*types.Chart, error) {
+	releaseSpec := &helmapi.HelmReleaseSpec{}
+	if err := json.Unmarshal(helm.Release.Raw, releaseSpec); err != nil {
+		return nil, errors.Wrap(err, "cannot parse helm release")
+	}
+	repoSpec := &helmapi.HelmRepositorySpec{}
+	if helm.Repository.Raw != nil {
+		if err := json.Unmarshal(helm.Repository.Raw, repoSpec); err != nil {
+			return nil, errors.Wrap(err, "cannot parse helm repository")
+		}
+	}
+	return &types.Chart{
+		URL:     repoSpec.URL,
+		Name:    releaseSpec.Chart.Spec.Chart,
+		Version: releaseSpec.Chart.Spec.Version,
+	}, nil
+}
@@ -0,0 +1,88 @@
+package util
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam"
+)
+
+// AnnotationDefinitionAlias lists the old names of a definition separated by comma,
+// templates requested by the old names are loaded from the definition.
+const AnnotationDefinitionAlias = "definition.oam.dev/alias"
+
+// definitionAliases returns the aliases in the annotations of a definition
+func definitionAliases(annotations map[string]string) []string {
+	var aliases []string
+	for _, alias := range strings.Split(annotations[AnnotationDefinitionAlias], ",") {
+		if alias = strings.TrimSpace(alias); alias != "" {
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases
+}
+
+// resolveDefinitionAlias returns the name of the definition of the template kind which has the alias,
+// it returns an empty name if there's no such definition.
+func resolveDefinitionAlias(ctx context.Context, cli client.Reader, alias string, kd TemplateKind, options *loadTemplateOptions) (string, error) {
+	var lists []runtime.Object
+	switch kd {
+	case ComponentTemplateKind:
+		lists = append(lists, &v1alpha2.ComponentDefinitionList{})
+		if !options.disableWorkloadFallback {
+			lists = append(lists, &v1alpha2.WorkloadDefinitionList{})
+		}
+	case TraitTemplateKind:
+		lists = append(lists, &v1alpha2.TraitDefinitionList{})
+	case ScopeTemplateKind:
+		lists = append(lists, &v1alpha2.ScopeDefinitionList{})
+	}
+	for _, list := range lists {
+		for _, ns := range options.searchNamespaces(ctx) {
+			if err := cli.List(ctx, list, client.InNamespace(ns)); err != nil {
+				return "", errors.Wrapf(err, "list definitions in namespace %s", ns)
+			}
+			items, err := meta.ExtractList(list)
+			if err != nil {
+				return "", err
+			}
+			for _, item := range items {
+				def, err := meta.Accessor(item)
+				if err != nil {
+					return "", err
+				}
+				for _, a := range definitionAliases(def.GetAnnotations()) {
+					if a == alias {
+						return def.GetName(), nil
+					}
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+// definitionNamespaces returns the namespaces to find definitions in, in the same order as GetDefinition
+func definitionNamespaces(ctx context.Context) []string {
+	var namespaces []string
+	for _, ns := range []string{os.Getenv(DefinitionNamespaceEnv), GetDefinitionNamespaceWithCtx(ctx), oam.SystemDefinitonNamespace} {
+		if ns == "" {
+			continue
+		}
+		duplicated := false
+		for _, n := range namespaces {
+			duplicated = duplicated || n == ns
+		}
+		if !duplicated {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
@@ -0,0 +1,67 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+func TestLoadTemplateWithAlias(t *testing.T) {
+	webservice := v1alpha2.ComponentDefinition{}
+	webservice.Name = "webservice"
+	webservice.Annotations = map[string]string{AnnotationDefinitionAlias: "web, webapp"}
+	webservice.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}}
+
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			switch o := obj.(type) {
+			case *v1alpha2.ComponentDefinition:
+				if key.Name == webservice.Name {
+					*o = webservice
+					return nil
+				}
+				return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: "componentdefinitions"}, key.Name)
+			case *v1alpha2.WorkloadDefinition:
+				return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: "workloaddefinitions"}, key.Name)
+			}
+			return nil
+		},
+		MockList: func(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+			if l, ok := list.(*v1alpha2.ComponentDefinitionList); ok {
+				l.Items = []v1alpha2.ComponentDefinition{webservice}
+			}
+			return nil
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+
+	tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "webservice", tmpl.Name)
+	assert.Equal(t, "", tmpl.Alias)
+
+	tmpl, source, err := LoadTemplateWithSource(context.TODO(), &tclient, dm, "webapp", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "webservice", tmpl.Name)
+	assert.Equal(t, "webapp", tmpl.Alias)
+	assert.Equal(t, "webservice", source.Name)
+
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "unknown", ComponentTemplateKind)
+	assert.True(t, kerrors.IsNotFound(errors.Cause(err)))
+}
+
+func TestDefinitionAliases(t *testing.T) {
+	assert.Nil(t, definitionAliases(nil))
+	assert.Equal(t, []string{"web", "webapp"}, definitionAliases(map[string]string{AnnotationDefinitionAlias: " web,,webapp "}))
+}
@@ -0,0 +1,133 @@
+package util
+
+import (
+	"fmt"
+
+	"cuelang.org/go/cue"
+	"github.com/pkg/errors"
+)
+
+// parameterField is a field of the parameter of a template
+type parameterField struct {
+	value    cue.Value
+	optional bool
+}
+
+// required returns true if applications must set the field, i.e. it's neither optional nor defaulted
+func (f parameterField) required() bool {
+	if f.optional {
+		return false
+	}
+	_, ok := f.value.Default()
+	return !ok
+}
+
+// IsBreakingChange classifies the changes from the old template to the new one, e.g. of a definition updated while
+// applications reference it, by DiffTemplates. It returns true and the reasons if any change may break the
+// applications rendered by the old template, that is a changed category, a removed parameter, a new required
+// parameter, a parameter becoming required, a narrowed type or a changed default value. Other changes like new
+// optional parameters are compatible.
+func IsBreakingChange(oldTmpl, newTmpl *Template) (bool, []string, error) {
+	diff, err := DiffTemplates(oldTmpl, newTmpl)
+	if err != nil {
+		return false, nil, err
+	}
+	var reasons []string
+	if diff.Category != nil {
+		reasons = append(reasons, fmt.Sprintf("category changes from %q to %q", diff.Category.Old, diff.Category.New))
+	}
+	if len(diff.Parameters) == 0 {
+		return len(reasons) > 0, reasons, nil
+	}
+	oldFields, err := parameterFields(oldTmpl)
+	if err != nil {
+		return false, nil, errors.WithMessage(err, "old template")
+	}
+	newFields, err := parameterFields(newTmpl)
+	if err != nil {
+		return false, nil, errors.WithMessage(err, "new template")
+	}
+	for _, change := range diff.Parameters {
+		o, n := oldFields[change.Path], newFields[change.Path]
+		switch change.Type {
+		case ParameterRemoved:
+			reasons = append(reasons, fmt.Sprintf("parameter %s is removed", change.Path))
+		case ParameterAdded:
+			if n.required() {
+				reasons = append(reasons, fmt.Sprintf("required parameter %s is added", change.Path))
+			}
+		case ParameterChanged:
+			reasons = append(reasons, breakingParameterChanges(change.Path, o, n)...)
+		}
+	}
+	return len(reasons) > 0, reasons, nil
+}
+
+// breakingParameterChanges returns the reasons why the change of a parameter is breaking
+func breakingParameterChanges(path string, o, n parameterField) []string {
+	var reasons []string
+	if n.required() && !o.required() {
+		reasons = append(reasons, fmt.Sprintf("parameter %s becomes required", path))
+	}
+	oldKind, newKind := o.value.IncompleteKind(), n.value.IncompleteKind()
+	if oldKind&^newKind != 0 {
+		reasons = append(reasons, fmt.Sprintf("type of parameter %s changes from %s to %s", path, oldKind, newKind))
+	}
+	oldDefault, hasOldDefault := o.value.Default()
+	newDefault, hasNewDefault := n.value.Default()
+	if hasOldDefault && hasNewDefault {
+		oldValue, newValue := formatDefault(oldDefault), formatDefault(newDefault)
+		if oldValue != newValue {
+			reasons = append(reasons, fmt.Sprintf("default of parameter %s changes from %s to %s", path, oldValue, newValue))
+		}
+	}
+	return reasons
+}
+
+// formatDefault formats a default value as JSON, e.g. `"http"` or `1`
+func formatDefault(v cue.Value) string {
+	b, err := v.MarshalJSON()
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// parameterFields returns the fields of the parameter of the template by path, like parameterSchemas
+func parameterFields(t *Template) (map[string]parameterField, error) {
+	fields := map[string]parameterField{}
+	if t.TemplateStr == "" {
+		return fields, nil
+	}
+	inst, err := buildCUETemplate(nil, t.TemplateStr, t.Imports)
+	if err != nil {
+		return nil, errors.WithMessage(err, "compile template")
+	}
+	if err := collectParameterFields(inst.Lookup("parameter"), "", fields); err != nil {
+		return nil, errors.WithMessage(err, "parse parameter")
+	}
+	return fields, nil
+}
+
+// collectParameterFields collects the fields of a struct like collectParameterSchemas
+func collectParameterFields(v cue.Value, prefix string, fields map[string]parameterField) error {
+	if !v.Exists() {
+		return nil
+	}
+	it, err := v.Fields(cue.Optional(true))
+	if err != nil {
+		return err
+	}
+	for it.Next() {
+		path := prefix + it.Label()
+		field := it.Value()
+		if field.IncompleteKind() == cue.StructKind && hasFields(field) {
+			if err := collectParameterFields(field, path+".", fields); err != nil {
+				return err
+			}
+			continue
+		}
+		fields[path] = parameterField{value: field, optional: it.IsOptional()}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oam-dev/kubevela/apis/types"
+)
+
+func TestIsBreakingChange(t *testing.T) {
+	oldTmpl := &Template{Name: "webservice", CapabilityCategory: types.CUECategory, TemplateStr: `
+parameter: {
+	image:    string
+	replicas: *1 | int
+	port:     *80 | int
+	cmd?: [...string]
+	env: debug: *false | bool
+}
+output: {}`}
+
+	// new optional and defaulted parameters, a wider type
+	breaking, reasons, err := IsBreakingChange(oldTmpl, &Template{Name: "webservice", CapabilityCategory: types.CUECategory, TemplateStr: `
+parameter: {
+	image:    string
+	replicas: *1 | int
+	port:     *80 | int | string
+	cmd?: [...string]
+	env: {
+		debug: *false | bool
+		name?: string
+	}
+	cpu: *"0.5" | string
+}
+output: {}`})
+	assert.NoError(t, err)
+	assert.False(t, breaking)
+	assert.Empty(t, reasons)
+
+	breaking, reasons, err = IsBreakingChange(oldTmpl, &Template{Name: "webservice", CapabilityCategory: types.HelmCategory, TemplateStr: `
+parameter: {
+	image:    string
+	replicas: *3 | int
+	port:     string
+	cmd?: [...string]
+	memory: string
+}
+output: {}`})
+	assert.NoError(t, err)
+	assert.True(t, breaking)
+	assert.Equal(t, []string{
+		`category changes from "cue" to "helm"`,
+		"parameter env.debug is removed",
+		"required parameter memory is added",
+		"parameter port becomes required",
+		"type of parameter port changes from int to string",
+		"default of parameter replicas changes from 1 to 3",
+	}, reasons)
+
+	_, _, err = IsBreakingChange(oldTmpl, &Template{Name: "broken", TemplateStr: "parameter: {"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,515 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam"
+	"github.com/oam-dev/kubevela/pkg/oam/discoverymapper"
+)
+
+// CachingTemplateLoader keeps templates loaded by LoadTemplate in memory, so that reconciling
+// an application doesn't read the same definitions from the API server over and over again.
+// A cached template is served until the definition it's loaded from is invalidated with a
+// different resourceVersion, usually by the EventHandler added to the informers of definitions.
+// Templates loaded from the system definition namespace, or from cluster-scoped definitions, are shared by the
+// applications of all the namespaces which don't have definitions of the same name, once WarmCache has listed the
+// definitions, so that warmed templates are hit in every namespace.
+type CachingTemplateLoader struct {
+	opts []LoadTemplateOption
+
+	mu        sync.RWMutex
+	templates map[string]*cachedTemplate
+	// shared are the templates loaded from the system definition namespace or cluster-scoped definitions, by kind and key
+	shared map[string]*cachedTemplate
+	// local has the definitions outside the system definition namespace by "namespace/name", the names include
+	// the aliases and the definitions a definition is a variant of
+	local map[string]map[string]bool
+	// localListed is true once the definitions have been listed by WarmCache, so that local is complete
+	localListed bool
+}
+
+type cachedTemplate struct {
+	template *Template
+	source   *ResolvedDefinition
+	// deps are the other definitions which the template is built from, e.g. the parent definition it extends or
+	// the constituents of a composite trait, the template is dropped if any of them changes
+	deps []*ResolvedDefinition
+}
+
+func newCachedTemplate(tmpl *Template, source *ResolvedDefinition) *cachedTemplate {
+	cached := &cachedTemplate{template: tmpl, source: source}
+	var collect func(deps []*ResolvedDefinition)
+	collect = func(deps []*ResolvedDefinition) {
+		for _, dep := range deps {
+			cached.deps = append(cached.deps, dep)
+			collect(dep.Dependencies)
+		}
+	}
+	collect(source.Dependencies)
+	return cached
+}
+
+// loadedFrom returns true if the template is built from the definition, with a different resourceVersion if
+// changedOnly is true
+func (c *cachedTemplate) loadedFrom(def metav1.Object, changedOnly bool) bool {
+	for _, source := range append([]*ResolvedDefinition{c.source}, c.deps...) {
+		if source.Name == def.GetName() && source.Namespace == def.GetNamespace() &&
+			(!changedOnly || source.ResourceVersion != def.GetResourceVersion()) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewCachingTemplateLoader creates a CachingTemplateLoader with an empty cache, which loads every template
+// with the options, e.g. LoadWithFeatureGates
+func NewCachingTemplateLoader(opts ...LoadTemplateOption) *CachingTemplateLoader {
+	return &CachingTemplateLoader{
+		opts:      opts,
+		templates: map[string]*cachedTemplate{},
+		shared:    map[string]*cachedTemplate{},
+		local:     map[string]map[string]bool{},
+	}
+}
+
+// LoadTemplate has the same contract as LoadTemplate, but serves the template from cache if it's already loaded.
+// The returned template is shared with the cache and must not be modified.
+func (l *CachingTemplateLoader) LoadTemplate(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper, key string, kd TemplateKind) (*Template, error) {
+	// the same name may resolve to different definitions for applications in different namespaces
+	namespace := GetDefinitionNamespaceWithCtx(ctx)
+	cacheKey := string(kd) + "/" + namespace + "/" + key
+	sharedKey := string(kd) + "/" + key
+
+	l.mu.RLock()
+	cached, ok := l.templates[cacheKey]
+	if !ok && l.localListed && len(l.local[namespace+"/"+key]) == 0 {
+		// the namespace has no definition of the name, so it resolves to the same one as any other namespace
+		cached, ok = l.shared[sharedKey]
+	}
+	l.mu.RUnlock()
+	if ok {
+		return cached.template, nil
+	}
+
+	tmpl, source, err := LoadTemplateWithSource(ctx, cli, dm, key, kd, l.opts...)
+	if err != nil {
+		return nil, err
+	}
+	cached = newCachedTemplate(tmpl, source)
+	l.mu.Lock()
+	l.templates[cacheKey] = cached
+	if source.Namespace == "" || source.Namespace == oam.SystemDefinitonNamespace {
+		l.shared[sharedKey] = cached
+	}
+	l.mu.Unlock()
+	return tmpl, nil
+}
+
+// definitionNames returns the names by which the definition is resolved, i.e. its name, its aliases and the name
+// of the definition it's a variant of
+func definitionNames(def metav1.Object) []string {
+	names := append([]string{def.GetName()}, definitionAliases(def.GetAnnotations())...)
+	if variantOf := def.GetLabels()[LabelVariantOf]; variantOf != "" {
+		names = append(names, variantOf)
+	}
+	return names
+}
+
+// localNames returns the "namespace/name" by which the definition outside the system definition namespace
+// is resolved, or nil if it's in the system definition namespace or cluster-scoped
+func localNames(def metav1.Object) []string {
+	ns := def.GetNamespace()
+	if ns == "" || ns == oam.SystemDefinitonNamespace {
+		return nil
+	}
+	var names []string
+	for _, name := range definitionNames(def) {
+		names = append(names, ns+"/"+name)
+	}
+	return names
+}
+
+// addLocal adds the definition to local, the caller must hold l.mu
+func (l *CachingTemplateLoader) addLocal(def metav1.Object) {
+	// definitions of different kinds may have the same name
+	id := fmt.Sprintf("%T/%s", def, def.GetName())
+	for _, name := range localNames(def) {
+		if l.local[name] == nil {
+			l.local[name] = map[string]bool{}
+		}
+		l.local[name][id] = true
+	}
+}
+
+// templateKindOfDefinition returns the kind of template which is loaded from the definition
+func templateKindOfDefinition(def metav1.Object) (TemplateKind, bool) {
+	switch def.(type) {
+	case *v1alpha2.ComponentDefinition, *v1alpha2.WorkloadDefinition:
+		return ComponentTemplateKind, true
+	case *v1alpha2.TraitDefinition:
+		return TraitTemplateKind, true
+	case *v1alpha2.ScopeDefinition:
+		return ScopeTemplateKind, true
+	}
+	return "", false
+}
+
+// evict drops the cached templates of the kind of the definition which are loaded by any of the names, in every
+// namespace, since they may resolve to the definition now, e.g. a template loaded from the WorkloadDefinition
+// fallback before a ComponentDefinition of the same name is created. The caller must hold l.mu.
+func (l *CachingTemplateLoader) evict(def metav1.Object, names []string) {
+	kd, ok := templateKindOfDefinition(def)
+	if !ok || len(names) == 0 {
+		return
+	}
+	evicted := map[string]bool{}
+	for _, name := range names {
+		evicted[name] = true
+	}
+	for k := range l.templates {
+		// the key is "kind/namespace/name"
+		if parts := strings.SplitN(k, "/", 3); len(parts) == 3 && parts[0] == string(kd) && evicted[parts[2]] {
+			delete(l.templates, k)
+		}
+	}
+	for k := range l.shared {
+		// the key is "kind/name"
+		if parts := strings.SplitN(k, "/", 2); len(parts) == 2 && parts[0] == string(kd) && evicted[parts[1]] {
+			delete(l.shared, k)
+		}
+	}
+}
+
+// removeLocal removes the definition from local, the caller must hold l.mu
+func (l *CachingTemplateLoader) removeLocal(def metav1.Object) {
+	id := fmt.Sprintf("%T/%s", def, def.GetName())
+	for _, name := range localNames(def) {
+		delete(l.local[name], id)
+		if len(l.local[name]) == 0 {
+			delete(l.local, name)
+		}
+	}
+}
+
+// Invalidate drops the cached templates loaded from the given definition, or built from it like the templates of
+// the definitions extending it and the composite traits of it, if its resourceVersion has changed, they will be
+// read again on next load.
+func (l *CachingTemplateLoader) Invalidate(def metav1.Object) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, templates := range []map[string]*cachedTemplate{l.templates, l.shared} {
+		for k, cached := range templates {
+			if cached.loadedFrom(def, true) {
+				delete(templates, k)
+			}
+		}
+	}
+}
+
+// Forget drops the cached templates loaded from the given definition, or built from it, it should be called when
+// the definition is deleted.
+func (l *CachingTemplateLoader) Forget(def metav1.Object) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, templates := range []map[string]*cachedTemplate{l.templates, l.shared} {
+		for k, cached := range templates {
+			if cached.loadedFrom(def, false) {
+				delete(templates, k)
+			}
+		}
+	}
+}
+
+// EventHandler returns the handler of the events of definitions which invalidates the cached templates of the updated
+// definitions and forgets the ones of the deleted definitions, it also evicts the templates loaded by the names of the
+// added definitions and tracks the definitions outside the system definition namespace for sharing templates. It should be added to the informers of ComponentDefinitions,
+// WorkloadDefinitions and TraitDefinitions, so that edited definitions aren't served stale.
+func (l *CachingTemplateLoader) EventHandler() toolscache.ResourceEventHandler {
+	return toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if def, ok := obj.(metav1.Object); ok {
+				l.mu.Lock()
+				l.addLocal(def)
+				l.evict(def, definitionNames(def))
+				l.mu.Unlock()
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if def, ok := newObj.(metav1.Object); ok {
+				l.Invalidate(def)
+				if old, ok := oldObj.(metav1.Object); ok {
+					l.mu.Lock()
+					l.removeLocal(old)
+					l.addLocal(def)
+					l.evict(def, addedNames(old, def))
+					l.mu.Unlock()
+				}
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if def, ok := obj.(metav1.Object); ok {
+				l.Forget(def)
+				l.mu.Lock()
+				l.removeLocal(def)
+				l.mu.Unlock()
+			}
+		},
+	}
+}
+
+// addedNames returns the names which the updated definition is resolved by but the old one isn't, e.g. a new alias
+func addedNames(old, updated metav1.Object) []string {
+	oldNames := map[string]bool{}
+	for _, name := range definitionNames(old) {
+		oldNames[name] = true
+	}
+	var names []string
+	for _, name := range definitionNames(updated) {
+		if !oldNames[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// WarmCache loads the templates of all the ComponentDefinitions, WorkloadDefinitions and TraitDefinitions into the
+// loader, so that the first reconciles after the controller boots don't wait for reading definitions. Each template
+// is loaded in the namespace of its definition, the ones of the system definition namespace are then shared by all
+// the namespaces without definitions of the same name. It continues past the definitions which fail to load, and
+// returns an aggregated error of them, except the ones whose feature gates aren't enabled.
+// PolicyDefinitions aren't warmed as they're not supported yet.
+func WarmCache(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper, loader *CachingTemplateLoader) error {
+	var errs []error
+	listed := true
+	var all []metav1.Object
+	warm := func(kind string, kd TemplateKind, defs []metav1.Object) {
+		for _, def := range defs {
+			nsCtx := SetNamespaceInCtx(ctx, def.GetNamespace())
+			if _, err := loader.LoadTemplate(nsCtx, cli, dm, def.GetName(), kd); err != nil && !IsFeatureGated(err) {
+				errs = append(errs, errors.WithMessagef(err, "warm %s %s/%s", kind, def.GetNamespace(), def.GetName()))
+			}
+		}
+		all = append(all, defs...)
+	}
+
+	cds := &v1alpha2.ComponentDefinitionList{}
+	if err := cli.List(ctx, cds); err != nil {
+		listed = false
+		errs = append(errs, errors.Wrap(err, "list ComponentDefinitions"))
+	}
+	var defs []metav1.Object
+	for i := range cds.Items {
+		defs = append(defs, &cds.Items[i])
+	}
+	warm("ComponentDefinition", ComponentTemplateKind, defs)
+
+	wds := &v1alpha2.WorkloadDefinitionList{}
+	if err := cli.List(ctx, wds); err != nil {
+		listed = false
+		errs = append(errs, errors.Wrap(err, "list WorkloadDefinitions"))
+	}
+	defs = nil
+	for i := range wds.Items {
+		defs = append(defs, &wds.Items[i])
+	}
+	warm("WorkloadDefinition", ComponentTemplateKind, defs)
+
+	tds := &v1alpha2.TraitDefinitionList{}
+	if err := cli.List(ctx, tds); err != nil {
+		listed = false
+		errs = append(errs, errors.Wrap(err, "list TraitDefinitions"))
+	}
+	defs = nil
+	for i := range tds.Items {
+		defs = append(defs, &tds.Items[i])
+	}
+	warm("TraitDefinition", TraitTemplateKind, defs)
+
+	// templates are shared only if all the definitions are known, otherwise a namespace may have a definition
+	// of the name which isn't tracked
+	if listed {
+		loader.mu.Lock()
+		for _, def := range all {
+			loader.addLocal(def)
+		}
+		loader.localListed = true
+		loader.mu.Unlock()
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// ScopeGVKCache memoizes GetScopeGVK, so that the GVK of a scope isn't resolved by the discovery mapper
+// on every reconcile. The ScopeDefinition is still read on each call, which is served by the informer cache
+// of a manager, a cached GVK is used only if the resourceVersion of the definition is unchanged and it's not expired.
+// It's safe for concurrent use.
+type ScopeGVKCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu   sync.RWMutex
+	gvks map[string]*cachedScopeGVK
+}
+
+type cachedScopeGVK struct {
+	resourceVersion string
+	gvk             schema.GroupVersionKind
+	expireAt        time.Time
+}
+
+// NewScopeGVKCache creates a ScopeGVKCache whose GVKs expire after ttl
+func NewScopeGVKCache(ttl time.Duration) *ScopeGVKCache {
+	return &ScopeGVKCache{ttl: ttl, now: time.Now, gvks: map[string]*cachedScopeGVK{}}
+}
+
+// GetScopeGVK has the same contract as GetScopeGVK, but serves the GVK from cache if the definition is unchanged
+func (c *ScopeGVKCache) GetScopeGVK(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper, name string) (schema.GroupVersionKind, error) {
+	sd := new(v1alpha2.ScopeDefinition)
+	if err := getDefinitionWithTimeout(ctx, cli, sd, name); err != nil {
+		return schema.GroupVersionKind{}, err
+	}
+	cacheKey := sd.Namespace + "/" + sd.Name
+
+	c.mu.RLock()
+	cached, ok := c.gvks[cacheKey]
+	c.mu.RUnlock()
+	if ok && cached.resourceVersion == sd.ResourceVersion && c.now().Before(cached.expireAt) {
+		return cached.gvk, nil
+	}
+
+	gvk, err := scopeGVKOfDefinition(dm, sd, name)
+	if err != nil {
+		return gvk, err
+	}
+	c.mu.Lock()
+	c.gvks[cacheKey] = &cachedScopeGVK{resourceVersion: sd.ResourceVersion, gvk: gvk, expireAt: c.now().Add(c.ttl)}
+	c.mu.Unlock()
+	return gvk, nil
+}
+
+// Invalidate drops the cached GVK of the given ScopeDefinition, it should be called on the update or delete events of the definition
+func (c *ScopeGVKCache) Invalidate(def metav1.Object) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.gvks, def.GetNamespace()+"/"+def.GetName())
+}
+
+// Reset drops all the cached GVKs
+func (c *ScopeGVKCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gvks = map[string]*cachedScopeGVK{}
+}
+
+// CachingDiscoveryMapper wraps a DiscoveryMapper and memoizes the kinds and REST mappings it resolves for ttl,
+// so that resolving the GVKs of definitions, e.g. by GetScopeGVK, doesn't go through discovery on every reconcile.
+// Errors aren't cached, a cache miss is resolved by the wrapped mapper, which refreshes discovery on no match.
+// RefreshDiscovery should be called when CRDs are changed. It's safe for concurrent use.
+type CachingDiscoveryMapper struct {
+	discoverymapper.DiscoveryMapper
+	ttl time.Duration
+	now func() time.Time
+
+	mu       sync.RWMutex
+	kinds    map[schema.GroupVersionResource]*cachedKinds
+	mappings map[string]*cachedRESTMapping
+}
+
+type cachedKinds struct {
+	kinds    []schema.GroupVersionKind
+	expireAt time.Time
+}
+
+type cachedRESTMapping struct {
+	mapping  *meta.RESTMapping
+	expireAt time.Time
+}
+
+var _ discoverymapper.DiscoveryMapper = &CachingDiscoveryMapper{}
+
+// NewCachingDiscoveryMapper creates a CachingDiscoveryMapper of dm whose results expire after ttl
+func NewCachingDiscoveryMapper(dm discoverymapper.DiscoveryMapper, ttl time.Duration) *CachingDiscoveryMapper {
+	return &CachingDiscoveryMapper{
+		DiscoveryMapper: dm,
+		ttl:             ttl,
+		now:             time.Now,
+		kinds:           map[schema.GroupVersionResource]*cachedKinds{},
+		mappings:        map[string]*cachedRESTMapping{},
+	}
+}
+
+// KindsFor serves the kinds of the resource from cache, or resolves them by the wrapped mapper
+func (d *CachingDiscoveryMapper) KindsFor(input schema.GroupVersionResource) ([]schema.GroupVersionKind, error) {
+	d.mu.RLock()
+	cached, ok := d.kinds[input]
+	d.mu.RUnlock()
+	if ok && d.now().Before(cached.expireAt) {
+		return cached.kinds, nil
+	}
+	kinds, err := d.DiscoveryMapper.KindsFor(input)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	d.kinds[input] = &cachedKinds{kinds: kinds, expireAt: d.now().Add(d.ttl)}
+	d.mu.Unlock()
+	return kinds, nil
+}
+
+// RESTMapping serves the REST mapping of the kind from cache, or resolves it by the wrapped mapper
+func (d *CachingDiscoveryMapper) RESTMapping(gk schema.GroupKind, version ...string) (*meta.RESTMapping, error) {
+	cacheKey := gk.String() + "/" + strings.Join(version, ",")
+	d.mu.RLock()
+	cached, ok := d.mappings[cacheKey]
+	d.mu.RUnlock()
+	if ok && d.now().Before(cached.expireAt) {
+		return cached.mapping, nil
+	}
+	mapping, err := d.DiscoveryMapper.RESTMapping(gk, version...)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	d.mappings[cacheKey] = &cachedRESTMapping{mapping: mapping, expireAt: d.now().Add(d.ttl)}
+	d.mu.Unlock()
+	return mapping, nil
+}
+
+// ResourcesFor resolves the resource of the kind by the cached REST mapping
+func (d *CachingDiscoveryMapper) ResourcesFor(input schema.GroupVersionKind) (schema.GroupVersionResource, error) {
+	mapping, err := d.RESTMapping(input.GroupKind(), input.Version)
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+	return mapping.Resource, nil
+}
+
+// Refresh drops the cached results and refreshes the wrapped mapper
+func (d *CachingDiscoveryMapper) Refresh() (meta.RESTMapper, error) {
+	d.mu.Lock()
+	d.kinds = map[schema.GroupVersionResource]*cachedKinds{}
+	d.mappings = map[string]*cachedRESTMapping{}
+	d.mu.Unlock()
+	return d.DiscoveryMapper.Refresh()
+}
+
+// RefreshDiscovery drops the cached results and refreshes discovery, it should be called when CRDs are changed
+func (d *CachingDiscoveryMapper) RefreshDiscovery() error {
+	_, err := d.Refresh()
+	return err
+}
@@ -0,0 +1,582 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/stretchr/testify/assert"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam"
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+// newCountingDefinitionClient returns a client serving a CUE ComponentDefinition for any name
+// with the given resourceVersion, and counts the Get calls
+func newCountingDefinitionClient(gets *int64, resourceVersion *string) *test.MockClient {
+	return &test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			atomic.AddInt64(gets, 1)
+			if o, ok := obj.(*v1alpha2.ComponentDefinition); ok {
+				*o = v1alpha2.ComponentDefinition{
+					ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace, ResourceVersion: *resourceVersion},
+					Spec: v1alpha2.ComponentDefinitionSpec{
+						Workload:  v1alpha2.WorkloadTypeDescriptor{Definition: v1alpha2.WorkloadGVK{APIVersion: "apps/v1", Kind: "Deployment"}},
+						Schematic: &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}},
+					},
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func TestCachingTemplateLoader(t *testing.T) {
+	var gets int64
+	rv := "1"
+	cli := newCountingDefinitionClient(&gets, &rv)
+	dm := mock.NewMockDiscoveryMapper()
+	loader := NewCachingTemplateLoader()
+
+	tmpl, err := loader.LoadTemplate(context.TODO(), cli, dm, "worker", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "output: {}", tmpl.TemplateStr)
+	assert.Equal(t, int64(1), gets)
+
+	_, err = loader.LoadTemplate(context.TODO(), cli, dm, "worker", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), gets, "cached template should not be read again")
+
+	def := &v1alpha2.ComponentDefinition{ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: oam.SystemDefinitonNamespace, ResourceVersion: "1"}}
+	loader.Invalidate(def)
+	_, err = loader.LoadTemplate(context.TODO(), cli, dm, "worker", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), gets, "invalidate with the same resourceVersion should keep the cache")
+
+	rv = "2"
+	def.ResourceVersion = "2"
+	loader.Invalidate(def)
+	_, err = loader.LoadTemplate(context.TODO(), cli, dm, "worker", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), gets, "invalidate with a new resourceVersion should read again")
+
+	loader.Forget(def)
+	_, err = loader.LoadTemplate(context.TODO(), cli, dm, "worker", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), gets, "forgotten definition should be read again")
+
+	_, err = loader.LoadTemplate(context.TODO(), cli, dm, "worker", TraitTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), gets, "kind is part of the cache key")
+}
+
+func TestCachingTemplateLoaderEventHandler(t *testing.T) {
+	var gets int64
+	rv := "1"
+	cli := newCountingDefinitionClient(&gets, &rv)
+	dm := mock.NewMockDiscoveryMapper()
+	loader := NewCachingTemplateLoader()
+	handler := loader.EventHandler()
+	load := func() {
+		_, err := loader.LoadTemplate(context.TODO(), cli, dm, "worker", ComponentTemplateKind)
+		assert.NoError(t, err)
+	}
+
+	load()
+	old := &v1alpha2.ComponentDefinition{ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: oam.SystemDefinitonNamespace, ResourceVersion: "1"}}
+	handler.OnUpdate(old, old.DeepCopy())
+	load()
+	assert.Equal(t, int64(1), gets, "resync of an unchanged definition should keep the cache")
+
+	rv = "2"
+	updated := old.DeepCopy()
+	updated.ResourceVersion = "2"
+	handler.OnUpdate(old, updated)
+	load()
+	assert.Equal(t, int64(2), gets, "updated definition should be read again")
+
+	handler.OnDelete(toolscache.DeletedFinalStateUnknown{Key: "vela-system/worker", Obj: updated})
+	load()
+	assert.Equal(t, int64(3), gets, "deleted definition should be read again")
+}
+
+func TestCachingTemplateLoaderInvalidatesExtendingTemplates(t *testing.T) {
+	var gets int64
+	parentRV := "1"
+	cli := &test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			atomic.AddInt64(&gets, 1)
+			o, ok := obj.(*v1alpha2.ComponentDefinition)
+			if !ok {
+				return kerrors.NewNotFound(schema.GroupResource{}, key.Name)
+			}
+			*o = v1alpha2.ComponentDefinition{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace, ResourceVersion: "1"}}
+			switch key.Name {
+			case "parent":
+				o.ResourceVersion = parentRV
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: kind: \"Deployment\"\nparameter: {}"}}
+			case "child":
+				o.Annotations = map[string]string{AnnotationExtends: "parent"}
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "parameter: image: string"}}
+			}
+			return nil
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	loader := NewCachingTemplateLoader()
+	load := func() {
+		_, err := loader.LoadTemplate(context.TODO(), cli, dm, "child", ComponentTemplateKind)
+		assert.NoError(t, err)
+	}
+
+	load()
+	assert.Equal(t, int64(2), gets, "the child and its parent should be read")
+	parent := &v1alpha2.ComponentDefinition{ObjectMeta: metav1.ObjectMeta{Name: "parent", Namespace: oam.SystemDefinitonNamespace, ResourceVersion: "1"}}
+	loader.Invalidate(parent)
+	load()
+	assert.Equal(t, int64(2), gets, "unchanged parent should keep the cache")
+
+	parentRV = "2"
+	parent.ResourceVersion = "2"
+	loader.Invalidate(parent)
+	load()
+	assert.Equal(t, int64(4), gets, "the template extending the updated parent should be read again")
+
+	loader.Forget(parent)
+	load()
+	assert.Equal(t, int64(6), gets, "the template extending the deleted parent should be read again")
+}
+
+func TestCachingTemplateLoaderInvalidatesCompositeTraits(t *testing.T) {
+	var gets int64
+	cli := &test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			atomic.AddInt64(&gets, 1)
+			o, ok := obj.(*v1alpha2.TraitDefinition)
+			if !ok {
+				return kerrors.NewNotFound(schema.GroupResource{}, key.Name)
+			}
+			*o = v1alpha2.TraitDefinition{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace, ResourceVersion: "1"}}
+			if key.Name == "gateway" {
+				o.Annotations = map[string]string{AnnotationComposedOf: "ingress,service"}
+			}
+			o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "patch: {}"}}
+			return nil
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	loader := NewCachingTemplateLoader()
+	load := func() {
+		_, err := loader.LoadTemplate(context.TODO(), cli, dm, "gateway", TraitTemplateKind)
+		assert.NoError(t, err)
+	}
+
+	load()
+	assert.Equal(t, int64(3), gets, "the composite trait and its constituents should be read")
+	service := &v1alpha2.TraitDefinition{ObjectMeta: metav1.ObjectMeta{Name: "service", Namespace: oam.SystemDefinitonNamespace, ResourceVersion: "2"}}
+	loader.Invalidate(service)
+	load()
+	assert.Equal(t, int64(6), gets, "the composite trait of the updated constituent should be read again")
+
+	loader.Forget(service)
+	load()
+	assert.Equal(t, int64(9), gets, "the composite trait of the deleted constituent should be read again")
+}
+
+func TestCachingTemplateLoaderEvictsFallbackTemplates(t *testing.T) {
+	var gets int64
+	created := false
+	cli := &test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			atomic.AddInt64(&gets, 1)
+			switch o := obj.(type) {
+			case *v1alpha2.ComponentDefinition:
+				if !created {
+					return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: "componentdefinitions"}, key.Name)
+				}
+				o.ObjectMeta = metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: kind: \"Job\""}}
+			case *v1alpha2.WorkloadDefinition:
+				o.ObjectMeta = metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: kind: \"Deployment\""}}
+			}
+			return nil
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	loader := NewCachingTemplateLoader()
+	ctx := SetNamespaceInCtx(context.TODO(), "default")
+
+	tmpl, err := loader.LoadTemplate(ctx, cli, dm, "worker", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "output: kind: \"Deployment\"", tmpl.TemplateStr, "should fall back to the WorkloadDefinition")
+	loaded := atomic.LoadInt64(&gets)
+	_, err = loader.LoadTemplate(ctx, cli, dm, "worker", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, loaded, atomic.LoadInt64(&gets))
+
+	// a ComponentDefinition of the same name created in any namespace takes over the fallback
+	created = true
+	loader.EventHandler().OnAdd(&v1alpha2.ComponentDefinition{ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: oam.SystemDefinitonNamespace}})
+	tmpl, err = loader.LoadTemplate(ctx, cli, dm, "worker", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "output: kind: \"Job\"", tmpl.TemplateStr)
+	assert.True(t, atomic.LoadInt64(&gets) > loaded, "the template should be read again")
+
+	// definitions of other kinds don't evict the template
+	loaded = atomic.LoadInt64(&gets)
+	loader.EventHandler().OnAdd(&v1alpha2.TraitDefinition{ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: "default"}})
+	_, err = loader.LoadTemplate(ctx, cli, dm, "worker", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, loaded, atomic.LoadInt64(&gets))
+}
+
+func TestWarmCache(t *testing.T) {
+	var gets int64
+	cli := &test.MockClient{
+		MockList: func(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+			switch l := list.(type) {
+			case *v1alpha2.ComponentDefinitionList:
+				l.Items = []v1alpha2.ComponentDefinition{
+					{ObjectMeta: metav1.ObjectMeta{Name: "webservice", Namespace: oam.SystemDefinitonNamespace}},
+					{ObjectMeta: metav1.ObjectMeta{Name: "broken", Namespace: "default"}},
+				}
+			case *v1alpha2.WorkloadDefinitionList:
+				l.Items = []v1alpha2.WorkloadDefinition{
+					{ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: oam.SystemDefinitonNamespace}},
+				}
+			case *v1alpha2.TraitDefinitionList:
+				l.Items = []v1alpha2.TraitDefinition{
+					{ObjectMeta: metav1.ObjectMeta{Name: "scaler", Namespace: oam.SystemDefinitonNamespace}},
+				}
+			}
+			return nil
+		},
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			atomic.AddInt64(&gets, 1)
+			if key.Name == "broken" {
+				return errors.New("connection refused")
+			}
+			// definitions only exist in the system definition namespace
+			if key.Namespace != oam.SystemDefinitonNamespace {
+				return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group}, key.Name)
+			}
+			switch o := obj.(type) {
+			case *v1alpha2.ComponentDefinition:
+				if key.Name == "worker" {
+					return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: "componentdefinitions"}, key.Name)
+				}
+				o.ObjectMeta = metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}}
+			case *v1alpha2.WorkloadDefinition:
+				o.ObjectMeta = metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}
+				o.Spec.Reference = v1alpha2.DefinitionReference{Name: "deployments.apps"}
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: kind: \"Deployment\""}}
+			case *v1alpha2.TraitDefinition:
+				o.ObjectMeta = metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "patch: {}"}}
+			}
+			return nil
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	dm.MockKindsFor = mock.NewMockKindsFor("Deployment", "v1")
+	loader := NewCachingTemplateLoader()
+
+	err := WarmCache(context.TODO(), cli, dm, loader)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "warm ComponentDefinition default/broken")
+	assert.Contains(t, err.Error(), "connection refused")
+	assert.NotContains(t, err.Error(), "webservice")
+	assert.NotContains(t, err.Error(), "scaler")
+
+	warmed := atomic.LoadInt64(&gets)
+	tmpl, err := loader.LoadTemplate(context.TODO(), cli, dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "output: {}", tmpl.TemplateStr)
+	tmpl, err = loader.LoadTemplate(context.TODO(), cli, dm, "scaler", TraitTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "patch: {}", tmpl.TemplateStr)
+	assert.Equal(t, warmed, atomic.LoadInt64(&gets), "warmed templates should be served from cache")
+
+	// templates of the system definition namespace are hit by applications in other namespaces
+	nsCtx := SetNamespaceInCtx(context.TODO(), "default")
+	tmpl, err = loader.LoadTemplate(nsCtx, cli, dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "output: {}", tmpl.TemplateStr)
+	tmpl, err = loader.LoadTemplate(nsCtx, cli, dm, "worker", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "output: kind: \"Deployment\"", tmpl.TemplateStr, "WorkloadDefinitions should be warmed")
+	tmpl, err = loader.LoadTemplate(nsCtx, cli, dm, "scaler", TraitTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "patch: {}", tmpl.TemplateStr)
+	assert.Equal(t, warmed, atomic.LoadInt64(&gets), "warmed templates should be served from cache in any namespace")
+
+	// a namespace with a definition of the same name doesn't share the template
+	local := &v1alpha2.ComponentDefinition{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "staging",
+		Annotations: map[string]string{AnnotationDefinitionAlias: "webservice"}}}
+	loader.EventHandler().OnAdd(local)
+	_, err = loader.LoadTemplate(SetNamespaceInCtx(context.TODO(), "staging"), cli, dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.True(t, atomic.LoadInt64(&gets) > warmed, "a namespace aliasing the name should load its own template")
+	loader.EventHandler().OnDelete(local)
+	// the shared template is evicted by the alias, and shared again once it's reloaded
+	_, err = loader.LoadTemplate(SetNamespaceInCtx(context.TODO(), "production"), cli, dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	warmed = atomic.LoadInt64(&gets)
+	_, err = loader.LoadTemplate(SetNamespaceInCtx(context.TODO(), "testing"), cli, dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, warmed, atomic.LoadInt64(&gets))
+
+	cli.MockList = test.NewMockListFn(errors.New("forbidden"))
+	err = WarmCache(context.TODO(), cli, dm, NewCachingTemplateLoader())
+	assert.Contains(t, err.Error(), "list ComponentDefinitions: forbidden")
+	assert.Contains(t, err.Error(), "list WorkloadDefinitions: forbidden")
+	assert.Contains(t, err.Error(), "list TraitDefinitions: forbidden")
+}
+
+// benchmarkLoad50Components loads the templates of an application with 50 components
+func benchmarkLoad50Components(b *testing.B, load func(ctx context.Context, key string) error, gets *int64) {
+	ctx := context.TODO()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for c := 0; c < 50; c++ {
+			if err := load(ctx, fmt.Sprintf("component-%d", c)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.ReportMetric(float64(atomic.LoadInt64(gets))/float64(b.N), "gets/op")
+}
+
+func BenchmarkLoadTemplate(b *testing.B) {
+	var gets int64
+	rv := "1"
+	cli := newCountingDefinitionClient(&gets, &rv)
+	dm := mock.NewMockDiscoveryMapper()
+	benchmarkLoad50Components(b, func(ctx context.Context, key string) error {
+		_, err := LoadTemplateOfKind(ctx, cli, dm, key, ComponentTemplateKind)
+		return err
+	}, &gets)
+}
+
+func BenchmarkCachingTemplateLoader(b *testing.B) {
+	var gets int64
+	rv := "1"
+	cli := newCountingDefinitionClient(&gets, &rv)
+	dm := mock.NewMockDiscoveryMapper()
+	loader := NewCachingTemplateLoader()
+	benchmarkLoad50Components(b, func(ctx context.Context, key string) error {
+		_, err := loader.LoadTemplate(ctx, cli, dm, key, ComponentTemplateKind)
+		return err
+	}, &gets)
+}
+
+// newCountingScopeDiscoveryMapper returns a discovery mapper resolving scopes to HealthScope, and counts the lookups
+func newCountingScopeDiscoveryMapper(lookups *int64) *mock.DiscoveryMapper {
+	dm := mock.NewMockDiscoveryMapper()
+	kindsFor := mock.NewMockKindsFor("HealthScope", "v1alpha2")
+	dm.MockKindsFor = func(input schema.GroupVersionResource) ([]schema.GroupVersionKind, error) {
+		atomic.AddInt64(lookups, 1)
+		return kindsFor(input)
+	}
+	return dm
+}
+
+// newScopeDefinitionClient returns a client serving a ScopeDefinition for any name with the given resourceVersion
+func newScopeDefinitionClient(resourceVersion *string) *test.MockClient {
+	return &test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			if o, ok := obj.(*v1alpha2.ScopeDefinition); ok {
+				*o = v1alpha2.ScopeDefinition{
+					ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace, ResourceVersion: *resourceVersion},
+					Spec:       v1alpha2.ScopeDefinitionSpec{Reference: v1alpha2.DefinitionReference{Name: "healthscopes.core.oam.dev"}},
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func TestScopeGVKCache(t *testing.T) {
+	var lookups int64
+	rv := "1"
+	cli := newScopeDefinitionClient(&rv)
+	dm := newCountingScopeDiscoveryMapper(&lookups)
+	now := time.Now()
+	cache := NewScopeGVKCache(time.Minute)
+	cache.now = func() time.Time { return now }
+	exp := schema.GroupVersionKind{Group: "core.oam.dev", Version: "v1alpha2", Kind: "HealthScope"}
+
+	gvk, err := cache.GetScopeGVK(context.TODO(), cli, dm, "healthscope")
+	assert.NoError(t, err)
+	assert.Equal(t, exp, gvk)
+	assert.Equal(t, int64(1), lookups)
+
+	gvk, err = cache.GetScopeGVK(context.TODO(), cli, dm, "healthscope")
+	assert.NoError(t, err)
+	assert.Equal(t, exp, gvk)
+	assert.Equal(t, int64(1), lookups, "cached GVK should not be resolved again")
+
+	rv = "2"
+	_, err = cache.GetScopeGVK(context.TODO(), cli, dm, "healthscope")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), lookups, "a new resourceVersion should be resolved again")
+
+	now = now.Add(2 * time.Minute)
+	_, err = cache.GetScopeGVK(context.TODO(), cli, dm, "healthscope")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), lookups, "expired GVK should be resolved again")
+
+	cache.Invalidate(&v1alpha2.ScopeDefinition{ObjectMeta: metav1.ObjectMeta{Name: "healthscope", Namespace: oam.SystemDefinitonNamespace}})
+	_, err = cache.GetScopeGVK(context.TODO(), cli, dm, "healthscope")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), lookups, "invalidated GVK should be resolved again")
+
+	cache.Reset()
+	_, err = cache.GetScopeGVK(context.TODO(), cli, dm, "healthscope")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), lookups, "reset should drop all GVKs")
+}
+
+func TestScopeGVKCacheConcurrency(t *testing.T) {
+	var lookups int64
+	rv := "1"
+	cli := newScopeDefinitionClient(&rv)
+	dm := newCountingScopeDiscoveryMapper(&lookups)
+	cache := NewScopeGVKCache(time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := cache.GetScopeGVK(context.TODO(), cli, dm, fmt.Sprintf("scope-%d", i%5))
+			assert.NoError(t, err)
+			if i%7 == 0 {
+				cache.Reset()
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// benchmarkGet50Scopes gets the GVKs of an application with 50 scopes
+func benchmarkGet50Scopes(b *testing.B, get func(ctx context.Context, name string) error, lookups *int64) {
+	ctx := context.TODO()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for s := 0; s < 50; s++ {
+			if err := get(ctx, fmt.Sprintf("scope-%d", s)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.ReportMetric(float64(atomic.LoadInt64(lookups))/float64(b.N), "lookups/op")
+}
+
+func BenchmarkGetScopeGVK(b *testing.B) {
+	var lookups int64
+	rv := "1"
+	cli := newScopeDefinitionClient(&rv)
+	dm := newCountingScopeDiscoveryMapper(&lookups)
+	benchmarkGet50Scopes(b, func(ctx context.Context, name string) error {
+		_, err := GetScopeGVK(ctx, cli, dm, name)
+		return err
+	}, &lookups)
+}
+
+func BenchmarkScopeGVKCache(b *testing.B) {
+	var lookups int64
+	rv := "1"
+	cli := newScopeDefinitionClient(&rv)
+	dm := newCountingScopeDiscoveryMapper(&lookups)
+	cache := NewScopeGVKCache(time.Minute)
+	benchmarkGet50Scopes(b, func(ctx context.Context, name string) error {
+		_, err := cache.GetScopeGVK(ctx, cli, dm, name)
+		return err
+	}, &lookups)
+}
+
+func TestCachingDiscoveryMapper(t *testing.T) {
+	var lookups, refreshes int64
+	dm := newCountingScopeDiscoveryMapper(&lookups)
+	dm.MockRefresh = func() (meta.RESTMapper, error) {
+		atomic.AddInt64(&refreshes, 1)
+		return nil, nil
+	}
+	now := time.Now()
+	cached := NewCachingDiscoveryMapper(dm, time.Minute)
+	cached.now = func() time.Time { return now }
+	exp := schema.GroupVersionKind{Group: "core.oam.dev", Version: "v1alpha2", Kind: "HealthScope"}
+	ref := v1alpha2.DefinitionReference{Name: "healthscopes.core.oam.dev"}
+
+	gvk, err := GetGVKFromDefinition(cached, ref)
+	assert.NoError(t, err)
+	assert.Equal(t, exp, gvk)
+	assert.Equal(t, int64(1), lookups)
+
+	gvk, err = GetGVKFromDefinition(cached, ref)
+	assert.NoError(t, err)
+	assert.Equal(t, exp, gvk)
+	assert.Equal(t, int64(1), lookups, "cached kinds should not be resolved again")
+
+	now = now.Add(2 * time.Minute)
+	_, err = GetGVKFromDefinition(cached, ref)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), lookups, "expired kinds should be resolved again")
+
+	assert.NoError(t, cached.RefreshDiscovery())
+	assert.Equal(t, int64(1), refreshes)
+	_, err = GetGVKFromDefinition(cached, ref)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), lookups, "kinds should be resolved again after refresh")
+
+	dm.MockKindsFor = func(input schema.GroupVersionResource) ([]schema.GroupVersionKind, error) {
+		atomic.AddInt64(&lookups, 1)
+		return nil, &meta.NoResourceMatchError{PartialResource: input}
+	}
+	missing := v1alpha2.DefinitionReference{Name: "foo.example.com"}
+	for i := 0; i < 2; i++ {
+		_, err = GetGVKFromDefinition(cached, missing)
+		assert.True(t, meta.IsNoMatchError(err))
+	}
+	assert.Equal(t, int64(5), lookups, "errors should not be cached")
+
+	var mappings int64
+	dm.MockRESTMapping = func(gk schema.GroupKind, versions ...string) (*meta.RESTMapping, error) {
+		atomic.AddInt64(&mappings, 1)
+		return &meta.RESTMapping{Resource: schema.GroupVersionResource{Group: gk.Group, Version: versions[0], Resource: "deployments"}}, nil
+	}
+	for i := 0; i < 2; i++ {
+		gvr, err := cached.ResourcesFor(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"})
+		assert.NoError(t, err)
+		assert.Equal(t, schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, gvr)
+	}
+	assert.Equal(t, int64(1), mappings)
+}
+
+func BenchmarkCachingDiscoveryMapper(b *testing.B) {
+	var lookups int64
+	rv := "1"
+	cli := newScopeDefinitionClient(&rv)
+	dm := NewCachingDiscoveryMapper(newCountingScopeDiscoveryMapper(&lookups), time.Minute)
+	benchmarkGet50Scopes(b, func(ctx context.Context, name string) error {
+		_, err := GetScopeGVK(ctx, cli, dm, name)
+		return err
+	}, &lookups)
+}
@@ -0,0 +1,70 @@
+package util
+
+import (
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/apis/types"
+)
+
+// CategoryDetector detects the capability category of a definition with the schematic, ok is false if it doesn't
+// recognize the definition, so that the next detector is tried.
+type CategoryDetector func(def metav1.Object, schematic *v1alpha2.Schematic) (category types.CapabilityCategory, ok bool)
+
+var (
+	categoryDetectorsMu sync.RWMutex
+	categoryDetectors   = DefaultCategoryDetectors()
+)
+
+// DefaultCategoryDetectors returns the built-in detectors: Terraform definitions by the "type" annotation,
+// then Helm and Kustomize definitions by the schematic. CUE definitions aren't recognized, they have the empty category.
+func DefaultCategoryDetectors() []CategoryDetector {
+	return []CategoryDetector{detectTerraformCategory, detectSchematicCategory}
+}
+
+// RegisterCategoryDetector registers the detector after the registered ones, so that LoadTemplate recognizes
+// out-of-tree capability categories. The detectors run in order and the first one which recognizes a definition wins.
+func RegisterCategoryDetector(detector CategoryDetector) {
+	categoryDetectorsMu.Lock()
+	defer categoryDetectorsMu.Unlock()
+	categoryDetectors = append(categoryDetectors, detector)
+}
+
+// ResetCategoryDetectors restores the default detectors, unregistering the others
+func ResetCategoryDetectors() {
+	categoryDetectorsMu.Lock()
+	defer categoryDetectorsMu.Unlock()
+	categoryDetectors = DefaultCategoryDetectors()
+}
+
+// DetectCapabilityCategory returns the category of the definition by the registered detectors,
+// it's empty if none of them recognizes the definition.
+func DetectCapabilityCategory(def metav1.Object, schematic *v1alpha2.Schematic) types.CapabilityCategory {
+	categoryDetectorsMu.RLock()
+	defer categoryDetectorsMu.RUnlock()
+	for _, detect := range categoryDetectors {
+		if category, ok := detect(def, schematic); ok {
+			return category
+		}
+	}
+	return ""
+}
+
+func detectTerraformCategory(def metav1.Object, _ *v1alpha2.Schematic) (types.CapabilityCategory, bool) {
+	category := CapabilityCategoryFromAnnotations(def.GetAnnotations())
+	return category, category == types.TerraformCategory
+}
+
+func detectSchematicCategory(_ metav1.Object, schematic *v1alpha2.Schematic) (types.CapabilityCategory, bool) {
+	switch {
+	case schematic == nil || schematic.CUE != nil:
+		return "", false
+	case schematic.HELM != nil:
+		return types.HelmCategory, true
+	case schematic.KUSTOMIZE != nil:
+		return types.KustomizeCategory, true
+	}
+	return "", false
+}
@@ -0,0 +1,77 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ktypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/apis/types"
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+func TestDetectCapabilityCategory(t *testing.T) {
+	cue := &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}}
+	terraform := &metav1.ObjectMeta{Annotations: map[string]string{"type": "terraform"}}
+	testCases := map[string]struct {
+		def       metav1.Object
+		schematic *v1alpha2.Schematic
+		exp       types.CapabilityCategory
+	}{
+		"cue":       {def: &metav1.ObjectMeta{}, schematic: cue, exp: ""},
+		"terraform": {def: terraform, schematic: cue, exp: types.TerraformCategory},
+		"helm":      {def: &metav1.ObjectMeta{}, schematic: &v1alpha2.Schematic{HELM: &v1alpha2.Helm{}}, exp: types.HelmCategory},
+		"kustomize": {def: &metav1.ObjectMeta{}, schematic: &v1alpha2.Schematic{KUSTOMIZE: &v1alpha2.Kustomize{}}, exp: types.KustomizeCategory},
+		"none":      {def: &metav1.ObjectMeta{}, exp: ""},
+	}
+	for name, tc := range testCases {
+		assert.Equal(t, tc.exp, DetectCapabilityCategory(tc.def, tc.schematic), name)
+	}
+}
+
+func TestRegisterCategoryDetector(t *testing.T) {
+	defer ResetCategoryDetectors()
+	const crossplane types.CapabilityCategory = "crossplane"
+	RegisterCategoryDetector(func(def metav1.Object, schematic *v1alpha2.Schematic) (types.CapabilityCategory, bool) {
+		_, ok := def.GetAnnotations()["crossplane.io/composition"]
+		return crossplane, ok && schematic != nil && schematic.CUE != nil
+	})
+
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			if o, ok := obj.(*v1alpha2.ComponentDefinition); ok {
+				o.Name = key.Name
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}}
+				switch key.Name {
+				case "rds":
+					o.Annotations = map[string]string{"crossplane.io/composition": "rds"}
+				case "oss":
+					// the built-in detectors take precedence
+					o.Annotations = map[string]string{"crossplane.io/composition": "oss", "type": "terraform"}
+				}
+			}
+			return nil
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+
+	tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, "rds", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, crossplane, tmpl.CapabilityCategory)
+	tmpl, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "oss", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, types.TerraformCategory, tmpl.CapabilityCategory)
+	tmpl, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, types.CapabilityCategory(""), tmpl.CapabilityCategory)
+
+	ResetCategoryDetectors()
+	tmpl, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "rds", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, types.CapabilityCategory(""), tmpl.CapabilityCategory)
+}
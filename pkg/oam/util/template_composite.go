@@ -0,0 +1,63 @@
+package util
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/kubevela/pkg/oam/discoverymapper"
+)
+
+// AnnotationComposedOf lists the traits which a composite trait expands into, separated by comma,
+// e.g. "ingress,service-binding". The templates of them are loaded into the Constituents of the template.
+const AnnotationComposedOf = "trait.oam.dev/composed-of"
+
+// expandCompositeTrait loads the templates of the traits which the trait named key is composed of, constituents
+// which are composite as well are expanded in turn, and returns the definitions of the constituents. It returns
+// an error if a constituent is not found or the composition is cyclic.
+func (o *loadTemplateOptions) expandCompositeTrait(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper,
+	key string, kd TemplateKind, tmpl *Template, def metav1.Object) ([]*ResolvedDefinition, error) {
+	if kd != TraitTemplateKind {
+		return nil, nil
+	}
+	constituents := composedOf(def.GetAnnotations())
+	if len(constituents) == 0 {
+		return nil, nil
+	}
+	chain := append(append([]string{}, o.composition...), key)
+	composition := o.composition
+	o.composition = chain
+	defer func() { o.composition = composition }()
+
+	var sources []*ResolvedDefinition
+	for _, name := range constituents {
+		if cyclic(chain, name) {
+			return nil, errors.Errorf("cyclic composition %s -> %s", strings.Join(chain, " -> "), name)
+		}
+		constituent, source, err := loadTemplateWithSource(ctx, cli, dm, name, kd, o)
+		if kerrors.IsNotFound(errors.Cause(err)) {
+			return nil, errors.Errorf("composite trait %s is composed of trait %s which is not found", key, name)
+		}
+		if err != nil {
+			return nil, errors.WithMessagef(err, "load constituent trait %s", name)
+		}
+		tmpl.Constituents = append(tmpl.Constituents, constituent)
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// composedOf returns the traits listed in AnnotationComposedOf, it's nil if none is listed
+func composedOf(annotations map[string]string) []string {
+	var traits []string
+	for _, trait := range strings.Split(annotations[AnnotationComposedOf], ",") {
+		if trait = strings.TrimSpace(trait); trait != "" {
+			traits = append(traits, trait)
+		}
+	}
+	return traits
+}
@@ -0,0 +1,69 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/stretchr/testify/assert"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ktypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+func TestLoadCompositeTrait(t *testing.T) {
+	traits := map[string]string{
+		"ingress": "",
+		"service": "",
+		"gateway": "ingress, service",
+		"broken":  "ingress,missing",
+		"loop-a":  "loop-b",
+		"loop-b":  "loop-a",
+	}
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			o, ok := obj.(*v1alpha2.TraitDefinition)
+			if !ok {
+				return nil
+			}
+			composedOf, ok := traits[key.Name]
+			if !ok {
+				return kerrors.NewNotFound(schema.GroupResource{}, key.Name)
+			}
+			o.Name = key.Name
+			if composedOf != "" {
+				o.Annotations = map[string]string{AnnotationComposedOf: composedOf}
+			}
+			o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "patch: metadata: labels: trait: \"" + key.Name + "\""}}
+			return nil
+		},
+		MockList: test.NewMockListFn(nil),
+	}
+	dm := mock.NewMockDiscoveryMapper()
+
+	tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, "gateway", TraitTemplateKind)
+	assert.NoError(t, err)
+	assert.Len(t, tmpl.Constituents, 2)
+	assert.Equal(t, "ingress", tmpl.Constituents[0].Name)
+	assert.Equal(t, `patch: metadata: labels: trait: "ingress"`, tmpl.Constituents[0].TemplateStr)
+	assert.Equal(t, "service", tmpl.Constituents[1].Name)
+	_, source, err := LoadTemplateWithSource(context.TODO(), &tclient, dm, "gateway", TraitTemplateKind)
+	assert.NoError(t, err)
+	assert.Len(t, source.Dependencies, 2)
+	assert.Equal(t, "ingress", source.Dependencies[0].Name)
+	assert.Equal(t, "service", source.Dependencies[1].Name)
+
+	tmpl, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "ingress", TraitTemplateKind)
+	assert.NoError(t, err)
+	assert.Nil(t, tmpl.Constituents)
+
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "broken", TraitTemplateKind)
+	assert.EqualError(t, err, "LoadTemplate [broken] : composite trait broken is composed of trait missing which is not found")
+
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "loop-a", TraitTemplateKind)
+	assert.Contains(t, err.Error(), "cyclic composition loop-a -> loop-b -> loop-a")
+}
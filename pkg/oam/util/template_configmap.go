@@ -0,0 +1,84 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/kubevela/pkg/oam/discoverymapper"
+)
+
+// ConfigMapTemplateLoader loads templates from a ConfigMap pre-baked by operators, e.g. in air-gapped environments
+// where reading definitions is expensive. Each entry is a template marshaled to JSON, keyed by ConfigMapTemplateKey
+// with the namespace the definitions are resolved in, so applications in different namespaces don't share entries.
+// Loads with options bypass the ConfigMap, as the options may resolve a different template. On a miss, or if the schema version of an entry is stale, the template is loaded by LoadTemplate and written back
+// to the ConfigMap if it exists, so that the next load is a hit. Entries aren't refreshed when definitions change,
+// operators should bake the ConfigMap again with the definitions.
+type ConfigMapTemplateLoader struct {
+	cli       client.Client
+	configMap ktypes.NamespacedName
+}
+
+// NewConfigMapTemplateLoader creates a ConfigMapTemplateLoader reading templates from the ConfigMap with cli
+func NewConfigMapTemplateLoader(cli client.Client, namespace, name string) *ConfigMapTemplateLoader {
+	return &ConfigMapTemplateLoader{cli: cli, configMap: ktypes.NamespacedName{Namespace: namespace, Name: name}}
+}
+
+// ConfigMapTemplateKey returns the key of the template of kind named name, resolved for applications in namespace,
+// in the data of a ConfigMap
+func ConfigMapTemplateKey(kd TemplateKind, namespace, name string) string {
+	return string(kd) + "." + namespace + "." + name
+}
+
+// SetConfigMapTemplate sets the template of kind named name, resolved for applications in namespace,
+// in the data of the ConfigMap
+func SetConfigMapTemplate(cm *corev1.ConfigMap, kd TemplateKind, namespace, name string, tmpl *Template) error {
+	data, err := json.Marshal(tmpl)
+	if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[ConfigMapTemplateKey(kd, namespace, name)] = string(data)
+	return nil
+}
+
+// LoadTemplate has the same contract as LoadTemplate, but serves the template from the ConfigMap if it's baked there
+func (l *ConfigMapTemplateLoader) LoadTemplate(ctx context.Context, dm discoverymapper.DiscoveryMapper, key string, kd TemplateKind, opts ...LoadTemplateOption) (*Template, error) {
+	if len(opts) > 0 {
+		return LoadTemplateOfKind(ctx, l.cli, dm, key, kd, opts...)
+	}
+	namespace := GetDefinitionNamespaceWithCtx(ctx)
+	cm := &corev1.ConfigMap{}
+	err := l.cli.Get(ctx, l.configMap, cm)
+	if err != nil && !kerrors.IsNotFound(err) {
+		return nil, errors.Wrapf(err, "LoadTemplate [%s] get ConfigMap %s", key, l.configMap)
+	}
+	exists := err == nil
+	if data, ok := cm.Data[ConfigMapTemplateKey(kd, namespace, key)]; ok {
+		tmpl := &Template{}
+		// entries of a stale schema version fail to unmarshal and are refreshed
+		if err := json.Unmarshal([]byte(data), tmpl); err == nil {
+			return tmpl, nil
+		}
+	}
+
+	tmpl, err := LoadTemplateOfKind(ctx, l.cli, dm, key, kd)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		patch := client.MergeFrom(cm.DeepCopy())
+		// the ConfigMap is only a cache, the template is returned even if it can't be written back
+		if err := SetConfigMapTemplate(cm, kd, namespace, key, tmpl); err == nil {
+			_ = l.cli.Patch(ctx, cm, patch)
+		}
+	}
+	return tmpl, nil
+}
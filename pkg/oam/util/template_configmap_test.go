@@ -0,0 +1,109 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+func TestConfigMapTemplateLoader(t *testing.T) {
+	var configMap *corev1.ConfigMap
+	var definitionGets, patches int
+	cli := &test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			switch o := obj.(type) {
+			case *corev1.ConfigMap:
+				if configMap == nil {
+					return kerrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, key.Name)
+				}
+				configMap.DeepCopyInto(o)
+			case *v1alpha2.TraitDefinition:
+				definitionGets++
+				o.Name = key.Name
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "patch: live: true"}}
+			case *v1alpha2.ComponentDefinition:
+				return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: "componentdefinitions"}, key.Name)
+			case *v1alpha2.WorkloadDefinition:
+				return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: "workloaddefinitions"}, key.Name)
+			}
+			return nil
+		},
+		MockPatch: func(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+			patches++
+			configMap = obj.(*corev1.ConfigMap).DeepCopy()
+			return nil
+		},
+		MockList: test.NewMockListFn(nil),
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	loader := NewConfigMapTemplateLoader(cli, "vela-system", "baked-templates")
+
+	// no ConfigMap, load live without writing back
+	tmpl, err := loader.LoadTemplate(context.TODO(), dm, "scaler", TraitTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "patch: live: true", tmpl.TemplateStr)
+	assert.Equal(t, 1, definitionGets)
+	assert.Equal(t, 0, patches)
+
+	// hit
+	configMap = &corev1.ConfigMap{}
+	assert.NoError(t, SetConfigMapTemplate(configMap, TraitTemplateKind, "vela-system", "scaler", &Template{Name: "scaler", TemplateStr: "patch: baked: true"}))
+	assert.Contains(t, configMap.Data, "trait.vela-system.scaler")
+	tmpl, err = loader.LoadTemplate(context.TODO(), dm, "scaler", TraitTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "patch: baked: true", tmpl.TemplateStr)
+	assert.Equal(t, 1, definitionGets, "a hit should not read the definition")
+
+	// miss with fallback, the entry is written back
+	tmpl, err = loader.LoadTemplate(context.TODO(), dm, "sidecar", TraitTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "patch: live: true", tmpl.TemplateStr)
+	assert.Equal(t, 2, definitionGets)
+	assert.Equal(t, 1, patches)
+	tmpl, err = loader.LoadTemplate(context.TODO(), dm, "sidecar", TraitTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "patch: live: true", tmpl.TemplateStr)
+	assert.Equal(t, 2, definitionGets, "the written back entry should be hit")
+
+	// stale entry is refreshed
+	configMap.Data[ConfigMapTemplateKey(TraitTemplateKind, "vela-system", "scaler")] = `{"schemaVersion":"v0","template":"patch: stale: true"}`
+	tmpl, err = loader.LoadTemplate(context.TODO(), dm, "scaler", TraitTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "patch: live: true", tmpl.TemplateStr)
+	assert.Equal(t, 3, definitionGets)
+	assert.Equal(t, 2, patches)
+	tmpl, err = loader.LoadTemplate(context.TODO(), dm, "scaler", TraitTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "patch: live: true", tmpl.TemplateStr)
+	assert.Equal(t, 3, definitionGets, "the refreshed entry should be hit")
+
+	// entries are keyed by kind
+	_, err = loader.LoadTemplate(context.TODO(), dm, "scaler", ComponentTemplateKind)
+	assert.True(t, kerrors.IsNotFound(errors.Cause(err)))
+
+	// entries are keyed by the namespace definitions are resolved in
+	tmpl, err = loader.LoadTemplate(SetNamespaceInCtx(context.TODO(), "default"), dm, "scaler", TraitTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "patch: live: true", tmpl.TemplateStr)
+	assert.Equal(t, 4, definitionGets, "an entry of another namespace should not be hit")
+	assert.Contains(t, configMap.Data, "trait.default.scaler")
+
+	// loads with options bypass the ConfigMap
+	tmpl, err = loader.LoadTemplate(context.TODO(), dm, "scaler", TraitTemplateKind, LoadWithFeatureGates("Autoscaling"))
+	assert.NoError(t, err)
+	assert.Equal(t, "patch: live: true", tmpl.TemplateStr)
+	assert.Equal(t, 5, definitionGets, "a load with options should not be served from the ConfigMap")
+	assert.Equal(t, 3, patches, "a load with options should not be written back")
+}
@@ -0,0 +1,126 @@
+package util
+
+import (
+	"sort"
+	"strings"
+
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/literal"
+	"cuelang.org/go/cue/parser"
+	"cuelang.org/go/cue/token"
+	"github.com/pkg/errors"
+)
+
+// DynamicContextField is the path segment of a context field referenced by a dynamic index, e.g. "outputs.*"
+// for `context.outputs[parameter.name]`, or the path of the whole context referenced as is
+const DynamicContextField = "*"
+
+// ReferencedContextFields returns the paths of the fields under `context` referenced by the CUE template, e.g. "name"
+// and "output.metadata.name", sorted. The template is analyzed statically, so the result is best-effort: the fields
+// referenced by a dynamic index end with DynamicContextField, and fields named `context` declared by the template
+// itself aren't told apart from the context. It returns nil for templates other than CUE.
+func (t *Template) ReferencedContextFields() ([]string, error) {
+	if !t.IsCUE() {
+		return nil, nil
+	}
+	f, err := parser.ParseFile("-", t.TemplateStr)
+	if err != nil {
+		return nil, t.withCapabilityName(errors.WithMessage(err, "parse template"))
+	}
+	fields := map[string]bool{}
+	collectContextReferences(f, fields)
+	paths := make([]string, 0, len(fields))
+	for p := range fields {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// collectContextReferences collects the paths of the context fields referenced in the node into fields
+func collectContextReferences(node ast.Node, fields map[string]bool) {
+	var before func(ast.Node) bool
+	before = func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.Field:
+			// an identifier label declares a field rather than references one
+			if _, ok := x.Label.(*ast.Ident); !ok {
+				ast.Walk(x.Label, before, nil)
+			}
+			ast.Walk(x.Value, before, nil)
+			return false
+		case *ast.Ident:
+			if x.Name == "context" {
+				fields[DynamicContextField] = true
+			}
+		case *ast.SelectorExpr, *ast.IndexExpr:
+			path, dynamicIndexes, ok := contextReference(x.(ast.Expr))
+			if !ok {
+				if sel, isSel := x.(*ast.SelectorExpr); isSel {
+					// the selector is a field of another value, e.g. `parameter.context`
+					ast.Walk(sel.X, before, nil)
+					return false
+				}
+				return true
+			}
+			fields[path] = true
+			for _, index := range dynamicIndexes {
+				ast.Walk(index, before, nil)
+			}
+			return false
+		}
+		return true
+	}
+	ast.Walk(node, before, nil)
+}
+
+// contextReference returns the path of the context field referenced by a chain of selectors and indexes, and the
+// dynamic indexes in the chain. It returns false if the chain doesn't start with `context`.
+func contextReference(expr ast.Expr) (string, []ast.Expr, bool) {
+	var segments []string
+	var dynamicIndexes []ast.Expr
+	for {
+		switch x := expr.(type) {
+		case *ast.SelectorExpr:
+			name, _, err := ast.LabelName(x.Sel)
+			if err != nil {
+				name = DynamicContextField
+			}
+			segments = append(segments, name)
+			expr = x.X
+			continue
+		case *ast.IndexExpr:
+			segment := DynamicContextField
+			if lit, ok := x.Index.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				if s, err := literal.Unquote(lit.Value); err == nil {
+					segment = s
+				}
+			}
+			if segment == DynamicContextField {
+				dynamicIndexes = append(dynamicIndexes, x.Index)
+			}
+			segments = append(segments, segment)
+			expr = x.X
+			continue
+		case *ast.Ident:
+			if x.Name != "context" {
+				return "", nil, false
+			}
+		default:
+			return "", nil, false
+		}
+		break
+	}
+	// the segments are collected from the end of the chain
+	for i, j := 0, len(segments)-1; i < j; i, j = i+1, j-1 {
+		segments[i], segments[j] = segments[j], segments[i]
+	}
+	// a dynamic index hides the fields selected after it
+	for i, s := range segments {
+		if s == DynamicContextField {
+			segments = segments[:i+1]
+			break
+		}
+	}
+	return strings.Join(segments, "."), dynamicIndexes, true
+}
@@ -0,0 +1,51 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+)
+
+func TestReferencedContextFields(t *testing.T) {
+	tmpl := &Template{Name: "webservice", TemplateStr: `
+output: {
+	kind: "Deployment"
+	metadata: {
+		name:      context.name
+		namespace: context["namespace"]
+		labels: "app.oam.dev/name": "\(context.appName)"
+	}
+	spec: {
+		replicas: context.output.spec.replicas
+		selector: parameter.labels[context.name]
+		template: metadata: annotations: context.outputs[parameter.service].metadata.annotations
+	}
+}
+parameter: {
+	labels: [string]: string
+	service: string
+	context: string
+}
+data: parameter.context
+`}
+	fields, err := tmpl.ReferencedContextFields()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"appName", "name", "namespace", "output.spec.replicas", "outputs.*"}, fields)
+
+	fields, err = (&Template{Name: "whole", TemplateStr: `output: data: context`}).ReferencedContextFields()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{DynamicContextField}, fields)
+
+	fields, err = (&Template{Name: "fixed", TemplateStr: `output: kind: "ConfigMap"`}).ReferencedContextFields()
+	assert.NoError(t, err)
+	assert.Empty(t, fields)
+
+	fields, err = (&Template{Name: "chart", Helm: &v1alpha2.Helm{}}).ReferencedContextFields()
+	assert.NoError(t, err)
+	assert.Nil(t, fields)
+
+	_, err = (&Template{Name: "broken", TemplateStr: `output: {`}).ReferencedContextFields()
+	assert.Error(t, err)
+}
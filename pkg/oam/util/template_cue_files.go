@@ -0,0 +1,173 @@
+package util
+
+import (
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/build"
+	"cuelang.org/go/cue/format"
+	"cuelang.org/go/cue/parser"
+	"cuelang.org/go/cue/token"
+	"github.com/pkg/errors"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	mycue "github.com/oam-dev/kubevela/pkg/cue"
+)
+
+// mainTemplateFile is the name of the file of schematic.cue.template when it's compiled with the other files
+const mainTemplateFile = "-"
+
+// cueTemplateFiles returns the decoded files of a CUE schematic, the template goes first as mainTemplateFile.
+// The names of the other files must be unique and not reserved by the template and the base context.
+func cueTemplateFiles(c *v1alpha2.CUE) ([]v1alpha2.CUEFile, error) {
+	templateStr, err := DecodeTemplate(c.Template)
+	if err != nil {
+		return nil, err
+	}
+	files := []v1alpha2.CUEFile{{Name: mainTemplateFile, Content: templateStr}}
+	names := map[string]bool{mainTemplateFile: true, "context": true}
+	for _, f := range c.Files {
+		if f.Name == "" {
+			return nil, errors.New("CUE file must have a name")
+		}
+		if names[f.Name] {
+			return nil, errors.Errorf("duplicate CUE file name %q", f.Name)
+		}
+		names[f.Name] = true
+		content, err := DecodeTemplate(f.Content)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "decode CUE file %s", f.Name)
+		}
+		files = append(files, v1alpha2.CUEFile{Name: f.Name, Content: content})
+	}
+	return files, nil
+}
+
+// mergeCUEFiles merges the files of a template into one, so that it's compiled like a template of a single file.
+// The imports are hoisted and deduplicated, and an error naming the files is returned if two files import
+// different packages by the same name, which can't be told apart in the merged template.
+func mergeCUEFiles(files []v1alpha2.CUEFile) (string, error) {
+	type importedBy struct {
+		path string
+		file string
+	}
+	importNames := map[string]importedBy{}
+	imports := &ast.ImportDecl{}
+	var decls []ast.Decl
+	for _, file := range files {
+		f, err := parser.ParseFile(file.Name, file.Content, parser.ParseComments)
+		if err != nil {
+			return "", errors.WithMessagef(err, "parse CUE file %s", displayFileName(file.Name))
+		}
+		for _, d := range f.Decls {
+			switch x := d.(type) {
+			case *ast.ImportDecl:
+				for _, spec := range x.Specs {
+					path, err := strconv.Unquote(spec.Path.Value)
+					if err != nil {
+						return "", errors.WithMessagef(err, "parse CUE file %s", displayFileName(file.Name))
+					}
+					name := importName(spec, path)
+					if prev, ok := importNames[name]; ok {
+						if prev.path != path {
+							return "", errors.Errorf("import name %q collides: %s imports %q, but %s imports %q",
+								name, displayFileName(prev.file), prev.path, displayFileName(file.Name), path)
+						}
+						continue
+					}
+					importNames[name] = importedBy{path: path, file: file.Name}
+					imports.Specs = append(imports.Specs, spec)
+				}
+				continue
+			case *ast.Package:
+				continue
+			}
+			decls = append(decls, d)
+		}
+	}
+	// the declarations come from separate files, keep them on separate lines
+	for i, d := range decls {
+		if i > 0 && !d.Pos().IsNewline() {
+			ast.SetRelPos(d, token.Newline)
+		}
+	}
+	if len(imports.Specs) > 0 {
+		// a single import is kept on the line of the keyword, grouped ones go on separate lines
+		pos := token.Blank
+		if len(imports.Specs) > 1 {
+			pos = token.Newline
+		}
+		for _, spec := range imports.Specs {
+			ast.SetRelPos(spec, pos)
+		}
+		decls = append([]ast.Decl{imports}, decls...)
+	}
+	b, err := format.Node(&ast.File{Decls: decls})
+	if err != nil {
+		return "", errors.Wrap(err, "format template")
+	}
+	return string(b), nil
+}
+
+// importName returns the name which the package is referenced by in the file
+func importName(spec *ast.ImportSpec, path string) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+	name := path[strings.LastIndex(path, "/")+1:]
+	// a qualifier like "example.com/pkg:name" names the package explicitly
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// validateCUEFiles compiles the files of a template as one instance with the base context, it returns a
+// *TemplateParseError with the files and positions of the CUE errors.
+func validateCUEFiles(r *cue.Runtime, files []v1alpha2.CUEFile, imports map[string]map[string]string) error {
+	merged, err := mergeCUEFiles(files)
+	if err != nil {
+		return err
+	}
+	if err := checkImportsResolved(merged, imports); err != nil {
+		return err
+	}
+	bctx := build.NewContext()
+	bi := bctx.NewInstance("", importLoader(bctx, imports))
+	sources := map[string]string{}
+	for _, f := range files {
+		sources[f.Name] = f.Content
+		if err := bi.AddFile(f.Name, f.Content); err != nil {
+			return newTemplateFilesParseError(sources, err)
+		}
+	}
+	if err := bi.AddFile("context", mycue.BaseTemplate); err != nil {
+		return err
+	}
+	if r == nil {
+		r = &cue.Runtime{}
+	}
+	if _, err := r.Build(bi); err != nil {
+		return newTemplateFilesParseError(sources, err)
+	}
+	return nil
+}
+
+// displayFileName returns the name of the file in errors
+func displayFileName(name string) string {
+	if name == mainTemplateFile {
+		return "template"
+	}
+	return name
+}
+
+// cueTemplateOfFiles returns the template merged from the files of a CUE schematic
+func cueTemplateOfFiles(c *v1alpha2.CUE) (string, error) {
+	files, err := cueTemplateFiles(c)
+	if err != nil {
+		return "", err
+	}
+	return mergeCUEFiles(files)
+}
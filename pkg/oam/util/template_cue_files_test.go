@@ -0,0 +1,107 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+)
+
+func TestNewTemplateWithCUEFiles(t *testing.T) {
+	schematic := &v1alpha2.Schematic{CUE: &v1alpha2.CUE{
+		Template: `import "strings"
+
+output: {
+	apiVersion: "apps/v1"
+	kind:       "Deployment"
+	metadata: name: strings.ToLower(context.name)
+	spec: replicas: parameter.replicas
+}
+`,
+		Files: []v1alpha2.CUEFile{{
+			Name: "parameter.cue",
+			Content: `import "strings"
+
+parameter: {
+	replicas: *1 | int
+	image:    string
+}
+output: spec: template: spec: containers: [{image: strings.TrimSpace(parameter.image)}]
+`,
+		}},
+	}}
+	tmpl, err := NewTemplateWithOptions(schematic, nil, nil, WithCUEValidation())
+	assert.NoError(t, err)
+	assert.Equal(t, `import "strings"
+
+output: {
+	apiVersion: "apps/v1"
+	kind:       "Deployment"
+	metadata: name: strings.ToLower(context.name)
+	spec: replicas: parameter.replicas
+}
+
+parameter: {
+	replicas: *1 | int
+	image:    string
+}
+output: spec: template: spec: containers: [{image: strings.TrimSpace(parameter.image)}]
+`, tmpl.TemplateStr)
+	assert.True(t, tmpl.HasParameters())
+	defaults, err := tmpl.ParameterDefaults()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"replicas": float64(1)}, defaults)
+}
+
+func TestNewTemplateWithInvalidCUEFiles(t *testing.T) {
+	testCases := map[string]struct {
+		files []v1alpha2.CUEFile
+		err   string
+	}{
+		"duplicate name": {
+			files: []v1alpha2.CUEFile{{Name: "a.cue", Content: "a: 1"}, {Name: "a.cue", Content: "b: 1"}},
+			err:   `duplicate CUE file name "a.cue"`,
+		},
+		"reserved name": {
+			files: []v1alpha2.CUEFile{{Name: "context", Content: "a: 1"}},
+			err:   `duplicate CUE file name "context"`,
+		},
+		"import name collision": {
+			files: []v1alpha2.CUEFile{
+				{Name: "a.cue", Content: "import \"vela.dev/a/lib\"\n\na: lib.#A\n"},
+				{Name: "b.cue", Content: "import \"vela.dev/b/lib\"\n\nb: lib.#B\n"},
+			},
+			err: `import name "lib" collides: a.cue imports "vela.dev/a/lib", but b.cue imports "vela.dev/b/lib"`,
+		},
+		"syntax error": {
+			files: []v1alpha2.CUEFile{{Name: "broken.cue", Content: "parameter: {"}},
+			err:   "parse CUE file broken.cue",
+		},
+	}
+	for name, tc := range testCases {
+		_, err := NewTemplate(&v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}", Files: tc.files}}, nil, nil)
+		if assert.Error(t, err, name) {
+			assert.Contains(t, err.Error(), tc.err, name)
+		}
+	}
+
+	// compile errors are reported in the file which causes them
+	schematic := &v1alpha2.Schematic{CUE: &v1alpha2.CUE{
+		Template: "output: kind: \"Deployment\"\n",
+		Files:    []v1alpha2.CUEFile{{Name: "job.cue", Content: "parameter: {}\n\noutput: spec: replicas: parameters.replicas\n"}},
+	}}
+	_, err := NewTemplate(schematic, nil, nil)
+	assert.NoError(t, err, "files are only compiled with validation")
+	_, err = NewTemplateWithOptions(schematic, nil, nil, WithCUEValidation())
+	parseErr, ok := errors.Cause(err).(*TemplateParseError)
+	if assert.True(t, ok, "%v", err) {
+		var files []string
+		for _, pos := range parseErr.Errors {
+			files = append(files, pos.File)
+		}
+		assert.Contains(t, files, "job.cue")
+		assert.Contains(t, err.Error(), "file job.cue, line 3, column")
+	}
+}
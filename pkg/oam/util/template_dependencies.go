@@ -0,0 +1,110 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/kubevela/pkg/oam/discoverymapper"
+)
+
+// AnnotationDependsOn lists the capabilities which a ScopeDefinition coordinates with, separated by comma.
+// Each of them is referenced by "<kind>/<name>" with a TemplateKind, e.g. "trait/ingress,componentDefinition/worker".
+const AnnotationDependsOn = "definition.oam.dev/depends-on"
+
+// TemplateDependency is a capability referenced by the AnnotationDependsOn of a definition
+type TemplateDependency struct {
+	Kind TemplateKind
+	Name string
+	// Template is the template of the capability, it's only set by LoadWithDependencies and nil if it's not found
+	Template *Template
+}
+
+func (d TemplateDependency) String() string {
+	return string(d.Kind) + "/" + d.Name
+}
+
+// LoadWithDependencies makes LoadTemplate resolve the templates of the capabilities referenced by the
+// AnnotationDependsOn of the definition, and of their dependencies in turn. Missing references and cycles
+// don't fail the loading, they are reported in Template.DependencyWarnings.
+func LoadWithDependencies() LoadTemplateOption {
+	return func(o *loadTemplateOptions) {
+		o.resolveDependencies = true
+	}
+}
+
+// templateDependencies parses the AnnotationDependsOn of a definition, invalid references are returned as warnings
+func templateDependencies(annotations map[string]string) ([]TemplateDependency, []string) {
+	var deps []TemplateDependency
+	var warnings []string
+	for _, ref := range strings.Split(annotations[AnnotationDependsOn], ",") {
+		if ref = strings.TrimSpace(ref); ref == "" {
+			continue
+		}
+		parts := strings.SplitN(ref, "/", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			warnings = append(warnings, fmt.Sprintf("invalid dependency %q, expect <kind>/<name>", ref))
+			continue
+		}
+		kd, err := ParseTemplateKind(parts[0])
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("invalid dependency %q: %v", ref, err))
+			continue
+		}
+		deps = append(deps, TemplateDependency{Kind: kd, Name: parts[1]})
+	}
+	return deps, warnings
+}
+
+// withDependencies loads the dependencies of the template of kind kd if LoadWithDependencies is set
+func (o *loadTemplateOptions) withDependencies(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper,
+	kd TemplateKind, tmpl *Template) error {
+	if !o.resolveDependencies || len(tmpl.Dependencies) == 0 {
+		return nil
+	}
+	return o.loadDependencies(ctx, cli, dm, kd, tmpl, []string{string(kd) + "/" + tmpl.Name})
+}
+
+// loadDependencies loads the templates of the dependencies of tmpl, the template of kind kd at the end of chain,
+// and of their dependencies. The warnings are added to the DependencyWarnings of tmpl.
+func (o *loadTemplateOptions) loadDependencies(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper,
+	kd TemplateKind, tmpl *Template, chain []string) error {
+	for i := range tmpl.Dependencies {
+		dep := &tmpl.Dependencies[i]
+		depChain := append(append([]string{}, chain...), dep.String())
+		if cyclic(chain, dep.String()) {
+			tmpl.DependencyWarnings = append(tmpl.DependencyWarnings,
+				fmt.Sprintf("cyclic dependency %s", strings.Join(depChain, " -> ")))
+			continue
+		}
+		depTmpl, _, err := loadTemplateWithSource(ctx, cli, dm, dep.Name, dep.Kind, o)
+		if kerrors.IsNotFound(errors.Cause(err)) {
+			tmpl.DependencyWarnings = append(tmpl.DependencyWarnings,
+				fmt.Sprintf("%s depends on %s which is not found", chain[len(chain)-1], dep))
+			continue
+		}
+		if err != nil {
+			return errors.WithMessagef(err, "load dependency %s of %s %s", dep, kd, tmpl.Name)
+		}
+		if err := o.loadDependencies(ctx, cli, dm, dep.Kind, depTmpl, depChain); err != nil {
+			return err
+		}
+		dep.Template = depTmpl
+		tmpl.DependencyWarnings = append(tmpl.DependencyWarnings, depTmpl.DependencyWarnings...)
+	}
+	return nil
+}
+
+// cyclic returns true if ref is in the chain of dependencies
+func cyclic(chain []string, ref string) bool {
+	for _, r := range chain {
+		if r == ref {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/stretchr/testify/assert"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ktypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+func TestLoadWithDependencies(t *testing.T) {
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			switch o := obj.(type) {
+			case *v1alpha2.ScopeDefinition:
+				o.Name = key.Name
+				o.Spec.Reference = v1alpha2.DefinitionReference{Name: "healthscopes.core.oam.dev"}
+				o.Annotations = map[string]string{AnnotationDependsOn: "trait/ingress, trait/missing, scope/health, invalid"}
+				return nil
+			case *v1alpha2.TraitDefinition:
+				if key.Name == "ingress" {
+					o.Name = key.Name
+					o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "outputs: ingress: {}"}}
+					return nil
+				}
+			}
+			return kerrors.NewNotFound(schema.GroupResource{}, key.Name)
+		},
+		MockList: test.NewMockListFn(nil),
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	dm.MockKindsFor = mock.NewMockKindsFor("HealthScope", "v1alpha2")
+
+	tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, "health", ScopeTemplateKind, LoadWithDependencies())
+	assert.NoError(t, err)
+	assert.Len(t, tmpl.Dependencies, 3)
+	assert.Equal(t, "trait/ingress", tmpl.Dependencies[0].String())
+	if assert.NotNil(t, tmpl.Dependencies[0].Template) {
+		assert.Equal(t, "outputs: ingress: {}", tmpl.Dependencies[0].Template.TemplateStr)
+	}
+	assert.Nil(t, tmpl.Dependencies[1].Template, "missing dependency is not resolved")
+	assert.Nil(t, tmpl.Dependencies[2].Template, "cyclic dependency is not resolved")
+	assert.Equal(t, []string{
+		`invalid dependency "invalid", expect <kind>/<name>`,
+		"scope/health depends on trait/missing which is not found",
+		"cyclic dependency scope/health -> scope/health",
+	}, tmpl.DependencyWarnings)
+
+	tmpl, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "health", ScopeTemplateKind)
+	assert.NoError(t, err)
+	assert.Len(t, tmpl.Dependencies, 3)
+	assert.Nil(t, tmpl.Dependencies[0].Template, "dependencies are only resolved with LoadWithDependencies")
+	assert.Equal(t, []string{`invalid dependency "invalid", expect <kind>/<name>`}, tmpl.DependencyWarnings)
+}
+
+func TestLoadWithDependenciesCycle(t *testing.T) {
+	dependsOn := map[string]string{"a": "scope/b", "b": "scope/a"}
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			if o, ok := obj.(*v1alpha2.ScopeDefinition); ok {
+				o.Name = key.Name
+				o.Spec.Reference = v1alpha2.DefinitionReference{Name: "healthscopes.core.oam.dev"}
+				o.Annotations = map[string]string{AnnotationDependsOn: dependsOn[key.Name]}
+			}
+			return nil
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	dm.MockKindsFor = mock.NewMockKindsFor("HealthScope", "v1alpha2")
+
+	tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, "a", ScopeTemplateKind, LoadWithDependencies())
+	assert.NoError(t, err)
+	assert.Equal(t, "b", tmpl.Dependencies[0].Template.Name)
+	assert.Equal(t, []string{"cyclic dependency scope/a -> scope/b -> scope/a"}, tmpl.DependencyWarnings)
+}
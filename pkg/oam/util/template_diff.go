@@ -0,0 +1,151 @@
+package util
+
+import (
+	"sort"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/format"
+	"github.com/pkg/errors"
+)
+
+// TemplateDiff is the difference between two templates, e.g. of two revisions of a definition.
+// Unchanged fields are nil or empty, it can be marshaled to JSON for rendering.
+type TemplateDiff struct {
+	Category     *ValueChange      `json:"category,omitempty"`
+	Health       *ValueChange      `json:"health,omitempty"`
+	CustomStatus *ValueChange      `json:"customStatus,omitempty"`
+	Parameters   []ParameterChange `json:"parameters,omitempty"`
+}
+
+// Empty returns true if there's no difference
+func (d TemplateDiff) Empty() bool {
+	return d.Category == nil && d.Health == nil && d.CustomStatus == nil && len(d.Parameters) == 0
+}
+
+// ValueChange is the old and new value of a changed field
+type ValueChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// ParameterChangeType is the type of the change of a parameter
+type ParameterChangeType string
+
+const (
+	// ParameterAdded means the parameter is only in the new template
+	ParameterAdded ParameterChangeType = "added"
+	// ParameterRemoved means the parameter is only in the old template
+	ParameterRemoved ParameterChangeType = "removed"
+	// ParameterChanged means the schema of the parameter is changed, e.g. its type or default value
+	ParameterChanged ParameterChangeType = "changed"
+)
+
+// ParameterChange is a change of a parameter, Old is nil for added parameters and New is nil for removed ones
+type ParameterChange struct {
+	// Path is the path of the parameter separated by dot, e.g. "env.debug"
+	Path string              `json:"path"`
+	Type ParameterChangeType `json:"type"`
+	Old  *ParameterSchema    `json:"old,omitempty"`
+	New  *ParameterSchema    `json:"new,omitempty"`
+}
+
+// ParameterSchema is the schema of a parameter
+type ParameterSchema struct {
+	// Type is the CUE expression of the parameter including its default value, e.g. `*1 | int`
+	Type     string `json:"type"`
+	Optional bool   `json:"optional,omitempty"`
+}
+
+// DiffTemplates compares the category, health policy, custom status and the parameter schema of two templates.
+// Parameters in nested structs are compared field by field.
+func DiffTemplates(oldTmpl, newTmpl *Template) (TemplateDiff, error) {
+	diff := TemplateDiff{}
+	if oldTmpl == nil || newTmpl == nil {
+		return diff, errors.New("cannot diff nil templates")
+	}
+	diff.Category = diffValue(string(oldTmpl.CapabilityCategory), string(newTmpl.CapabilityCategory))
+	diff.Health = diffValue(oldTmpl.Health, newTmpl.Health)
+	diff.CustomStatus = diffValue(oldTmpl.CustomStatus, newTmpl.CustomStatus)
+
+	oldParams, err := parameterSchemas(oldTmpl)
+	if err != nil {
+		return diff, errors.WithMessage(err, "old template")
+	}
+	newParams, err := parameterSchemas(newTmpl)
+	if err != nil {
+		return diff, errors.WithMessage(err, "new template")
+	}
+	for path, o := range oldParams {
+		n, ok := newParams[path]
+		switch {
+		case !ok:
+			diff.Parameters = append(diff.Parameters, ParameterChange{Path: path, Type: ParameterRemoved, Old: o})
+		case *o != *n:
+			diff.Parameters = append(diff.Parameters, ParameterChange{Path: path, Type: ParameterChanged, Old: o, New: n})
+		}
+	}
+	for path, n := range newParams {
+		if _, ok := oldParams[path]; !ok {
+			diff.Parameters = append(diff.Parameters, ParameterChange{Path: path, Type: ParameterAdded, New: n})
+		}
+	}
+	sort.Slice(diff.Parameters, func(i, j int) bool {
+		return diff.Parameters[i].Path < diff.Parameters[j].Path
+	})
+	return diff, nil
+}
+
+func diffValue(oldValue, newValue string) *ValueChange {
+	if oldValue == newValue {
+		return nil
+	}
+	return &ValueChange{Old: oldValue, New: newValue}
+}
+
+// parameterSchemas returns the schemas of the parameters of the template by path
+func parameterSchemas(t *Template) (map[string]*ParameterSchema, error) {
+	schemas := map[string]*ParameterSchema{}
+	if t.TemplateStr == "" {
+		return schemas, nil
+	}
+	inst, err := buildCUETemplate(nil, t.TemplateStr, t.Imports)
+	if err != nil {
+		return nil, errors.WithMessage(err, "compile template")
+	}
+	if err := collectParameterSchemas(inst.Lookup("parameter"), "", schemas); err != nil {
+		return nil, errors.WithMessage(err, "parse parameter")
+	}
+	return schemas, nil
+}
+
+// collectParameterSchemas collects the schemas of the fields of a struct, structs with fields are collected field by field
+func collectParameterSchemas(v cue.Value, prefix string, schemas map[string]*ParameterSchema) error {
+	if !v.Exists() {
+		return nil
+	}
+	it, err := v.Fields(cue.Optional(true))
+	if err != nil {
+		return err
+	}
+	for it.Next() {
+		path := prefix + it.Label()
+		field := it.Value()
+		if field.IncompleteKind() == cue.StructKind && hasFields(field) {
+			if err := collectParameterSchemas(field, path+".", schemas); err != nil {
+				return err
+			}
+			continue
+		}
+		typ, err := format.Node(field.Syntax())
+		if err != nil {
+			return errors.Wrapf(err, "format parameter %s", path)
+		}
+		schemas[path] = &ParameterSchema{Type: string(typ), Optional: it.IsOptional()}
+	}
+	return nil
+}
+
+func hasFields(v cue.Value) bool {
+	it, err := v.Fields(cue.Optional(true))
+	return err == nil && it.Next()
+}
@@ -0,0 +1,70 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oam-dev/kubevela/apis/types"
+)
+
+func TestDiffTemplates(t *testing.T) {
+	old := &Template{
+		CapabilityCategory: types.CUECategory,
+		Health:             "isHealth: true",
+		TemplateStr: `
+parameter: {
+	image:    string
+	replicas: *1 | int
+	env: {
+		debug: *false | bool
+		name?: string
+	}
+	cmd?: [...string]
+}
+output: {}`,
+	}
+
+	diff, err := DiffTemplates(old, old)
+	assert.NoError(t, err)
+	assert.True(t, diff.Empty())
+
+	upgraded := &Template{
+		CapabilityCategory: types.CUECategory,
+		Health:             "isHealth: context.output.status.ready",
+		CustomStatus:       `message: "ready"`,
+		TemplateStr: `
+parameter: {
+	image:    string
+	replicas: *3 | int
+	port:     *80 | int
+	env: {
+		debug: *false | bool
+		name:  string
+	}
+}
+output: {}`,
+	}
+	diff, err = DiffTemplates(old, upgraded)
+	assert.NoError(t, err)
+	assert.False(t, diff.Empty())
+	assert.Nil(t, diff.Category)
+	assert.Equal(t, &ValueChange{Old: "isHealth: true", New: "isHealth: context.output.status.ready"}, diff.Health)
+	assert.Equal(t, &ValueChange{Old: "", New: `message: "ready"`}, diff.CustomStatus)
+	assert.Equal(t, []ParameterChange{
+		{Path: "cmd", Type: ParameterRemoved, Old: &ParameterSchema{Type: "[...string]", Optional: true}},
+		{Path: "env.name", Type: ParameterChanged, Old: &ParameterSchema{Type: "string", Optional: true}, New: &ParameterSchema{Type: "string"}},
+		{Path: "port", Type: ParameterAdded, New: &ParameterSchema{Type: "*80 | int"}},
+		{Path: "replicas", Type: ParameterChanged, Old: &ParameterSchema{Type: "*1 | int"}, New: &ParameterSchema{Type: "*3 | int"}},
+	}, diff.Parameters)
+
+	diff, err = DiffTemplates(&Template{CapabilityCategory: types.HelmCategory}, &Template{TemplateStr: "parameter: name: string"})
+	assert.NoError(t, err)
+	assert.Equal(t, &ValueChange{Old: "helm", New: ""}, diff.Category)
+	assert.Equal(t, []ParameterChange{{Path: "name", Type: ParameterAdded, New: &ParameterSchema{Type: "string"}}}, diff.Parameters)
+
+	_, err = DiffTemplates(old, &Template{TemplateStr: "parameter: {"})
+	assert.Error(t, err)
+	_, err = DiffTemplates(nil, old)
+	assert.Error(t, err)
+}
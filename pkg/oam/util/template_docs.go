@@ -0,0 +1,236 @@
+package util
+
+import (
+	"encoding/json"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"github.com/pkg/errors"
+
+	mycue "github.com/oam-dev/kubevela/pkg/cue"
+)
+
+const (
+	// ExampleTag is the comment marker of the example value of a parameter field, e.g. `// +example=nginx:1.19`.
+	// The value is decoded as JSON, or kept as a string if it isn't valid JSON.
+	ExampleTag = "+example="
+	// ExamplesFieldName is the field of a CUE template which declares the example values of the parameter,
+	// e.g. `examples: resources: cpu: "0.5"`
+	ExamplesFieldName = "examples"
+	// LocalizedUsageTag is the comment marker of the usage of a parameter field in a locale, e.g.
+	// `// +usage:zh=镜像名称`, see ExtractParameterDocsLocalized
+	LocalizedUsageTag = "+usage:"
+)
+
+// ExtractParameterDocs returns the descriptions of the parameter fields of the CUE template by the path of the
+// fields, e.g. "resources.cpu" for nested ones. The description is the `// +usage=` marker of a field, or its
+// comment without markers if it has no usage. Fields without docs map to empty strings.
+func ExtractParameterDocs(tmpl *Template) (map[string]string, error) {
+	docs := map[string]string{}
+	if !tmpl.IsCUE() {
+		return docs, nil
+	}
+	inst, err := buildCUETemplate(nil, tmpl.TemplateStr, tmpl.Imports)
+	if err != nil {
+		return nil, tmpl.withCapabilityName(errors.WithMessage(err, "compile template"))
+	}
+	if err := collectParameterDocs(inst.Lookup("parameter"), "", docs, fieldDescription); err != nil {
+		return nil, tmpl.withCapabilityName(errors.WithMessage(err, "extract parameter docs"))
+	}
+	return docs, nil
+}
+
+// ExtractParameterDocsLocalized returns the descriptions of the parameter fields like ExtractParameterDocs, in the
+// locale if they're declared by the `// +usage:<locale>=` markers, e.g. "zh" or "zh-CN". The marker of the locale
+// is preferred, then the one of its language, e.g. "zh" for "zh-CN", and the description of ExtractParameterDocs
+// is returned for the fields without them, so unknown locales fall back to the default descriptions.
+func ExtractParameterDocsLocalized(tmpl *Template, locale string) (map[string]string, error) {
+	docs := map[string]string{}
+	if !tmpl.IsCUE() {
+		return docs, nil
+	}
+	inst, err := buildCUETemplate(nil, tmpl.TemplateStr, tmpl.Imports)
+	if err != nil {
+		return nil, tmpl.withCapabilityName(errors.WithMessage(err, "compile template"))
+	}
+	candidates := localeCandidates(locale)
+	describe := func(v cue.Value) string {
+		usages := localizedUsages(v)
+		for _, l := range candidates {
+			if usage, ok := usages[l]; ok {
+				return usage
+			}
+		}
+		return fieldDescription(v)
+	}
+	if err := collectParameterDocs(inst.Lookup("parameter"), "", docs, describe); err != nil {
+		return nil, tmpl.withCapabilityName(errors.WithMessage(err, "extract parameter docs"))
+	}
+	return docs, nil
+}
+
+// localeCandidates returns the normalized locales to look up for the locale, from the most specific,
+// e.g. "zh-cn" and "zh" for "zh_CN"
+func localeCandidates(locale string) []string {
+	locale = normalizeLocale(locale)
+	if locale == "" {
+		return nil
+	}
+	candidates := []string{locale}
+	for i := strings.LastIndex(locale, "-"); i > 0; i = strings.LastIndex(locale, "-") {
+		locale = locale[:i]
+		candidates = append(candidates, locale)
+	}
+	return candidates
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// localizedUsages returns the `// +usage:<locale>=` markers of the field by the normalized locale
+func localizedUsages(v cue.Value) map[string]string {
+	usages := map[string]string{}
+	for _, doc := range v.Doc() {
+		for _, line := range strings.Split(doc.Text(), "\n") {
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, LocalizedUsageTag) {
+				continue
+			}
+			marker := strings.SplitN(strings.TrimPrefix(line, LocalizedUsageTag), "=", 2)
+			if len(marker) != 2 {
+				continue
+			}
+			usages[normalizeLocale(marker[0])] = strings.TrimSpace(marker[1])
+		}
+	}
+	return usages
+}
+
+// collectParameterDocs collects the docs of the fields of a struct and its nested structs into docs,
+// the doc of a field is described by describe
+func collectParameterDocs(v cue.Value, prefix string, docs map[string]string, describe func(cue.Value) string) error {
+	if !v.Exists() || v.IncompleteKind() != cue.StructKind {
+		return nil
+	}
+	it, err := v.Fields(cue.Optional(true))
+	if err != nil {
+		return err
+	}
+	for it.Next() {
+		path := prefix + it.Label()
+		docs[path] = describe(it.Value())
+		if err := collectParameterDocs(it.Value(), path+".", docs, describe); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldDescription returns the usage of the field, or its comment without markers like `+short=`
+func fieldDescription(v cue.Value) string {
+	if _, usage, _ := mycue.RetrieveComments(v); usage != "" {
+		return strings.TrimSpace(usage)
+	}
+	var lines []string
+	for _, doc := range v.Doc() {
+		for _, line := range strings.Split(doc.Text(), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "+") {
+				continue
+			}
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, " ")
+}
+
+// ExtractParameterExamples returns the example values of the parameter fields of the CUE template by the path of the
+// fields, like ExtractParameterDocs. The examples are declared by the `// +example=` marker of a field, or in the
+// `examples` field of the template, the marker takes precedence. It returns an empty map if there are no examples.
+func ExtractParameterExamples(tmpl *Template) (map[string]interface{}, error) {
+	examples := map[string]interface{}{}
+	if !tmpl.IsCUE() {
+		return examples, nil
+	}
+	inst, err := buildCUETemplate(nil, tmpl.TemplateStr, tmpl.Imports)
+	if err != nil {
+		return nil, tmpl.withCapabilityName(errors.WithMessage(err, "compile template"))
+	}
+	parameter := inst.Lookup("parameter")
+	if err := collectDeclaredExamples(inst.Lookup(ExamplesFieldName), parameter, "", examples); err != nil {
+		return nil, tmpl.withCapabilityName(errors.WithMessage(err, "extract parameter examples"))
+	}
+	if err := collectMarkedExamples(parameter, "", examples); err != nil {
+		return nil, tmpl.withCapabilityName(errors.WithMessage(err, "extract parameter examples"))
+	}
+	return examples, nil
+}
+
+// collectDeclaredExamples collects the values of the `examples` field, the value of a struct parameter is
+// collected by its fields so that the paths match the ones of the markers
+func collectDeclaredExamples(v, parameter cue.Value, prefix string, examples map[string]interface{}) error {
+	if !v.Exists() {
+		return nil
+	}
+	it, err := v.Fields()
+	if err != nil {
+		return err
+	}
+	for it.Next() {
+		path := prefix + it.Label()
+		param := parameter.Lookup(it.Label())
+		if it.Value().IncompleteKind() == cue.StructKind && param.Exists() && param.IncompleteKind() == cue.StructKind {
+			if err := collectDeclaredExamples(it.Value(), param, path+".", examples); err != nil {
+				return err
+			}
+			continue
+		}
+		var value interface{}
+		if err := it.Value().Decode(&value); err != nil {
+			return errors.WithMessagef(err, "decode example of %s", path)
+		}
+		examples[path] = value
+	}
+	return nil
+}
+
+// collectMarkedExamples collects the `// +example=` markers of the fields of a struct and its nested structs
+func collectMarkedExamples(v cue.Value, prefix string, examples map[string]interface{}) error {
+	if !v.Exists() || v.IncompleteKind() != cue.StructKind {
+		return nil
+	}
+	it, err := v.Fields(cue.Optional(true))
+	if err != nil {
+		return err
+	}
+	for it.Next() {
+		path := prefix + it.Label()
+		if example, ok := exampleMarker(it.Value()); ok {
+			examples[path] = example
+		}
+		if err := collectMarkedExamples(it.Value(), path+".", examples); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exampleMarker returns the value of the `// +example=` marker of the field
+func exampleMarker(v cue.Value) (interface{}, bool) {
+	for _, doc := range v.Doc() {
+		for _, line := range strings.Split(doc.Text(), "\n") {
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, ExampleTag) {
+				continue
+			}
+			raw := strings.TrimSpace(strings.TrimPrefix(line, ExampleTag))
+			var value interface{}
+			if err := json.Unmarshal([]byte(raw), &value); err != nil {
+				return raw, true
+			}
+			return value, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,160 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+)
+
+func TestExtractParameterDocs(t *testing.T) {
+	tmpl := &Template{Name: "webservice", TemplateStr: `
+output: spec: replicas: parameter.replicas
+parameter: {
+	// +usage=Which image would you like to use for your service
+	// +short=i
+	image: string
+
+	// The number of replicas
+	// of the service
+	replicas: *1 | int
+
+	port?: int
+
+	resources: {
+		// +usage=CPU units of the service, like ` + "`0.5`" + `
+		cpu?: string
+		memory?: string
+	}
+}
+`}
+	docs, err := ExtractParameterDocs(tmpl)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"image":            "Which image would you like to use for your service",
+		"replicas":         "The number of replicas of the service",
+		"port":             "",
+		"resources":        "",
+		"resources.cpu":    "CPU units of the service, like `0.5`",
+		"resources.memory": "",
+	}, docs)
+
+	docs, err = ExtractParameterDocs(&Template{TemplateStr: "output: {}"})
+	assert.NoError(t, err)
+	assert.Empty(t, docs, "template without parameter has no docs")
+
+	docs, err = ExtractParameterDocs(&Template{Helm: &v1alpha2.Helm{}})
+	assert.NoError(t, err)
+	assert.Empty(t, docs)
+
+	_, err = ExtractParameterDocs(&Template{Name: "broken", TemplateStr: "parameter: {"})
+	assert.Error(t, err)
+}
+
+func TestExtractParameterDocsLocalized(t *testing.T) {
+	tmpl := &Template{Name: "webservice", TemplateStr: `
+parameter: {
+	// +usage=Which image would you like to use for your service
+	// +usage:zh=服务使用的镜像
+	// +usage:fr=L'image utilisée par le service
+	image: string
+
+	// +usage=The number of replicas
+	// +usage:zh-TW=服務的副本數
+	replicas: *1 | int
+
+	// The port of the service
+	port?: int
+}
+`}
+	testCases := map[string]map[string]string{
+		"zh": {
+			"image":    "服务使用的镜像",
+			"replicas": "The number of replicas",
+			"port":     "The port of the service",
+		},
+		"zh_TW": {
+			"image":    "服务使用的镜像",
+			"replicas": "服務的副本數",
+			"port":     "The port of the service",
+		},
+		"fr-CA": {
+			"image":    "L'image utilisée par le service",
+			"replicas": "The number of replicas",
+			"port":     "The port of the service",
+		},
+		"de": {
+			"image":    "Which image would you like to use for your service",
+			"replicas": "The number of replicas",
+			"port":     "The port of the service",
+		},
+		"": {
+			"image":    "Which image would you like to use for your service",
+			"replicas": "The number of replicas",
+			"port":     "The port of the service",
+		},
+	}
+	for locale, exp := range testCases {
+		docs, err := ExtractParameterDocsLocalized(tmpl, locale)
+		assert.NoError(t, err, locale)
+		assert.Equal(t, exp, docs, locale)
+	}
+
+	_, err := ExtractParameterDocsLocalized(&Template{Name: "broken", TemplateStr: "parameter: {"}, "zh")
+	assert.Error(t, err)
+}
+
+func TestExtractParameterExamples(t *testing.T) {
+	tmpl := &Template{Name: "webservice", TemplateStr: `
+output: spec: replicas: parameter.replicas
+parameter: {
+	// +usage=Which image would you like to use for your service
+	// +example=nginx:1.19
+	image: string
+
+	// +example=3
+	replicas: *1 | int
+
+	// +example=["80", "443"]
+	ports?: [...string]
+
+	env?: [string]: string
+
+	resources: {
+		// +example="0.5"
+		cpu?: string
+		memory?: string
+	}
+}
+examples: {
+	replicas: 2
+	env: {DEBUG: "true"}
+	resources: memory: "1Gi"
+}
+`}
+	examples, err := ExtractParameterExamples(tmpl)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"image":            "nginx:1.19",
+		"replicas":         float64(3),
+		"ports":            []interface{}{"80", "443"},
+		"env":              map[string]interface{}{"DEBUG": "true"},
+		"resources.cpu":    "0.5",
+		"resources.memory": "1Gi",
+	}, examples)
+
+	examples, err = ExtractParameterExamples(&Template{TemplateStr: `
+output: spec: replicas: parameter.replicas
+parameter: replicas: *1 | int
+`})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{}, examples, "template without examples")
+
+	examples, err = ExtractParameterExamples(&Template{Helm: &v1alpha2.Helm{}})
+	assert.NoError(t, err)
+	assert.Empty(t, examples)
+
+	_, err = ExtractParameterExamples(&Template{Name: "broken", TemplateStr: "parameter: {"})
+	assert.Error(t, err)
+}
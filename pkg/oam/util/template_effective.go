@@ -0,0 +1,121 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"github.com/pkg/errors"
+)
+
+// the layers of parameter values, from the lowest precedence to the highest
+const (
+	platformDefaultsLayer = "platform defaults"
+	userValuesLayer       = "user values"
+)
+
+// EffectiveParameters resolves the parameter values of the template, the values set by user override the platform-wide
+// defaults, which override the defaults of the definition, e.g. `replicas: *1 | int`. Nested values are merged field by
+// field, other values including lists are replaced as a whole. The merged values are unified with the parameter of the
+// template, values conflicting with it are reported as a *ParameterValidationError naming the layer setting them.
+// Required fields without values are left out rather than reported, since they may be set later.
+func EffectiveParameters(tmpl *Template, platformDefaults, userValues map[string]interface{}) (map[string]interface{}, error) {
+	sources := map[string]string{}
+	merged := map[string]interface{}{}
+	mergeParameterValues(merged, platformDefaults, "", platformDefaultsLayer, sources)
+	mergeParameterValues(merged, userValues, "", userValuesLayer, sources)
+	if !tmpl.IsCUE() {
+		return merged, nil
+	}
+	inst, err := buildCUETemplate(nil, tmpl.TemplateStr, tmpl.Imports)
+	if err != nil {
+		return nil, tmpl.withCapabilityName(errors.WithMessage(err, "compile template"))
+	}
+	parameter := inst.Lookup("parameter")
+	if !parameter.Exists() {
+		return merged, nil
+	}
+	parameter = parameter.Fill(merged)
+	if err := parameter.Validate(); err != nil {
+		validationErr := newParameterValidationError(err)
+		for i, pe := range validationErr.Errors {
+			if layer := sourceOfPath(sources, pe.Path); layer != "" {
+				validationErr.Errors[i].Message = fmt.Sprintf("%s, set by %s", pe.Message, layer)
+			}
+		}
+		return nil, tmpl.withCapabilityName(validationErr)
+	}
+	effective := map[string]interface{}{}
+	if err := collectEffectiveValues(parameter, effective); err != nil {
+		return nil, tmpl.withCapabilityName(errors.WithMessage(err, "resolve parameter values"))
+	}
+	return effective, nil
+}
+
+// mergeParameterValues merges the values into dst, nested maps are copied so that the values are never modified.
+// The layer of each value merged is recorded in sources by its path.
+func mergeParameterValues(dst, values map[string]interface{}, prefix, layer string, sources map[string]string) {
+	for k, v := range values {
+		path := prefix + k
+		if nested, ok := v.(map[string]interface{}); ok {
+			existing, ok := dst[k].(map[string]interface{})
+			if !ok {
+				existing = map[string]interface{}{}
+				dst[k] = existing
+			}
+			sources[path] = layer
+			mergeParameterValues(existing, nested, path+".", layer, sources)
+			continue
+		}
+		dst[k] = v
+		sources[path] = layer
+	}
+}
+
+// sourceOfPath returns the layer which sets the value of the path or its closest parent,
+// it's empty if the value comes from the definition
+func sourceOfPath(sources map[string]string, path string) string {
+	for p := path; p != ""; {
+		if layer, ok := sources[p]; ok {
+			return layer
+		}
+		i := strings.LastIndex(p, ".")
+		if i < 0 {
+			break
+		}
+		p = p[:i]
+	}
+	return ""
+}
+
+// collectEffectiveValues collects the concrete values of the fields of a struct into values, the default values are
+// taken for the fields without values, and fields which are neither set nor defaulted are left out
+func collectEffectiveValues(v cue.Value, values map[string]interface{}) error {
+	var ierr error
+	err := iterateFields(v, func(name string, field cue.Value) {
+		if ierr != nil {
+			return
+		}
+		if field.IncompleteKind() == cue.StructKind {
+			nested := map[string]interface{}{}
+			if ierr = collectEffectiveValues(field, nested); ierr == nil && len(nested) > 0 {
+				values[name] = nested
+			}
+			return
+		}
+		d, _ := field.Default()
+		if !d.IsConcrete() {
+			return
+		}
+		var value interface{}
+		if ierr = d.Decode(&value); ierr != nil {
+			ierr = errors.WithMessagef(ierr, "decode value of %s", name)
+			return
+		}
+		values[name] = value
+	})
+	if err != nil {
+		return err
+	}
+	return ierr
+}
@@ -0,0 +1,83 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+)
+
+func TestEffectiveParameters(t *testing.T) {
+	tmpl := &Template{Name: "webservice", TemplateStr: `
+output: spec: replicas: parameter.replicas
+parameter: {
+	image:    string
+	replicas: *1 | int
+	port:     *80 | int
+	resources: {
+		cpu:    *"0.5" | string
+		memory: *"256Mi" | string
+	}
+	env?: [...string]
+}
+`}
+	testCases := map[string]struct {
+		platform map[string]interface{}
+		user     map[string]interface{}
+		exp      map[string]interface{}
+	}{
+		"definition defaults": {
+			exp: map[string]interface{}{
+				"replicas":  float64(1),
+				"port":      float64(80),
+				"resources": map[string]interface{}{"cpu": "0.5", "memory": "256Mi"},
+			},
+		},
+		"platform defaults win over definition": {
+			platform: map[string]interface{}{"replicas": 2, "resources": map[string]interface{}{"memory": "1Gi"}},
+			exp: map[string]interface{}{
+				"replicas":  float64(2),
+				"port":      float64(80),
+				"resources": map[string]interface{}{"cpu": "0.5", "memory": "1Gi"},
+			},
+		},
+		"user values win over platform": {
+			platform: map[string]interface{}{"replicas": 2, "resources": map[string]interface{}{"memory": "1Gi"}},
+			user: map[string]interface{}{
+				"image":     "nginx",
+				"replicas":  3,
+				"resources": map[string]interface{}{"memory": "2Gi"},
+				"env":       []string{"DEBUG=true"},
+			},
+			exp: map[string]interface{}{
+				"image":     "nginx",
+				"replicas":  float64(3),
+				"port":      float64(80),
+				"resources": map[string]interface{}{"cpu": "0.5", "memory": "2Gi"},
+				"env":       []interface{}{"DEBUG=true"},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			params, err := EffectiveParameters(tmpl, tc.platform, tc.user)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.exp, params)
+		})
+	}
+
+	platform := map[string]interface{}{"resources": map[string]interface{}{"memory": "1Gi"}}
+	_, err := EffectiveParameters(tmpl, platform, map[string]interface{}{"resources": map[string]interface{}{"cpu": "1"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"resources": map[string]interface{}{"memory": "1Gi"}}, platform, "inputs must not be modified")
+
+	_, err = EffectiveParameters(tmpl, map[string]interface{}{"port": "http"}, map[string]interface{}{"replicas": "three"})
+	assert.EqualError(t, err, "capability webservice: invalid parameters: "+
+		"port: conflicting values (*80 | int) and \"http\" (mismatched types int and string), set by platform defaults; "+
+		"replicas: conflicting values (*1 | int) and \"three\" (mismatched types int and string), set by user values")
+
+	params, err := EffectiveParameters(&Template{Helm: &v1alpha2.Helm{}}, map[string]interface{}{"replicaCount": 2}, map[string]interface{}{"image": "nginx"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"replicaCount": 2, "image": "nginx"}, params)
+}
@@ -0,0 +1,58 @@
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// EncodedTemplatePrefix marks a CUE template in a definition as gzip compressed and base64 encoded,
+// so that templates larger than the size limit of a CRD can be shipped. It's decoded by NewTemplate.
+const EncodedTemplatePrefix = "gzip+base64:"
+
+// maxDecodedTemplateSize is the max size of a decoded CUE template, so that a small payload which decompresses to
+// a huge template can't exhaust the memory
+const maxDecodedTemplateSize = 16 << 20
+
+// EncodeTemplate compresses the CUE template with gzip and encodes it with base64, with EncodedTemplatePrefix
+func EncodeTemplate(templateStr string) (string, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(templateStr)); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return EncodedTemplatePrefix + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecodeTemplate decodes the CUE template encoded by EncodeTemplate, templates without EncodedTemplatePrefix are returned as is.
+// It returns an error if the decoded template is larger than 16MiB.
+func DecodeTemplate(templateStr string) (string, error) {
+	if !strings.HasPrefix(templateStr, EncodedTemplatePrefix) {
+		return templateStr, nil
+	}
+	compressed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(strings.TrimPrefix(templateStr, EncodedTemplatePrefix)))
+	if err != nil {
+		return "", errors.Wrap(err, "cannot decode the base64 of the encoded CUE template")
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return "", errors.Wrap(err, "cannot decompress the encoded CUE template")
+	}
+	defer zr.Close()
+	decoded, err := ioutil.ReadAll(io.LimitReader(zr, maxDecodedTemplateSize+1))
+	if err != nil {
+		return "", errors.Wrap(err, "cannot decompress the encoded CUE template")
+	}
+	if len(decoded) > maxDecodedTemplateSize {
+		return "", errors.Errorf("the decoded CUE template exceeds the max size of %d bytes", maxDecodedTemplateSize)
+	}
+	return string(decoded), nil
+}
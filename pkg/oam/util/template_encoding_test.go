@@ -0,0 +1,61 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+)
+
+func TestEncodeTemplate(t *testing.T) {
+	templates := []string{
+		"",
+		"output: kind: \"Deployment\"\n",
+		strings.Repeat("parameter: name: string\n", 10000),
+	}
+	for _, templateStr := range templates {
+		encoded, err := EncodeTemplate(templateStr)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(encoded, EncodedTemplatePrefix))
+		decoded, err := DecodeTemplate(encoded)
+		assert.NoError(t, err)
+		assert.Equal(t, templateStr, decoded)
+	}
+
+	decoded, err := DecodeTemplate("output: {}")
+	assert.NoError(t, err)
+	assert.Equal(t, "output: {}", decoded, "plain templates should be untouched")
+
+	_, err = DecodeTemplate(EncodedTemplatePrefix + "not base64!")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "base64")
+	_, err = DecodeTemplate(EncodedTemplatePrefix + "b3V0cHV0OiB7fQ==")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "decompress")
+
+	// a small payload decompressing beyond the max size is rejected
+	bomb, err := EncodeTemplate(strings.Repeat(" ", maxDecodedTemplateSize+1))
+	assert.NoError(t, err)
+	assert.True(t, len(bomb) < 1<<20)
+	_, err = DecodeTemplate(bomb)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds the max size")
+	atMax, err := EncodeTemplate(strings.Repeat(" ", maxDecodedTemplateSize))
+	assert.NoError(t, err)
+	decoded, err = DecodeTemplate(atMax)
+	assert.NoError(t, err)
+	assert.Len(t, decoded, maxDecodedTemplateSize)
+}
+
+func TestNewTemplateWithEncodedTemplate(t *testing.T) {
+	encoded, err := EncodeTemplate("output: {}")
+	assert.NoError(t, err)
+	tmpl, err := NewTemplate(&v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: encoded}}, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "output: {}", tmpl.TemplateStr)
+
+	_, err = NewTemplate(&v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: EncodedTemplatePrefix + "%%%"}}, nil, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,175 @@
+package util
+
+import (
+	"context"
+	"strings"
+
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/format"
+	"cuelang.org/go/cue/parser"
+	"cuelang.org/go/cue/token"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/kubevela/pkg/oam/discoverymapper"
+)
+
+// AnnotationExtends names the parent definition of the same kind which a definition extends. The template of
+// the parent is loaded first, then the template of the child is overlaid on it, see overlayTemplate.
+const AnnotationExtends = "definition.oam.dev/extends"
+
+// inheritTemplate overlays the template of the definition named key on the template of its parent,
+// if the definition extends one, and returns the parent definition, which is nil if it extends none.
+// It returns an error if the chain of parents is cyclic.
+func (o *loadTemplateOptions) inheritTemplate(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper,
+	key string, kd TemplateKind, tmpl *Template, def metav1.Object) (*ResolvedDefinition, error) {
+	parent := strings.TrimSpace(def.GetAnnotations()[AnnotationExtends])
+	if parent == "" {
+		return nil, nil
+	}
+	chain := append(append([]string{}, o.inheritance...), key)
+	for _, name := range chain {
+		if name == parent {
+			return nil, errors.Errorf("cyclic inheritance %s -> %s", strings.Join(chain, " -> "), parent)
+		}
+	}
+	inheritance := o.inheritance
+	o.inheritance = chain
+	defer func() { o.inheritance = inheritance }()
+
+	parentTmpl, source, err := loadTemplateWithSource(ctx, cli, dm, parent, kd, o)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "load parent definition %s", parent)
+	}
+	if err := overlayTemplate(parentTmpl, tmpl); err != nil {
+		return nil, errors.WithMessagef(err, "extend parent definition %s", parent)
+	}
+	return source, nil
+}
+
+// overlayTemplate overlays the template of a child definition on the template of its parent in place.
+// The top-level fields of the child's CUE template, e.g. "parameter", replace those of the parent and the imports are merged.
+// The health policy and custom status of the child replace the parent's if set, and a child without
+// any template or workload inherits those of the parent.
+func overlayTemplate(parent, child *Template) error {
+	switch {
+	case child.TemplateStr == "" && !child.IsHelm() && !child.IsKustomize() && !child.IsTerraform():
+		child.TemplateStr = parent.TemplateStr
+		child.Helm, child.HelmValues = parent.Helm, parent.HelmValues
+		child.Kustomize = parent.Kustomize
+		child.Terraform = parent.Terraform
+		child.CapabilityCategory = parent.CapabilityCategory
+	case child.IsCUE() && parent.IsCUE():
+		templateStr, err := overlayCUETemplate(parent.TemplateStr, child.TemplateStr)
+		if err != nil {
+			return err
+		}
+		child.TemplateStr = templateStr
+	}
+	if child.Health == "" {
+		child.Health = parent.Health
+	}
+	if child.CustomStatus == "" {
+		child.CustomStatus = parent.CustomStatus
+	}
+	if child.Reference.Kind == "" {
+		child.Reference = parent.Reference
+	}
+	if len(child.RequiredTraits) == 0 {
+		child.RequiredTraits = parent.RequiredTraits
+	}
+	if child.Limits == nil {
+		child.Limits = parent.Limits
+	}
+	if len(child.AppliesToWorkloads) == 0 {
+		child.AppliesToWorkloads = parent.AppliesToWorkloads
+	}
+	if child.ExpectedOutputs == nil {
+		child.ExpectedOutputs = parent.ExpectedOutputs
+	}
+	for path, files := range parent.Imports {
+		if child.Imports == nil {
+			child.Imports = map[string]map[string]string{}
+		}
+		if _, ok := child.Imports[path]; !ok {
+			child.Imports[path] = files
+		}
+	}
+	return nil
+}
+
+// overlayCUETemplate replaces the top-level fields of the parent template with the fields of the same label in
+// the child template, and appends the other fields of the child.
+func overlayCUETemplate(parent, child string) (string, error) {
+	pf, err := parser.ParseFile("parent", parent)
+	if err != nil {
+		return "", errors.Wrap(err, "parse template of parent")
+	}
+	cf, err := parser.ParseFile("child", child)
+	if err != nil {
+		return "", errors.Wrap(err, "parse template")
+	}
+
+	overridden := map[string]bool{}
+	imported := map[string]bool{}
+	imports := &ast.ImportDecl{}
+	var decls []ast.Decl
+	for _, d := range cf.Decls {
+		switch x := d.(type) {
+		case *ast.Field:
+			if name, _, err := ast.LabelName(x.Label); err == nil {
+				overridden[name] = true
+			}
+		case *ast.ImportDecl:
+			for _, spec := range x.Specs {
+				imported[spec.Path.Value] = true
+				imports.Specs = append(imports.Specs, spec)
+			}
+			continue
+		case *ast.Package:
+			continue
+		}
+		decls = append(decls, d)
+	}
+
+	var merged []ast.Decl
+	for _, d := range pf.Decls {
+		switch x := d.(type) {
+		case *ast.Field:
+			if name, _, err := ast.LabelName(x.Label); err == nil && overridden[name] {
+				continue
+			}
+		case *ast.ImportDecl:
+			for _, spec := range x.Specs {
+				if !imported[spec.Path.Value] {
+					imported[spec.Path.Value] = true
+					imports.Specs = append(imports.Specs, spec)
+				}
+			}
+			continue
+		case *ast.Package:
+			continue
+		}
+		merged = append(merged, d)
+	}
+	merged = append(merged, decls...)
+	if len(imports.Specs) > 0 {
+		for _, spec := range imports.Specs {
+			ast.SetRelPos(spec, token.Newline)
+		}
+		merged = append([]ast.Decl{imports}, merged...)
+	}
+	// the declarations come from two files, keep them on separate lines
+	for i, d := range merged {
+		if i > 0 && !d.Pos().IsNewline() {
+			ast.SetRelPos(d, token.Newline)
+		}
+	}
+
+	b, err := format.Node(&ast.File{Decls: merged})
+	if err != nil {
+		return "", errors.Wrap(err, "format template")
+	}
+	return string(b), nil
+}
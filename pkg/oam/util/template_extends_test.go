@@ -0,0 +1,121 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/stretchr/testify/assert"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ktypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+func TestLoadTemplateExtends(t *testing.T) {
+	definitions := map[string]*v1alpha2.ComponentDefinition{
+		"base": {
+			Spec: v1alpha2.ComponentDefinitionSpec{
+				Workload: v1alpha2.WorkloadTypeDescriptor{Definition: v1alpha2.WorkloadGVK{APIVersion: "apps/v1", Kind: "Deployment"}},
+				Schematic: &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: `import "strings"
+
+output: {
+	kind: "Deployment"
+	spec: image: strings.ToLower(parameter.image)
+}
+parameter: image: string
+`}},
+				Status: &v1alpha2.Status{HealthPolicy: "isHealth: true", CustomStatus: "message: \"base\""},
+			},
+		},
+		"webservice": {
+			Spec: v1alpha2.ComponentDefinitionSpec{
+				Schematic: &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: `import "strconv"
+
+parameter: {
+	image: string
+	port:  *80 | int
+}
+outputs: service: {
+	kind: "Service"
+	metadata: annotations: port: strconv.FormatInt(parameter.port, 10)
+}
+`}},
+				Status: &v1alpha2.Status{CustomStatus: "message: \"webservice\""},
+			},
+		},
+		"internal-service": {
+			Spec: v1alpha2.ComponentDefinitionSpec{
+				Status: &v1alpha2.Status{HealthPolicy: "isHealth: context.output.status.readyReplicas > 0"},
+			},
+		},
+		"cyclic-a": {},
+		"cyclic-b": {},
+	}
+	definitions["webservice"].Annotations = map[string]string{AnnotationExtends: "base"}
+	definitions["internal-service"].Annotations = map[string]string{AnnotationExtends: "webservice"}
+	definitions["cyclic-a"].Annotations = map[string]string{AnnotationExtends: "cyclic-b"}
+	definitions["cyclic-b"].Annotations = map[string]string{AnnotationExtends: "cyclic-a"}
+
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			o, ok := obj.(*v1alpha2.ComponentDefinition)
+			if !ok || definitions[key.Name] == nil {
+				return kerrors.NewNotFound(schema.GroupResource{Resource: "definitions"}, key.Name)
+			}
+			definitions[key.Name].DeepCopyInto(o)
+			o.Name = key.Name
+			return nil
+		},
+		MockList: test.NewMockListFn(nil),
+	}
+	dm := mock.NewMockDiscoveryMapper()
+
+	tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, "internal-service", ComponentTemplateKind, DisableWorkloadFallback())
+	assert.NoError(t, err)
+	assert.Equal(t, "internal-service", tmpl.Name)
+	assert.Equal(t, `import (
+	"strconv"
+	"strings"
+)
+
+output: {
+	kind: "Deployment"
+	spec: image: strings.ToLower(parameter.image)
+}
+
+parameter: {
+	image: string
+	port:  *80 | int
+}
+outputs: service: {
+	kind: "Service"
+	metadata: annotations: port: strconv.FormatInt(parameter.port, 10)
+}
+`, tmpl.TemplateStr)
+	assert.Equal(t, "isHealth: context.output.status.readyReplicas > 0", tmpl.Health)
+	assert.Equal(t, "message: \"webservice\"", tmpl.CustomStatus)
+	assert.Equal(t, v1alpha2.WorkloadGVK{APIVersion: "apps/v1", Kind: "Deployment"}, tmpl.Reference)
+	defaults, err := tmpl.ParameterDefaults()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"port": float64(80)}, defaults)
+
+	_, source, err := LoadTemplateWithSource(context.TODO(), &tclient, dm, "internal-service", ComponentTemplateKind, DisableWorkloadFallback())
+	assert.NoError(t, err)
+	assert.Len(t, source.Dependencies, 1)
+	assert.Equal(t, "webservice", source.Dependencies[0].Name)
+	assert.Len(t, source.Dependencies[0].Dependencies, 1)
+	assert.Equal(t, "base", source.Dependencies[0].Dependencies[0].Name)
+
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "cyclic-a", ComponentTemplateKind, DisableWorkloadFallback())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cyclic inheritance cyclic-a -> cyclic-b -> cyclic-a")
+
+	definitions["webservice"].Annotations[AnnotationExtends] = "missing"
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "webservice", ComponentTemplateKind, DisableWorkloadFallback())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "load parent definition missing")
+}
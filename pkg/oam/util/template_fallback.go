@@ -0,0 +1,100 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+)
+
+// FallbackStep is a lookup of the definition of a template by LoadTemplate, the steps of a fallback chain are tried
+// in order until one finds the definition
+type FallbackStep struct {
+	// Kind is the kind of the definition to look up, e.g. ComponentDefinition or WorkloadDefinition for a component
+	Kind string
+	// Namespaces are the namespaces to look up the definition in, they are the namespaces LoadTemplate searches if empty
+	Namespaces []string
+}
+
+func (s FallbackStep) String() string {
+	if len(s.Namespaces) == 0 {
+		return s.Kind
+	}
+	return fmt.Sprintf("%s in %s", s.Kind, strings.Join(s.Namespaces, ", "))
+}
+
+// FallbackAttempt is a step of the fallback chain tried by LoadTemplate, Err is nil if the step found the definition
+type FallbackAttempt struct {
+	Step FallbackStep
+	Err  error
+}
+
+// LoadWithFallbackChain makes LoadTemplate look up the definition of the templates of the kind by the steps,
+// instead of the default chain of the kind, e.g. to try a tenant-scoped definition before the system one.
+// By default, a component template is looked up as a ComponentDefinition and then a WorkloadDefinition unless
+// DisableWorkloadFallback is set, and trait and scope templates by their only definition kinds.
+func LoadWithFallbackChain(kd TemplateKind, steps ...FallbackStep) LoadTemplateOption {
+	return func(o *loadTemplateOptions) {
+		if o.fallbackChains == nil {
+			o.fallbackChains = map[TemplateKind][]FallbackStep{}
+		}
+		o.fallbackChains[kd] = steps
+	}
+}
+
+// fallbackChain returns the steps to look up the definition of a template of the kind
+func (o *loadTemplateOptions) fallbackChain(kd TemplateKind) ([]FallbackStep, error) {
+	steps, ok := o.fallbackChains[kd]
+	if !ok {
+		return defaultFallbackChain(kd, o.disableWorkloadFallback), nil
+	}
+	if len(steps) == 0 {
+		return nil, errors.Errorf("empty fallback chain of %s", kd)
+	}
+	for _, step := range steps {
+		if !definitionKindOf(kd, step.Kind) {
+			return nil, errors.Errorf("invalid fallback step %s: %s is not a definition of %s", step, step.Kind, kd)
+		}
+	}
+	return steps, nil
+}
+
+// defaultFallbackChain returns the steps LoadTemplate looks up the definition of a template of the kind by default
+func defaultFallbackChain(kd TemplateKind, disableWorkloadFallback bool) []FallbackStep {
+	switch kd {
+	case ComponentTemplateKind:
+		if disableWorkloadFallback {
+			return []FallbackStep{{Kind: v1alpha2.ComponentDefinitionKind}}
+		}
+		return []FallbackStep{{Kind: v1alpha2.ComponentDefinitionKind}, {Kind: v1alpha2.WorkloadDefinitionKind}}
+	case TraitTemplateKind:
+		return []FallbackStep{{Kind: v1alpha2.TraitDefinitionKind}}
+	case ScopeTemplateKind:
+		return []FallbackStep{{Kind: v1alpha2.ScopeDefinitionKind}}
+	}
+	return nil
+}
+
+// definitionKindOf returns true if the templates of the kind can be loaded from the definitions of defKind
+func definitionKindOf(kd TemplateKind, defKind string) bool {
+	switch kd {
+	case ComponentTemplateKind:
+		return defKind == v1alpha2.ComponentDefinitionKind || defKind == v1alpha2.WorkloadDefinitionKind
+	case TraitTemplateKind:
+		return defKind == v1alpha2.TraitDefinitionKind
+	case ScopeTemplateKind:
+		return defKind == v1alpha2.ScopeDefinitionKind
+	}
+	return false
+}
+
+// loadErrorFormatOfKind returns the format of the error of reading the definition of the kind by key
+func loadErrorFormatOfKind(kind string) string {
+	switch kind {
+	case v1alpha2.ComponentDefinitionKind, v1alpha2.WorkloadDefinitionKind, v1alpha2.ScopeDefinitionKind:
+		return "LoadTemplate from " + kind + " [%s] "
+	}
+	return "LoadTemplate [%s] "
+}
@@ -0,0 +1,75 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ktypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam"
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+func TestLoadWithFallbackChain(t *testing.T) {
+	templates := map[ktypes.NamespacedName]string{
+		{Namespace: "tenant-a", Name: "scaler"}:                    "patch: spec: replicas: 2",
+		{Namespace: oam.SystemDefinitonNamespace, Name: "scaler"}:  "patch: spec: replicas: 1",
+		{Namespace: oam.SystemDefinitonNamespace, Name: "ingress"}: "outputs: ingress: {}",
+	}
+	var reads []ktypes.NamespacedName
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			reads = append(reads, key)
+			template, ok := templates[key]
+			if !ok {
+				return kerrors.NewNotFound(schema.GroupResource{}, key.Name)
+			}
+			o := obj.(*v1alpha2.TraitDefinition)
+			o.Name, o.Namespace = key.Name, key.Namespace
+			o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: template}}
+			return nil
+		},
+		MockList: test.NewMockListFn(nil),
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	tenantStep := FallbackStep{Kind: v1alpha2.TraitDefinitionKind, Namespaces: []string{"tenant-a"}}
+	systemStep := FallbackStep{Kind: v1alpha2.TraitDefinitionKind, Namespaces: []string{oam.SystemDefinitonNamespace}}
+	chain := LoadWithFallbackChain(TraitTemplateKind, tenantStep, systemStep)
+
+	tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, "scaler", TraitTemplateKind, chain)
+	assert.NoError(t, err)
+	assert.Equal(t, "patch: spec: replicas: 2", tmpl.TemplateStr)
+	assert.Equal(t, "tenant-a", tmpl.Namespace)
+	assert.Equal(t, []FallbackAttempt{{Step: tenantStep}}, tmpl.FallbackAttempts)
+
+	tmpl, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "ingress", TraitTemplateKind, chain)
+	assert.NoError(t, err)
+	assert.Equal(t, "outputs: ingress: {}", tmpl.TemplateStr)
+	assert.Equal(t, oam.SystemDefinitonNamespace, tmpl.Namespace)
+	assert.Equal(t, 2, len(tmpl.FallbackAttempts))
+	assert.Equal(t, tenantStep, tmpl.FallbackAttempts[0].Step)
+	assert.True(t, kerrors.IsNotFound(tmpl.FallbackAttempts[0].Err))
+	assert.Equal(t, FallbackAttempt{Step: systemStep}, tmpl.FallbackAttempts[1])
+
+	reads = nil
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "missing", TraitTemplateKind, chain)
+	assert.True(t, kerrors.IsNotFound(errors.Cause(err)))
+	assert.Equal(t, []ktypes.NamespacedName{{Namespace: "tenant-a", Name: "missing"}, {Namespace: oam.SystemDefinitonNamespace, Name: "missing"}}, reads)
+
+	// the default chain
+	tmpl, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "scaler", TraitTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "patch: spec: replicas: 1", tmpl.TemplateStr)
+	assert.Equal(t, []FallbackAttempt{{Step: FallbackStep{Kind: v1alpha2.TraitDefinitionKind}}}, tmpl.FallbackAttempts)
+
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "scaler", TraitTemplateKind,
+		LoadWithFallbackChain(TraitTemplateKind, FallbackStep{Kind: v1alpha2.WorkloadDefinitionKind}))
+	assert.EqualError(t, err, "LoadTemplate [scaler] : invalid fallback step WorkloadDefinition: WorkloadDefinition is not a definition of trait")
+}
@@ -0,0 +1,58 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AnnotationFeatureGate lists the feature gates required by a definition separated by comma, LoadTemplate returns
+// an ErrFeatureGated error for the definition unless all of them are enabled by LoadWithFeatureGates.
+const AnnotationFeatureGate = "definition.oam.dev/feature-gate"
+
+// ErrFeatureGated is the error of loading a template from a definition whose feature gates are not enabled,
+// callers may skip the capability or warn about it.
+type ErrFeatureGated struct {
+	Kind string
+	Name string
+	// Gates are the required gates which are not enabled
+	Gates []string
+}
+
+func (e *ErrFeatureGated) Error() string {
+	return fmt.Sprintf("%s %s requires feature gates which are not enabled: %s", e.Kind, e.Name, strings.Join(e.Gates, ", "))
+}
+
+// IsFeatureGated returns true if the cause of err is an ErrFeatureGated
+func IsFeatureGated(err error) bool {
+	_, ok := errors.Cause(err).(*ErrFeatureGated)
+	return ok
+}
+
+// LoadWithFeatureGates enables the feature gates, so that LoadTemplate loads the definitions requiring them
+func LoadWithFeatureGates(gates ...string) LoadTemplateOption {
+	return func(o *loadTemplateOptions) {
+		if o.featureGates == nil {
+			o.featureGates = map[string]bool{}
+		}
+		for _, gate := range gates {
+			o.featureGates[gate] = true
+		}
+	}
+}
+
+// checkFeatureGates returns an ErrFeatureGated error if the feature gates required by the definition are not all enabled
+func (o *loadTemplateOptions) checkFeatureGates(kind string, def metav1.Object) error {
+	var disabled []string
+	for _, gate := range strings.Split(def.GetAnnotations()[AnnotationFeatureGate], ",") {
+		if gate = strings.TrimSpace(gate); gate != "" && !o.featureGates[gate] {
+			disabled = append(disabled, gate)
+		}
+	}
+	if len(disabled) == 0 {
+		return nil
+	}
+	return &ErrFeatureGated{Kind: kind, Name: def.GetName(), Gates: disabled}
+}
@@ -0,0 +1,75 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ktypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+func TestLoadTemplateWithFeatureGates(t *testing.T) {
+	gates := map[string]string{
+		"webservice": "",
+		"canary":     "CanaryRollout",
+		"autoscaler": "Autoscaling, CustomMetrics",
+	}
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			switch o := obj.(type) {
+			case *v1alpha2.ComponentDefinition:
+				if key.Name == "worker" {
+					return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: "componentdefinitions"}, key.Name)
+				}
+				o.Name = key.Name
+				o.Annotations = map[string]string{AnnotationFeatureGate: gates[key.Name]}
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}}
+			case *v1alpha2.WorkloadDefinition:
+				o.Name = key.Name
+				o.Annotations = map[string]string{AnnotationFeatureGate: "Workers"}
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}}
+			case *v1alpha2.TraitDefinition:
+				o.Name = key.Name
+				o.Annotations = map[string]string{AnnotationFeatureGate: gates[key.Name]}
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "patch: {}"}}
+			}
+			return nil
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+
+	_, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err, "definitions without feature gates are always loaded")
+
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "canary", ComponentTemplateKind)
+	assert.True(t, IsFeatureGated(err))
+	assert.Equal(t, &ErrFeatureGated{Kind: v1alpha2.ComponentDefinitionKind, Name: "canary", Gates: []string{"CanaryRollout"}}, errors.Cause(err))
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "canary", ComponentTemplateKind, LoadWithFeatureGates("CanaryRollout"))
+	assert.NoError(t, err)
+
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "autoscaler", TraitTemplateKind, LoadWithFeatureGates("Autoscaling"))
+	assert.EqualError(t, errors.Cause(err), "TraitDefinition autoscaler requires feature gates which are not enabled: CustomMetrics")
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "autoscaler", TraitTemplateKind,
+		LoadWithFeatureGates("Autoscaling"), LoadWithFeatureGates("CustomMetrics"))
+	assert.NoError(t, err)
+
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "worker", ComponentTemplateKind)
+	assert.True(t, IsFeatureGated(err), "gates of the WorkloadDefinition fallen back to should be checked")
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "worker", ComponentTemplateKind, LoadWithFeatureGates("Workers"))
+	assert.NoError(t, err)
+
+	_, err = NewCachingTemplateLoader().LoadTemplate(context.TODO(), &tclient, dm, "canary", ComponentTemplateKind)
+	assert.True(t, IsFeatureGated(err))
+	_, err = NewCachingTemplateLoader(LoadWithFeatureGates("CanaryRollout")).LoadTemplate(context.TODO(), &tclient, dm, "canary", ComponentTemplateKind)
+	assert.NoError(t, err, "the options of the caching loader should be applied on load")
+
+	assert.False(t, IsFeatureGated(errors.New("boom")))
+}
@@ -0,0 +1,221 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam/discoverymapper"
+)
+
+// FileTemplateLoader loads templates like LoadTemplate, but from the definition files in a local directory
+// instead of the API server, so that templates can be tested without a cluster.
+type FileTemplateLoader struct {
+	definitions *fileDefinitionReader
+}
+
+// NewFileTemplateLoader creates a FileTemplateLoader with the definitions in the YAML or JSON files of dir and its subdirectories,
+// objects which are not ComponentDefinition, WorkloadDefinition, TraitDefinition or ScopeDefinition are ignored.
+func NewFileTemplateLoader(dir string) (*FileTemplateLoader, error) {
+	definitions := newFileDefinitionReader()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if err := definitions.addFile(path); err != nil {
+			return errors.WithMessagef(err, "load definitions from %s", path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &FileTemplateLoader{definitions: definitions}, nil
+}
+
+// LoadTemplate has the same contract as LoadTemplate, including the fallback to WorkloadDefinition
+func (l *FileTemplateLoader) LoadTemplate(ctx context.Context, dm discoverymapper.DiscoveryMapper, key string, kd TemplateKind, opts ...LoadTemplateOption) (*Template, error) {
+	return LoadTemplateOfKind(ctx, l.definitions, dm, key, kd, opts...)
+}
+
+// FileDefinition is a definition loaded by FileTemplateLoader and where it's defined
+type FileDefinition struct {
+	Kind string
+	Name string
+	File string
+	// Line is the line where the YAML document of the definition starts, 1-based
+	Line int
+	// TemplateLine is the line before the CUE template if it's a YAML block scalar, so that line N of the template
+	// is line TemplateLine+N of the file. It's 0 if the line is unknown.
+	TemplateLine int
+	Object       runtime.Object
+}
+
+// Definitions returns the definitions loaded from the files, sorted by file and line
+func (l *FileTemplateLoader) Definitions() []FileDefinition {
+	definitions := make([]FileDefinition, 0, len(l.definitions.sources))
+	for key, source := range l.definitions.sources {
+		source.Object = l.definitions.objects[key].DeepCopyObject()
+		definitions = append(definitions, source)
+	}
+	sort.Slice(definitions, func(i, j int) bool {
+		if definitions[i].File != definitions[j].File {
+			return definitions[i].File < definitions[j].File
+		}
+		return definitions[i].Line < definitions[j].Line
+	})
+	return definitions
+}
+
+// fileDefinitionReader serves the definitions read from files by kind and name, the namespace is ignored
+type fileDefinitionReader struct {
+	objects map[string]runtime.Object
+	// sources are the locations of the definitions read from files, by the same key as objects
+	sources map[string]FileDefinition
+}
+
+var _ client.Reader = &fileDefinitionReader{}
+
+func newDefinitionObject(kind string) runtime.Object {
+	switch kind {
+	case v1alpha2.ComponentDefinitionKind:
+		return &v1alpha2.ComponentDefinition{}
+	case v1alpha2.WorkloadDefinitionKind:
+		return &v1alpha2.WorkloadDefinition{}
+	case v1alpha2.TraitDefinitionKind:
+		return &v1alpha2.TraitDefinition{}
+	case v1alpha2.ScopeDefinitionKind:
+		return &v1alpha2.ScopeDefinition{}
+	}
+	return nil
+}
+
+func newFileDefinitionReader() *fileDefinitionReader {
+	return &fileDefinitionReader{objects: map[string]runtime.Object{}, sources: map[string]FileDefinition{}}
+}
+
+// templateBlockLine matches the key of a CUE template in a YAML block scalar, e.g. "template: |"
+var templateBlockLine = regexp.MustCompile(`^\s*template:\s*\|[-+]?[0-9]?\s*$`)
+
+// addFile adds the definitions in the file, and records the line where each of them is defined
+func (r *fileDefinitionReader) addFile(path string) error {
+	data, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(data), "\n")
+	start := 0
+	for i := 0; i <= len(lines); i++ {
+		if i < len(lines) && strings.TrimRight(lines[i], " \t\r") != "---" {
+			continue
+		}
+		source := &FileDefinition{File: path, Line: start + 1}
+		for j := start; j < i; j++ {
+			if templateBlockLine.MatchString(lines[j]) {
+				source.TemplateLine = j + 1
+				break
+			}
+		}
+		doc := strings.Join(lines[start:i], "\n")
+		if err := r.addDocuments(strings.NewReader(doc), source); err != nil {
+			return errors.WithMessagef(err, "line %d", source.Line)
+		}
+		start = i + 1
+	}
+	return nil
+}
+
+// addDefinitions adds the definitions in the YAML or JSON documents read from in
+func (r *fileDefinitionReader) addDefinitions(in io.Reader) error {
+	return r.addDocuments(in, nil)
+}
+
+// addDocuments adds the definitions in the documents read from in, the source of each of them is recorded if not nil
+func (r *fileDefinitionReader) addDocuments(in io.Reader, source *FileDefinition) error {
+	decoder := yaml.NewYAMLOrJSONDecoder(in, 4096)
+	for {
+		raw := map[string]interface{}{}
+		if err := decoder.Decode(&raw); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		kind, _ := raw["kind"].(string)
+		obj := newDefinitionObject(kind)
+		if obj == nil {
+			continue
+		}
+		bt, err := json.Marshal(raw)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(bt, obj); err != nil {
+			return errors.Wrapf(err, "parse %s", kind)
+		}
+		name := obj.(metav1.Object).GetName()
+		r.objects[kind+"/"+name] = obj
+		if source != nil {
+			src := *source
+			src.Kind, src.Name = kind, name
+			r.sources[kind+"/"+name] = src
+		}
+	}
+}
+
+// Get gets the definition with the same kind as obj and the name of key
+func (r *fileDefinitionReader) Get(_ context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+	kind := reflect.TypeOf(obj).Elem().Name()
+	stored, ok := r.objects[kind+"/"+key.Name]
+	if !ok {
+		return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: strings.ToLower(kind) + "s"}, key.Name)
+	}
+	reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(stored.DeepCopyObject()).Elem())
+	return nil
+}
+
+// List lists the definitions with the kind of the items of list, the options are ignored
+func (r *fileDefinitionReader) List(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
+	kind := strings.TrimSuffix(reflect.TypeOf(list).Elem().Name(), "List")
+	if newDefinitionObject(kind) == nil {
+		return errors.Errorf("list %s is not supported by definitions from files", kind)
+	}
+	var names []string
+	for key := range r.objects {
+		if strings.HasPrefix(key, kind+"/") {
+			names = append(names, key)
+		}
+	}
+	sort.Strings(names)
+	items := make([]runtime.Object, 0, len(names))
+	for _, name := range names {
+		items = append(items, r.objects[name].DeepCopyObject())
+	}
+	return meta.SetList(list, items)
+}
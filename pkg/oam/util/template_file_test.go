@@ -0,0 +1,119 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+func TestFileTemplateLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "definitions")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"webservice.yaml": `
+apiVersion: core.oam.dev/v1alpha2
+kind: ComponentDefinition
+metadata:
+  name: webservice
+spec:
+  workload:
+    definition:
+      apiVersion: apps/v1
+      kind: Deployment
+  schematic:
+    cue:
+      template: |
+        output: kind: "Deployment"
+`,
+		"traits/traits.yaml": `
+apiVersion: core.oam.dev/v1alpha2
+kind: TraitDefinition
+metadata:
+  name: scaler
+  annotations:
+    definition.oam.dev/alias: manualscaler
+spec:
+  schematic:
+    cue:
+      template: |
+        patch: spec: replicas: parameter.replicas
+---
+apiVersion: core.oam.dev/v1alpha2
+kind: WorkloadDefinition
+metadata:
+  name: worker
+spec:
+  definitionRef:
+    name: deployments.apps
+  schematic:
+    cue:
+      template: |
+        output: kind: "Worker"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: worker
+`,
+		"README.md": "not a definition",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0750))
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	}
+
+	loader, err := NewFileTemplateLoader(dir)
+	assert.NoError(t, err)
+	dm := mock.NewMockDiscoveryMapper()
+	dm.MockKindsFor = mock.NewMockKindsFor("Deployment", "v1")
+
+	tmpl, err := loader.LoadTemplate(context.TODO(), dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "output: kind: \"Deployment\"\n", tmpl.TemplateStr)
+
+	tmpl, err = loader.LoadTemplate(context.TODO(), dm, "worker", ComponentTemplateKind)
+	assert.NoError(t, err, "should fall back to WorkloadDefinition")
+	assert.Equal(t, "output: kind: \"Worker\"\n", tmpl.TemplateStr)
+	assert.Equal(t, "Deployment", tmpl.Reference.Kind)
+
+	tmpl, err = loader.LoadTemplate(context.TODO(), dm, "scaler", TraitTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "patch: spec: replicas: parameter.replicas\n", tmpl.TemplateStr)
+
+	tmpl, err = loader.LoadTemplate(context.TODO(), dm, "manualscaler", TraitTemplateKind)
+	assert.NoError(t, err, "should load the template by alias")
+	assert.Equal(t, "scaler", tmpl.Name)
+	assert.Equal(t, "manualscaler", tmpl.Alias)
+
+	_, err = loader.LoadTemplate(context.TODO(), dm, "not-exist", TraitTemplateKind)
+	assert.True(t, kerrors.IsNotFound(errors.Cause(err)))
+
+	var locations []string
+	for _, def := range loader.Definitions() {
+		rel, err := filepath.Rel(dir, def.File)
+		assert.NoError(t, err)
+		locations = append(locations, fmt.Sprintf("%s %s %s:%d:%d", def.Kind, def.Name, rel, def.Line, def.TemplateLine))
+		assert.Equal(t, def.Name, def.Object.(metav1.Object).GetName())
+	}
+	assert.Equal(t, []string{
+		"TraitDefinition scaler traits/traits.yaml:1:11",
+		"WorkloadDefinition worker traits/traits.yaml:14:23",
+		"ComponentDefinition webservice webservice.yaml:1:13",
+	}, locations)
+
+	_, err = NewFileTemplateLoader(filepath.Join(dir, "not-exist"))
+	assert.Error(t, err)
+}
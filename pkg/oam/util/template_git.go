@@ -0,0 +1,347 @@
+package util
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oam-dev/kubevela/pkg/oam/discoverymapper"
+)
+
+// DefaultGitCacheSize is the max number of commits whose definitions are cached by GitTemplateLoader
+const DefaultGitCacheSize = 16
+
+// GitTemplateLoader loads templates like LoadTemplate, but from the definition files in a directory of a git
+// repository. The repository is fetched into a local mirror by the git command on every load, so that branches
+// are pulled, and the definitions are cached by the commit SHA which the ref resolves to, the least recently used
+// commits are evicted once the cache is full. Concurrent loads share one fetch.
+// It's safe for concurrent use, Close removes the temporary directory it creates.
+type GitTemplateLoader struct {
+	url           string
+	path          string
+	token         string
+	cacheDir      string
+	fetchInterval time.Duration
+	maxTrees      int
+
+	// gitMu serializes the git commands on the mirror
+	gitMu       sync.Mutex
+	tempDir     string
+	lastFetch   time.Time
+	lastFetchOK bool
+
+	mu    sync.Mutex
+	trees map[string]*FileTemplateLoader
+	// recent has the SHAs of the cached commits, from the least to the most recently used
+	recent []string
+}
+
+// GitTemplateLoaderOption customizes how GitTemplateLoader fetches the repository
+type GitTemplateLoaderOption func(*GitTemplateLoader)
+
+// WithGitPath makes GitTemplateLoader read the definitions in the directory of the repository,
+// e.g. "definitions", they're read from the root of the repository by default.
+func WithGitPath(path string) GitTemplateLoaderOption {
+	return func(l *GitTemplateLoader) {
+		l.path = path
+	}
+}
+
+// WithGitToken makes GitTemplateLoader authenticate to the HTTP(S) repository with the access token,
+// repositories are accessed anonymously by default.
+func WithGitToken(token string) GitTemplateLoaderOption {
+	return func(l *GitTemplateLoader) {
+		l.token = token
+	}
+}
+
+// WithGitCacheDir makes GitTemplateLoader keep the mirror of the repository and the definitions in the directory,
+// a temporary directory is created by default.
+func WithGitCacheDir(dir string) GitTemplateLoaderOption {
+	return func(l *GitTemplateLoader) {
+		l.cacheDir = dir
+	}
+}
+
+// WithGitFetchInterval makes GitTemplateLoader fetch the repository at most once in the interval, loads within
+// the interval of the last fetch read the mirror as is. The repository is fetched on every load by default.
+func WithGitFetchInterval(interval time.Duration) GitTemplateLoaderOption {
+	return func(l *GitTemplateLoader) {
+		l.fetchInterval = interval
+	}
+}
+
+// WithGitCacheSize makes GitTemplateLoader cache the definitions of at most n commits, DefaultGitCacheSize by default
+func WithGitCacheSize(n int) GitTemplateLoaderOption {
+	return func(l *GitTemplateLoader) {
+		l.maxTrees = n
+	}
+}
+
+// NewGitTemplateLoader creates a GitTemplateLoader of the repository with an empty cache, the url is anything
+// accepted by `git fetch`, e.g. "https://github.com/oam-dev/catalog.git" or the path of a local repository.
+func NewGitTemplateLoader(url string, opts ...GitTemplateLoaderOption) *GitTemplateLoader {
+	l := &GitTemplateLoader{url: url, maxTrees: DefaultGitCacheSize, trees: map[string]*FileTemplateLoader{}}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// LoadTemplate has the same contract as LoadTemplate, the definition is read from the commit of ref,
+// which is a branch, a tag or a commit SHA.
+func (l *GitTemplateLoader) LoadTemplate(ctx context.Context, ref string, dm discoverymapper.DiscoveryMapper, key string, kd TemplateKind, opts ...LoadTemplateOption) (*Template, error) {
+	definitions, err := l.pull(ctx, ref)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "LoadTemplate [%s] pull %s", key, ref)
+	}
+	return definitions.LoadTemplate(ctx, dm, key, kd, opts...)
+}
+
+// pull fetches the repository and returns the definitions of the commit of ref, from cache if it's already read
+func (l *GitTemplateLoader) pull(ctx context.Context, ref string) (*FileTemplateLoader, error) {
+	if strings.HasPrefix(l.url, "-") {
+		return nil, errors.Errorf("invalid repository url %q", l.url)
+	}
+	requested := time.Now()
+	l.gitMu.Lock()
+	defer l.gitMu.Unlock()
+	mirror, err := l.initMirror(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.fetch(ctx, mirror, requested); err != nil {
+		return nil, err
+	}
+	sha, err := l.resolve(ctx, mirror, ref)
+	if err != nil {
+		return nil, err
+	}
+	if cached := l.cachedTree(sha); cached != nil {
+		return cached, nil
+	}
+	// the definitions are read into memory, so the files are only kept while they're loaded
+	tree := filepath.Join(l.cacheDir, "trees", sha)
+	defer os.RemoveAll(tree)
+	if err := l.extract(ctx, mirror, sha, tree); err != nil {
+		return nil, errors.WithMessagef(err, "read commit %s", sha)
+	}
+	definitions, err := NewFileTemplateLoader(filepath.Join(tree, filepath.FromSlash(l.path)))
+	if err != nil {
+		return nil, errors.WithMessagef(err, "load definitions of commit %s", sha)
+	}
+	l.cacheTree(sha, definitions)
+	return definitions, nil
+}
+
+// fetch fetches the branches and tags of the repository into the mirror, unless a fetch has succeeded since the load
+// was requested, so that concurrent loads share one fetch, or within the fetch interval. The caller must hold l.gitMu.
+func (l *GitTemplateLoader) fetch(ctx context.Context, mirror string, requested time.Time) error {
+	if l.lastFetchOK && (!l.lastFetch.Before(requested) || time.Since(l.lastFetch) < l.fetchInterval) {
+		return nil
+	}
+	started := time.Now()
+	_, err := l.git(ctx, mirror, true, "fetch", "--prune", "--force", "--update-head-ok", "--", l.url,
+		"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*")
+	l.lastFetch, l.lastFetchOK = started, err == nil
+	return errors.WithMessagef(err, "fetch %s", l.url)
+}
+
+// cachedTree returns the cached definitions of the commit and marks it as the most recently used,
+// or nil if it isn't cached
+func (l *GitTemplateLoader) cachedTree(sha string) *FileTemplateLoader {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	definitions, ok := l.trees[sha]
+	if ok {
+		l.touchTree(sha)
+	}
+	return definitions
+}
+
+// cacheTree caches the definitions of the commit, evicting the least recently used commits if the cache is full
+func (l *GitTemplateLoader) cacheTree(sha string, definitions *FileTemplateLoader) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.trees[sha] = definitions
+	l.touchTree(sha)
+	for len(l.recent) > l.maxTrees && len(l.recent) > 0 {
+		delete(l.trees, l.recent[0])
+		l.recent = l.recent[1:]
+	}
+}
+
+// touchTree moves the SHA to the end of the recently used ones, the caller must hold l.mu
+func (l *GitTemplateLoader) touchTree(sha string) {
+	for i, s := range l.recent {
+		if s == sha {
+			l.recent = append(l.recent[:i], l.recent[i+1:]...)
+			break
+		}
+	}
+	l.recent = append(l.recent, sha)
+}
+
+// Close drops the cached definitions and removes the temporary directory of the mirror, if it's created
+// by the loader rather than set by WithGitCacheDir. The loader can still be used, it fetches the repository again.
+func (l *GitTemplateLoader) Close() error {
+	l.gitMu.Lock()
+	defer l.gitMu.Unlock()
+	l.mu.Lock()
+	l.trees, l.recent = map[string]*FileTemplateLoader{}, nil
+	l.mu.Unlock()
+	if l.tempDir == "" {
+		return nil
+	}
+	err := os.RemoveAll(l.tempDir)
+	if l.cacheDir == l.tempDir {
+		l.cacheDir = ""
+	}
+	l.tempDir, l.lastFetchOK = "", false
+	return errors.Wrap(err, "remove cache directory")
+}
+
+// initMirror creates the bare repository mirroring the remote one in the cache directory if it doesn't exist,
+// the caller must hold l.gitMu
+func (l *GitTemplateLoader) initMirror(ctx context.Context) (string, error) {
+	if l.cacheDir == "" {
+		dir, err := ioutil.TempDir("", "vela-git-templates")
+		if err != nil {
+			return "", errors.Wrap(err, "create cache directory")
+		}
+		l.cacheDir, l.tempDir = dir, dir
+	}
+	mirror := filepath.Join(l.cacheDir, "mirror.git")
+	if _, err := os.Stat(mirror); err == nil {
+		return mirror, nil
+	}
+	if _, err := l.git(ctx, "", false, "init", "--bare", "--quiet", mirror); err != nil {
+		return "", errors.WithMessage(err, "init mirror")
+	}
+	return mirror, nil
+}
+
+// commitSHA matches an abbreviated or full commit SHA
+var commitSHA = regexp.MustCompile(`^[0-9a-fA-F]{4,40}$`)
+
+// resolve returns the commit SHA of the branch, tag or commit, branches take precedence over tags of the same name
+func (l *GitTemplateLoader) resolve(ctx context.Context, mirror, ref string) (string, error) {
+	candidates := []string{"refs/heads/" + ref, "refs/tags/" + ref}
+	if commitSHA.MatchString(ref) {
+		candidates = append(candidates, ref)
+	}
+	for _, c := range candidates {
+		out, err := l.git(ctx, mirror, false, "rev-parse", "--verify", "--quiet", c+"^{commit}")
+		if err == nil {
+			return strings.TrimSpace(string(out)), nil
+		}
+	}
+	return "", errors.Errorf("ref %q is not a branch, tag or commit of %s", ref, l.url)
+}
+
+// extract writes the files of the commit under the path of the definitions into dir
+func (l *GitTemplateLoader) extract(ctx context.Context, mirror, sha, dir string) error {
+	args := []string{"archive", "--format=tar", sha}
+	if p := strings.Trim(l.path, "/"); p != "" && p != "." {
+		args = append(args, "--", p)
+	}
+	archive, err := l.git(ctx, mirror, false, args...)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(bytes.NewReader(archive))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "read archive")
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(filepath.Separator)) {
+			return errors.Errorf("invalid file %s in archive", hdr.Name)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0750); err != nil {
+			return err
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return errors.Wrapf(err, "read %s", hdr.Name)
+		}
+		if err := ioutil.WriteFile(target, content, 0600); err != nil {
+			return err
+		}
+	}
+}
+
+// git runs the git command in the repository, authenticating with the token if remote is true,
+// and returns its output. The error has the message of git, e.g. of failed authentication.
+func (l *GitTemplateLoader) git(ctx context.Context, gitDir string, remote bool, args ...string) ([]byte, error) {
+	cmd := l.command(ctx, gitDir, remote, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, gitCommandError(args[0], l.url, stderr.String(), err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// command returns the git command in the repository, the token is passed by the environment rather than
+// the arguments, which are visible to other users of the host
+func (l *GitTemplateLoader) command(ctx context.Context, gitDir string, remote bool, args ...string) *exec.Cmd {
+	var global []string
+	if gitDir != "" {
+		global = append(global, "--git-dir="+gitDir)
+	}
+	// #nosec G204 the arguments are passed to git rather than a shell
+	cmd := exec.CommandContext(ctx, "git", append(global, args...)...)
+	// never prompt for credentials, so that failed authentication is reported instead of blocking
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if remote && l.token != "" {
+		cmd.Env = append(cmd.Env, "GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=http.extraHeader", "GIT_CONFIG_VALUE_0="+gitAuthHeader(l.token))
+	}
+	return cmd
+}
+
+// gitAuthHeader returns the HTTP header authenticating with the access token, it's accepted by GitHub and GitLab
+func gitAuthHeader(token string) string {
+	return "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte("x-access-token:"+token))
+}
+
+// gitCommandError returns the error of a git command with its message, failed authentication is told apart
+// from other errors like unreachable repositories
+func gitCommandError(command, url, stderr string, err error) error {
+	if errors.Is(err, exec.ErrNotFound) {
+		return errors.New("git is not installed")
+	}
+	msg := strings.TrimSpace(stderr)
+	if msg == "" {
+		msg = err.Error()
+	}
+	lower := strings.ToLower(msg)
+	for _, s := range []string{"authentication failed", "could not read username", "returned error: 401", "returned error: 403"} {
+		if strings.Contains(lower, s) {
+			return errors.Errorf("git %s: authentication to %s failed, check the token: %s", command, url, msg)
+		}
+	}
+	return errors.Errorf("git %s: %s", command, msg)
+}
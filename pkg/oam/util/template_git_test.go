@@ -0,0 +1,226 @@
+package util
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+const gitTestDefinition = `
+apiVersion: core.oam.dev/v1alpha2
+kind: ComponentDefinition
+metadata:
+  name: webservice
+spec:
+  workload:
+    definition:
+      apiVersion: apps/v1
+      kind: Deployment
+  schematic:
+    cue:
+      template: |
+        output: kind: "%s"
+`
+
+// newTestGitRepo creates a bare repository with the webservice definition in the definitions directory, committed
+// on the main branch and tagged v1, and returns the directories of the bare repository and of its work tree
+func newTestGitRepo(t *testing.T) (string, string) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "git-definitions")
+	assert.NoError(t, err)
+	work, bare := filepath.Join(dir, "work"), filepath.Join(dir, "definitions.git")
+	runGit(t, "", "init", "--quiet", work)
+	runGit(t, work, "checkout", "--quiet", "-b", "main")
+	commitDefinition(t, work, "Deployment")
+	runGit(t, work, "tag", "v1")
+	runGit(t, "", "clone", "--quiet", "--bare", work, bare)
+	return bare, work
+}
+
+// commitDefinition commits the webservice definition with the kind of its output
+func commitDefinition(t *testing.T, work, kind string) {
+	path := filepath.Join(work, "definitions", "webservice.yaml")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0750))
+	assert.NoError(t, ioutil.WriteFile(path, []byte(strings.Replace(gitTestDefinition, "%s", kind, 1)), 0600))
+	runGit(t, work, "add", "-A")
+	runGit(t, work, "-c", "user.name=vela", "-c", "user.email=vela@oam.dev", "commit", "--quiet", "-m", kind)
+}
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+func TestGitTemplateLoader(t *testing.T) {
+	bare, work := newTestGitRepo(t)
+	defer os.RemoveAll(filepath.Dir(bare))
+	cacheDir, err := ioutil.TempDir("", "git-cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+	dm := mock.NewMockDiscoveryMapper()
+	dm.MockKindsFor = mock.NewMockKindsFor("Deployment", "v1")
+	loader := NewGitTemplateLoader(bare, WithGitPath("definitions"), WithGitCacheDir(cacheDir))
+	first := runGit(t, work, "rev-parse", "HEAD")
+
+	for _, ref := range []string{"main", "v1", first, first[:8]} {
+		tmpl, err := loader.LoadTemplate(context.TODO(), ref, dm, "webservice", ComponentTemplateKind)
+		assert.NoError(t, err, ref)
+		assert.Equal(t, "output: kind: \"Deployment\"\n", tmpl.TemplateStr, ref)
+	}
+	assert.Len(t, loader.trees, 1, "definitions should be cached by commit")
+
+	commitDefinition(t, work, "StatefulSet")
+	runGit(t, work, "push", "--quiet", bare, "main")
+	tmpl, err := loader.LoadTemplate(context.TODO(), "main", dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "output: kind: \"StatefulSet\"\n", tmpl.TemplateStr, "the branch should be pulled")
+	tmpl, err = loader.LoadTemplate(context.TODO(), "v1", dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "output: kind: \"Deployment\"\n", tmpl.TemplateStr, "the tag should keep its commit")
+	assert.Len(t, loader.trees, 2)
+
+	_, err = loader.LoadTemplate(context.TODO(), "v2", dm, "webservice", ComponentTemplateKind)
+	assert.Contains(t, err.Error(), `ref "v2" is not a branch, tag or commit of `+bare)
+	_, err = NewGitTemplateLoader(bare, WithGitPath("not-exist")).LoadTemplate(context.TODO(), "main", dm, "webservice", ComponentTemplateKind)
+	assert.Error(t, err)
+	_, err = NewGitTemplateLoader(filepath.Join(filepath.Dir(bare), "not-exist.git")).LoadTemplate(context.TODO(), "main", dm, "webservice", ComponentTemplateKind)
+	assert.Contains(t, err.Error(), "git fetch: ")
+}
+
+func TestGitTemplateLoaderTokenAuth(t *testing.T) {
+	bare, _ := newTestGitRepo(t)
+	defer os.RemoveAll(filepath.Dir(bare))
+	backend := &cgi.Handler{
+		Path: "git",
+		Args: []string{"http-backend"},
+		Env:  []string{"GIT_PROJECT_ROOT=" + filepath.Dir(bare), "GIT_HTTP_EXPORT_ALL=1"},
+	}
+	if gitPath, err := exec.LookPath("git"); err == nil {
+		backend.Path = gitPath
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != gitAuthHeader("secret-token")[len("Authorization: "):] {
+			w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		backend.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	url := server.URL + "/" + filepath.Base(bare)
+	dm := mock.NewMockDiscoveryMapper()
+
+	_, err := NewGitTemplateLoader(url, WithGitPath("definitions")).LoadTemplate(context.TODO(), "main", dm, "webservice", ComponentTemplateKind)
+	assert.Contains(t, err.Error(), "authentication to "+url+" failed")
+	_, err = NewGitTemplateLoader(url, WithGitPath("definitions"), WithGitToken("wrong-token")).LoadTemplate(context.TODO(), "main", dm, "webservice", ComponentTemplateKind)
+	assert.Contains(t, err.Error(), "authentication to "+url+" failed")
+	assert.NotContains(t, err.Error(), "wrong-token")
+	tmpl, err := NewGitTemplateLoader(url, WithGitPath("definitions"), WithGitToken("secret-token")).LoadTemplate(context.TODO(), "main", dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "output: kind: \"Deployment\"\n", tmpl.TemplateStr)
+}
+
+func TestGitTemplateLoaderCache(t *testing.T) {
+	bare, work := newTestGitRepo(t)
+	defer os.RemoveAll(filepath.Dir(bare))
+	dm := mock.NewMockDiscoveryMapper()
+	dm.MockKindsFor = mock.NewMockKindsFor("Deployment", "v1")
+
+	loader := NewGitTemplateLoader(bare, WithGitPath("definitions"), WithGitCacheSize(1), WithGitFetchInterval(time.Hour))
+	_, err := loader.LoadTemplate(context.TODO(), "main", dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	cacheDir := loader.cacheDir
+	_, err = os.Stat(filepath.Join(cacheDir, "mirror.git"))
+	assert.NoError(t, err)
+	entries, err := ioutil.ReadDir(filepath.Join(cacheDir, "trees"))
+	assert.NoError(t, err)
+	assert.Empty(t, entries, "the files of definitions should be removed once they're loaded")
+
+	commitDefinition(t, work, "StatefulSet")
+	runGit(t, work, "push", "--quiet", bare, "main")
+	runGit(t, work, "tag", "v2")
+	runGit(t, work, "push", "--quiet", bare, "v2")
+	tmpl, err := loader.LoadTemplate(context.TODO(), "main", dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "output: kind: \"Deployment\"\n", tmpl.TemplateStr, "the repository should not be fetched within the interval")
+
+	loader.fetchInterval = 0
+	tmpl, err = loader.LoadTemplate(context.TODO(), "main", dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "output: kind: \"StatefulSet\"\n", tmpl.TemplateStr)
+	assert.Len(t, loader.trees, 1, "the least recently used commit should be evicted")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := loader.LoadTemplate(context.TODO(), "v1", dm, "webservice", ComponentTemplateKind)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.NoError(t, loader.Close())
+	_, err = os.Stat(cacheDir)
+	assert.True(t, os.IsNotExist(err), "the temporary directory should be removed")
+	assert.Empty(t, loader.trees)
+	tmpl, err = loader.LoadTemplate(context.TODO(), "v2", dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err, "the loader should fetch again after closed")
+	assert.Equal(t, "output: kind: \"StatefulSet\"\n", tmpl.TemplateStr)
+	assert.NoError(t, loader.Close())
+
+	userDir, err := ioutil.TempDir("", "git-cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(userDir)
+	loader = NewGitTemplateLoader(bare, WithGitPath("definitions"), WithGitCacheDir(userDir))
+	_, err = loader.LoadTemplate(context.TODO(), "main", dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.NoError(t, loader.Close())
+	_, err = os.Stat(filepath.Join(userDir, "mirror.git"))
+	assert.NoError(t, err, "the cache directory set by the user should be kept")
+}
+
+func TestGitTemplateLoaderArguments(t *testing.T) {
+	_, err := NewGitTemplateLoader("--upload-pack=touch /tmp/pwned").LoadTemplate(context.TODO(), "main", mock.NewMockDiscoveryMapper(), "webservice", ComponentTemplateKind)
+	assert.Contains(t, err.Error(), `invalid repository url "--upload-pack=touch /tmp/pwned"`)
+
+	loader := NewGitTemplateLoader("https://example.com/definitions.git", WithGitToken("secret-token"))
+	cmd := loader.command(context.TODO(), "mirror.git", true, "fetch", "--", loader.url)
+	assert.Equal(t, []string{"git", "--git-dir=mirror.git", "fetch", "--", "https://example.com/definitions.git"}, cmd.Args)
+	assert.NotContains(t, strings.Join(cmd.Args, " "), "secret-token")
+	assert.NotContains(t, strings.Join(cmd.Args, " "), gitAuthHeader("secret-token"))
+	assert.Contains(t, cmd.Env, "GIT_CONFIG_VALUE_0="+gitAuthHeader("secret-token"))
+	cmd = loader.command(context.TODO(), "mirror.git", false, "rev-parse", "main")
+	assert.NotContains(t, cmd.Env, "GIT_CONFIG_VALUE_0="+gitAuthHeader("secret-token"), "the token should only be sent to the remote")
+}
+
+func TestGitCommandError(t *testing.T) {
+	err := gitCommandError("fetch", "https://example.com/definitions.git",
+		"fatal: could not read Username for 'https://example.com': terminal prompts disabled\n", errors.New("exit status 128"))
+	assert.EqualError(t, err, "git fetch: authentication to https://example.com/definitions.git failed, check the token: "+
+		"fatal: could not read Username for 'https://example.com': terminal prompts disabled")
+	err = gitCommandError("fetch", "https://example.com/definitions.git",
+		"fatal: unable to access 'https://example.com/definitions.git/': Could not resolve host: example.com", errors.New("exit status 128"))
+	assert.EqualError(t, err, "git fetch: fatal: unable to access 'https://example.com/definitions.git/': Could not resolve host: example.com")
+	assert.EqualError(t, gitCommandError("fetch", "", "", &exec.Error{Name: "git", Err: exec.ErrNotFound}), "git is not installed")
+}
@@ -0,0 +1,109 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam/discoverymapper"
+)
+
+// ErrAmbiguousDefinition is the error of looking up the definition of a GVK which is produced by more than one definition
+type ErrAmbiguousDefinition struct {
+	GVK schema.GroupVersionKind
+	// Candidates are the names of the definitions producing the GVK
+	Candidates []string
+}
+
+func (e *ErrAmbiguousDefinition) Error() string {
+	return fmt.Sprintf("workload %s is produced by multiple ComponentDefinitions: %s", e.GVK.String(), strings.Join(e.Candidates, ", "))
+}
+
+// IsAmbiguousDefinition returns true if the cause of err is an ErrAmbiguousDefinition
+func IsAmbiguousDefinition(err error) bool {
+	_, ok := errors.Cause(err).(*ErrAmbiguousDefinition)
+	return ok
+}
+
+// LoadTemplateByWorkloadGVK loads the template of the ComponentDefinition whose workload is of the GVK, e.g. to find
+// the component of an existing resource. The workload of a ComponentDefinition is either defined by its apiVersion
+// and kind, or typed by the name of a WorkloadDefinition. The ComponentDefinitions are searched in the definition
+// namespaces of the context, it returns a not found error if none matches, or an *ErrAmbiguousDefinition
+// listing the candidates if more than one does.
+func LoadTemplateByWorkloadGVK(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper, gvk schema.GroupVersionKind) (*Template, error) {
+	if dm == nil {
+		return nil, errors.WithMessagef(ErrNilDiscoveryMapper, "load template of workload %s", gvk.String())
+	}
+	var candidates []string
+	candidateNamespace := map[string]string{}
+	typeGVKs := map[string]*schema.GroupVersionKind{}
+	for _, ns := range definitionNamespaces(ctx) {
+		cdList := &v1alpha2.ComponentDefinitionList{}
+		if err := cli.List(ctx, cdList, client.InNamespace(ns)); err != nil {
+			return nil, errors.Wrapf(err, "list ComponentDefinitions in namespace %s", ns)
+		}
+		for i := range cdList.Items {
+			cd := &cdList.Items[i]
+			if _, ok := candidateNamespace[cd.Name]; ok {
+				// shadowed by the definition with the same name found earlier
+				continue
+			}
+			workloadGVK, err := componentWorkloadGVK(ctx, cli, dm, cd, typeGVKs)
+			if err != nil {
+				return nil, err
+			}
+			if workloadGVK == nil || *workloadGVK != gvk {
+				continue
+			}
+			candidates = append(candidates, cd.Name)
+			candidateNamespace[cd.Name] = ns
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return nil, kerrors.NewNotFound(v1alpha2.SchemeGroupVersion.WithResource("componentdefinitions").GroupResource(),
+			"for workload "+gvk.String())
+	case 1:
+		name := candidates[0]
+		return LoadTemplateOfKind(ctx, cli, dm, name, ComponentTemplateKind,
+			LoadFromNamespaces(candidateNamespace[name]), DisableWorkloadFallback())
+	default:
+		sort.Strings(candidates)
+		return nil, &ErrAmbiguousDefinition{GVK: gvk, Candidates: candidates}
+	}
+}
+
+// componentWorkloadGVK returns the GVK of the workload of the ComponentDefinition, the GVKs of WorkloadDefinitions
+// are cached in typeGVKs by name. It returns nil if the workload can't be resolved since it can't match any GVK.
+func componentWorkloadGVK(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper,
+	cd *v1alpha2.ComponentDefinition, typeGVKs map[string]*schema.GroupVersionKind) (*schema.GroupVersionKind, error) {
+	if cd.Spec.Workload.Type == "" {
+		var result *schema.GroupVersionKind
+		if gv, err := schema.ParseGroupVersion(cd.Spec.Workload.Definition.APIVersion); err == nil {
+			gvk := gv.WithKind(cd.Spec.Workload.Definition.Kind)
+			result = &gvk
+		}
+		return result, nil
+	}
+	if gvk, ok := typeGVKs[cd.Spec.Workload.Type]; ok {
+		return gvk, nil
+	}
+	var result *schema.GroupVersionKind
+	gvk, err := getWorkloadDefinitionGVK(ctx, cli, dm, cd.Spec.Workload.Type)
+	switch {
+	case kerrors.IsNotFound(err):
+	case err != nil:
+		return nil, errors.WithMessagef(err, "cannot resolve the workload type of ComponentDefinition %s", cd.Name)
+	default:
+		result = &gvk
+	}
+	typeGVKs[cd.Spec.Workload.Type] = result
+	return result, nil
+}
@@ -0,0 +1,86 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/stretchr/testify/assert"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam"
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+func TestLoadTemplateByWorkloadGVK(t *testing.T) {
+	componentDef := func(name string, workload v1alpha2.WorkloadTypeDescriptor) v1alpha2.ComponentDefinition {
+		return v1alpha2.ComponentDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: oam.SystemDefinitonNamespace},
+			Spec: v1alpha2.ComponentDefinitionSpec{
+				Workload:  workload,
+				Schematic: &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {} // " + name}},
+			},
+		}
+	}
+	cds := []v1alpha2.ComponentDefinition{
+		componentDef("webservice", v1alpha2.WorkloadTypeDescriptor{Definition: v1alpha2.WorkloadGVK{APIVersion: "apps/v1", Kind: "Deployment"}}),
+		componentDef("cron", v1alpha2.WorkloadTypeDescriptor{Definition: v1alpha2.WorkloadGVK{APIVersion: "batch/v1beta1", Kind: "CronJob"}}),
+		componentDef("task", v1alpha2.WorkloadTypeDescriptor{Type: "cronjobs.batch"}),
+		componentDef("legacy", v1alpha2.WorkloadTypeDescriptor{Type: "missing"}),
+	}
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			switch o := obj.(type) {
+			case *v1alpha2.ComponentDefinition:
+				for _, cd := range cds {
+					if cd.Name == key.Name && cd.Namespace == key.Namespace {
+						*o = cd
+						return nil
+					}
+				}
+			case *v1alpha2.WorkloadDefinition:
+				if key.Name == "cronjobs.batch" {
+					o.Name = key.Name
+					o.Spec.Reference = v1alpha2.DefinitionReference{Name: "cronjobs.batch", Version: "v1beta1"}
+					return nil
+				}
+			}
+			return kerrors.NewNotFound(schema.GroupResource{}, key.Name)
+		},
+		MockList: func(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+			lo := &client.ListOptions{}
+			lo.ApplyOptions(opts)
+			if lo.Namespace == oam.SystemDefinitonNamespace {
+				list.(*v1alpha2.ComponentDefinitionList).Items = cds
+			}
+			return nil
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	dm.MockKindsFor = func(gvr schema.GroupVersionResource) ([]schema.GroupVersionKind, error) {
+		return []schema.GroupVersionKind{{Group: "batch", Version: "v1beta1", Kind: "CronJob"}}, nil
+	}
+
+	tmpl, err := LoadTemplateByWorkloadGVK(context.TODO(), &tclient, dm, schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"})
+	assert.NoError(t, err)
+	assert.Equal(t, "webservice", tmpl.Name)
+	assert.Equal(t, "output: {} // webservice", tmpl.TemplateStr)
+
+	gvk := schema.GroupVersionKind{Group: "batch", Version: "v1beta1", Kind: "CronJob"}
+	_, err = LoadTemplateByWorkloadGVK(context.TODO(), &tclient, dm, gvk)
+	assert.True(t, IsAmbiguousDefinition(err))
+	assert.Equal(t, &ErrAmbiguousDefinition{GVK: gvk, Candidates: []string{"cron", "task"}}, err)
+	assert.EqualError(t, err, "workload batch/v1beta1, Kind=CronJob is produced by multiple ComponentDefinitions: cron, task")
+
+	_, err = LoadTemplateByWorkloadGVK(context.TODO(), &tclient, dm, schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"})
+	assert.True(t, kerrors.IsNotFound(err))
+
+	_, err = LoadTemplateByWorkloadGVK(context.TODO(), &tclient, nil, gvk)
+	assert.Error(t, err)
+}
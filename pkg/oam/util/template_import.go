@@ -0,0 +1,192 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue/build"
+	"cuelang.org/go/cue/parser"
+	"cuelang.org/go/cue/token"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// LabelCUEPackage marks a ConfigMap as a CUE package which can be imported by templates
+	LabelCUEPackage = "definition.oam.dev/cue-package"
+	// AnnotationCUEImportPath is the import path of the CUE package stored in a ConfigMap
+	AnnotationCUEImportPath = "definition.oam.dev/cue-import-path"
+)
+
+// ImportResolver resolves the CUE packages imported by templates
+type ImportResolver interface {
+	// ResolveImport returns the files of the package by file name, found is false if there's no such package
+	ResolveImport(path string) (files map[string]string, found bool, err error)
+}
+
+// StaticImportResolver resolves imports from the packages it holds, by import path and then file name
+type StaticImportResolver map[string]map[string]string
+
+// ResolveImport returns the files of the package
+func (r StaticImportResolver) ResolveImport(path string) (map[string]string, bool, error) {
+	files, ok := r[path]
+	return files, ok, nil
+}
+
+// ConfigMapImportResolver resolves imports from the ConfigMaps labeled with LabelCUEPackage in a namespace,
+// the import path of each package is in the AnnotationCUEImportPath annotation and the files are in the data.
+type ConfigMapImportResolver struct {
+	ctx       context.Context
+	cli       client.Reader
+	namespace string
+}
+
+// NewConfigMapImportResolver creates a ConfigMapImportResolver for the namespace
+func NewConfigMapImportResolver(ctx context.Context, cli client.Reader, namespace string) *ConfigMapImportResolver {
+	return &ConfigMapImportResolver{ctx: ctx, cli: cli, namespace: namespace}
+}
+
+// ResolveImport returns the files of the package in the ConfigMap with the import path
+func (r *ConfigMapImportResolver) ResolveImport(path string) (map[string]string, bool, error) {
+	cms := &corev1.ConfigMapList{}
+	if err := r.cli.List(r.ctx, cms, client.InNamespace(r.namespace), client.HasLabels{LabelCUEPackage}); err != nil {
+		return nil, false, errors.Wrapf(err, "list CUE packages in namespace %s", r.namespace)
+	}
+	for _, cm := range cms.Items {
+		if cm.Annotations[AnnotationCUEImportPath] == path {
+			return cm.Data, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// ErrImportUnresolved is returned when building a template if a CUE package it imports can't be resolved,
+// callers can get it by errors.Cause to tell the missing package from other errors of the template.
+type ErrImportUnresolved struct {
+	// Path is the import path of the missing package
+	Path string
+	// ImportedBy is the import path of the package which imports the missing one, it's empty if the template does
+	ImportedBy string
+}
+
+func (e *ErrImportUnresolved) Error() string {
+	if e.ImportedBy != "" {
+		return fmt.Sprintf("cannot find CUE package %q imported by package %q", e.Path, e.ImportedBy)
+	}
+	return fmt.Sprintf("cannot find CUE package %q imported by the template", e.Path)
+}
+
+// isBuiltinImport returns true for the packages of the CUE standard library, which have no dot in the first path element
+func isBuiltinImport(path string) bool {
+	return !strings.Contains(strings.Split(path, "/")[0], ".")
+}
+
+// resolveImports resolves the packages imported by the template and the packages they import
+func resolveImports(templateStr string, resolver ImportResolver) (map[string]map[string]string, error) {
+	imports := map[string]map[string]string{}
+	paths, err := importPaths("-", templateStr)
+	if err != nil {
+		return nil, err
+	}
+	var pending []ErrImportUnresolved
+	for _, path := range paths {
+		pending = append(pending, ErrImportUnresolved{Path: path})
+	}
+	for len(pending) > 0 {
+		imp := pending[0]
+		pending = pending[1:]
+		if _, ok := imports[imp.Path]; ok || isBuiltinImport(imp.Path) {
+			continue
+		}
+		files, found, err := resolver.ResolveImport(imp.Path)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "resolve CUE package %q", imp.Path)
+		}
+		if !found {
+			return nil, &imp
+		}
+		imports[imp.Path] = files
+		for name, src := range files {
+			paths, err := importPaths(name, src)
+			if err != nil {
+				return nil, errors.WithMessagef(err, "parse CUE package %q", imp.Path)
+			}
+			for _, path := range paths {
+				pending = append(pending, ErrImportUnresolved{Path: path, ImportedBy: imp.Path})
+			}
+		}
+	}
+	return imports, nil
+}
+
+// checkImportsResolved returns an *ErrImportUnresolved if a non-builtin package imported by the template
+// isn't in the resolved imports
+func checkImportsResolved(templateStr string, imports map[string]map[string]string) error {
+	paths, err := importPaths("-", templateStr)
+	if err != nil {
+		// syntax errors are reported by building the template
+		return nil
+	}
+	for _, path := range paths {
+		if _, ok := imports[path]; !ok && !isBuiltinImport(path) {
+			return &ErrImportUnresolved{Path: path}
+		}
+	}
+	return nil
+}
+
+// importPaths returns the import paths of a CUE file
+func importPaths(filename, src string) ([]string, error) {
+	f, err := parser.ParseFile(filename, src, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, spec := range f.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// NewBuildInstance creates the CUE build instance of a template, which loads the imported packages from the
+// resolved imports, e.g. Template.Imports, so that templates can be built outside of this package with their imports
+func NewBuildInstance(imports map[string]map[string]string) *build.Instance {
+	bctx := build.NewContext()
+	return bctx.NewInstance("", importLoader(bctx, imports))
+}
+
+// importLoader loads the resolved imports as instances when building a template
+func importLoader(bctx *build.Context, imports map[string]map[string]string) build.LoadFunc {
+	var load build.LoadFunc
+	load = func(_ token.Pos, path string) *build.Instance {
+		files, ok := imports[path]
+		if !ok {
+			// builtin packages are resolved by CUE itself
+			return nil
+		}
+		inst := bctx.NewInstance(path, load)
+		names := make([]string, 0, len(files))
+		for name := range files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			// the error is kept in inst.Err and reported by the import
+			if err := inst.AddFile(name, files[name]); err != nil {
+				return inst
+			}
+		}
+		// load the imports of the package, CUE only completes the instances to build
+		_ = inst.Complete()
+		return inst
+	}
+	return load
+}
@@ -0,0 +1,137 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/build"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+)
+
+func TestNewTemplateWithImports(t *testing.T) {
+	resolver := StaticImportResolver{
+		"vela.dev/helpers": {
+			"labels.cue": `package helpers
+
+import "vela.dev/naming"
+
+#Labels: app: naming.#Prefix + "app"
+`,
+		},
+		"vela.dev/naming": {
+			"naming.cue": "package naming\n\n#Prefix: \"vela-\"\n",
+		},
+	}
+	template := `import (
+	"strings"
+	"vela.dev/helpers"
+)
+
+output: {
+	metadata: labels: helpers.#Labels
+	metadata: name:   strings.ToLower(context.name)
+}
+`
+	tmpl, err := NewTemplateWithOptions(&v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: template}}, nil, nil,
+		WithImportResolver(resolver), WithCUEValidation())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]string{
+		"vela.dev/helpers": resolver["vela.dev/helpers"],
+		"vela.dev/naming":  resolver["vela.dev/naming"],
+	}, tmpl.Imports)
+
+	inst, err := buildCUETemplate(nil, template, tmpl.Imports)
+	assert.NoError(t, err)
+	app, err := inst.Lookup("output", "metadata", "labels", "app").String()
+	assert.NoError(t, err)
+	assert.Equal(t, "vela-app", app)
+
+	bi := NewBuildInstance(tmpl.Imports)
+	assert.NoError(t, bi.AddFile("-", template))
+	assert.NoError(t, bi.AddFile("context", "context: name: \"Web\""))
+	built := cue.Build([]*build.Instance{bi})[0]
+	assert.NoError(t, built.Err)
+	name, err := built.Lookup("output", "metadata", "name").String()
+	assert.NoError(t, err)
+	assert.Equal(t, "web", name)
+
+	_, err = NewTemplateWithOptions(&v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: `import "vela.dev/missing"
+output: missing.#Labels
+`}}, nil, nil, WithImportResolver(resolver))
+	assert.EqualError(t, err, `cannot find CUE package "vela.dev/missing" imported by the template`)
+
+	tmpl, err = NewTemplate(&v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: template}}, nil, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, tmpl.Imports, "imports are only resolved with a resolver")
+}
+
+func TestErrImportUnresolved(t *testing.T) {
+	template := `import "vela.dev/missing"
+
+output: missing.#Labels
+`
+	_, err := NewTemplateWithOptions(&v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: template}}, nil, nil, WithCUEValidation())
+	unresolved, ok := errors.Cause(err).(*ErrImportUnresolved)
+	assert.True(t, ok, "should not be reported as a parse error: %v", err)
+	assert.Equal(t, &ErrImportUnresolved{Path: "vela.dev/missing"}, unresolved)
+
+	err = ValidateTemplate(&Template{Name: "worker", TemplateStr: template})
+	assert.Equal(t, &ErrImportUnresolved{Path: "vela.dev/missing"}, errors.Cause(err))
+
+	resolver := StaticImportResolver{"vela.dev/helpers": {"labels.cue": "package helpers\n\nimport \"vela.dev/missing\"\n"}}
+	_, err = NewTemplateWithOptions(&v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: `import "vela.dev/helpers"
+output: {}
+`}}, nil, nil, WithImportResolver(resolver))
+	assert.Equal(t, &ErrImportUnresolved{Path: "vela.dev/missing", ImportedBy: "vela.dev/helpers"}, errors.Cause(err))
+	assert.EqualError(t, err, `cannot find CUE package "vela.dev/missing" imported by package "vela.dev/helpers"`)
+
+	// builtin packages and syntax errors aren't import resolution errors
+	_, err = NewTemplateWithOptions(&v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: `import "strings"
+output: name: strings.ToLower("A")
+`}}, nil, nil, WithCUEValidation())
+	assert.NoError(t, err)
+	_, err = NewTemplateWithOptions(&v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {"}}, nil, nil, WithCUEValidation())
+	_, ok = errors.Cause(err).(*TemplateParseError)
+	assert.True(t, ok)
+}
+
+func TestConfigMapImportResolver(t *testing.T) {
+	cli := test.MockClient{
+		MockList: func(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+			listOpts := &client.ListOptions{}
+			for _, opt := range opts {
+				opt.ApplyToList(listOpts)
+			}
+			assert.Equal(t, "vela-system", listOpts.Namespace)
+			cms := list.(*corev1.ConfigMapList)
+			cms.Items = []corev1.ConfigMap{{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "helpers",
+					Labels:      map[string]string{LabelCUEPackage: "true"},
+					Annotations: map[string]string{AnnotationCUEImportPath: "vela.dev/helpers"},
+				},
+				Data: map[string]string{"labels.cue": "package helpers\n"},
+			}}
+			return nil
+		},
+	}
+	resolver := NewConfigMapImportResolver(context.TODO(), &cli, "vela-system")
+
+	files, found, err := resolver.ResolveImport("vela.dev/helpers")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, map[string]string{"labels.cue": "package helpers\n"}, files)
+
+	_, found, err = resolver.ResolveImport("vela.dev/missing")
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
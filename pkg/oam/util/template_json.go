@@ -0,0 +1,111 @@
+package util
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/apis/types"
+)
+
+// TemplateSchemaVersion is the version of the JSON representation of Template,
+// it must be changed when the representation is changed incompatibly.
+const TemplateSchemaVersion = "v1"
+
+// templateJSON is the JSON representation of Template, empty fields are omitted to keep it compact
+type templateJSON struct {
+	SchemaVersion      string                       `json:"schemaVersion"`
+	Name               string                       `json:"name,omitempty"`
+	Alias              string                       `json:"alias,omitempty"`
+	Namespace          string                       `json:"namespace,omitempty"`
+	Template           string                       `json:"template,omitempty"`
+	Health             string                       `json:"health,omitempty"`
+	CustomStatus       string                       `json:"customStatus,omitempty"`
+	StatusDetails      string                       `json:"statusDetails,omitempty"`
+	CapabilityCategory types.CapabilityCategory     `json:"category,omitempty"`
+	Reference          *v1alpha2.WorkloadGVK        `json:"reference,omitempty"`
+	Helm               *v1alpha2.Helm               `json:"helm,omitempty"`
+	HelmValues         map[string]interface{}       `json:"helmValues,omitempty"`
+	Kustomize          *v1alpha2.Kustomize          `json:"kustomize,omitempty"`
+	Imports            map[string]map[string]string `json:"imports,omitempty"`
+	Terraform          *TerraformConfiguration      `json:"terraform,omitempty"`
+	Deprecations       []DeprecatedField            `json:"deprecations,omitempty"`
+	Order              int                          `json:"order,omitempty"`
+	TemplateAPIVersion string                       `json:"templateAPIVersion,omitempty"`
+	RequiredTraits     []string                     `json:"requiredTraits,omitempty"`
+	Limits             *ResourceBounds              `json:"limits,omitempty"`
+	AppliesToWorkloads []string                     `json:"appliesToWorkloads,omitempty"`
+	ExpectedOutputs    *int                         `json:"expectedOutputs,omitempty"`
+	Source             *TemplateSource              `json:"source,omitempty"`
+}
+
+// MarshalJSON marshals the template with TemplateSchemaVersion, so that it can be persisted and loaded later
+func (t Template) MarshalJSON() ([]byte, error) {
+	out := templateJSON{
+		SchemaVersion:      TemplateSchemaVersion,
+		Name:               t.Name,
+		Alias:              t.Alias,
+		Namespace:          t.Namespace,
+		Template:           t.TemplateStr,
+		Health:             t.Health,
+		CustomStatus:       t.CustomStatus,
+		StatusDetails:      t.StatusDetails,
+		CapabilityCategory: t.CapabilityCategory,
+		Helm:               t.Helm,
+		HelmValues:         t.HelmValues,
+		Kustomize:          t.Kustomize,
+		Imports:            t.Imports,
+		Terraform:          t.Terraform,
+		Deprecations:       t.Deprecations,
+		Order:              t.Order,
+		TemplateAPIVersion: t.TemplateAPIVersion,
+		RequiredTraits:     t.RequiredTraits,
+		Limits:             t.Limits,
+		AppliesToWorkloads: t.AppliesToWorkloads,
+		ExpectedOutputs:    t.ExpectedOutputs,
+		Source:             t.Source,
+	}
+	if t.Reference != (v1alpha2.WorkloadGVK{}) {
+		out.Reference = &t.Reference
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON unmarshals the template marshaled by MarshalJSON, it returns an error for other schema versions
+func (t *Template) UnmarshalJSON(data []byte) error {
+	in := templateJSON{}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	if in.SchemaVersion != TemplateSchemaVersion {
+		return errors.Errorf("unsupported template schema version %q, expect %q", in.SchemaVersion, TemplateSchemaVersion)
+	}
+	*t = Template{
+		Name:               in.Name,
+		Alias:              in.Alias,
+		Namespace:          in.Namespace,
+		TemplateStr:        in.Template,
+		Health:             in.Health,
+		CustomStatus:       in.CustomStatus,
+		StatusDetails:      in.StatusDetails,
+		CapabilityCategory: in.CapabilityCategory,
+		Helm:               in.Helm,
+		HelmValues:         in.HelmValues,
+		Kustomize:          in.Kustomize,
+		Imports:            in.Imports,
+		Terraform:          in.Terraform,
+		Deprecations:       in.Deprecations,
+		Order:              in.Order,
+		TemplateAPIVersion: in.TemplateAPIVersion,
+		RequiredTraits:     in.RequiredTraits,
+		Limits:             in.Limits,
+		AppliesToWorkloads: in.AppliesToWorkloads,
+		ExpectedOutputs:    in.ExpectedOutputs,
+		Source:             in.Source,
+	}
+	if in.Reference != nil {
+		t.Reference = *in.Reference
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package util
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/apis/types"
+)
+
+func TestTemplateJSONRoundTrip(t *testing.T) {
+	testCases := map[string]*Template{
+		"empty": {},
+		"cue": {
+			Name:               "webservice",
+			Alias:              "web",
+			Namespace:          "vela-system",
+			TemplateStr:        "output: {\n\tkind: \"Deployment\"\n}\n",
+			Health:             "isHealth: context.output.status.readyReplicas == context.output.status.replicas\n",
+			CustomStatus:       "message: \"ready\"\ndetails: ready: true\n",
+			StatusDetails:      "details: ready: true",
+			CapabilityCategory: types.CUECategory,
+			Reference:          v1alpha2.WorkloadGVK{APIVersion: "apps/v1", Kind: "Deployment"},
+			Imports:            map[string]map[string]string{"oam.dev/lib": {"lib.cue": "package lib\n"}},
+			Deprecations:       []DeprecatedField{deprecatedExtensionTemplate},
+			Order:              -10,
+			TemplateAPIVersion: "v1.2",
+			RequiredTraits:     []string{"scaler"},
+			Limits:             &ResourceBounds{CPU: ResourceBound{Max: quantity("2")}},
+			AppliesToWorkloads: []string{"deployments.apps"},
+			Source:             &TemplateSource{Addon: "fluxcd", Version: "1.0.0"},
+		},
+		"helm": {
+			CapabilityCategory: types.HelmCategory,
+			Helm: &v1alpha2.Helm{
+				Release:    runtime.RawExtension{Raw: []byte(`{"chart":{"spec":{"chart":"podinfo"}}}`)},
+				Repository: runtime.RawExtension{Raw: []byte(`{"url":"http://oam.dev/catalog/"}`)},
+			},
+			HelmValues: map[string]interface{}{"image": map[string]interface{}{"tag": "5.1.2"}},
+		},
+		"kustomize": {
+			CapabilityCategory: types.KustomizeCategory,
+			Kustomize:          &v1alpha2.Kustomize{Spec: runtime.RawExtension{Raw: []byte(`{"path":"./overlays/production"}`)}},
+		},
+		"terraform": {
+			CapabilityCategory: types.TerraformCategory,
+			Terraform: &TerraformConfiguration{
+				ModuleSources: map[string]string{"rds": "terraform-aws-modules/rds/aws"},
+				Variables:     []TerraformVariable{{Name: "engine", Description: "the engine", Required: true}},
+				Outputs:       []string{"endpoint"},
+				Backend:       &TerraformBackend{Type: "s3", Config: map[string]interface{}{"bucket": "state", "encrypt": true}},
+			},
+		},
+	}
+	for name, tmpl := range testCases {
+		bt, err := json.Marshal(tmpl)
+		assert.NoError(t, err, name)
+		got := &Template{}
+		assert.NoError(t, json.Unmarshal(bt, got), name)
+		assert.Equal(t, tmpl, got, name)
+	}
+
+	bt, err := json.Marshal(&Template{})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"schemaVersion":"v1"}`, string(bt))
+
+	err = json.Unmarshal([]byte(`{"schemaVersion":"v0","template":"output: {}"}`), &Template{})
+	assert.EqualError(t, err, `unsupported template schema version "v0", expect "v1"`)
+}
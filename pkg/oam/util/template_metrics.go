@@ -0,0 +1,80 @@
+package util
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	templateLoadSuccess  = "success"
+	templateLoadNotFound = "not_found"
+	templateLoadError    = "error"
+)
+
+// templateMetrics are the metrics of LoadTemplate, nil means LoadTemplate is not instrumented
+var templateMetrics *templateLoaderMetrics
+
+type templateLoaderMetrics struct {
+	loads            *prometheus.CounterVec
+	loadDuration     *prometheus.HistogramVec
+	workloadFallback prometheus.Counter
+}
+
+// RegisterTemplateMetrics registers the metrics of LoadTemplate to the registerer, e.g. the metrics registry of controller-runtime.
+// LoadTemplate is not instrumented until it's called, it should be called once before loading templates.
+func RegisterTemplateMetrics(registerer prometheus.Registerer) error {
+	m := &templateLoaderMetrics{
+		loads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kubevela_template_loads_total",
+			Help: "Number of templates loaded by kind and outcome (success, not_found, error).",
+		}, []string{"kind", "outcome"}),
+		loadDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kubevela_template_load_duration_seconds",
+			Help:    "Time taken to load a template, including reading its definition.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"kind"}),
+		workloadFallback: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "kubevela_template_workload_fallback_total",
+			Help: "Number of component templates loaded from WorkloadDefinition as no ComponentDefinition is found.",
+		}),
+	}
+	for _, c := range []prometheus.Collector{m.loads, m.loadDuration, m.workloadFallback} {
+		if err := registerer.Register(c); err != nil {
+			return err
+		}
+	}
+	templateMetrics = m
+	return nil
+}
+
+// observeTemplateLoad records the outcome and duration of loading a template
+func observeTemplateLoad(kind TemplateKind, start time.Time, err error) {
+	if templateMetrics == nil {
+		return
+	}
+	templateMetrics.loads.WithLabelValues(kind.String(), templateLoadOutcome(err)).Inc()
+	templateMetrics.loadDuration.WithLabelValues(kind.String()).Observe(time.Since(start).Seconds())
+}
+
+// templateLoadOutcome returns the outcome of loading a template with the error
+func templateLoadOutcome(err error) string {
+	switch {
+	case err == nil:
+		return templateLoadSuccess
+	case kerrors.IsNotFound(errors.Cause(err)):
+		return templateLoadNotFound
+	default:
+		return templateLoadError
+	}
+}
+
+// observeWorkloadFallback records a component template loaded from WorkloadDefinition
+func observeWorkloadFallback() {
+	if templateMetrics == nil {
+		return
+	}
+	templateMetrics.workloadFallback.Inc()
+}
@@ -0,0 +1,63 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ktypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+func TestTemplateMetrics(t *testing.T) {
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			switch o := obj.(type) {
+			case *v1alpha2.ComponentDefinition:
+				return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: "componentdefinitions"}, key.Name)
+			case *v1alpha2.WorkloadDefinition:
+				if key.Name != "worker" {
+					return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: "workloaddefinitions"}, key.Name)
+				}
+				o.Spec.Reference = v1alpha2.DefinitionReference{Name: "deployments.apps"}
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}}
+			}
+			return nil
+		},
+		MockList: test.NewMockListFn(nil),
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	dm.MockKindsFor = mock.NewMockKindsFor("Deployment", "v1")
+
+	// not instrumented without a registry
+	_, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, "worker", ComponentTemplateKind)
+	assert.NoError(t, err)
+
+	registry := prometheus.NewRegistry()
+	assert.NoError(t, RegisterTemplateMetrics(registry))
+	defer func() { templateMetrics = nil }()
+
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "worker", ComponentTemplateKind)
+	assert.NoError(t, err)
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "unknown", ComponentTemplateKind)
+	assert.Error(t, err)
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "worker", TemplateKind("Unknown"))
+	assert.Error(t, err)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(templateMetrics.loads.WithLabelValues(ComponentTemplateKind.String(), templateLoadSuccess)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(templateMetrics.loads.WithLabelValues(ComponentTemplateKind.String(), templateLoadNotFound)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(templateMetrics.loads.WithLabelValues("Unknown", templateLoadError)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(templateMetrics.workloadFallback))
+	assert.Equal(t, 2, testutil.CollectAndCount(templateMetrics.loadDuration))
+
+	// registering twice is rejected by the registry
+	assert.Error(t, RegisterTemplateMetrics(registry))
+}
@@ -0,0 +1,437 @@
+package util
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oam-dev/kubevela/pkg/oam/discoverymapper"
+)
+
+const (
+	ociManifestMediaType    = "application/vnd.oci.image.manifest.v1+json"
+	dockerManifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+
+	// DefaultOCIMaxBundleSize is the max size in bytes of the manifest and layers of a bundle, uncompressed
+	DefaultOCIMaxBundleSize int64 = 32 << 20
+	// DefaultOCICacheSize is the max number of bundles cached by OCITemplateLoader
+	DefaultOCICacheSize = 16
+	// DefaultOCITimeout is the timeout of the requests to the registry
+	DefaultOCITimeout = 30 * time.Second
+)
+
+// OCITemplateLoader loads templates like LoadTemplate, but from the definitions in a bundle pulled from an OCI registry.
+// Each layer of the bundle is a YAML or JSON file of definitions, or a tar.gz archive of them. Bundles are cached by
+// the digest of their manifest, so a tag is resolved on every load while its layers are only pulled once, the least
+// recently used bundles are evicted once the cache is full.
+// It's safe for concurrent use.
+type OCITemplateLoader struct {
+	client   *http.Client
+	username string
+	password string
+	scheme   string
+	maxSize  int64
+	maxCache int
+
+	mu      sync.Mutex
+	tokens  map[string]string
+	bundles map[string]*fileDefinitionReader
+	// recent has the digests of the cached bundles, from the least to the most recently used
+	recent []string
+}
+
+// OCITemplateLoaderOption customizes how OCITemplateLoader pulls bundles
+type OCITemplateLoaderOption func(*OCITemplateLoader)
+
+// WithOCIBasicAuth makes OCITemplateLoader authenticate to the registry with the username and password,
+// registries are accessed anonymously by default.
+func WithOCIBasicAuth(username, password string) OCITemplateLoaderOption {
+	return func(l *OCITemplateLoader) {
+		l.username, l.password = username, password
+	}
+}
+
+// WithOCIHTTPClient makes OCITemplateLoader pull bundles with the client, e.g. to set the timeout or the CAs of the registry
+func WithOCIHTTPClient(client *http.Client) OCITemplateLoaderOption {
+	return func(l *OCITemplateLoader) {
+		l.client = client
+	}
+}
+
+// WithOCIPlainHTTP makes OCITemplateLoader access the registry with HTTP instead of HTTPS, e.g. for a local registry
+func WithOCIPlainHTTP() OCITemplateLoaderOption {
+	return func(l *OCITemplateLoader) {
+		l.scheme = "http"
+	}
+}
+
+// WithOCIMaxBundleSize makes OCITemplateLoader reject bundles larger than size bytes, DefaultOCIMaxBundleSize by default
+func WithOCIMaxBundleSize(size int64) OCITemplateLoaderOption {
+	return func(l *OCITemplateLoader) {
+		l.maxSize = size
+	}
+}
+
+// WithOCICacheSize makes OCITemplateLoader cache at most n bundles, DefaultOCICacheSize by default
+func WithOCICacheSize(n int) OCITemplateLoaderOption {
+	return func(l *OCITemplateLoader) {
+		l.maxCache = n
+	}
+}
+
+// NewOCITemplateLoader creates an OCITemplateLoader with an empty cache, its requests time out after DefaultOCITimeout
+// unless the client is set by WithOCIHTTPClient
+func NewOCITemplateLoader(opts ...OCITemplateLoaderOption) *OCITemplateLoader {
+	l := &OCITemplateLoader{
+		client:   &http.Client{Timeout: DefaultOCITimeout},
+		scheme:   "https",
+		maxSize:  DefaultOCIMaxBundleSize,
+		maxCache: DefaultOCICacheSize,
+		tokens:   map[string]string{},
+		bundles:  map[string]*fileDefinitionReader{},
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// LoadTemplate has the same contract as LoadTemplate, the definition is read from the bundle of ref,
+// e.g. "registry.example.com/addons/definitions:v1.0.0" or "registry.example.com/addons/definitions@sha256:...".
+func (l *OCITemplateLoader) LoadTemplate(ctx context.Context, ref string, dm discoverymapper.DiscoveryMapper, key string, kd TemplateKind, opts ...LoadTemplateOption) (*Template, error) {
+	definitions, err := l.pull(ctx, ref)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "LoadTemplate [%s] pull %s", key, ref)
+	}
+	return LoadTemplateOfKind(ctx, definitions, dm, key, kd, opts...)
+}
+
+// ociReference is a parsed reference of an OCI artifact
+type ociReference struct {
+	registry   string
+	repository string
+	// reference is a tag or a digest
+	reference string
+}
+
+func parseOCIReference(ref string) (ociReference, error) {
+	r := ociReference{}
+	i := strings.Index(ref, "/")
+	if i <= 0 {
+		return r, errors.Errorf("invalid reference %q, expect registry/repository:tag or registry/repository@digest", ref)
+	}
+	r.registry, r.repository = ref[:i], ref[i+1:]
+	switch {
+	case strings.Contains(r.repository, "@"):
+		i = strings.Index(r.repository, "@")
+		r.repository, r.reference = r.repository[:i], r.repository[i+1:]
+	case strings.LastIndex(r.repository, ":") > strings.LastIndex(r.repository, "/"):
+		i = strings.LastIndex(r.repository, ":")
+		r.repository, r.reference = r.repository[:i], r.repository[i+1:]
+	default:
+		r.reference = "latest"
+	}
+	if r.repository == "" || r.reference == "" {
+		return r, errors.Errorf("invalid reference %q, expect registry/repository:tag or registry/repository@digest", ref)
+	}
+	return r, nil
+}
+
+// ociManifest is the part of an OCI image manifest used to pull the layers
+type ociManifest struct {
+	Layers []ociDescriptor `json:"layers"`
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+}
+
+// pull returns the definitions in the bundle of ref, from cache if the digest of its manifest is already pulled
+func (l *OCITemplateLoader) pull(ctx context.Context, ref string) (*fileDefinitionReader, error) {
+	r, err := parseOCIReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	body, err := l.get(ctx, r, "manifests/"+r.reference, ociManifestMediaType+", "+dockerManifestMediaType, l.maxSize)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get manifest")
+	}
+	digest := sha256Digest(body)
+	if strings.HasPrefix(r.reference, "sha256:") && r.reference != digest {
+		return nil, errors.Errorf("digest of manifest %s doesn't match the reference", digest)
+	}
+	if cached := l.cached(digest); cached != nil {
+		return cached, nil
+	}
+
+	manifest := ociManifest{}
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, errors.Wrap(err, "parse manifest")
+	}
+	definitions := newFileDefinitionReader()
+	// the layers share what's left of the max size after the manifest, so does the content of an archive uncompressed
+	remaining := l.maxSize - int64(len(body))
+	for _, layer := range manifest.Layers {
+		blob, err := l.get(ctx, r, "blobs/"+layer.Digest, "", remaining)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "get layer %s", layer.Digest)
+		}
+		remaining -= int64(len(blob))
+		if sha256Digest(blob) != layer.Digest {
+			return nil, errors.Errorf("digest of layer %s doesn't match its content", layer.Digest)
+		}
+		if err := addLayerDefinitions(definitions, layer.MediaType, blob, remaining); err != nil {
+			return nil, errors.WithMessagef(err, "load definitions from layer %s", layer.Digest)
+		}
+	}
+	l.cache(digest, definitions)
+	return definitions, nil
+}
+
+// cached returns the cached bundle of the digest and marks it as the most recently used, or nil if it isn't cached
+func (l *OCITemplateLoader) cached(digest string) *fileDefinitionReader {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	definitions, ok := l.bundles[digest]
+	if ok {
+		l.touch(digest)
+	}
+	return definitions
+}
+
+// cache caches the bundle of the digest, evicting the least recently used bundles if the cache is full
+func (l *OCITemplateLoader) cache(digest string, definitions *fileDefinitionReader) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bundles[digest] = definitions
+	l.touch(digest)
+	for len(l.recent) > l.maxCache && len(l.recent) > 0 {
+		delete(l.bundles, l.recent[0])
+		l.recent = l.recent[1:]
+	}
+}
+
+// touch moves the digest to the end of the recently used ones, the caller must hold l.mu
+func (l *OCITemplateLoader) touch(digest string) {
+	for i, d := range l.recent {
+		if d == digest {
+			l.recent = append(l.recent[:i], l.recent[i+1:]...)
+			break
+		}
+	}
+	l.recent = append(l.recent, digest)
+}
+
+// addLayerDefinitions adds the definitions in a layer, which is a tar.gz archive or a YAML or JSON file,
+// the archive is rejected if it's larger than maxSize bytes uncompressed
+func addLayerDefinitions(definitions *fileDefinitionReader, mediaType string, blob []byte, maxSize int64) error {
+	if !strings.HasSuffix(mediaType, "tar+gzip") && !strings.HasSuffix(mediaType, ".tar.gzip") {
+		return definitions.addDefinitions(bytes.NewReader(blob))
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(blob))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	tr := tar.NewReader(&sizeLimitedReader{r: zr, remaining: maxSize})
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(path.Ext(hdr.Name)) {
+		case ".yaml", ".yml", ".json":
+		default:
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := definitions.addDefinitions(tr); err != nil {
+			return errors.WithMessagef(err, "load definitions from %s", hdr.Name)
+		}
+	}
+}
+
+// get gets the manifest or blob of the repository, which must be no larger than maxSize bytes,
+// it authenticates to the registry on challenge
+func (l *OCITemplateLoader) get(ctx context.Context, r ociReference, resource, accept string, maxSize int64) ([]byte, error) {
+	u := fmt.Sprintf("%s://%s/v2/%s/%s", l.scheme, r.registry, r.repository, resource)
+	tokenKey := r.registry + "/" + r.repository
+	resp, err := l.do(ctx, u, accept, tokenKey)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := l.authenticate(ctx, challenge, tokenKey); err != nil {
+			return nil, err
+		}
+		if resp, err = l.do(ctx, u, accept, tokenKey); err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %s from %s", resp.Status, u)
+	}
+	return ioutil.ReadAll(&sizeLimitedReader{r: resp.Body, remaining: maxSize})
+}
+
+// errBundleTooLarge is returned by sizeLimitedReader when the bundle exceeds the max size
+var errBundleTooLarge = errors.New("bundle exceeds the max size")
+
+// sizeLimitedReader reads from r until remaining bytes are read, then fails with errBundleTooLarge
+// if r has more, unlike io.LimitReader which silently truncates the content
+type sizeLimitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (s *sizeLimitedReader) Read(p []byte) (int, error) {
+	if s.remaining < 0 {
+		return 0, errBundleTooLarge
+	}
+	// read one more byte than remaining to tell whether r has more
+	if int64(len(p)) > s.remaining+1 {
+		p = p[:s.remaining+1]
+	}
+	n, err := s.r.Read(p)
+	s.remaining -= int64(n)
+	if s.remaining < 0 {
+		return n, errBundleTooLarge
+	}
+	return n, err
+}
+
+func (l *OCITemplateLoader) do(ctx context.Context, u, accept, tokenKey string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	l.mu.Lock()
+	token := l.tokens[tokenKey]
+	l.mu.Unlock()
+	switch {
+	case token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	case l.username != "":
+		req.SetBasicAuth(l.username, l.password)
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot reach registry")
+	}
+	return resp, nil
+}
+
+// authenticate gets a bearer token for the repository from the realm of the challenge of registry,
+// a basic challenge can only be met by the credentials which have already been sent.
+func (l *OCITemplateLoader) authenticate(ctx context.Context, challenge, tokenKey string) error {
+	scheme, params := parseAuthChallenge(challenge)
+	if !strings.EqualFold(scheme, "bearer") || params["realm"] == "" {
+		return errors.New("unauthorized, the registry requires credentials")
+	}
+	u, err := url.Parse(params["realm"])
+	if err != nil {
+		return errors.Wrapf(err, "invalid realm %q", params["realm"])
+	}
+	query := u.Query()
+	for _, k := range []string{"service", "scope"} {
+		if params[k] != "" {
+			query.Set(k, params[k])
+		}
+	}
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if l.username != "" {
+		req.SetBasicAuth(l.username, l.password)
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "cannot reach the token service of registry")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unauthorized, unexpected status %s from the token service of registry", resp.Status)
+	}
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return errors.Wrap(err, "parse token")
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	l.mu.Lock()
+	l.tokens[tokenKey] = token.Token
+	l.mu.Unlock()
+	return nil
+}
+
+// parseAuthChallenge parses a WWW-Authenticate header like `Bearer realm="https://auth.example.com/token",service="registry"`
+func parseAuthChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+	challenge = strings.TrimSpace(challenge)
+	i := strings.Index(challenge, " ")
+	if i < 0 {
+		return challenge, params
+	}
+	scheme, rest := challenge[:i], challenge[i+1:]
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		k := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimSpace(rest[eq+1:])
+		var v string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				break
+			}
+			v, rest = rest[1:end+1], rest[end+2:]
+		} else if comma := strings.Index(rest, ","); comma >= 0 {
+			v, rest = rest[:comma], rest[comma:]
+		} else {
+			v, rest = rest, ""
+		}
+		params[k] = v
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+	return scheme, params
+}
+
+func sha256Digest(content []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+}
@@ -0,0 +1,230 @@
+package util
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+// newTestRegistry serves the bundle of repository "addons/definitions" with tag "v1", the handler of each request
+// is wrapped by auth which returns false if the request is rejected. It counts the requests for blobs.
+func newTestRegistry(t *testing.T, blobs *int64, auth func(w http.ResponseWriter, r *http.Request) bool) (*httptest.Server, string) {
+	webservice := []byte(`
+apiVersion: core.oam.dev/v1alpha2
+kind: ComponentDefinition
+metadata:
+  name: webservice
+spec:
+  workload:
+    definition:
+      apiVersion: apps/v1
+      kind: Deployment
+  schematic:
+    cue:
+      template: |
+        output: kind: "Deployment"
+`)
+	var archive bytes.Buffer
+	zw := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(zw)
+	scaler := []byte(`{"apiVersion":"core.oam.dev/v1alpha2","kind":"TraitDefinition","metadata":{"name":"scaler"},` +
+		`"spec":{"schematic":{"cue":{"template":"patch: spec: replicas: 1"}}}}`)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "traits/scaler.json", Mode: 0600, Size: int64(len(scaler)), Typeflag: tar.TypeReg}))
+	_, err := tw.Write(scaler)
+	assert.NoError(t, err)
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, zw.Close())
+
+	layers := map[string][]byte{
+		sha256Digest(webservice):      webservice,
+		sha256Digest(archive.Bytes()): archive.Bytes(),
+	}
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     ociManifestMediaType,
+		"layers": []map[string]interface{}{
+			{"mediaType": "application/vnd.oam.definition.layer.v1+yaml", "digest": sha256Digest(webservice)},
+			{"mediaType": "application/vnd.oam.definitions.layer.v1.tar+gzip", "digest": sha256Digest(archive.Bytes())},
+		},
+	})
+	assert.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/addons/definitions/", func(w http.ResponseWriter, r *http.Request) {
+		if !auth(w, r) {
+			return
+		}
+		resource := strings.TrimPrefix(r.URL.Path, "/v2/addons/definitions/")
+		switch {
+		case resource == "manifests/v1" || resource == "manifests/"+sha256Digest(manifest):
+			w.Header().Set("Content-Type", ociManifestMediaType)
+			_, _ = w.Write(manifest)
+		case strings.HasPrefix(resource, "blobs/") && layers[strings.TrimPrefix(resource, "blobs/")] != nil:
+			atomic.AddInt64(blobs, 1)
+			_, _ = w.Write(layers[strings.TrimPrefix(resource, "blobs/")])
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("scope") != "repository:addons/definitions:pull" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"token":"secret-token"}`))
+	})
+	server := httptest.NewServer(mux)
+	return server, strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestOCITemplateLoader(t *testing.T) {
+	var blobs int64
+	server, registry := newTestRegistry(t, &blobs, func(w http.ResponseWriter, r *http.Request) bool { return true })
+	defer server.Close()
+	dm := mock.NewMockDiscoveryMapper()
+	loader := NewOCITemplateLoader(WithOCIPlainHTTP())
+
+	tmpl, err := loader.LoadTemplate(context.TODO(), registry+"/addons/definitions:v1", dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "output: kind: \"Deployment\"\n", tmpl.TemplateStr)
+	assert.Equal(t, int64(2), blobs)
+
+	tmpl, err = loader.LoadTemplate(context.TODO(), registry+"/addons/definitions:v1", dm, "scaler", TraitTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "patch: spec: replicas: 1", tmpl.TemplateStr)
+	assert.Equal(t, int64(2), blobs, "layers of a pulled digest should be cached")
+
+	_, err = loader.LoadTemplate(context.TODO(), registry+"/addons/definitions:v1", dm, "worker", ComponentTemplateKind)
+	assert.Error(t, err)
+	_, err = loader.LoadTemplate(context.TODO(), registry+"/addons/definitions:v2", dm, "webservice", ComponentTemplateKind)
+	assert.Contains(t, err.Error(), "unexpected status 404 Not Found")
+	_, err = loader.LoadTemplate(context.TODO(), registry+"/addons/definitions@sha256:0000", dm, "webservice", ComponentTemplateKind)
+	assert.Error(t, err)
+
+	server.Close()
+	_, err = NewOCITemplateLoader(WithOCIPlainHTTP()).LoadTemplate(context.TODO(), registry+"/addons/definitions:v1", dm, "webservice", ComponentTemplateKind)
+	assert.Contains(t, err.Error(), "cannot reach registry")
+}
+
+func TestOCITemplateLoaderLimits(t *testing.T) {
+	var blobs int64
+	server, registry := newTestRegistry(t, &blobs, func(w http.ResponseWriter, r *http.Request) bool { return true })
+	defer server.Close()
+	dm := mock.NewMockDiscoveryMapper()
+	assert.Equal(t, DefaultOCITimeout, NewOCITemplateLoader().client.Timeout)
+
+	_, err := NewOCITemplateLoader(WithOCIPlainHTTP(), WithOCIMaxBundleSize(64)).
+		LoadTemplate(context.TODO(), registry+"/addons/definitions:v1", dm, "webservice", ComponentTemplateKind)
+	assert.Contains(t, err.Error(), errBundleTooLarge.Error())
+	_, err = NewOCITemplateLoader(WithOCIPlainHTTP(), WithOCIMaxBundleSize(1024)).
+		LoadTemplate(context.TODO(), registry+"/addons/definitions:v1", dm, "webservice", ComponentTemplateKind)
+	assert.Contains(t, err.Error(), errBundleTooLarge.Error())
+
+	atomic.StoreInt64(&blobs, 0)
+	loader := NewOCITemplateLoader(WithOCIPlainHTTP(), WithOCICacheSize(1))
+	loader.cache("sha256:other", newFileDefinitionReader())
+	_, err = loader.LoadTemplate(context.TODO(), registry+"/addons/definitions:v1", dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Len(t, loader.bundles, 1, "the least recently used bundle should be evicted")
+	assert.Nil(t, loader.cached("sha256:other"))
+	loader.cache("sha256:other", newFileDefinitionReader())
+	_, err = loader.LoadTemplate(context.TODO(), registry+"/addons/definitions:v1", dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), blobs, "the evicted bundle should be pulled again")
+}
+
+func TestSizeLimitedReader(t *testing.T) {
+	content, err := ioutil.ReadAll(&sizeLimitedReader{r: strings.NewReader("definitions"), remaining: 11})
+	assert.NoError(t, err)
+	assert.Equal(t, "definitions", string(content))
+	_, err = ioutil.ReadAll(&sizeLimitedReader{r: strings.NewReader("definitions"), remaining: 10})
+	assert.Equal(t, errBundleTooLarge, err)
+}
+
+func TestOCITemplateLoaderBasicAuth(t *testing.T) {
+	var blobs int64
+	server, registry := newTestRegistry(t, &blobs, func(w http.ResponseWriter, r *http.Request) bool {
+		if username, password, ok := r.BasicAuth(); !ok || username != "vela" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return false
+		}
+		return true
+	})
+	defer server.Close()
+	dm := mock.NewMockDiscoveryMapper()
+	ref := registry + "/addons/definitions:v1"
+
+	_, err := NewOCITemplateLoader(WithOCIPlainHTTP()).LoadTemplate(context.TODO(), ref, dm, "webservice", ComponentTemplateKind)
+	assert.Contains(t, err.Error(), "unauthorized, the registry requires credentials")
+	_, err = NewOCITemplateLoader(WithOCIPlainHTTP(), WithOCIBasicAuth("vela", "wrong")).LoadTemplate(context.TODO(), ref, dm, "webservice", ComponentTemplateKind)
+	assert.Error(t, err)
+	tmpl, err := NewOCITemplateLoader(WithOCIPlainHTTP(), WithOCIBasicAuth("vela", "secret")).LoadTemplate(context.TODO(), ref, dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "output: kind: \"Deployment\"\n", tmpl.TemplateStr)
+}
+
+func TestOCITemplateLoaderTokenAuth(t *testing.T) {
+	var blobs, challenges int64
+	var realm string
+	server, registry := newTestRegistry(t, &blobs, func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get("Authorization") != "Bearer secret-token" {
+			atomic.AddInt64(&challenges, 1)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+realm+`",service="registry",scope="repository:addons/definitions:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return false
+		}
+		return true
+	})
+	defer server.Close()
+	realm = server.URL + "/token"
+
+	loader := NewOCITemplateLoader(WithOCIPlainHTTP())
+	tmpl, err := loader.LoadTemplate(context.TODO(), registry+"/addons/definitions:v1", mock.NewMockDiscoveryMapper(), "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "output: kind: \"Deployment\"\n", tmpl.TemplateStr)
+	assert.Equal(t, int64(1), challenges, "the token should be reused")
+}
+
+func TestParseOCIReference(t *testing.T) {
+	testCases := map[string]ociReference{
+		"registry.example.com/addons/definitions:v1": {registry: "registry.example.com", repository: "addons/definitions", reference: "v1"},
+		"localhost:5000/definitions":                 {registry: "localhost:5000", repository: "definitions", reference: "latest"},
+		"localhost:5000/definitions@sha256:abc":      {registry: "localhost:5000", repository: "definitions", reference: "sha256:abc"},
+	}
+	for ref, exp := range testCases {
+		r, err := parseOCIReference(ref)
+		assert.NoError(t, err, ref)
+		assert.Equal(t, exp, r, ref)
+	}
+	for _, ref := range []string{"definitions", "/definitions", "registry.example.com/definitions:"} {
+		_, err := parseOCIReference(ref)
+		assert.Error(t, err, ref)
+	}
+}
+
+func TestParseAuthChallenge(t *testing.T) {
+	scheme, params := parseAuthChallenge(`Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:a/b:pull,push"`)
+	assert.Equal(t, "Bearer", scheme)
+	assert.Equal(t, map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "registry.example.com",
+		"scope":   "repository:a/b:pull,push",
+	}, params)
+
+	scheme, params = parseAuthChallenge(`Basic realm=registry`)
+	assert.Equal(t, "Basic", scheme)
+	assert.Equal(t, map[string]string{"realm": "registry"}, params)
+}
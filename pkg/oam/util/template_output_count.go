@@ -0,0 +1,38 @@
+package util
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// AnnotationExpectedOutputs declares the number of auxiliary objects in the outputs of the template of a definition,
+// besides the workload in its output, e.g. "2" for a Service and an Ingress. It's checked by ValidateOutputCount.
+const AnnotationExpectedOutputs = "definition.oam.dev/expected-outputs"
+
+// expectedOutputs returns the number declared by the AnnotationExpectedOutputs, it's nil if there's no annotation
+func expectedOutputs(annotations map[string]string) (*int, error) {
+	value, ok := annotations[AnnotationExpectedOutputs]
+	if !ok {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid annotation %s", AnnotationExpectedOutputs)
+	}
+	if n < 0 {
+		return nil, errors.Errorf("invalid annotation %s: negative number %d", AnnotationExpectedOutputs, n)
+	}
+	return &n, nil
+}
+
+// ValidateOutputCount returns an error if the number of auxiliary objects rendered in the outputs of the template
+// differs from its ExpectedOutputs, so that template regressions are caught by rendering, e.g. in CI.
+// Any number is valid if ExpectedOutputs is undeclared.
+func (t *Template) ValidateOutputCount(outputs int) error {
+	if t.ExpectedOutputs == nil || *t.ExpectedOutputs == outputs {
+		return nil
+	}
+	return t.withCapabilityName(errors.Errorf("expect %d objects in outputs, got %d", *t.ExpectedOutputs, outputs))
+}
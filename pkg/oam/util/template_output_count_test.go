@@ -0,0 +1,50 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	ktypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+func TestExpectedOutputs(t *testing.T) {
+	annotations := map[string]string{
+		"webservice": "2",
+		"worker":     "",
+		"broken":     "two",
+	}
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			if o, ok := obj.(*v1alpha2.ComponentDefinition); ok {
+				o.Name = key.Name
+				if v := annotations[key.Name]; v != "" {
+					o.Annotations = map[string]string{AnnotationExpectedOutputs: v}
+				}
+				o.Spec.Workload.Definition = v1alpha2.WorkloadGVK{APIVersion: "apps/v1", Kind: "Deployment"}
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}}
+			}
+			return nil
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+
+	tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, *tmpl.ExpectedOutputs)
+	assert.NoError(t, tmpl.ValidateOutputCount(2))
+	assert.EqualError(t, tmpl.ValidateOutputCount(1), "capability webservice: expect 2 objects in outputs, got 1")
+
+	tmpl, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "worker", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Nil(t, tmpl.ExpectedOutputs)
+	assert.NoError(t, tmpl.ValidateOutputCount(3))
+
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "broken", ComponentTemplateKind)
+	assert.Contains(t, err.Error(), "invalid annotation definition.oam.dev/expected-outputs")
+}
@@ -0,0 +1,133 @@
+package util
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+)
+
+// AnnotationSchematicSelector selects the schematic of a definition declaring more than one by the labels of
+// the platform, e.g. `{"helm": "arch=arm64", "cue": "arch in (amd64)"}`. It's a JSON object of label selectors
+// by the type of the schematic, i.e. "cue", "helm" or "kustomize", see LoadForPlatform.
+const AnnotationSchematicSelector = "definition.oam.dev/schematic-selector"
+
+// schematicTypes are the types of schematics in the order of precedence
+var schematicTypes = []string{"cue", "helm", "kustomize"}
+
+// SchematicSelectors are the label selectors of the platforms by the type of schematic
+type SchematicSelectors map[string]labels.Selector
+
+// ParseSchematicSelectors parses the AnnotationSchematicSelector of a definition, it returns nil if there's none
+func ParseSchematicSelectors(annotations map[string]string) (SchematicSelectors, error) {
+	value, ok := annotations[AnnotationSchematicSelector]
+	if !ok {
+		return nil, nil
+	}
+	var raw map[string]string
+	if err := json.Unmarshal([]byte(value), &raw); err != nil {
+		return nil, errors.Wrapf(err, "invalid annotation %s", AnnotationSchematicSelector)
+	}
+	selectors := SchematicSelectors{}
+	for typ, s := range raw {
+		if !isSchematicType(typ) {
+			return nil, errors.Errorf("invalid annotation %s: unknown schematic type %q", AnnotationSchematicSelector, typ)
+		}
+		selector, err := labels.Parse(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid annotation %s: invalid selector of %s", AnnotationSchematicSelector, typ)
+		}
+		selectors[typ] = selector
+	}
+	return selectors, nil
+}
+
+// Select returns the schematic of the first type, in the order of CUE, Helm and Kustomize, whose selector matches
+// the labels of the platform. It falls back to the first type set if none matches, like AllowMultipleSchematics.
+// The returned schematic has only the selected type set.
+func (s SchematicSelectors) Select(schematic *v1alpha2.Schematic, platform labels.Labels) *v1alpha2.Schematic {
+	if schematic == nil {
+		return nil
+	}
+	if platform == nil {
+		platform = labels.Set{}
+	}
+	var fallback string
+	for _, typ := range schematicTypes {
+		if !schematicHasType(schematic, typ) {
+			continue
+		}
+		if fallback == "" {
+			fallback = typ
+		}
+		if selector, ok := s[typ]; ok && selector.Matches(platform) {
+			return schematicOfType(schematic, typ)
+		}
+	}
+	return schematicOfType(schematic, fallback)
+}
+
+// WithSchematicSelector makes NewTemplateWithOptions create the template from the schematic selected for the
+// platform by the selectors, instead of returning an error for a schematic with more than one type set
+func WithSchematicSelector(selectors SchematicSelectors, platform labels.Labels) TemplateOption {
+	return func(o *templateOptions) {
+		o.schematicSelectors = selectors
+		o.platform = platform
+	}
+}
+
+// LoadForPlatform makes LoadTemplate select the schematic of the definitions declaring more than one by the
+// labels of the platform, according to their AnnotationSchematicSelector
+func LoadForPlatform(platform map[string]string) LoadTemplateOption {
+	return func(o *loadTemplateOptions) {
+		o.platform = platform
+	}
+}
+
+// selectSchematic returns the schematic of the definition selected for the platform to load from,
+// it's the schematic of the definition if the definition doesn't declare AnnotationSchematicSelector
+func (o *loadTemplateOptions) selectSchematic(def metav1.Object, schematic *v1alpha2.Schematic) (*v1alpha2.Schematic, error) {
+	selectors, err := ParseSchematicSelectors(def.GetAnnotations())
+	if err != nil || selectors == nil {
+		return schematic, err
+	}
+	return selectors.Select(schematic, labels.Set(o.platform)), nil
+}
+
+func isSchematicType(typ string) bool {
+	for _, t := range schematicTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+func schematicHasType(schematic *v1alpha2.Schematic, typ string) bool {
+	switch typ {
+	case "cue":
+		return schematic.CUE != nil
+	case "helm":
+		return schematic.HELM != nil
+	case "kustomize":
+		return schematic.KUSTOMIZE != nil
+	}
+	return false
+}
+
+// schematicOfType returns a copy of the schematic with only the type set, the schematic is returned as is
+// if the type is empty
+func schematicOfType(schematic *v1alpha2.Schematic, typ string) *v1alpha2.Schematic {
+	switch typ {
+	case "cue":
+		return &v1alpha2.Schematic{CUE: schematic.CUE}
+	case "helm":
+		return &v1alpha2.Schematic{HELM: schematic.HELM}
+	case "kustomize":
+		return &v1alpha2.Schematic{KUSTOMIZE: schematic.KUSTOMIZE}
+	}
+	return schematic
+}
@@ -0,0 +1,91 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	ktypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/apis/types"
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+func TestSchematicSelectors(t *testing.T) {
+	helm := &v1alpha2.Helm{
+		Release:    runtime.RawExtension{Raw: []byte(`{"chart":{"spec":{"chart":"podinfo","version":"5.1.4"}}}`)},
+		Repository: runtime.RawExtension{Raw: []byte(`{"url":"http://oam.dev/catalog/"}`)},
+	}
+	schematic := &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}, HELM: helm}
+	selectors, err := ParseSchematicSelectors(map[string]string{AnnotationSchematicSelector: `{"helm": "arch=arm64", "cue": "arch in (amd64)"}`})
+	assert.NoError(t, err)
+
+	testCases := map[string]struct {
+		platform labels.Labels
+		exp      *v1alpha2.Schematic
+	}{
+		"select helm":             {platform: labels.Set{"arch": "arm64"}, exp: &v1alpha2.Schematic{HELM: helm}},
+		"select cue":              {platform: labels.Set{"arch": "amd64"}, exp: &v1alpha2.Schematic{CUE: schematic.CUE}},
+		"fallback to cue":         {platform: labels.Set{"arch": "s390x"}, exp: &v1alpha2.Schematic{CUE: schematic.CUE}},
+		"fallback without labels": {exp: &v1alpha2.Schematic{CUE: schematic.CUE}},
+	}
+	for name, tc := range testCases {
+		assert.Equal(t, tc.exp, selectors.Select(schematic, tc.platform), name)
+	}
+
+	tmpl, err := NewTemplateWithOptions(schematic, nil, nil, WithSchematicSelector(selectors, labels.Set{"arch": "arm64"}))
+	assert.NoError(t, err)
+	assert.Equal(t, types.HelmCategory, tmpl.CapabilityCategory)
+	assert.Equal(t, helm, tmpl.Helm)
+	assert.Empty(t, tmpl.TemplateStr)
+	tmpl, err = NewTemplateWithOptions(schematic, nil, nil, WithSchematicSelector(selectors, labels.Set{"arch": "s390x"}))
+	assert.NoError(t, err)
+	assert.Equal(t, "output: {}", tmpl.TemplateStr)
+	assert.Nil(t, tmpl.Helm)
+	_, err = NewTemplate(schematic, nil, nil)
+	assert.EqualError(t, err, "only one schematic can be set, but got cue, helm")
+
+	selectors, err = ParseSchematicSelectors(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, selectors)
+	_, err = ParseSchematicSelectors(map[string]string{AnnotationSchematicSelector: `{"terraform": "arch=arm64"}`})
+	assert.EqualError(t, err, `invalid annotation definition.oam.dev/schematic-selector: unknown schematic type "terraform"`)
+	_, err = ParseSchematicSelectors(map[string]string{AnnotationSchematicSelector: `{"helm": "arch in arm64"}`})
+	assert.Error(t, err)
+}
+
+func TestLoadForPlatform(t *testing.T) {
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			o := obj.(*v1alpha2.ComponentDefinition)
+			o.Name = key.Name
+			o.Annotations = map[string]string{AnnotationSchematicSelector: `{"helm": "kubernetes.io/arch=arm64"}`}
+			o.Spec.Schematic = &v1alpha2.Schematic{
+				CUE: &v1alpha2.CUE{Template: "output: {}"},
+				HELM: &v1alpha2.Helm{
+					Release:    runtime.RawExtension{Raw: []byte(`{"chart":{"spec":{"chart":"podinfo","version":"5.1.4"}}}`)},
+					Repository: runtime.RawExtension{Raw: []byte(`{"url":"http://oam.dev/catalog/"}`)},
+				},
+			}
+			return nil
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+
+	tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, "podinfo", ComponentTemplateKind, LoadForPlatform(map[string]string{"kubernetes.io/arch": "arm64"}))
+	assert.NoError(t, err)
+	assert.True(t, tmpl.IsHelm())
+	assert.Equal(t, types.HelmCategory, tmpl.CapabilityCategory)
+
+	tmpl, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "podinfo", ComponentTemplateKind, LoadForPlatform(map[string]string{"kubernetes.io/arch": "amd64"}))
+	assert.NoError(t, err)
+	assert.True(t, tmpl.IsCUE())
+
+	tmpl, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "podinfo", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.True(t, tmpl.IsCUE(), "definitions declaring selectors fall back to the precedence of schematics")
+}
@@ -0,0 +1,103 @@
+package util
+
+import (
+	"time"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/build"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ReadinessTimeoutFieldName is the field of the health policy declaring how long the controller waits for the
+	// capability to become healthy, e.g. `readinessTimeout: "10m"`
+	ReadinessTimeoutFieldName = "readinessTimeout"
+	// RetryPolicyFieldName is the field of the health policy declaring how the controller retries the health check,
+	// e.g. `retryPolicy: {maxRetries: 5, backoff: "30s"}`
+	RetryPolicyFieldName = "retryPolicy"
+)
+
+// the readiness behavior of capabilities which don't declare their own
+const (
+	DefaultReadinessTimeout = 5 * time.Minute
+	DefaultMaxRetries       = 3
+	DefaultRetryBackoff     = 10 * time.Second
+)
+
+// ReadinessPolicy is how the controller waits for a capability to become healthy
+type ReadinessPolicy struct {
+	// Timeout is how long to wait before the capability is declared unhealthy
+	Timeout time.Duration
+	Retry   RetryPolicy
+}
+
+// RetryPolicy is how the health check of a capability is retried
+type RetryPolicy struct {
+	MaxRetries int
+	Backoff    time.Duration
+}
+
+// DefaultReadinessPolicy returns the readiness policy of capabilities which don't declare their own
+func DefaultReadinessPolicy() ReadinessPolicy {
+	return ReadinessPolicy{
+		Timeout: DefaultReadinessTimeout,
+		Retry:   RetryPolicy{MaxRetries: DefaultMaxRetries, Backoff: DefaultRetryBackoff},
+	}
+}
+
+// ReadinessPolicy returns the readiness policy declared by the `readinessTimeout` and `retryPolicy` fields of the
+// health policy of the template, so that the controller waits longer for slow-starting capabilities, e.g. databases.
+// Missing values fall back to the ones of DefaultReadinessPolicy.
+func (t *Template) ReadinessPolicy() (ReadinessPolicy, error) {
+	policy := DefaultReadinessPolicy()
+	if t.Health == "" {
+		return policy, nil
+	}
+	bi := build.NewContext().NewInstance("", nil)
+	if err := bi.AddFile("-", t.Health); err != nil {
+		return policy, t.withCapabilityName(errors.WithMessage(err, "parse health policy"))
+	}
+	if err := bi.AddFile("context", "context: _\n"); err != nil {
+		return policy, err
+	}
+	var r cue.Runtime
+	inst, err := r.Build(bi)
+	if err != nil {
+		return policy, t.withCapabilityName(errors.WithMessage(err, "compile health policy"))
+	}
+	if err := lookupDuration(inst.Lookup(ReadinessTimeoutFieldName), &policy.Timeout); err != nil {
+		return policy, t.withCapabilityName(errors.WithMessagef(err, "invalid %s", ReadinessTimeoutFieldName))
+	}
+	retry := inst.Lookup(RetryPolicyFieldName)
+	if v := retry.Lookup("maxRetries"); v.Exists() {
+		n, err := v.Int64()
+		if err != nil || n < 0 {
+			return policy, t.withCapabilityName(errors.Errorf("invalid %s.maxRetries, expect a non-negative integer", RetryPolicyFieldName))
+		}
+		policy.Retry.MaxRetries = int(n)
+	}
+	if err := lookupDuration(retry.Lookup("backoff"), &policy.Retry.Backoff); err != nil {
+		return policy, t.withCapabilityName(errors.WithMessagef(err, "invalid %s.backoff", RetryPolicyFieldName))
+	}
+	return policy, nil
+}
+
+// lookupDuration parses the duration of the value into d, e.g. "30s", d is kept if the value doesn't exist
+func lookupDuration(v cue.Value, d *time.Duration) error {
+	if !v.Exists() {
+		return nil
+	}
+	s, err := v.String()
+	if err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	if parsed <= 0 {
+		return errors.Errorf("duration %s must be positive", s)
+	}
+	*d = parsed
+	return nil
+}
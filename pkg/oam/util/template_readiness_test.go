@@ -0,0 +1,55 @@
+package util
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	ktypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+func TestReadinessPolicy(t *testing.T) {
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			if o, ok := obj.(*v1alpha2.ComponentDefinition); ok {
+				o.Name = key.Name
+				o.Spec.Workload.Definition = v1alpha2.WorkloadGVK{APIVersion: "apps/v1", Kind: "StatefulSet"}
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}}
+				o.Spec.Status = &v1alpha2.Status{HealthPolicy: `
+isHealth: context.output.status.readyReplicas == context.output.status.replicas
+readinessTimeout: "20m"
+retryPolicy: backoff: "1m"
+`}
+			}
+			return nil
+		},
+	}
+	tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, mock.NewMockDiscoveryMapper(), "mysql", ComponentTemplateKind)
+	assert.NoError(t, err)
+	policy, err := tmpl.ReadinessPolicy()
+	assert.NoError(t, err)
+	assert.Equal(t, ReadinessPolicy{
+		Timeout: 20 * time.Minute,
+		Retry:   RetryPolicy{MaxRetries: DefaultMaxRetries, Backoff: time.Minute},
+	}, policy)
+
+	policy, err = (&Template{Name: "worker", Health: "isHealth: true"}).ReadinessPolicy()
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultReadinessPolicy(), policy)
+
+	policy, err = (&Template{Name: "worker"}).ReadinessPolicy()
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultReadinessPolicy(), policy)
+
+	_, err = (&Template{Name: "worker", Health: `readinessTimeout: "soon"`}).ReadinessPolicy()
+	assert.Contains(t, err.Error(), "capability worker: invalid readinessTimeout")
+
+	_, err = (&Template{Name: "worker", Health: `retryPolicy: maxRetries: -1`}).ReadinessPolicy()
+	assert.EqualError(t, err, "capability worker: invalid retryPolicy.maxRetries, expect a non-negative integer")
+}
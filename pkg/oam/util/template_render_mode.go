@@ -0,0 +1,45 @@
+package util
+
+import (
+	"github.com/pkg/errors"
+)
+
+// PatchFieldName is the field of a trait template which patches the workload
+const PatchFieldName = "patch"
+
+// RenderMode is how a trait is rendered, by patching the workload, by rendering objects, or both
+type RenderMode string
+
+const (
+	// RenderModePatch means the trait only patches the workload by its `patch`
+	RenderModePatch RenderMode = "Patch"
+	// RenderModeOutput means the trait only renders objects by its `output` or `outputs`
+	RenderModeOutput RenderMode = "Output"
+	// RenderModeBoth means the trait patches the workload and renders objects
+	RenderModeBoth RenderMode = "Both"
+)
+
+// TraitRenderMode returns how the trait template is rendered by inspecting the `patch`, `output` and `outputs`
+// of the CUE template, so that controllers can route the patch to the workload and apply the objects.
+// Templates other than CUE always render objects. It returns an error if the CUE template has none of them.
+func (t *Template) TraitRenderMode() (RenderMode, error) {
+	if !t.IsCUE() {
+		return RenderModeOutput, nil
+	}
+	inst, err := buildCUETemplate(nil, t.TemplateStr, t.Imports)
+	if err != nil {
+		return "", t.withCapabilityName(errors.WithMessage(err, "compile template"))
+	}
+	patches := inst.Lookup(PatchFieldName).Exists()
+	outputs := inst.Lookup(outputFieldName).Exists() || inst.Lookup(outputsFieldName).Exists()
+	switch {
+	case patches && outputs:
+		return RenderModeBoth, nil
+	case patches:
+		return RenderModePatch, nil
+	case outputs:
+		return RenderModeOutput, nil
+	}
+	return "", t.withCapabilityName(errors.Errorf("template has none of %s, %s and %s",
+		PatchFieldName, outputFieldName, outputsFieldName))
+}
@@ -0,0 +1,57 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/apis/types"
+)
+
+func TestTraitRenderMode(t *testing.T) {
+	testCases := map[string]struct {
+		tmpl *Template
+		exp  RenderMode
+		err  string
+	}{
+		"patch only": {
+			tmpl: &Template{Name: "scaler", TemplateStr: `
+patch: spec: replicas: parameter.replicas
+parameter: replicas: *1 | int`},
+			exp: RenderModePatch,
+		},
+		"outputs only": {
+			tmpl: &Template{Name: "ingress", TemplateStr: `
+outputs: service: {
+	kind: "Service"
+	metadata: name: context.name
+}
+parameter: domain: string`},
+			exp: RenderModeOutput,
+		},
+		"both": {
+			tmpl: &Template{Name: "sidecar", TemplateStr: `
+patch: metadata: annotations: "sidecar.oam.dev/inject": "true"
+output: kind: "ConfigMap"`},
+			exp: RenderModeBoth,
+		},
+		"helm": {
+			tmpl: &Template{Name: "monitor", CapabilityCategory: types.HelmCategory, Helm: &v1alpha2.Helm{}},
+			exp:  RenderModeOutput,
+		},
+		"neither": {
+			tmpl: &Template{Name: "empty", TemplateStr: `parameter: {}`},
+			err:  "capability empty: template has none of patch, output and outputs",
+		},
+	}
+	for name, tc := range testCases {
+		mode, err := tc.tmpl.TraitRenderMode()
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err, name)
+			continue
+		}
+		assert.NoError(t, err, name)
+		assert.Equal(t, tc.exp, mode, name)
+	}
+}
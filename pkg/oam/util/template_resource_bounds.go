@@ -0,0 +1,159 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// AnnotationResourceBounds declares the bounds of the resources of the components of a definition, e.g.
+	// `{"cpu": {"recommended": "500m", "max": "2"}, "memory": {"max": "4Gi"}}`, it overrides the `limits` block
+	// of the CUE template
+	AnnotationResourceBounds = "definition.oam.dev/limits"
+	// ResourceBoundsFieldName is the field of a CUE template which declares the resource bounds,
+	// e.g. `limits: cpu: max: "2"`
+	ResourceBoundsFieldName = "limits"
+)
+
+// ResourceBound is the bound of a resource, nil quantities are unbounded
+type ResourceBound struct {
+	Recommended *resource.Quantity `json:"recommended,omitempty"`
+	Max         *resource.Quantity `json:"max,omitempty"`
+}
+
+// ResourceBounds are the bounds of the CPU and memory of the components of a definition
+type ResourceBounds struct {
+	CPU    ResourceBound `json:"cpu"`
+	Memory ResourceBound `json:"memory"`
+}
+
+// Validate returns an error listing the requested quantities exceeding the maximums, e.g. the cpu and memory
+// parameters of a component. Resources other than CPU and memory are unbounded.
+func (b ResourceBounds) Validate(requested map[corev1.ResourceName]string) error {
+	names := make([]string, 0, len(requested))
+	for name := range requested {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	var exceeded []string
+	for _, name := range names {
+		bound := b.boundOf(corev1.ResourceName(name))
+		if bound == nil || bound.Max == nil {
+			continue
+		}
+		q, err := resource.ParseQuantity(requested[corev1.ResourceName(name)])
+		if err != nil {
+			return errors.Wrapf(err, "invalid quantity of %s", name)
+		}
+		if q.Cmp(*bound.Max) > 0 {
+			exceeded = append(exceeded, fmt.Sprintf("%s %s exceeds the maximum %s", name, q.String(), bound.Max.String()))
+		}
+	}
+	if len(exceeded) > 0 {
+		return errors.New(strings.Join(exceeded, ", "))
+	}
+	return nil
+}
+
+func (b *ResourceBounds) boundOf(name corev1.ResourceName) *ResourceBound {
+	switch name {
+	case corev1.ResourceCPU:
+		return &b.CPU
+	case corev1.ResourceMemory:
+		return &b.Memory
+	}
+	return nil
+}
+
+// override sets the quantities of the bounds declared by o
+func (b *ResourceBounds) override(o *ResourceBounds) {
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		bound, overridden := b.boundOf(name), o.boundOf(name)
+		if overridden.Recommended != nil {
+			bound.Recommended = overridden.Recommended
+		}
+		if overridden.Max != nil {
+			bound.Max = overridden.Max
+		}
+	}
+}
+
+// ResourceBounds returns the resource bounds of the template, declared by the `limits` block of the CUE template
+// and the AnnotationResourceBounds of the definition, which takes precedence. Missing bounds are unbounded.
+func (t *Template) ResourceBounds() (ResourceBounds, error) {
+	var bounds ResourceBounds
+	if t.IsCUE() {
+		inst, err := buildCUETemplate(nil, t.TemplateStr, t.Imports)
+		if err != nil {
+			return bounds, t.withCapabilityName(errors.WithMessage(err, "compile template"))
+		}
+		if v := inst.Lookup(ResourceBoundsFieldName); v.Exists() {
+			var raw map[string]map[string]interface{}
+			if err := v.Decode(&raw); err != nil {
+				return bounds, t.withCapabilityName(errors.WithMessagef(err, "decode %s", ResourceBoundsFieldName))
+			}
+			declared, err := parseResourceBounds(raw)
+			if err != nil {
+				return bounds, t.withCapabilityName(errors.WithMessagef(err, "invalid %s", ResourceBoundsFieldName))
+			}
+			bounds = *declared
+		}
+	}
+	if t.Limits != nil {
+		bounds.override(t.Limits)
+	}
+	return bounds, nil
+}
+
+// resourceBoundsOf returns the resource bounds declared by the AnnotationResourceBounds,
+// it's nil if there's no annotation
+func resourceBoundsOf(annotations map[string]string) (*ResourceBounds, error) {
+	value, ok := annotations[AnnotationResourceBounds]
+	if !ok {
+		return nil, nil
+	}
+	var raw map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &raw); err != nil {
+		return nil, errors.Wrapf(err, "invalid annotation %s", AnnotationResourceBounds)
+	}
+	bounds, err := parseResourceBounds(raw)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "invalid annotation %s", AnnotationResourceBounds)
+	}
+	return bounds, nil
+}
+
+// parseResourceBounds parses the quantities of the bounds by the names of the resources and bounds,
+// quantities may be numbers like `cpu: max: 2`
+func parseResourceBounds(raw map[string]map[string]interface{}) (*ResourceBounds, error) {
+	bounds := &ResourceBounds{}
+	for name, values := range raw {
+		bound := bounds.boundOf(corev1.ResourceName(name))
+		if bound == nil {
+			return nil, errors.Errorf("unknown resource %q, expect cpu or memory", name)
+		}
+		for key, value := range values {
+			var target **resource.Quantity
+			switch key {
+			case "recommended":
+				target = &bound.Recommended
+			case "max":
+				target = &bound.Max
+			default:
+				return nil, errors.Errorf("unknown bound %q of %s, expect recommended or max", key, name)
+			}
+			q, err := resource.ParseQuantity(strings.TrimSpace(fmt.Sprint(value)))
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid %s bound of %s", key, name)
+			}
+			*target = &q
+		}
+	}
+	return bounds, nil
+}
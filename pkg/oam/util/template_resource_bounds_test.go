@@ -0,0 +1,67 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	ktypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+func quantity(s string) *resource.Quantity {
+	q := resource.MustParse(s)
+	return &q
+}
+
+func TestResourceBounds(t *testing.T) {
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			if o, ok := obj.(*v1alpha2.ComponentDefinition); ok {
+				o.Name = key.Name
+				o.Annotations = map[string]string{AnnotationResourceBounds: `{"cpu": {"max": "2"}, "memory": {"recommended": "512Mi", "max": "4Gi"}}`}
+				o.Spec.Workload.Definition = v1alpha2.WorkloadGVK{APIVersion: "apps/v1", Kind: "Deployment"}
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: `
+output: kind: "Deployment"
+limits: cpu: {
+	recommended: "500m"
+	max:         1
+}
+`}}
+			}
+			return nil
+		},
+	}
+	tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, mock.NewMockDiscoveryMapper(), "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	bounds, err := tmpl.ResourceBounds()
+	assert.NoError(t, err)
+	// the annotation overrides the maximum CPU of the template
+	assert.Equal(t, ResourceBounds{
+		CPU:    ResourceBound{Recommended: quantity("500m"), Max: quantity("2")},
+		Memory: ResourceBound{Recommended: quantity("512Mi"), Max: quantity("4Gi")},
+	}, bounds)
+
+	assert.NoError(t, bounds.Validate(map[corev1.ResourceName]string{corev1.ResourceCPU: "1500m", corev1.ResourceMemory: "4Gi"}))
+	assert.EqualError(t, bounds.Validate(map[corev1.ResourceName]string{corev1.ResourceCPU: "4", corev1.ResourceMemory: "8Gi"}),
+		"cpu 4 exceeds the maximum 2, memory 8Gi exceeds the maximum 4Gi")
+	assert.Error(t, bounds.Validate(map[corev1.ResourceName]string{corev1.ResourceCPU: "two"}))
+
+	// missing bounds are unbounded
+	bounds, err = (&Template{Name: "worker", TemplateStr: `output: kind: "Deployment"`}).ResourceBounds()
+	assert.NoError(t, err)
+	assert.Equal(t, ResourceBounds{}, bounds)
+	assert.NoError(t, bounds.Validate(map[corev1.ResourceName]string{corev1.ResourceCPU: "64"}))
+
+	_, err = (&Template{Name: "worker", TemplateStr: `limits: gpu: max: 1`}).ResourceBounds()
+	assert.EqualError(t, err, `capability worker: invalid limits: unknown resource "gpu", expect cpu or memory`)
+
+	_, err = resourceBoundsOf(map[string]string{AnnotationResourceBounds: `{"cpu": {"min": "1"}}`})
+	assert.EqualError(t, err, `invalid annotation definition.oam.dev/limits: unknown bound "min" of cpu, expect recommended or max`)
+}
@@ -0,0 +1,118 @@
+package util
+
+import (
+	"sort"
+
+	"cuelang.org/go/cue"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/oam-dev/kubevela/pkg/oam/discoverymapper"
+)
+
+const (
+	// outputFieldName is the field of a template which renders the workload, or the main resource of a trait
+	outputFieldName = "output"
+	// outputsFieldName is the field of a template which renders the auxiliary resources by name
+	outputsFieldName = "outputs"
+)
+
+// ErrResourceScopeUnknown is returned by ProducesClusterScopedResources if the resources of the template can't be
+// known without rendering it, e.g. the resources of a Helm chart, or a CUE output whose kind depends on the parameter
+var ErrResourceScopeUnknown = errors.New("cannot know the scope of the resources produced by the template")
+
+// IsResourceScopeUnknown returns true if the cause of err is ErrResourceScopeUnknown
+func IsResourceScopeUnknown(err error) bool {
+	return errors.Cause(err) == ErrResourceScopeUnknown
+}
+
+// ProducesClusterScopedResources returns true if any resource produced by the template is cluster-scoped, which has
+// RBAC and multi-tenancy implications. The resources are the workload referenced by the definition, and the output
+// and outputs of a CUE template, the scopes of their kinds are resolved by the discovery mapper.
+// The patch of a trait doesn't produce resources. The outputs which are only rendered on some parameter values
+// are not checked. It returns an error whose cause is ErrResourceScopeUnknown for Helm, Kustomize and Terraform
+// templates, and CUE templates whose resources have apiVersion or kind depending on the parameter.
+func (t *Template) ProducesClusterScopedResources(dm discoverymapper.DiscoveryMapper) (bool, error) {
+	if dm == nil {
+		return false, t.withCapabilityName(errors.WithMessage(ErrNilDiscoveryMapper, "resolve resource scope"))
+	}
+	if t.IsHelm() || t.IsKustomize() || t.IsTerraform() {
+		return false, t.withCapabilityName(errors.WithMessagef(ErrResourceScopeUnknown, "%s template", t.CapabilityCategory))
+	}
+	var gvks []schema.GroupVersionKind
+	if t.Reference.Kind != "" {
+		gv, err := schema.ParseGroupVersion(t.Reference.APIVersion)
+		if err != nil {
+			return false, t.withCapabilityName(errors.Wrap(err, "invalid apiVersion of workload"))
+		}
+		gvks = append(gvks, gv.WithKind(t.Reference.Kind))
+	}
+	if t.IsCUE() {
+		outputGVKs, err := t.outputGVKs()
+		if err != nil {
+			return false, t.withCapabilityName(err)
+		}
+		gvks = append(gvks, outputGVKs...)
+	}
+	for _, gvk := range gvks {
+		mapping, err := dm.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return false, t.withCapabilityName(errors.WithMessagef(err, "resolve scope of %s", gvk.String()))
+		}
+		if mapping.Scope != nil && mapping.Scope.Name() == meta.RESTScopeNameRoot {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// outputGVKs returns the GVKs of the output and outputs of the CUE template compiled without parameter
+func (t *Template) outputGVKs() ([]schema.GroupVersionKind, error) {
+	inst, err := buildCUETemplate(nil, t.TemplateStr, t.Imports)
+	if err != nil {
+		return nil, errors.WithMessage(err, "compile template")
+	}
+	var gvks []schema.GroupVersionKind
+	if output := inst.Lookup(outputFieldName); output.Exists() {
+		gvk, err := resourceGVK(outputFieldName, output)
+		if err != nil {
+			return nil, err
+		}
+		gvks = append(gvks, gvk)
+	}
+	outputs := inst.Lookup(outputsFieldName)
+	if !outputs.Exists() {
+		return gvks, nil
+	}
+	var names []string
+	if err := iterateFields(outputs, func(name string, _ cue.Value) { names = append(names, name) }); err != nil {
+		return nil, errors.WithMessage(err, "iterate outputs")
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		gvk, err := resourceGVK(outputsFieldName+"."+name, outputs.Lookup(name))
+		if err != nil {
+			return nil, err
+		}
+		gvks = append(gvks, gvk)
+	}
+	return gvks, nil
+}
+
+// resourceGVK returns the GVK of the resource rendered by the value, its apiVersion and kind must be concrete strings
+func resourceGVK(name string, v cue.Value) (schema.GroupVersionKind, error) {
+	apiVersion, err := v.Lookup("apiVersion").String()
+	if err != nil {
+		return schema.GroupVersionKind{}, errors.WithMessagef(ErrResourceScopeUnknown, "apiVersion of %s is not concrete", name)
+	}
+	kind, err := v.Lookup("kind").String()
+	if err != nil {
+		return schema.GroupVersionKind{}, errors.WithMessagef(ErrResourceScopeUnknown, "kind of %s is not concrete", name)
+	}
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return schema.GroupVersionKind{}, errors.Wrapf(err, "invalid apiVersion of %s", name)
+	}
+	return gv.WithKind(kind), nil
+}
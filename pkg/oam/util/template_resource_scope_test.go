@@ -0,0 +1,100 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/apis/types"
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+func TestProducesClusterScopedResources(t *testing.T) {
+	dm := mock.NewMockDiscoveryMapper()
+	dm.MockRESTMapping = func(gk schema.GroupKind, versions ...string) (*meta.RESTMapping, error) {
+		scope := meta.RESTScopeNamespace
+		if gk.Kind == "ClusterRole" || gk.Kind == "Namespace" {
+			scope = meta.RESTScopeRoot
+		}
+		return &meta.RESTMapping{GroupVersionKind: gk.WithVersion(versions[0]), Scope: scope}, nil
+	}
+
+	testCases := map[string]struct {
+		tmpl      *Template
+		exp       bool
+		isUnknown bool
+	}{
+		"namespaced workload": {
+			tmpl: &Template{Name: "webservice", TemplateStr: `
+output: {
+	apiVersion: "apps/v1"
+	kind:       "Deployment"
+	spec: replicas: parameter.replicas
+}
+outputs: service: {
+	apiVersion: "v1"
+	kind:       "Service"
+}
+parameter: replicas: *1 | int
+`},
+			exp: false,
+		},
+		"cluster-scoped output": {
+			tmpl: &Template{Name: "tenant", TemplateStr: `
+output: {
+	apiVersion: "apps/v1"
+	kind:       "Deployment"
+}
+outputs: namespace: {
+	apiVersion: "v1"
+	kind:       "Namespace"
+	metadata: name: context.appName
+}
+`},
+			exp: true,
+		},
+		"cluster-scoped workload reference": {
+			tmpl: &Template{Name: "role", Reference: v1alpha2.WorkloadGVK{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole"}},
+			exp:  true,
+		},
+		"patch trait": {
+			tmpl: &Template{Name: "scaler", TemplateStr: `patch: spec: replicas: 3`},
+			exp:  false,
+		},
+		"kind depends on parameter": {
+			tmpl: &Template{Name: "raw", TemplateStr: `
+output: {
+	apiVersion: "v1"
+	kind:       parameter.kind
+}
+parameter: kind: string
+`},
+			isUnknown: true,
+		},
+		"helm": {
+			tmpl:      &Template{Name: "podinfo", Helm: &v1alpha2.Helm{}, CapabilityCategory: types.HelmCategory},
+			isUnknown: true,
+		},
+		"terraform": {
+			tmpl:      &Template{Name: "rds", TemplateStr: "output: {}", Terraform: &TerraformConfiguration{}, CapabilityCategory: types.TerraformCategory},
+			isUnknown: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			clusterScoped, err := tc.tmpl.ProducesClusterScopedResources(dm)
+			if tc.isUnknown {
+				assert.True(t, IsResourceScopeUnknown(err), err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.exp, clusterScoped)
+		})
+	}
+
+	_, err := (&Template{TemplateStr: "output: {}"}).ProducesClusterScopedResources(nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,49 @@
+package util
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/oam-dev/kubevela/pkg/oam"
+)
+
+// RedactedValue replaces the sensitive values of the objects sanitized by SanitizeRendered
+const RedactedValue = "<redacted>"
+
+// sensitiveAnnotations are the annotations of Secrets which copy their data, e.g. for three-way merging
+var sensitiveAnnotations = []string{
+	"kubectl.kubernetes.io/last-applied-configuration",
+	oam.AnnotationLastAppliedConfig,
+}
+
+// SanitizeRendered returns copies of the rendered objects which are safe to log, e.g. the objects of definition.RenderStream.
+// The values of the data and stringData of Secrets and their sensitiveAnnotations are replaced by RedactedValue,
+// while the keys are kept so that the structure is preserved. Other objects are copied as is.
+func SanitizeRendered(objs []*unstructured.Unstructured) []*unstructured.Unstructured {
+	sanitized := make([]*unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		if obj == nil {
+			sanitized = append(sanitized, nil)
+			continue
+		}
+		obj = obj.DeepCopy()
+		if obj.GetKind() == "Secret" && obj.GroupVersionKind().Group == "" {
+			for _, field := range []string{"data", "stringData"} {
+				if values, ok := obj.Object[field].(map[string]interface{}); ok {
+					for k := range values {
+						values[k] = RedactedValue
+					}
+				}
+			}
+			if annotations := obj.GetAnnotations(); annotations != nil {
+				for _, k := range sensitiveAnnotations {
+					if _, ok := annotations[k]; ok {
+						annotations[k] = RedactedValue
+					}
+				}
+				obj.SetAnnotations(annotations)
+			}
+		}
+		sanitized = append(sanitized, obj)
+	}
+	return sanitized
+}
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/oam-dev/kubevela/pkg/oam"
+)
+
+func TestSanitizeRendered(t *testing.T) {
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name": "db-credentials",
+			"annotations": map[string]interface{}{
+				oam.AnnotationLastAppliedConfig: `{"data":{"password":"c2VjcmV0"}}`,
+				"app.oam.dev/owner":             "frontend",
+			},
+		},
+		"type":       "Opaque",
+		"data":       map[string]interface{}{"password": "c2VjcmV0"},
+		"stringData": map[string]interface{}{"username": "admin"},
+	}}
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "config"},
+		"data":       map[string]interface{}{"level": "debug"},
+	}}
+
+	sanitized := SanitizeRendered([]*unstructured.Unstructured{secret, configMap, nil})
+	assert.Len(t, sanitized, 3)
+	assert.Equal(t, map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name": "db-credentials",
+			"annotations": map[string]interface{}{
+				oam.AnnotationLastAppliedConfig: RedactedValue,
+				"app.oam.dev/owner":             "frontend",
+			},
+		},
+		"type":       "Opaque",
+		"data":       map[string]interface{}{"password": RedactedValue},
+		"stringData": map[string]interface{}{"username": RedactedValue},
+	}, sanitized[0].Object)
+	assert.Equal(t, configMap, sanitized[1])
+	assert.Nil(t, sanitized[2])
+
+	// the rendered objects are untouched
+	assert.Equal(t, "c2VjcmV0", secret.Object["data"].(map[string]interface{})["password"])
+	assert.Equal(t, `{"data":{"password":"c2VjcmV0"}}`, secret.GetAnnotations()[oam.AnnotationLastAppliedConfig])
+}
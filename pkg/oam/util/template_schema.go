@@ -0,0 +1,195 @@
+package util
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"github.com/getkin/kin-openapi/openapi3"
+
+	mycue "github.com/oam-dev/kubevela/pkg/cue"
+	"github.com/oam-dev/kubevela/pkg/utils/common"
+)
+
+const (
+	// UsageTag is usage comment annotation
+	UsageTag = "+usage="
+	// ShortTag is the short alias annotation
+	ShortTag = "+short"
+)
+
+// InputSchema returns the OpenAPI v3 schema of the inputs of the template, so that all kinds of components can be
+// rendered as a form by one code path. The schema is generated from the `parameter` of a CUE template, inferred
+// from the chart values of a Helm template, or built from the variables of a Terraform template. It's an empty
+// object schema if the template has no inputs, e.g. a Kustomize template.
+func (t *Template) InputSchema() ([]byte, error) {
+	var schema *openapi3.Schema
+	switch {
+	case t.IsTerraform():
+		schema = terraformInputSchema(t.Terraform)
+	case t.IsHelm():
+		schema = helmInputSchema(t.HelmValues)
+	case t.IsCUE() && t.HasParameters():
+		return GenerateParameterSchema(t.Name, t.TemplateStr)
+	default:
+		schema = openapi3.NewObjectSchema()
+	}
+	return schema.MarshalJSON()
+}
+
+// GenerateParameterSchema generates the OpenAPI v3 schema of the `parameter` section of a CUE template, it's the
+// generator of InputSchema for CUE templates and fails if the template has no `parameter` section
+func GenerateParameterSchema(name, templateStr string) ([]byte, error) {
+	openAPISchema, err := generateOpenAPISchemaFromParameter(name, templateStr)
+	if err != nil {
+		return nil, err
+	}
+	swagger, err := openapi3.NewSwaggerLoader().LoadSwaggerFromData(openAPISchema)
+	if err != nil {
+		return nil, err
+	}
+	schemaRef := swagger.Components.Schemas["parameter"]
+	if schemaRef == nil {
+		return nil, fmt.Errorf(ErrGenerateOpenAPIV2JSONSchemaForCapability, name, nil)
+	}
+	schema := schemaRef.Value
+	FixOpenAPISchema("", schema)
+	return schema.MarshalJSON()
+}
+
+// generateOpenAPISchemaFromParameter returns the OpenAPI document generated from the parameter of a CUE template
+func generateOpenAPISchemaFromParameter(name, templateStr string) ([]byte, error) {
+	template, err := prepareParameterCue(name, templateStr)
+	if err != nil {
+		return nil, err
+	}
+
+	// append context section in CUE string
+	template += mycue.BaseTemplate
+
+	var r cue.Runtime
+	cueInst, err := r.Compile("-", template)
+	if err != nil {
+		return nil, err
+	}
+	return common.GenOpenAPI(cueInst)
+}
+
+// prepareParameterCue cuts `parameter` section form definition .cue file
+func prepareParameterCue(capabilityName, capabilityTemplate string) (string, error) {
+	var template string
+	var withParameterFlag bool
+	r := regexp.MustCompile("[[:space:]]*parameter:[[:space:]]*{.*")
+
+	for _, text := range strings.Split(capabilityTemplate, "\n") {
+		if r.MatchString(text) {
+			// a variable has to be refined as a definition which starts with "#"
+			text = fmt.Sprintf("parameter: #parameter\n#%s", text)
+			withParameterFlag = true
+		}
+		template += fmt.Sprintf("%s\n", text)
+	}
+
+	if !withParameterFlag {
+		return "", fmt.Errorf("capability %s doesn't contain section `parmeter`", capabilityName)
+	}
+	return template, nil
+}
+
+// FixOpenAPISchema fixes tainted `description` filed, missing of title `field`.
+func FixOpenAPISchema(name string, schema *openapi3.Schema) {
+	t := schema.Type
+	switch t {
+	case "object":
+		for k, v := range schema.Properties {
+			s := v.Value
+			FixOpenAPISchema(k, s)
+		}
+	case "array":
+		FixOpenAPISchema("", schema.Items.Value)
+	}
+	if name != "" {
+		schema.Title = name
+	}
+
+	description := schema.Description
+	if strings.Contains(description, UsageTag) {
+		description = strings.Split(description, UsageTag)[1]
+	}
+	if strings.Contains(description, ShortTag) {
+		description = strings.Split(description, ShortTag)[0]
+		description = strings.TrimSpace(description)
+	}
+	schema.Description = description
+}
+
+// helmInputSchema infers the schema of the chart values from the values set in the HelmRelease,
+// which become the defaults of the properties
+func helmInputSchema(values map[string]interface{}) *openapi3.Schema {
+	schema := openapi3.NewObjectSchema()
+	for name, v := range values {
+		s := inferValueSchema(v)
+		s.Title = name
+		schema.WithProperty(name, s)
+	}
+	return schema
+}
+
+// inferValueSchema infers the schema of a value decoded from JSON, the value is the default of the schema
+func inferValueSchema(v interface{}) *openapi3.Schema {
+	var schema *openapi3.Schema
+	switch value := v.(type) {
+	case map[string]interface{}:
+		return helmInputSchema(value).WithDefault(value)
+	case []interface{}:
+		schema = openapi3.NewArraySchema()
+		if len(value) > 0 {
+			schema.WithItems(inferValueSchema(value[0]).WithDefault(nil))
+		}
+	case string:
+		schema = openapi3.NewStringSchema()
+	case bool:
+		schema = openapi3.NewBoolSchema()
+	case nil:
+		return openapi3.NewSchema()
+	default:
+		kind := reflect.ValueOf(v).Kind()
+		switch {
+		case kind == reflect.Float32 || kind == reflect.Float64:
+			schema = openapi3.NewFloat64Schema()
+			if f := reflect.ValueOf(v).Float(); f == float64(int64(f)) {
+				schema = openapi3.NewIntegerSchema()
+			}
+		case kind >= reflect.Int && kind <= reflect.Uint64:
+			schema = openapi3.NewIntegerSchema()
+		default:
+			schema = openapi3.NewSchema()
+		}
+	}
+	return schema.WithDefault(v)
+}
+
+// terraformInputSchema builds the schema of the variables of a Terraform configuration, variables without
+// a default value are required. The variables are untyped because the configuration doesn't declare their types.
+func terraformInputSchema(conf *TerraformConfiguration) *openapi3.Schema {
+	schema := openapi3.NewObjectSchema()
+	if conf == nil {
+		return schema
+	}
+	var required []string
+	for _, variable := range conf.Variables {
+		s := openapi3.NewSchema()
+		s.Title = variable.Name
+		s.Description = variable.Description
+		schema.WithProperty(variable.Name, s)
+		if variable.Required {
+			required = append(required, variable.Name)
+		}
+	}
+	sort.Strings(required)
+	schema.Required = required
+	return schema
+}
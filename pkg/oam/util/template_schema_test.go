@@ -0,0 +1,194 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/apis/types"
+)
+
+const schemaTestDir = "testdata/schema"
+
+func TestCUEInputSchema(t *testing.T) {
+	tmpl := &Template{Name: "worker", TemplateStr: `
+output: spec: replicas: parameter.replicas
+parameter: {
+	// +usage=Number of replicas
+	replicas: *1 | int
+	image:    string
+}
+`}
+	schema, err := tmpl.InputSchema()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"required": ["replicas", "image"],
+		"properties": {
+			"image": {"type": "string", "title": "image"},
+			"replicas": {"type": "integer", "title": "replicas", "default": 1, "description": "Number of replicas"}
+		}
+	}`, string(schema))
+
+	tmpl = &Template{Name: "annotations", TemplateStr: `patch: metadata: annotations: "oam.dev/managed": "true"`}
+	schema, err = tmpl.InputSchema()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"type":"object"}`, string(schema))
+
+	_, err = GenerateParameterSchema("invalid", `output: kind: "Deployment"`)
+	assert.EqualError(t, err, "capability invalid doesn't contain section `parmeter`")
+}
+
+func TestHelmInputSchema(t *testing.T) {
+	var values map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"image": {"repository": "nginx", "tag": "1.19"},
+		"replicaCount": 2,
+		"ratio": 0.5,
+		"ingress": {"enabled": false, "hosts": ["example.com"]},
+		"podAnnotations": null
+	}`), &values))
+	tmpl := &Template{Helm: &v1alpha2.Helm{}, HelmValues: values, CapabilityCategory: types.HelmCategory}
+	schema, err := tmpl.InputSchema()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"image": {
+				"type": "object",
+				"title": "image",
+				"default": {"repository": "nginx", "tag": "1.19"},
+				"properties": {
+					"repository": {"type": "string", "title": "repository", "default": "nginx"},
+					"tag": {"type": "string", "title": "tag", "default": "1.19"}
+				}
+			},
+			"replicaCount": {"type": "integer", "title": "replicaCount", "default": 2},
+			"ratio": {"type": "number", "title": "ratio", "default": 0.5},
+			"ingress": {
+				"type": "object",
+				"title": "ingress",
+				"default": {"enabled": false, "hosts": ["example.com"]},
+				"properties": {
+					"enabled": {"type": "boolean", "title": "enabled", "default": false},
+					"hosts": {"type": "array", "title": "hosts", "default": ["example.com"], "items": {"type": "string"}}
+				}
+			},
+			"podAnnotations": {"title": "podAnnotations"}
+		}
+	}`, string(schema))
+
+	tmpl = &Template{Helm: &v1alpha2.Helm{}, CapabilityCategory: types.HelmCategory}
+	schema, err = tmpl.InputSchema()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"type":"object"}`, string(schema))
+}
+
+func TestTerraformInputSchema(t *testing.T) {
+	conf, err := ParseTerraformConfiguration(`
+output: {
+	module: rds: source: "terraform-aws-modules/rds/aws"
+	variable: {
+		instance_class: {
+			description: "The instance type of the RDS instance"
+			default:     "db.t3.micro"
+		}
+		password: description: "Password for the master DB user"
+		username: {}
+	}
+}
+`)
+	assert.NoError(t, err)
+	tmpl := &Template{TemplateStr: "output: {}", Terraform: conf, CapabilityCategory: types.TerraformCategory}
+	schema, err := tmpl.InputSchema()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"required": ["password", "username"],
+		"properties": {
+			"instance_class": {"title": "instance_class", "description": "The instance type of the RDS instance"},
+			"password": {"title": "password", "description": "Password for the master DB user"},
+			"username": {"title": "username"}
+		}
+	}`, string(schema))
+}
+
+func TestKustomizeInputSchema(t *testing.T) {
+	tmpl := &Template{Kustomize: &v1alpha2.Kustomize{}, CapabilityCategory: types.KustomizeCategory}
+	schema, err := tmpl.InputSchema()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"type":"object"}`, string(schema))
+}
+
+func TestGenerateOpenAPISchemaFromCapabilityParameter(t *testing.T) {
+	var invalidWorkloadName = "IAmAnInvalidWorkloadDefinition"
+
+	type want struct {
+		data []byte
+		err  error
+	}
+
+	cases := map[string]struct {
+		reason   string
+		template string
+		want     want
+	}{
+		"GenerateOpenAPISchemaFromInvalidCapability": {
+			reason:   "generate OpenAPI schema for an invalid Workload/Trait",
+			template: "output: {}",
+			want:     want{data: nil, err: fmt.Errorf("capability IAmAnInvalidWorkloadDefinition doesn't contain section `parmeter`")},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := GenerateParameterSchema(invalidWorkloadName, tc.template)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nGenerateParameterSchema(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.data, got); diff != "" {
+				t.Errorf("\n%s\nGenerateParameterSchema(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+
+	// the parameter section doesn't compile
+	got, err := GenerateParameterSchema(invalidWorkloadName, "parameter: {\n\timage: string &\n}")
+	assert.Error(t, err)
+	assert.Nil(t, got)
+}
+
+func TestFixOpenAPISchema(t *testing.T) {
+	cases := map[string]struct {
+		inputFile string
+		fixedFile string
+	}{
+		"StandardWorkload": {
+			inputFile: "webservice.json",
+			fixedFile: "webserviceFixed.json",
+		},
+		"ShortTagJson": {
+			inputFile: "shortTagSchema.json",
+			fixedFile: "shortTagSchemaFixed.json",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			swagger, err := openapi3.NewSwaggerLoader().LoadSwaggerFromFile(filepath.Join(schemaTestDir, tc.inputFile))
+			assert.NoError(t, err)
+			schema := swagger.Components.Schemas["parameter"].Value
+			FixOpenAPISchema("", schema)
+			fixedSchema, _ := schema.MarshalJSON()
+			expectedSchema, _ := ioutil.ReadFile(filepath.Join(schemaTestDir, tc.fixedFile))
+			assert.Equal(t, string(expectedSchema), string(fixedSchema))
+		})
+	}
+}
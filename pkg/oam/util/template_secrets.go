@@ -0,0 +1,131 @@
+package util
+
+import (
+	"sort"
+
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/format"
+	"cuelang.org/go/cue/literal"
+	"cuelang.org/go/cue/parser"
+	"cuelang.org/go/cue/token"
+	"github.com/pkg/errors"
+)
+
+// ObjectRef is a Secret or ConfigMap which the objects rendered by a template read
+type ObjectRef struct {
+	// Kind is "Secret" or "ConfigMap"
+	Kind string `json:"kind"`
+	// Name is the name of the object, it's empty if the name is dynamic, e.g. set by a parameter
+	Name string `json:"name,omitempty"`
+	// Expression is the CUE expression of a dynamic name, e.g. "parameter.dbSecret"
+	Expression string `json:"expression,omitempty"`
+}
+
+// objectRefField is a field of Kubernetes objects which references a Secret or ConfigMap by its nameField
+type objectRefField struct {
+	kind      string
+	nameField string
+	list      bool
+}
+
+// objectRefFields are the fields referencing Secrets and ConfigMaps by their labels, e.g. `secretKeyRef` of env
+// and `secret` of volumes
+var objectRefFields = map[string]objectRefField{
+	"secretKeyRef":     {kind: "Secret", nameField: "name"},
+	"secretRef":        {kind: "Secret", nameField: "name"},
+	"secret":           {kind: "Secret", nameField: "secretName"},
+	"imagePullSecrets": {kind: "Secret", nameField: "name", list: true},
+	"configMapKeyRef":  {kind: "ConfigMap", nameField: "name"},
+	"configMapRef":     {kind: "ConfigMap", nameField: "name"},
+	"configMap":        {kind: "ConfigMap", nameField: "name"},
+}
+
+// ReferencedSecrets returns the Secrets and ConfigMaps referenced by the objects of the CUE template, e.g. by
+// `secretKeyRef` of env, `envFrom`, volumes and `imagePullSecrets`, sorted by kind and name. It's for auditing what
+// a capability can read. The template is analyzed statically, so the result is best-effort: references with
+// dynamic names have the expression of the name instead, and the fields of the parameter are skipped.
+// It returns nil for templates other than CUE.
+func (t *Template) ReferencedSecrets() ([]ObjectRef, error) {
+	if !t.IsCUE() {
+		return nil, nil
+	}
+	f, err := parser.ParseFile("-", t.TemplateStr)
+	if err != nil {
+		return nil, t.withCapabilityName(errors.WithMessage(err, "parse template"))
+	}
+	found := map[ObjectRef]bool{}
+	ast.Walk(f, func(n ast.Node) bool {
+		field, ok := n.(*ast.Field)
+		if !ok {
+			return true
+		}
+		label, _, err := ast.LabelName(field.Label)
+		if err != nil {
+			return true
+		}
+		if label == "parameter" {
+			return false
+		}
+		if refField, ok := objectRefFields[label]; ok {
+			for _, ref := range objectRefsOf(refField, field.Value) {
+				found[ref] = true
+			}
+		}
+		return true
+	}, nil)
+	var refs []ObjectRef
+	for ref := range found {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Kind != refs[j].Kind {
+			return refs[i].Kind < refs[j].Kind
+		}
+		if refs[i].Name != refs[j].Name {
+			return refs[i].Name < refs[j].Name
+		}
+		return refs[i].Expression < refs[j].Expression
+	})
+	return refs, nil
+}
+
+// objectRefsOf returns the objects referenced by the value of a field, i.e. by the name field of a struct, or of
+// the structs in a list
+func objectRefsOf(refField objectRefField, value ast.Expr) []ObjectRef {
+	var structs []*ast.StructLit
+	if list, ok := value.(*ast.ListLit); ok && refField.list {
+		for _, elt := range list.Elts {
+			if s, ok := elt.(*ast.StructLit); ok {
+				structs = append(structs, s)
+			}
+		}
+	} else if s, ok := value.(*ast.StructLit); ok && !refField.list {
+		structs = append(structs, s)
+	}
+	var refs []ObjectRef
+	for _, s := range structs {
+		for _, elt := range s.Elts {
+			f, ok := elt.(*ast.Field)
+			if !ok {
+				continue
+			}
+			if name, _, err := ast.LabelName(f.Label); err != nil || name != refField.nameField {
+				continue
+			}
+			ref := ObjectRef{Kind: refField.kind}
+			if lit, ok := f.Value.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				if ref.Name, _ = literal.Unquote(lit.Value); ref.Name != "" {
+					refs = append(refs, ref)
+					continue
+				}
+			}
+			b, err := format.Node(f.Value)
+			if err != nil {
+				continue
+			}
+			ref.Expression = string(b)
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
@@ -0,0 +1,67 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/apis/types"
+)
+
+func TestReferencedSecrets(t *testing.T) {
+	tmpl := &Template{Name: "webservice", TemplateStr: `
+output: {
+	kind: "Deployment"
+	spec: template: spec: {
+		containers: [{
+			name:  context.name
+			image: parameter.image
+			env: [{
+				name: "DB_PASSWORD"
+				valueFrom: secretKeyRef: {
+					name: "db-credentials"
+					key:  "password"
+				}
+			}, {
+				name: "LOG_LEVEL"
+				valueFrom: configMapKeyRef: {
+					name: "\(context.name)-config"
+					key:  "level"
+				}
+			}]
+			envFrom: [{secretRef: name: parameter.envSecret}]
+		}]
+		imagePullSecrets: [{name: "registry"}]
+		volumes: [{
+			name: "tls"
+			secret: secretName: "db-credentials"
+		}]
+	}
+}
+parameter: {
+	image:     string
+	envSecret: string
+	secret: secretName: string
+}
+`}
+	refs, err := tmpl.ReferencedSecrets()
+	assert.NoError(t, err)
+	assert.Equal(t, []ObjectRef{
+		{Kind: "ConfigMap", Expression: `"\(context.name)-config"`},
+		{Kind: "Secret", Expression: "parameter.envSecret"},
+		{Kind: "Secret", Name: "db-credentials"},
+		{Kind: "Secret", Name: "registry"},
+	}, refs)
+
+	refs, err = (&Template{Name: "scaler", TemplateStr: `patch: spec: replicas: 1`}).ReferencedSecrets()
+	assert.NoError(t, err)
+	assert.Empty(t, refs)
+
+	refs, err = (&Template{Name: "chart", CapabilityCategory: types.HelmCategory, Helm: &v1alpha2.Helm{}}).ReferencedSecrets()
+	assert.NoError(t, err)
+	assert.Nil(t, refs)
+
+	_, err = (&Template{Name: "broken", TemplateStr: `output: {`}).ReferencedSecrets()
+	assert.Error(t, err)
+}
@@ -0,0 +1,24 @@
+package util
+
+const (
+	// LabelAddonName is the label of the definitions installed by an addon, it's the name of the addon
+	LabelAddonName = "addons.oam.dev/name"
+	// LabelAddonVersion is the label of the version of the addon which installed a definition
+	LabelAddonVersion = "addons.oam.dev/version"
+)
+
+// TemplateSource is the addon which installed the definition of a template
+type TemplateSource struct {
+	Addon string `json:"addon"`
+	// Version is the version of the addon, it's empty if unlabeled
+	Version string `json:"version,omitempty"`
+}
+
+// templateSourceOf returns the addon labeled on a definition, it's nil if the definition isn't installed by an addon
+func templateSourceOf(labels map[string]string) *TemplateSource {
+	addon := labels[LabelAddonName]
+	if addon == "" {
+		return nil
+	}
+	return &TemplateSource{Addon: addon, Version: labels[LabelAddonVersion]}
+}
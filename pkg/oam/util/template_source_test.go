@@ -0,0 +1,38 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	ktypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+func TestLoadTemplateSource(t *testing.T) {
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			if o, ok := obj.(*v1alpha2.TraitDefinition); ok {
+				o.Name = key.Name
+				if key.Name == "kustomize-patch" {
+					o.Labels = map[string]string{LabelAddonName: "fluxcd", LabelAddonVersion: "1.0.0"}
+				}
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "patch: {}"}}
+			}
+			return nil
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+
+	tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, "kustomize-patch", TraitTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, &TemplateSource{Addon: "fluxcd", Version: "1.0.0"}, tmpl.Source)
+
+	tmpl, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "scaler", TraitTemplateKind)
+	assert.NoError(t, err)
+	assert.Nil(t, tmpl.Source, "manually created definition has no source")
+}
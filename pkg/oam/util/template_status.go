@@ -0,0 +1,68 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/format"
+	"cuelang.org/go/cue/parser"
+	"github.com/pkg/errors"
+)
+
+// StatusDetailsFieldName is the field of the custom status which renders the structured status of a component
+const StatusDetailsFieldName = "details"
+
+// statusDetailsOf returns the source of the details block of the custom status, it's empty if there's no such
+// block or the custom status can't be parsed, which is reported by ValidateTemplate.
+func statusDetailsOf(customStatus string) string {
+	if customStatus == "" {
+		return ""
+	}
+	f, err := parser.ParseFile("-", customStatus)
+	if err != nil {
+		return ""
+	}
+	for _, decl := range f.Decls {
+		field, ok := decl.(*ast.Field)
+		if !ok {
+			continue
+		}
+		if name, _, _ := ast.LabelName(field.Label); name != StatusDetailsFieldName {
+			continue
+		}
+		b, err := format.Node(field)
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+	return ""
+}
+
+// RenderStatusDetails renders the details block of the custom status with the given template context like
+// RenderCustomStatus, the block is evaluated with the whole custom status so that it can reference the other fields.
+// It returns nil if the template has no status details.
+func (t *Template) RenderStatusDetails(ctx context.Context, templateContext map[string]interface{}) (map[string]interface{}, error) {
+	if t.StatusDetails == "" {
+		return nil, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	bt, err := json.Marshal(templateContext)
+	if err != nil {
+		return nil, t.withCapabilityName(errors.WithMessage(err, "json marshal template context"))
+	}
+	var r cue.Runtime
+	inst, err := r.Compile("-", "context: "+string(bt)+"\n"+t.CustomStatus)
+	if err != nil {
+		return nil, t.withCapabilityName(errors.WithMessage(err, "compile customStatus template"))
+	}
+	details := map[string]interface{}{}
+	if err := inst.Lookup(StatusDetailsFieldName).Decode(&details); err != nil {
+		return nil, t.withCapabilityName(errors.WithMessage(err, "evaluate customStatus.details"))
+	}
+	return details, nil
+}
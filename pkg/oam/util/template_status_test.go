@@ -0,0 +1,51 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+)
+
+func TestRenderStatusDetails(t *testing.T) {
+	customStatus := `ready: context.output.status.readyReplicas
+message: "Ready: \(ready)/\(context.output.spec.replicas)"
+details: {
+	readyReplicas: ready
+	image:         context.output.spec.template.spec.containers[0].image
+}
+`
+	templateContext := map[string]interface{}{
+		"output": map[string]interface{}{
+			"spec": map[string]interface{}{
+				"replicas": 3,
+				"template": map[string]interface{}{"spec": map[string]interface{}{
+					"containers": []interface{}{map[string]interface{}{"image": "nginx:1.19"}},
+				}},
+			},
+			"status": map[string]interface{}{"readyReplicas": 2},
+		},
+	}
+
+	tmpl, err := NewTemplate(&v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}}, &v1alpha2.Status{CustomStatus: customStatus}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "details: {\n\treadyReplicas: ready\n\timage:         context.output.spec.template.spec.containers[0].image\n}", tmpl.StatusDetails)
+	details, err := tmpl.RenderStatusDetails(context.TODO(), templateContext)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"readyReplicas": float64(2), "image": "nginx:1.19"}, details)
+	message, err := tmpl.RenderCustomStatus(context.TODO(), templateContext)
+	assert.NoError(t, err)
+	assert.Equal(t, "Ready: 2/3", message)
+
+	_, err = tmpl.RenderStatusDetails(context.TODO(), map[string]interface{}{})
+	assert.Error(t, err, "details referencing missing status should not be rendered")
+
+	tmpl, err = NewTemplate(&v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}}, &v1alpha2.Status{CustomStatus: `message: "ok"`}, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, tmpl.StatusDetails)
+	details, err = tmpl.RenderStatusDetails(context.TODO(), templateContext)
+	assert.NoError(t, err)
+	assert.Nil(t, details)
+}
@@ -2,17 +2,32 @@ package util
 
 import (
 	"context"
+	"fmt"
+	"math/rand"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"cuelang.org/go/cue"
 	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
 
 	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
 	"github.com/oam-dev/kubevela/apis/types"
+	"github.com/oam-dev/kubevela/pkg/oam"
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
 )
 
 func TestLoadComponentTemplate(t *testing.T) {
@@ -234,7 +249,428 @@ spec:
 	}
 }
 
+func TestLoadScopeTemplate(t *testing.T) {
+	cueTemplate := `
+        parameter: {
+        	probeTimeout: *10 | int
+        }
+        output: {
+        	apiVersion: "core.oam.dev/v1alpha2"
+        	kind:       "HealthScope"
+        	spec: probeTimeout: parameter.probeTimeout
+        }
+      `
+
+	var scopeDefinition = `
+apiVersion: core.oam.dev/v1alpha2
+kind: ScopeDefinition
+metadata:
+  name: healthscope
+  namespace: default
+spec:
+  definitionRef:
+    name: healthscopes.core.oam.dev
+    version: v1alpha2
+  allowComponentOverlap: true
+  workloadRefsPath: spec.workloadRefs
+  status:
+    healthPolicy: |
+      isHealth: context.output.status.health == "healthy"
+  schematic:
+    cue:
+      template: |
+` + cueTemplate
+
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			switch o := obj.(type) {
+			case *v1alpha2.ScopeDefinition:
+				if key.Name != "healthscope" {
+					return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: "scopedefinitions"}, key.Name)
+				}
+				sd, err := UnMarshalStringToScopeDefinition(scopeDefinition)
+				if err != nil {
+					return err
+				}
+				*o = *sd
+			}
+			return nil
+		},
+		MockList: test.NewMockListFn(nil),
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	dm.MockKindsFor = mock.NewMockKindsFor("HealthScope", "v1alpha2")
+
+	temp, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, "healthscope", ScopeTemplateKind)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var r cue.Runtime
+	inst, err := r.Compile("-", temp.TemplateStr)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	instDest, err := r.Compile("-", cueTemplate)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	s1, _ := inst.Value().String()
+	s2, _ := instDest.Value().String()
+	if s1 != s2 {
+		t.Errorf("parsered template is not correct")
+	}
+	assert.Equal(t, "isHealth: context.output.status.health == \"healthy\"\n", temp.Health)
+	assert.Equal(t, v1alpha2.WorkloadGVK{APIVersion: "core.oam.dev/v1alpha2", Kind: "HealthScope"}, temp.Reference)
+
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "not-exist", ScopeTemplateKind)
+	assert.Error(t, err)
+	assert.True(t, kerrors.IsNotFound(errors.Cause(err)))
+}
+
+func TestGetScopeGVK(t *testing.T) {
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			if o, ok := obj.(*v1alpha2.ScopeDefinition); ok {
+				o.Spec.Reference = v1alpha2.DefinitionReference{Name: key.Name + ".core.oam.dev"}
+			}
+			return nil
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	dm.MockKindsFor = mock.NewMockKindsFor("HealthScope", "v1alpha2")
+	dm.MockRESTMapping = func(gk schema.GroupKind, versions ...string) (*meta.RESTMapping, error) {
+		if gk.Kind != "HealthScope" {
+			return nil, &meta.NoKindMatchError{GroupKind: gk, SearchedVersions: versions}
+		}
+		return &meta.RESTMapping{}, nil
+	}
+
+	gvk, err := GetScopeGVK(context.TODO(), &tclient, dm, "healthscopes")
+	assert.NoError(t, err)
+	assert.Equal(t, schema.GroupVersionKind{Group: "core.oam.dev", Version: "v1alpha2", Kind: "HealthScope"}, gvk)
+
+	dm.MockKindsFor = mock.NewMockKindsFor("HealthScop", "v1alpha2")
+	_, err = GetScopeGVK(context.TODO(), &tclient, dm, "healthscops")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "kind core.oam.dev/v1alpha2, Kind=HealthScop referenced by ScopeDefinition healthscops is not registered")
+	assert.True(t, meta.IsNoMatchError(errors.Cause(err)))
+}
+
+func TestGetComponentWorkloadGVK(t *testing.T) {
+	notFound := func(resource, name string) error {
+		return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: resource}, name)
+	}
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			switch o := obj.(type) {
+			case *v1alpha2.ComponentDefinition:
+				switch key.Name {
+				case "webservice":
+					o.Spec.Workload.Definition = v1alpha2.WorkloadGVK{APIVersion: "apps/v1", Kind: "Deployment"}
+				case "worker":
+					o.Spec.Workload.Type = "deployments.apps"
+				case "cronjob":
+					o.Spec.Workload.Definition = v1alpha2.WorkloadGVK{APIVersion: "batch/v1beta1", Kind: "CronJob"}
+				default:
+					return notFound("componentdefinitions", key.Name)
+				}
+			case *v1alpha2.WorkloadDefinition:
+				if key.Name != "deployments.apps" && key.Name != "legacy" {
+					return notFound("workloaddefinitions", key.Name)
+				}
+				o.Spec.Reference = v1alpha2.DefinitionReference{Name: "deployments.apps"}
+			}
+			return nil
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	dm.MockKindsFor = mock.NewMockKindsFor("Deployment", "v1")
+	dm.MockRESTMapping = func(gk schema.GroupKind, versions ...string) (*meta.RESTMapping, error) {
+		if gk.Kind != "Deployment" {
+			return nil, &meta.NoKindMatchError{GroupKind: gk, SearchedVersions: versions}
+		}
+		return &meta.RESTMapping{}, nil
+	}
+	deployment := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+
+	gvk, err := GetComponentWorkloadGVK(context.TODO(), &tclient, dm, "webservice")
+	assert.NoError(t, err, "definition-ref style")
+	assert.Equal(t, deployment, gvk)
+
+	gvk, err = GetComponentWorkloadGVK(context.TODO(), &tclient, dm, "worker")
+	assert.NoError(t, err, "type-ref style")
+	assert.Equal(t, deployment, gvk)
+
+	gvk, err = GetComponentWorkloadGVK(context.TODO(), &tclient, dm, "legacy")
+	assert.NoError(t, err, "should fall back to WorkloadDefinition")
+	assert.Equal(t, deployment, gvk)
+
+	_, err = GetComponentWorkloadGVK(context.TODO(), &tclient, dm, "cronjob")
+	assert.True(t, meta.IsNoMatchError(errors.Cause(err)))
+
+	_, err = GetComponentWorkloadGVK(context.TODO(), &tclient, dm, "not-exist")
+	assert.True(t, kerrors.IsNotFound(errors.Cause(err)))
+}
+
+func TestLoadTemplateWithSource(t *testing.T) {
+	notFound := func(resource, name string) error {
+		return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: resource}, name)
+	}
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			switch o := obj.(type) {
+			case *v1alpha2.ComponentDefinition:
+				if key.Name != "webservice" {
+					return notFound("componentdefinitions", key.Name)
+				}
+				o.Name, o.Namespace, o.ResourceVersion = key.Name, key.Namespace, "10"
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}}
+			case *v1alpha2.WorkloadDefinition:
+				if key.Name != "worker" {
+					return notFound("workloaddefinitions", key.Name)
+				}
+				o.Name, o.Namespace, o.ResourceVersion = key.Name, key.Namespace, "20"
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}}
+			}
+			return nil
+		},
+		MockList: test.NewMockListFn(nil),
+	}
+	dm := mock.NewMockDiscoveryMapper()
+
+	_, source, err := LoadTemplateWithSource(context.TODO(), &tclient, dm, "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, &ResolvedDefinition{Kind: v1alpha2.ComponentDefinitionKind, Namespace: oam.SystemDefinitonNamespace,
+		Name: "webservice", ResourceVersion: "10"}, source)
+
+	_, source, err = LoadTemplateWithSource(context.TODO(), &tclient, dm, "worker", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, &ResolvedDefinition{Kind: v1alpha2.WorkloadDefinitionKind, Namespace: oam.SystemDefinitonNamespace,
+		Name: "worker", ResourceVersion: "20"}, source)
+
+	_, source, err = LoadTemplateWithSource(context.TODO(), &tclient, dm, "not-exist", ComponentTemplateKind)
+	assert.Error(t, err)
+	assert.Nil(t, source)
+
+	_, source, err = LoadTemplateWithSource(context.TODO(), &tclient, dm, "worker", ComponentTemplateKind, DisableWorkloadFallback())
+	assert.True(t, kerrors.IsNotFound(errors.Cause(err)), "should return the not found error of ComponentDefinition")
+	assert.Contains(t, err.Error(), "LoadTemplate from ComponentDefinition [worker]")
+	assert.Nil(t, source)
+
+	_, source, err = LoadTemplateWithSource(context.TODO(), &tclient, dm, "webservice", ComponentTemplateKind, DisableWorkloadFallback())
+	assert.NoError(t, err)
+	assert.Equal(t, v1alpha2.ComponentDefinitionKind, source.Kind)
+}
+
+// importedTFTemplate is a Terraform template importing a CUE package
+const importedTFTemplate = `import "vela.dev/oss"
+
+output: module: bucket: source: oss.#Source
+`
+
+func TestLoadTerraformTemplate(t *testing.T) {
+	tfTemplate := `
+output: {
+	module: rds: source: "terraform-alicloud-modules/rds/alicloud"
+	variable: {
+		bucket: {
+			description: "OSS bucket name"
+			default:     parameter.bucket
+		}
+		region: {}
+	}
+	output: BUCKET_NAME: value: "${alicloud_oss_bucket.bucket-acl.bucket}"
+}
+parameter: bucket: string
+`
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			switch o := obj.(type) {
+			case *v1alpha2.ComponentDefinition:
+				return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: "componentdefinitions"}, key.Name)
+			case *v1alpha2.WorkloadDefinition:
+				o.Name, o.Namespace = key.Name, key.Namespace
+				if key.Name == "aliyun-oss" || key.Name == "imported-oss" {
+					o.Annotations = map[string]string{"type": string(types.TerraformCategory)}
+				}
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: tfTemplate}}
+				if key.Name == "imported-oss" {
+					o.Spec.Schematic.CUE.Template = importedTFTemplate
+				}
+			}
+			return nil
+		},
+	}
+
+	tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, mock.NewMockDiscoveryMapper(), "aliyun-oss", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, types.TerraformCategory, tmpl.CapabilityCategory)
+	assert.Equal(t, &TerraformConfiguration{
+		ModuleSources: map[string]string{"rds": "terraform-alicloud-modules/rds/alicloud"},
+		Variables: []TerraformVariable{
+			{Name: "bucket", Description: "OSS bucket name"},
+			{Name: "region", Required: true},
+		},
+		Outputs: []string{"BUCKET_NAME"},
+	}, tmpl.Terraform)
+
+	tmpl, err = LoadTemplateOfKind(context.TODO(), &tclient, mock.NewMockDiscoveryMapper(), "worker", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Nil(t, tmpl.Terraform, "non-Terraform definitions should not have terraform configuration")
+
+	tmpl, err = LoadTemplateOfKind(context.TODO(), &tclient, mock.NewMockDiscoveryMapper(), "imported-oss", ComponentTemplateKind)
+	assert.NoError(t, err, "unresolved imports should not fail the load")
+	assert.Equal(t, types.TerraformCategory, tmpl.CapabilityCategory)
+	assert.Nil(t, tmpl.Terraform)
+
+	conf, err := parseTerraformConfiguration(importedTFTemplate, map[string]map[string]string{
+		"vela.dev/oss": {"oss.cue": "package oss\n\n#Source: \"terraform-alicloud-modules/oss/alicloud\"\n"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"bucket": "terraform-alicloud-modules/oss/alicloud"}, conf.ModuleSources)
+}
+
+func TestParseTerraformBackend(t *testing.T) {
+	conf, err := ParseTerraformConfiguration(`
+output: {
+	terraform: backend: s3: {
+		bucket:  "vela-terraform-state"
+		key:     "rds/" + parameter.name + ".tfstate"
+		region:  "us-west-2"
+		encrypt: true
+	}
+	module: rds: source: "terraform-aws-modules/rds/aws"
+}
+parameter: name: string
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, &TerraformBackend{
+		Type:   "s3",
+		Config: map[string]interface{}{"bucket": "vela-terraform-state", "region": "us-west-2", "encrypt": true},
+	}, conf.Backend, "settings depending on parameters should be omitted")
+
+	conf, err = ParseTerraformConfiguration(`output: module: rds: source: "terraform-aws-modules/rds/aws"`)
+	assert.NoError(t, err)
+	assert.Nil(t, conf.Backend)
+
+	_, err = ParseTerraformConfiguration(`output: terraform: backend: {
+	s3: bucket: "state"
+	gcs: bucket: "state"
+}`)
+	assert.EqualError(t, err, "parse terraform backend: only one backend can be declared, but got 2")
+}
+
+func TestLoadTemplateTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { DefinitionReadTimeout = timeout }(DefinitionReadTimeout)
+	DefinitionReadTimeout = 10 * time.Millisecond
+
+	// a client blocking until the request is canceled, like a hanging API server
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+
+	_, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, "worker", ComponentTemplateKind)
+	assert.Error(t, err)
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+	assert.Contains(t, err.Error(), "timed out after 10ms reading definition worker")
+
+	_, err = GetScopeGVK(context.TODO(), &tclient, dm, "healthscope")
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+}
+
+func TestLoadTemplateRetry(t *testing.T) {
+	var gets int
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			gets++
+			switch {
+			case key.Name == "missing":
+				return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: "componentdefinitions"}, key.Name)
+			case key.Name == "throttled":
+				return kerrors.NewTooManyRequests("throttled", 1)
+			case gets <= 2:
+				return kerrors.NewServerTimeout(schema.GroupResource{Group: v1alpha2.Group, Resource: "componentdefinitions"}, "get", 1)
+			}
+			if o, ok := obj.(*v1alpha2.ComponentDefinition); ok {
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}}
+			}
+			return nil
+		},
+		MockList: test.NewMockListFn(nil),
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	backoff := wait.Backoff{Steps: 3, Duration: time.Millisecond}
+
+	tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, "worker", ComponentTemplateKind, LoadWithRetry(backoff))
+	assert.NoError(t, err)
+	assert.Equal(t, "output: {}", tmpl.TemplateStr)
+	assert.Equal(t, 3, gets, "should succeed on the third read")
+
+	gets = 0
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "missing", ComponentTemplateKind, LoadWithRetry(backoff), DisableWorkloadFallback())
+	assert.True(t, kerrors.IsNotFound(errors.Cause(err)))
+	// a single read looks for the definition in the application namespace, the system namespace and the cluster scope
+	assert.Equal(t, 3, gets, "not found should not be retried")
+
+	gets = 0
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "throttled", ComponentTemplateKind, LoadWithRetry(backoff))
+	assert.True(t, kerrors.IsTooManyRequests(errors.Cause(err)))
+	assert.Equal(t, 3, gets, "should give up after the steps of the backoff")
+
+	gets = 0
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "worker", ComponentTemplateKind, LoadWithRetry(wait.Backoff{}))
+	assert.True(t, kerrors.IsTimeout(errors.Cause(err)) || kerrors.IsServerTimeout(errors.Cause(err)))
+	assert.Equal(t, 1, gets, "retry should be disabled")
+}
+
+func TestLoadTemplateReferenceFromWorkloadDefinition(t *testing.T) {
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			switch o := obj.(type) {
+			case *v1alpha2.ComponentDefinition:
+				return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: "componentdefinitions"}, key.Name)
+			case *v1alpha2.WorkloadDefinition:
+				o.Spec.Reference = v1alpha2.DefinitionReference{Name: "deployments.apps"}
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}}
+			}
+			return nil
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	dm.MockKindsFor = mock.NewMockKindsFor("Deployment", "v1")
+
+	tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, "worker", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, v1alpha2.WorkloadGVK{APIVersion: "apps/v1", Kind: "Deployment"}, tmpl.Reference)
+
+	// the CRD of the workload isn't installed
+	dm.MockKindsFor = func(schema.GroupVersionResource) ([]schema.GroupVersionKind, error) {
+		return nil, &meta.NoResourceMatchError{}
+	}
+	tmpl, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "worker", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "output: {}", tmpl.TemplateStr)
+	assert.Equal(t, v1alpha2.WorkloadGVK{}, tmpl.Reference)
+}
+
 func TestNewTemplate(t *testing.T) {
+	helm := &v1alpha2.Helm{
+		Release:    runtime.RawExtension{Raw: []byte(`{"chart":{"spec":{"chart":"podinfo","version":"5.1.4"}},"values":{"image":{"tag":"5.1.2"}}}`)},
+		Repository: runtime.RawExtension{Raw: []byte(`{"url":"http://oam.dev/catalog/"}`)},
+	}
+	malformedHelm := &v1alpha2.Helm{
+		Release: runtime.RawExtension{Raw: []byte(`{"chart":{"spec":{"chart":"podinfo"}},"values":"tag=5.1.2"}`)},
+	}
+	kustomize := &v1alpha2.Kustomize{
+		Spec: runtime.RawExtension{Raw: []byte(`{"path":"./overlays/production","source":{"git":"https://github.com/oam-dev/samples"}}`)},
+	}
 	testCases := map[string]struct {
 		tmp    *v1alpha2.Schematic
 		status *v1alpha2.Status
@@ -249,6 +685,14 @@ func TestNewTemplate(t *testing.T) {
 		},
 		"no tmp,but has extension": {
 			ext: &runtime.RawExtension{Raw: []byte(`{"template":"t1"}`)},
+			exp: &Template{
+				TemplateStr:  "t1",
+				Deprecations: []DeprecatedField{{Field: "spec.extension.template", Replacement: "spec.schematic.cue.template"}},
+			},
+		},
+		"tmp takes precedence over extension": {
+			tmp: &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "t1"}},
+			ext: &runtime.RawExtension{Raw: []byte(`{"template":"t2"}`)},
 			exp: &Template{
 				TemplateStr: "t1",
 			},
@@ -281,6 +725,41 @@ func TestNewTemplate(t *testing.T) {
 				Health:       "h1",
 			},
 		},
+		"helm with values": {
+			tmp: &v1alpha2.Schematic{HELM: helm},
+			exp: &Template{
+				CapabilityCategory: types.HelmCategory,
+				Helm:               helm,
+				HelmValues: map[string]interface{}{
+					"image": map[string]interface{}{"tag": "5.1.2"},
+				},
+			},
+		},
+		"helm without release": {
+			tmp: &v1alpha2.Schematic{HELM: &v1alpha2.Helm{}},
+			exp: &Template{
+				CapabilityCategory: types.HelmCategory,
+				Helm:               &v1alpha2.Helm{},
+			},
+		},
+		"helm with malformed release": {
+			tmp: &v1alpha2.Schematic{HELM: malformedHelm},
+			exp: &Template{
+				CapabilityCategory: types.HelmCategory,
+				Helm:               malformedHelm,
+			},
+		},
+		"kustomize with status": {
+			tmp: &v1alpha2.Schematic{KUSTOMIZE: kustomize},
+			status: &v1alpha2.Status{
+				HealthPolicy: "h1",
+			},
+			exp: &Template{
+				CapabilityCategory: types.KustomizeCategory,
+				Kustomize:          kustomize,
+				Health:             "h1",
+			},
+		},
 	}
 	for reason, casei := range testCases {
 		gtmp, err := NewTemplate(casei.tmp, casei.status, casei.ext)
@@ -288,3 +767,1160 @@ func TestNewTemplate(t *testing.T) {
 		assert.Equal(t, gtmp, casei.exp, reason)
 	}
 }
+
+func TestNewTemplateWithExtensionTemplateKey(t *testing.T) {
+	ext := &runtime.RawExtension{Raw: []byte(`{"template":"t1","cueTemplate":"t2"}`)}
+	tmpl, err := NewTemplateWithOptions(nil, nil, ext)
+	assert.NoError(t, err)
+	assert.Equal(t, "t1", tmpl.TemplateStr)
+
+	tmpl, err = NewTemplateWithOptions(nil, nil, ext, WithExtensionTemplateKey("cueTemplate"))
+	assert.NoError(t, err)
+	assert.Equal(t, &Template{
+		TemplateStr:  "t2",
+		Deprecations: []DeprecatedField{{Field: "spec.extension.cueTemplate", Replacement: "spec.schematic.cue.template"}},
+	}, tmpl)
+
+	tmpl, err = NewTemplateWithOptions(&v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "t0"}}, nil, ext, WithExtensionTemplateKey("cueTemplate"))
+	assert.NoError(t, err)
+	assert.Equal(t, "t0", tmpl.TemplateStr, "schematic takes precedence over extension")
+
+	tmpl, err = NewTemplateWithOptions(nil, nil, ext, WithExtensionTemplateKey("missing"))
+	assert.NoError(t, err)
+	assert.Equal(t, "", tmpl.TemplateStr)
+}
+
+func TestNewTemplateWithCUEValidation(t *testing.T) {
+	valid := &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: `
+output: {
+	apiVersion: "apps/v1"
+	kind:       "Deployment"
+	metadata: name: context.name
+}
+`}}
+	tmp, err := NewTemplateWithOptions(valid, nil, nil, WithCUEValidation())
+	assert.NoError(t, err)
+	assert.Equal(t, valid.CUE.Template, tmp.TemplateStr)
+
+	invalid := &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: `
+output: {
+	apiVersion: "apps/v1"
+	kind:       "Deployment"
+`}}
+	_, err = NewTemplate(invalid, nil, nil)
+	assert.NoError(t, err, "validation is opt-in")
+	_, err = NewTemplateWithOptions(invalid, nil, nil, WithCUEValidation())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "line 4, column 27")
+
+	unresolved := &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: `
+output: {
+	metadata: name: parameter.name
+}
+`}}
+	_, err = NewTemplateWithOptions(unresolved, nil, nil, WithCUEValidation())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "line 3, column 18")
+
+	invalidExt := &runtime.RawExtension{Raw: []byte(`{"template":"output: {\n\tkind: \n}"}`)}
+	_, err = NewTemplateWithOptions(nil, nil, invalidExt, WithCUEValidation())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "line 3, column 1")
+}
+
+func TestTemplateToCapability(t *testing.T) {
+	testCases := map[string]struct {
+		tmpl *Template
+		exp  types.Capability
+	}{
+		"cue": {
+			tmpl: &Template{TemplateStr: "output: {}", CapabilityCategory: types.CUECategory, Namespace: "vela-system"},
+			exp:  types.Capability{Name: "webservice", Namespace: "vela-system", Category: types.CUECategory, CueTemplate: "output: {}"},
+		},
+		"helm": {
+			tmpl: &Template{
+				CapabilityCategory: types.HelmCategory,
+				Helm: &v1alpha2.Helm{
+					Release:    runtime.RawExtension{Raw: []byte(`{"chart":{"spec":{"chart":"podinfo","version":"5.1.4"}}}`)},
+					Repository: runtime.RawExtension{Raw: []byte(`{"url":"http://oam.dev/catalog/"}`)},
+				},
+				HelmValues: map[string]interface{}{"image": "nginx"},
+			},
+			exp: types.Capability{Name: "webservice", Category: types.HelmCategory, Helm: &types.Chart{
+				URL: "http://oam.dev/catalog/", Name: "podinfo", Version: "5.1.4", Values: map[string]interface{}{"image": "nginx"},
+			}},
+		},
+		"terraform": {
+			tmpl: &Template{
+				TemplateStr:        "module \"rds\" {}",
+				CapabilityCategory: types.TerraformCategory,
+				Terraform:          &TerraformConfiguration{ModuleSources: map[string]string{"rds": ""}},
+			},
+			exp: types.Capability{Name: "webservice", Category: types.TerraformCategory, CueTemplate: "module \"rds\" {}"},
+		},
+	}
+	for name, tc := range testCases {
+		assert.Equal(t, tc.exp, tc.tmpl.ToCapability("webservice"), name)
+	}
+
+	schematic := &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}}
+	converted, err := ConvertTemplateJSON2Object("webservice", nil, schematic)
+	assert.NoError(t, err)
+	tmpl, err := NewTemplate(schematic, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, converted, tmpl.ToCapability("webservice"))
+}
+
+func TestConvertTemplateJSON2Object(t *testing.T) {
+	capability, err := ConvertTemplateJSON2Object("webservice", nil, &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}})
+	assert.NoError(t, err)
+	assert.Equal(t, types.Capability{Name: "webservice", CueTemplate: "output: {}"}, capability)
+
+	capability, err = ConvertTemplateJSON2Object("podinfo", nil, &v1alpha2.Schematic{HELM: &v1alpha2.Helm{
+		Release:    runtime.RawExtension{Raw: []byte(`{"chart":{"spec":{"chart":"podinfo","version":"5.1.4"}},"values":{"replicaCount":2}}`)},
+		Repository: runtime.RawExtension{Raw: []byte(`{"url":"http://oam.dev/catalog/"}`)},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, types.Capability{Name: "podinfo", Helm: &types.Chart{
+		URL:     "http://oam.dev/catalog/",
+		Name:    "podinfo",
+		Version: "5.1.4",
+		Values:  map[string]interface{}{"replicaCount": float64(2)},
+	}}, capability)
+}
+
+func TestConvertTemplateJSON2ObjectMalformedExtension(t *testing.T) {
+	testCases := map[string]struct {
+		raw    string
+		errMsg string
+	}{
+		"syntax error":   {raw: `{"template": "output: {}",}`, errMsg: "invalid JSON at offset 27"},
+		"type mismatch":  {raw: `{"appliesTo": "webservice"}`, errMsg: "invalid value at offset 26"},
+		"not an object":  {raw: `["template"]`, errMsg: "extension is not a JSON object"},
+		"null":           {raw: ` null `},
+		"trailing data":  {raw: `{"template": "output: {}"} {}`, errMsg: "unexpected data after the extension object"},
+		"truncated":      {raw: `{"template": "out`, errMsg: "invalid extension: unexpected EOF"},
+		"too large":      {raw: `{"description": "` + strings.Repeat("a", MaxExtensionSize) + `"}`, errMsg: "exceeds the limit"},
+		"unknown fields": {raw: `{"template": "output: {}", "unknown": true}`},
+	}
+	for name, tc := range testCases {
+		_, err := ConvertTemplateJSON2Object("webservice", &runtime.RawExtension{Raw: []byte(tc.raw)}, nil)
+		if tc.errMsg == "" {
+			assert.NoError(t, err, name)
+			continue
+		}
+		assert.Error(t, err, name)
+		assert.Contains(t, err.Error(), "parse extension of capability webservice: ", name)
+		assert.Contains(t, err.Error(), tc.errMsg, name)
+	}
+
+	_, err := ConvertTemplateJSON2Object("webservice", &runtime.RawExtension{Raw: []byte(`{"template": "output: {}", "unknown": true}`)}, nil,
+		DisallowUnknownExtensionFields())
+	assert.EqualError(t, err, `parse extension of capability webservice: invalid extension: json: unknown field "unknown"`)
+}
+
+// TestConvertTemplateJSON2ObjectFuzz feeds randomly mutated extensions, the conversion must never panic and
+// must either succeed or return an error naming the capability.
+func TestConvertTemplateJSON2ObjectFuzz(t *testing.T) {
+	seeds := []string{
+		`{"template": "output: {}", "appliesTo": ["webservice"], "parameters": [{"name": "image", "required": true}]}`,
+		`{"name": "scaler", "type": "trait", "install": {"helm": {"repo": "oam", "name": "podinfo"}}, "crdInfo": {"apiVersion": "v1"}}`,
+		`{"source": {"repoName": "center"}, "status": "installed", "description": "\u00e9\ud83d"}`,
+	}
+	tokens := []string{`{`, `}`, `[`, `]`, `"`, `:`, `,`, `\`, `null`, `-1e999`, "\x00", `\ud800`}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		raw := []byte(seeds[r.Intn(len(seeds))])
+		for n := r.Intn(4) + 1; n > 0; n-- {
+			pos := r.Intn(len(raw) + 1)
+			switch r.Intn(3) {
+			case 0:
+				raw = append(raw[:pos:pos], append([]byte(tokens[r.Intn(len(tokens))]), raw[pos:]...)...)
+			case 1:
+				raw = raw[:pos]
+			default:
+				if pos < len(raw) {
+					raw[pos] = byte(r.Intn(256))
+				}
+			}
+		}
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					t.Fatalf("panic on extension %q: %v", raw, p)
+				}
+			}()
+			if _, err := ConvertTemplateJSON2Object("webservice", &runtime.RawExtension{Raw: raw}, nil); err != nil {
+				assert.Contains(t, err.Error(), "capability webservice", "extension %q", raw)
+			}
+		}()
+	}
+}
+
+func TestNewTemplateWithMultipleSchematics(t *testing.T) {
+	cueSchematic := &v1alpha2.CUE{Template: "output: {}"}
+	helmSchematic := &v1alpha2.Helm{Release: runtime.RawExtension{Raw: []byte(`{"chart":{"spec":{"chart":"podinfo"}}}`)}}
+
+	tmpl, err := NewTemplate(&v1alpha2.Schematic{CUE: cueSchematic}, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "output: {}", tmpl.TemplateStr)
+
+	tmpl, err = NewTemplate(&v1alpha2.Schematic{HELM: helmSchematic}, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, types.HelmCategory, tmpl.CapabilityCategory)
+
+	_, err = NewTemplate(&v1alpha2.Schematic{CUE: cueSchematic, HELM: helmSchematic}, nil, nil)
+	assert.EqualError(t, err, "only one schematic can be set, but got cue, helm")
+
+	tmpl, err = NewTemplateWithOptions(&v1alpha2.Schematic{CUE: cueSchematic, HELM: helmSchematic}, nil, nil, AllowMultipleSchematics())
+	assert.NoError(t, err)
+	assert.Equal(t, "output: {}", tmpl.TemplateStr, "CUE schematic should take precedence")
+	assert.Nil(t, tmpl.Helm)
+
+	kustomizeSchematic := &v1alpha2.Kustomize{Spec: runtime.RawExtension{Raw: []byte(`{"path":"./overlays/production"}`)}}
+	_, err = NewTemplate(&v1alpha2.Schematic{HELM: helmSchematic, KUSTOMIZE: kustomizeSchematic}, nil, nil)
+	assert.EqualError(t, err, "only one schematic can be set, but got helm, kustomize")
+
+	tmpl, err = NewTemplateWithOptions(&v1alpha2.Schematic{HELM: helmSchematic, KUSTOMIZE: kustomizeSchematic}, nil, nil, AllowMultipleSchematics())
+	assert.NoError(t, err)
+	assert.Equal(t, types.HelmCategory, tmpl.CapabilityCategory, "Helm schematic should take precedence")
+	assert.Nil(t, tmpl.Kustomize)
+}
+
+func TestLoadTemplates(t *testing.T) {
+	var gets int64
+	rv := "1"
+	cli := newCountingDefinitionClient(&gets, &rv)
+	dm := mock.NewMockDiscoveryMapper()
+
+	var keys []TemplateKey
+	for i := 0; i < 20; i++ {
+		keys = append(keys, TemplateKey{Name: fmt.Sprintf("component-%d", i), Kind: ComponentTemplateKind})
+	}
+	keys = append(keys, TemplateKey{Name: "unknown", Kind: TemplateKind(types.TypeWorkload)})
+	templates, errs := LoadTemplates(context.TODO(), cli, dm, keys)
+	assert.Len(t, templates, 20)
+	assert.Equal(t, "output: {}", templates[keys[0]].TemplateStr)
+	assert.Len(t, errs, 1)
+	assert.Error(t, errs[TemplateKey{Name: "unknown", Kind: TemplateKind(types.TypeWorkload)}])
+
+	// the WorkloadDefinition fallback is kept per key
+	wdClient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			switch o := obj.(type) {
+			case *v1alpha2.ComponentDefinition:
+				return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: "componentdefinitions"}, key.Name)
+			case *v1alpha2.WorkloadDefinition:
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: " + key.Name}}
+			}
+			return nil
+		},
+	}
+	templates, errs = LoadTemplates(context.TODO(), &wdClient, dm, keys[:2])
+	assert.Empty(t, errs)
+	assert.Equal(t, "output: component-1", templates[keys[1]].TemplateStr)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	templates, errs = LoadTemplates(ctx, cli, dm, keys)
+	assert.Empty(t, templates)
+	assert.Len(t, errs, len(keys))
+
+	defer func(concurrency int) { LoadTemplatesConcurrency = concurrency }(LoadTemplatesConcurrency)
+	for _, concurrency := range []int{0, -1} {
+		LoadTemplatesConcurrency = concurrency
+		templates, errs = LoadTemplates(context.TODO(), cli, dm, keys[:3])
+		assert.Len(t, templates, 3, "concurrency %d should be taken as 1", concurrency)
+		assert.Empty(t, errs)
+	}
+}
+
+func TestCapabilityCategoryFromAnnotations(t *testing.T) {
+	testCases := map[string]struct {
+		annotations map[string]string
+		exp         types.CapabilityCategory
+	}{
+		"no annotations":    {exp: ""},
+		"empty annotation":  {annotations: map[string]string{"type": ""}, exp: ""},
+		"cue":               {annotations: map[string]string{"type": "cue"}, exp: types.CUECategory},
+		"helm":              {annotations: map[string]string{"type": "helm"}, exp: types.HelmCategory},
+		"terraform":         {annotations: map[string]string{"type": "terraform"}, exp: types.TerraformCategory},
+		"mixed case":        {annotations: map[string]string{"type": "Terraform"}, exp: types.TerraformCategory},
+		"with whitespace":   {annotations: map[string]string{"type": " terraform\n"}, exp: types.TerraformCategory},
+		"misspelled":        {annotations: map[string]string{"type": "terrafrom"}, exp: ""},
+		"other annotations": {annotations: map[string]string{"definition.oam.dev/description": "terraform"}, exp: ""},
+	}
+	for reason, casei := range testCases {
+		assert.Equal(t, casei.exp, CapabilityCategoryFromAnnotations(casei.annotations), reason)
+	}
+}
+
+func TestEvaluateHealth(t *testing.T) {
+	templateContext := map[string]interface{}{
+		"output": map[string]interface{}{
+			"status": map[string]interface{}{
+				"readyReplicas": 4,
+				"replicas":      5,
+			},
+		},
+	}
+	testCases := map[string]struct {
+		health string
+		exp    bool
+	}{
+		"no health policy": {health: "", exp: true},
+		"healthy":          {health: "isHealth: context.output.status.readyReplicas > 0", exp: true},
+		"unhealthy":        {health: "isHealth: context.output.status.readyReplicas == context.output.status.replicas", exp: false},
+	}
+	for reason, casei := range testCases {
+		tmpl := &Template{Health: casei.health}
+		healthy, err := tmpl.EvaluateHealth(context.TODO(), templateContext)
+		assert.NoError(t, err, reason)
+		assert.Equal(t, casei.exp, healthy, reason)
+	}
+
+	tmpl := &Template{Health: "isHealth: context.output.status.notExist"}
+	_, err := tmpl.EvaluateHealth(context.TODO(), templateContext)
+	assert.Error(t, err)
+}
+
+func TestRenderCustomStatus(t *testing.T) {
+	templateContext := map[string]interface{}{
+		"outputs": map[string]interface{}{
+			"service": map[string]interface{}{
+				"spec": map[string]interface{}{"clusterIP": "10.0.0.1"},
+			},
+		},
+	}
+	tmpl := &Template{Name: "webservice"}
+	message, err := tmpl.RenderCustomStatus(context.TODO(), templateContext)
+	assert.NoError(t, err)
+	assert.Equal(t, "", message)
+
+	tmpl.CustomStatus = `message: "clusterIP: " + context.outputs.service.spec.clusterIP`
+	message, err = tmpl.RenderCustomStatus(context.TODO(), templateContext)
+	assert.NoError(t, err)
+	assert.Equal(t, "clusterIP: 10.0.0.1", message)
+
+	tmpl.CustomStatus = `message: "type: " + context.outputs.service.spec.type`
+	_, err = tmpl.RenderCustomStatus(context.TODO(), templateContext)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "capability webservice: evaluate customStatus.message")
+}
+
+func TestTemplateKind(t *testing.T) {
+	for _, kind := range []string{"componentDefinition", "trait", "scope"} {
+		k, err := ParseTemplateKind(kind)
+		assert.NoError(t, err, kind)
+		assert.Equal(t, kind, k.String())
+	}
+	_, err := ParseTemplateKind("workload")
+	assert.EqualError(t, err, `unsupported template kind "workload"`)
+
+	// unsupported kind is rejected before reading any definition
+	var gets int64
+	rv := "1"
+	_, err = LoadTemplateOfKind(context.TODO(), newCountingDefinitionClient(&gets, &rv), mock.NewMockDiscoveryMapper(), "worker", TemplateKind("workload"))
+	assert.Error(t, err)
+	assert.Equal(t, int64(0), gets)
+	_, err = LoadTemplate(context.TODO(), newCountingDefinitionClient(&gets, &rv), "worker", types.TypeWorkload)
+	assert.EqualError(t, err, `unsupported template kind "workload"`)
+	assert.Equal(t, int64(0), gets)
+}
+
+func TestTemplateParseError(t *testing.T) {
+	invalid := "output: {\n\tmetadata: name: parameter.name\n}\n"
+	_, err := NewTemplateWithOptions(&v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: invalid}}, nil, nil, WithCUEValidation())
+	parseErr, ok := err.(*TemplateParseError)
+	assert.True(t, ok, "should be a *TemplateParseError")
+	assert.Equal(t, "", parseErr.Key)
+	assert.Equal(t, 1, len(parseErr.Errors))
+	assert.Equal(t, 2, parseErr.Errors[0].Line)
+	assert.Equal(t, 18, parseErr.Errors[0].Column)
+	assert.Contains(t, parseErr.Errors[0].Message, "parameter")
+	assert.Equal(t, "2 | \tmetadata: name: parameter.name\n  | \t                ^", parseErr.Errors[0].Snippet)
+
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			if o, ok := obj.(*v1alpha2.TraitDefinition); ok {
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: invalid}}
+			}
+			return nil
+		},
+	}
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, mock.NewMockDiscoveryMapper(), "scaler", TraitTemplateKind)
+	assert.NoError(t, err, "validation is opt-in")
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, mock.NewMockDiscoveryMapper(), "scaler", TraitTemplateKind, LoadWithCUEValidation())
+	parseErr, ok = errors.Cause(err).(*TemplateParseError)
+	assert.True(t, ok, "should be a *TemplateParseError")
+	assert.Equal(t, "scaler", parseErr.Key)
+	assert.Equal(t, 2, parseErr.Errors[0].Line)
+}
+
+func TestParameterDefaults(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		exp      map[string]interface{}
+		hasError bool
+	}{
+		"no parameter": {
+			template: `output: {}`,
+			exp:      map[string]interface{}{},
+		},
+		"defaults": {
+			template: `
+parameter: {
+	image:    string
+	replicas: *1 | int
+	port:     *"http" | "https"
+	env: {
+		debug: *false | bool
+		name:  string
+	}
+	labels: [string]: string
+}
+output: {}`,
+			exp: map[string]interface{}{
+				"replicas": float64(1),
+				"port":     "http",
+				"env":      map[string]interface{}{"debug": false},
+			},
+		},
+		"invalid template": {
+			template: `parameter: {`,
+			hasError: true,
+		},
+	}
+	for name, tc := range testCases {
+		tmpl := &Template{Name: "worker", TemplateStr: tc.template}
+		defaults, err := tmpl.ParameterDefaults()
+		if tc.hasError {
+			assert.Error(t, err, name)
+			continue
+		}
+		assert.NoError(t, err, name)
+		assert.Equal(t, tc.exp, defaults, name)
+	}
+}
+
+func TestDefaultedFields(t *testing.T) {
+	tmpl := &Template{Name: "worker", TemplateStr: `
+parameter: {
+	image:    string
+	replicas: *1 | int
+	env: {
+		debug: *false | bool
+		name:  string
+	}
+}
+output: {}`}
+	fields, err := tmpl.DefaultedFields()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"env.debug", "replicas"}, fields)
+
+	fields, err = (&Template{Name: "worker", TemplateStr: `output: {}`}).DefaultedFields()
+	assert.NoError(t, err)
+	assert.Empty(t, fields)
+
+	_, err = (&Template{Name: "worker", TemplateStr: `parameter: {`}).DefaultedFields()
+	assert.Error(t, err)
+}
+
+func TestParameterlessTemplate(t *testing.T) {
+	// a trait rendering fixed resources
+	tmpl := &Template{Name: "managed", TemplateStr: `
+patch: metadata: annotations: "oam.dev/managed": "true"
+outputs: configmap: {
+	kind: "ConfigMap"
+	metadata: name: context.name + "-managed"
+}
+`}
+	assert.False(t, tmpl.HasParameters())
+	assert.NoError(t, ValidateParameters(tmpl, map[string]interface{}{}))
+	assert.NoError(t, ValidateParameters(tmpl, nil))
+	defaults, err := tmpl.ParameterDefaults()
+	assert.NoError(t, err)
+	assert.Empty(t, defaults)
+
+	tmpl.TemplateStr += "parameter: {}\n"
+	assert.False(t, tmpl.HasParameters())
+	assert.NoError(t, ValidateParameters(tmpl, map[string]interface{}{}))
+
+	tmpl.TemplateStr += "parameter: replicas: *1 | int\n"
+	assert.True(t, tmpl.HasParameters())
+	assert.False(t, (&Template{}).HasParameters())
+	assert.False(t, (&Template{TemplateStr: "parameter: {"}).HasParameters())
+}
+
+func TestValidateParameters(t *testing.T) {
+	tmpl := &Template{TemplateStr: `
+parameter: {
+	image:    string
+	replicas: *1 | int & >0
+	env: {
+		name: string
+	}
+	cmd?: [...string]
+}
+output: {}`}
+	assert.NoError(t, ValidateParameters(tmpl, map[string]interface{}{
+		"image": "nginx",
+		"env":   map[string]interface{}{"name": "prod"},
+		"cmd":   []interface{}{"sleep", "1000"},
+		"extra": true,
+	}))
+
+	err := ValidateParameters(tmpl, map[string]interface{}{
+		"replicas": "3",
+		"env":      map[string]interface{}{"name": "prod"},
+	})
+	validationErr, ok := err.(*ParameterValidationError)
+	assert.True(t, ok, "should be a *ParameterValidationError")
+	assert.Equal(t, []ParameterError{
+		{Path: "image", Message: "missing required value (string)"},
+		{Path: "replicas", Message: `conflicting values (*1 | int & >0) and "3" (mismatched types int and string)`},
+	}, validationErr.Errors)
+	assert.EqualError(t, err, `invalid parameters: image: missing required value (string); `+
+		`replicas: conflicting values (*1 | int & >0) and "3" (mismatched types int and string)`)
+
+	tmpl.Name = "webservice"
+	err = ValidateParameters(tmpl, map[string]interface{}{"image": "nginx", "env": map[string]interface{}{}, "cmd": []interface{}{1}})
+	assert.Contains(t, err.Error(), "capability webservice")
+	validationErr, ok = errors.Cause(err).(*ParameterValidationError)
+	assert.True(t, ok, "should be a *ParameterValidationError")
+	assert.Equal(t, []ParameterError{
+		{Path: "cmd.0", Message: "conflicting values string and 1 (mismatched types string and int)"},
+		{Path: "env.name", Message: "missing required value (string)"},
+	}, validationErr.Errors)
+
+	assert.NoError(t, ValidateParameters(&Template{TemplateStr: "output: {}"}, nil), "no parameter to validate")
+	assert.NoError(t, ValidateParameters(&Template{}, nil))
+	assert.Error(t, ValidateParameters(&Template{TemplateStr: "parameter: {"}, nil))
+}
+
+func TestDefinitionExists(t *testing.T) {
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			switch obj.(type) {
+			case *v1alpha2.ComponentDefinition:
+				if key.Name == "webservice" {
+					return nil
+				}
+				return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: "componentdefinitions"}, key.Name)
+			case *v1alpha2.WorkloadDefinition:
+				if key.Name == "worker" {
+					return nil
+				}
+				return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: "workloaddefinitions"}, key.Name)
+			case *v1alpha2.TraitDefinition:
+				if key.Name == "error" {
+					return errors.New("connection refused")
+				}
+				return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: "traitdefinitions"}, key.Name)
+			}
+			return nil
+		},
+		MockList: test.NewMockListFn(nil),
+	}
+	testCases := map[string]struct {
+		kind     TemplateKind
+		key      string
+		exists   bool
+		hasError bool
+	}{
+		"component":           {kind: ComponentTemplateKind, key: "webservice", exists: true},
+		"workload fallback":   {kind: ComponentTemplateKind, key: "worker", exists: true},
+		"component not found": {kind: ComponentTemplateKind, key: "not-exist"},
+		"trait not found":     {kind: TraitTemplateKind, key: "scaler"},
+		"trait read error":    {kind: TraitTemplateKind, key: "error", hasError: true},
+		"unsupported kind":    {kind: TemplateKind("Unknown"), key: "webservice", hasError: true},
+	}
+	for name, tc := range testCases {
+		exists, err := DefinitionExists(context.TODO(), &tclient, tc.kind, tc.key)
+		assert.Equal(t, tc.hasError, err != nil, name)
+		assert.Equal(t, tc.exists, exists, name)
+	}
+}
+
+func TestHelmChartPinned(t *testing.T) {
+	helmWithVersion := func(version string) *v1alpha2.Helm {
+		return &v1alpha2.Helm{Release: runtime.RawExtension{Raw: []byte(
+			fmt.Sprintf(`{"chart":{"spec":{"chart":"podinfo","version":%q}}}`, version))}}
+	}
+	testCases := map[string]struct {
+		helm   *v1alpha2.Helm
+		pinned bool
+	}{
+		"no helm":       {},
+		"no version":    {helm: &v1alpha2.Helm{Release: runtime.RawExtension{Raw: []byte(`{"chart":{"spec":{"chart":"podinfo"}}}`)}}},
+		"exact version": {helm: helmWithVersion("5.1.4"), pinned: true},
+		"pre-release":   {helm: helmWithVersion("v1.0.0-rc.1+build.2"), pinned: true},
+		"wildcard":      {helm: helmWithVersion("5.1.x")},
+		"range":         {helm: helmWithVersion(">=5.0.0")},
+		"any":           {helm: helmWithVersion("*")},
+		"invalid helm":  {helm: &v1alpha2.Helm{Release: runtime.RawExtension{Raw: []byte(`{`)}}},
+	}
+	for name, tc := range testCases {
+		tmpl := &Template{Helm: tc.helm}
+		assert.Equal(t, tc.pinned, tmpl.HelmChartPinned(), name)
+	}
+}
+
+func TestNewTemplatePartialOnError(t *testing.T) {
+	status := &v1alpha2.Status{HealthPolicy: "isHealth: true", CustomStatus: "message: \"ok\""}
+
+	invalidCUE := &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {"}}
+	tmp, err := NewTemplateWithOptions(invalidCUE, status, nil, WithCUEValidation())
+	assert.Error(t, err)
+	assert.NotNil(t, tmp, "partial template should be returned with the error")
+	assert.Equal(t, "output: {", tmp.TemplateStr)
+	assert.Equal(t, status.HealthPolicy, tmp.Health)
+	assert.Equal(t, status.CustomStatus, tmp.CustomStatus)
+
+	invalidHelm := &v1alpha2.Schematic{HELM: &v1alpha2.Helm{Release: runtime.RawExtension{Raw: []byte(`{"values":"image"}`)}}}
+	tmp, err = NewTemplate(invalidHelm, status, nil)
+	assert.NoError(t, err, "malformed values are left to be validated when the release is applied")
+	assert.Nil(t, tmp.HelmValues)
+	assert.Equal(t, types.HelmCategory, tmp.CapabilityCategory)
+	assert.Equal(t, status.HealthPolicy, tmp.Health)
+
+	multiple := &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}, HELM: invalidHelm.HELM}
+	tmp, err = NewTemplate(multiple, status, nil)
+	assert.Error(t, err)
+	assert.NotNil(t, tmp, "partial template should be returned with the error")
+	assert.Equal(t, status.CustomStatus, tmp.CustomStatus)
+
+	tmp, err = NewTemplate(nil, status, &runtime.RawExtension{Raw: []byte(`{`)})
+	assert.Error(t, err)
+	assert.NotNil(t, tmp, "partial template should be returned with the error")
+	assert.Equal(t, status.HealthPolicy, tmp.Health)
+}
+
+func TestListTemplates(t *testing.T) {
+	cueSchematic := &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}}
+	terraform := map[string]string{"catalog": "terraform"}
+	newCD := func(namespace, name string, labels map[string]string, schematic *v1alpha2.Schematic) v1alpha2.ComponentDefinition {
+		cd := v1alpha2.ComponentDefinition{}
+		cd.Namespace, cd.Name, cd.Labels = namespace, name, labels
+		cd.Spec.Schematic = schematic
+		return cd
+	}
+	definitions := map[string][]v1alpha2.ComponentDefinition{
+		"default": {
+			newCD("default", "webservice", terraform, cueSchematic),
+		},
+		oam.SystemDefinitonNamespace: {
+			newCD(oam.SystemDefinitonNamespace, "webservice", terraform, &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: kind: \"shadowed\""}}),
+			newCD(oam.SystemDefinitonNamespace, "empty", terraform, nil),
+			newCD(oam.SystemDefinitonNamespace, "broken", terraform, &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"},
+				HELM: &v1alpha2.Helm{}}),
+			newCD(oam.SystemDefinitonNamespace, "other", nil, cueSchematic),
+		},
+	}
+	tclient := test.MockClient{
+		MockList: func(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+			listOpts := &client.ListOptions{}
+			for _, opt := range opts {
+				opt.ApplyToList(listOpts)
+			}
+			switch l := list.(type) {
+			case *v1alpha2.ComponentDefinitionList:
+				l.Items = nil
+				for _, cd := range definitions[listOpts.Namespace] {
+					if listOpts.LabelSelector.Matches(labels.Set(cd.Labels)) {
+						l.Items = append(l.Items, cd)
+					}
+				}
+			case *v1alpha2.WorkloadDefinitionList:
+				wd := v1alpha2.WorkloadDefinition{}
+				wd.Namespace, wd.Name, wd.Labels = listOpts.Namespace, "worker", terraform
+				wd.Spec.Reference = v1alpha2.DefinitionReference{Name: "deployments.apps"}
+				wd.Spec.Schematic = cueSchematic
+				l.Items = []v1alpha2.WorkloadDefinition{wd}
+			}
+			return nil
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	dm.MockKindsFor = mock.NewMockKindsFor("Deployment", "v1")
+
+	ctx := SetNamespaceInCtx(context.TODO(), "default")
+	templates, err := ListTemplates(ctx, &tclient, dm, ComponentTemplateKind, labels.SelectorFromSet(terraform))
+	assert.Error(t, err, "the error of the broken definition should be returned")
+	assert.Contains(t, err.Error(), "LoadTemplate [broken]")
+	var names []string
+	for _, tmpl := range templates {
+		names = append(names, tmpl.Name)
+	}
+	assert.Equal(t, []string{"webservice", "worker"}, names)
+	assert.Equal(t, "output: {}", templates[0].TemplateStr, "definitions in the namespace of application should shadow the system ones")
+	assert.Equal(t, v1alpha2.WorkloadGVK{APIVersion: "apps/v1", Kind: "Deployment"}, templates[1].Reference)
+
+	_, err = ListTemplates(ctx, &tclient, dm, TemplateKind("Unknown"), labels.Everything())
+	assert.Error(t, err)
+}
+
+func TestNewTemplateWithCUERuntime(t *testing.T) {
+	valid := &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: `output: metadata: name: context.name`}}
+	invalid := &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: `output: {`}}
+
+	r := &cue.Runtime{}
+	for i := 0; i < 2; i++ {
+		_, err := NewTemplateWithOptions(valid, nil, nil, WithCUEValidation(), WithCUERuntime(r))
+		assert.NoError(t, err, "a shared runtime should be reusable")
+	}
+	_, err := NewTemplateWithOptions(invalid, nil, nil, WithCUEValidation(), WithCUERuntime(r))
+	parseErr, ok := err.(*TemplateParseError)
+	assert.True(t, ok, "should return a TemplateParseError")
+	if ok {
+		assert.Equal(t, 1, parseErr.Errors[0].Line)
+	}
+
+	_, err = NewTemplateWithOptions(valid, nil, nil, WithCUEValidation(), WithCUERuntime(nil))
+	assert.NoError(t, err, "nil runtime should fall back to the default")
+}
+
+func TestValidateTemplate(t *testing.T) {
+	testCases := map[string]struct {
+		tmpl   *Template
+		errMsg string
+	}{
+		"empty": {
+			tmpl: &Template{},
+		},
+		"valid": {
+			tmpl: &Template{
+				TemplateStr:  "output: metadata: name: context.name",
+				Health:       "isHealth: context.output.status.readyReplicas == context.output.status.replicas",
+				CustomStatus: "message: \"ready replicas: \\(context.output.status.readyReplicas)\"",
+			},
+		},
+		"invalid template": {
+			tmpl:   &Template{Name: "worker", TemplateStr: "output: {"},
+			errMsg: "capability worker: invalid CUE template",
+		},
+		"invalid health policy": {
+			tmpl:   &Template{Health: "isHealth: context.output.status.ready ==="},
+			errMsg: "invalid health policy: invalid CUE template: line 1",
+		},
+		"health policy without isHealth": {
+			tmpl:   &Template{Health: "healthy: true"},
+			errMsg: "invalid health policy: isHealth is not defined",
+		},
+		"invalid custom status": {
+			tmpl:   &Template{CustomStatus: "message: \"ready"},
+			errMsg: "invalid custom status: invalid CUE template: line 1",
+		},
+		"custom status without message": {
+			tmpl:   &Template{CustomStatus: "msg: \"ready\""},
+			errMsg: "invalid custom status: message is not defined",
+		},
+	}
+	for name, tc := range testCases {
+		err := ValidateTemplate(tc.tmpl)
+		if tc.errMsg == "" {
+			assert.NoError(t, err, name)
+			continue
+		}
+		if assert.Error(t, err, name) {
+			assert.Contains(t, err.Error(), tc.errMsg, name)
+		}
+	}
+}
+
+func TestLoadTemplateRequireNonEmpty(t *testing.T) {
+	definitions := map[string]*v1alpha2.TraitDefinitionSpec{
+		"scaler":  {Schematic: &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "patch: spec: replicas: 1"}}},
+		"chart":   {Schematic: &v1alpha2.Schematic{HELM: &v1alpha2.Helm{Release: runtime.RawExtension{Raw: []byte(`{"chart":{"spec":{"chart":"podinfo"}}}`)}}}},
+		"overlay": {Schematic: &v1alpha2.Schematic{KUSTOMIZE: &v1alpha2.Kustomize{Spec: runtime.RawExtension{Raw: []byte(`{"path":"./overlays/production"}`)}}}},
+		"no-op":   {Extension: &runtime.RawExtension{Raw: []byte(`{"install":{"helm":{}}}`)}},
+		"no-spec": {},
+	}
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			if o, ok := obj.(*v1alpha2.TraitDefinition); ok {
+				o.Spec = *definitions[key.Name]
+			}
+			return nil
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	for name := range definitions {
+		_, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, name, TraitTemplateKind)
+		assert.NoError(t, err, "%s: empty templates are allowed by default", name)
+	}
+	for _, name := range []string{"scaler", "chart", "overlay"} {
+		_, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, name, TraitTemplateKind, RequireNonEmptyTemplate())
+		assert.NoError(t, err, name)
+	}
+	for _, name := range []string{"no-op", "no-spec"} {
+		_, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, name, TraitTemplateKind, RequireNonEmptyTemplate())
+		assert.EqualError(t, err, "LoadTemplate ["+name+"] : no template found in definition", name)
+	}
+}
+
+func TestLoadTemplateFromNamespaces(t *testing.T) {
+	definitions := map[string]string{
+		"tenant-a/webservice":    "output: kind: \"TenantDeployment\"",
+		"vela-system/webservice": "output: kind: \"Deployment\"",
+		"vela-system/worker":     "output: kind: \"Worker\"",
+	}
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			switch o := obj.(type) {
+			case *v1alpha2.ComponentDefinition:
+				template, ok := definitions[key.Namespace+"/"+key.Name]
+				if !ok {
+					return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: "componentdefinitions"}, key.Name)
+				}
+				o.Name, o.Namespace = key.Name, key.Namespace
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: template}}
+			case *v1alpha2.WorkloadDefinition:
+				return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: "workloaddefinitions"}, key.Name)
+			}
+			return nil
+		},
+		MockList: test.NewMockListFn(nil),
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	search := LoadFromNamespaces("tenant-a", oam.SystemDefinitonNamespace)
+
+	tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, "webservice", ComponentTemplateKind, search)
+	assert.NoError(t, err)
+	assert.Equal(t, "output: kind: \"TenantDeployment\"", tmpl.TemplateStr, "tenant definition should shadow the system one")
+	assert.Equal(t, "tenant-a", tmpl.Namespace)
+
+	tmpl, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "worker", ComponentTemplateKind, search)
+	assert.NoError(t, err)
+	assert.Equal(t, "output: kind: \"Worker\"", tmpl.TemplateStr)
+	assert.Equal(t, oam.SystemDefinitonNamespace, tmpl.Namespace)
+
+	tmpl, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "webservice", ComponentTemplateKind, LoadFromNamespaces(oam.SystemDefinitonNamespace))
+	assert.NoError(t, err)
+	assert.Equal(t, "output: kind: \"Deployment\"", tmpl.TemplateStr)
+
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "worker", ComponentTemplateKind, LoadFromNamespaces("tenant-a"))
+	assert.True(t, kerrors.IsNotFound(errors.Cause(err)))
+}
+
+func TestTemplateHash(t *testing.T) {
+	newTemplate := func() *Template {
+		return &Template{
+			Name:               "webservice",
+			TemplateStr:        "output: {}",
+			Health:             "isHealth: true",
+			CustomStatus:       "message: \"ok\"",
+			CapabilityCategory: types.CUECategory,
+			Reference:          v1alpha2.WorkloadGVK{APIVersion: "apps/v1", Kind: "Deployment"},
+			Helm:               &v1alpha2.Helm{Release: runtime.RawExtension{Raw: []byte(`{"chart":{"spec":{"chart":"podinfo","version":"5.1.4"}}}`)}},
+			Terraform:          &TerraformConfiguration{ModuleSources: map[string]string{"rds": "rds", "s3": "s3"}},
+			Imports:            map[string]map[string]string{"vela.dev/lib": {"a.cue": "package lib", "b.cue": "package lib"}},
+		}
+	}
+	hash := newTemplate().Hash()
+	assert.Equal(t, hash, newTemplate().Hash(), "hash should be deterministic")
+	// the hash is stored in status, it must not change across runs and versions
+	assert.Equal(t, "7f95f87c88b9f587b6", hash)
+
+	tmpl := newTemplate()
+	tmpl.Name = "worker"
+	tmpl.HelmValues = map[string]interface{}{"image": "nginx"}
+	assert.Equal(t, hash, tmpl.Hash(), "name and helm values derived from release should not change the hash")
+
+	changes := map[string]func(tmpl *Template){
+		"template":      func(tmpl *Template) { tmpl.TemplateStr = "output: kind: \"Deployment\"" },
+		"health":        func(tmpl *Template) { tmpl.Health = "isHealth: false" },
+		"custom status": func(tmpl *Template) { tmpl.CustomStatus = "message: \"ready\"" },
+		"category":      func(tmpl *Template) { tmpl.CapabilityCategory = types.TerraformCategory },
+		"reference":     func(tmpl *Template) { tmpl.Reference.Kind = "StatefulSet" },
+		"helm": func(tmpl *Template) {
+			tmpl.Helm.Release.Raw = []byte(`{"chart":{"spec":{"chart":"podinfo","version":"5.1.5"}}}`)
+		},
+		"terraform": func(tmpl *Template) { tmpl.Terraform.Outputs = []string{"endpoint"} },
+		"terraform backend": func(tmpl *Template) {
+			tmpl.Terraform.Backend = &TerraformBackend{Type: "s3", Config: map[string]interface{}{"bucket": "state"}}
+		},
+		"imports": func(tmpl *Template) { tmpl.Imports["vela.dev/lib"]["a.cue"] = "package lib\nx: 1" },
+		"kustomize": func(tmpl *Template) {
+			tmpl.Kustomize = &v1alpha2.Kustomize{Spec: runtime.RawExtension{Raw: []byte(`{"path":"./overlays/production"}`)}}
+		},
+	}
+	for name, change := range changes {
+		tmpl := newTemplate()
+		change(tmpl)
+		assert.NotEqual(t, hash, tmpl.Hash(), name)
+	}
+}
+
+func TestTemplateClassification(t *testing.T) {
+	helm := &v1alpha2.Helm{Release: runtime.RawExtension{Raw: []byte(`{"chart":{"spec":{"chart":"podinfo"}}}`)}}
+	kustomize := &v1alpha2.Kustomize{Spec: runtime.RawExtension{Raw: []byte(`{"path":"./overlays/production"}`)}}
+	terraform := &TerraformConfiguration{ModuleSources: map[string]string{"rds": "terraform-aws-modules/rds/aws"}}
+	testCases := map[string]struct {
+		tmpl                                    *Template
+		isCUE, isHelm, isKustomize, isTerraform bool
+	}{
+		"empty":                  {tmpl: &Template{}},
+		"only status":            {tmpl: &Template{Health: "isHealth: true"}},
+		"cue":                    {tmpl: &Template{TemplateStr: "output: {}", CapabilityCategory: types.CUECategory}, isCUE: true},
+		"cue without category":   {tmpl: &Template{TemplateStr: "output: {}"}, isCUE: true},
+		"helm":                   {tmpl: &Template{Helm: helm, CapabilityCategory: types.HelmCategory}, isHelm: true},
+		"helm with template":     {tmpl: &Template{TemplateStr: "output: {}", Helm: helm}, isHelm: true},
+		"kustomize":              {tmpl: &Template{Kustomize: kustomize, CapabilityCategory: types.KustomizeCategory}, isKustomize: true},
+		"terraform":              {tmpl: &Template{TemplateStr: "output: {}", CapabilityCategory: types.TerraformCategory, Terraform: terraform}, isTerraform: true},
+		"terraform not parsed":   {tmpl: &Template{TemplateStr: "output: {}", CapabilityCategory: types.TerraformCategory}, isCUE: true},
+		"terraform without type": {tmpl: &Template{TemplateStr: "output: {}", Terraform: terraform}, isCUE: true},
+	}
+	for name, tc := range testCases {
+		assert.Equal(t, tc.isCUE, tc.tmpl.IsCUE(), name)
+		assert.Equal(t, tc.isHelm, tc.tmpl.IsHelm(), name)
+		assert.Equal(t, tc.isKustomize, tc.tmpl.IsKustomize(), name)
+		assert.Equal(t, tc.isTerraform, tc.tmpl.IsTerraform(), name)
+	}
+}
+
+// recordingLogger records the messages and key/values logged at any level
+type recordingLogger struct {
+	ctrllog.NullLogger
+	entries *[]string
+}
+
+func (l recordingLogger) Enabled() bool {
+	return true
+}
+
+func (l recordingLogger) Info(msg string, keysAndValues ...interface{}) {
+	*l.entries = append(*l.entries, strings.TrimSpace(fmt.Sprintln(append([]interface{}{msg}, keysAndValues...)...)))
+}
+
+func (l recordingLogger) V(int) logr.InfoLogger {
+	return l
+}
+
+func TestLoadTemplateWithLogger(t *testing.T) {
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			switch o := obj.(type) {
+			case *v1alpha2.ComponentDefinition:
+				return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: "componentdefinitions"}, key.Name)
+			case *v1alpha2.WorkloadDefinition:
+				o.Name, o.Namespace = key.Name, key.Namespace
+				o.Spec.Reference = v1alpha2.DefinitionReference{Name: "deployments.apps"}
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}}
+			}
+			return nil
+		},
+	}
+	var entries []string
+	_, err := LoadTemplateOfKind(context.TODO(), &tclient, mock.NewMockDiscoveryMapper(), "worker", ComponentTemplateKind,
+		LoadWithLogger(recordingLogger{entries: &entries}))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"Load template kind componentDefinition name worker",
+		"ComponentDefinition not found, fall back to WorkloadDefinition name worker",
+		"Loaded template name worker definition WorkloadDefinition namespace vela-system category",
+	}, entries)
+
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, mock.NewMockDiscoveryMapper(), "worker", ComponentTemplateKind)
+	assert.NoError(t, err, "logging is optional")
+}
+
+func TestWorkloadTypeName(t *testing.T) {
+	dm := mock.NewMockDiscoveryMapper()
+	dm.MockRESTMapping = mock.NewMockRESTMapping("deployments")
+	tmpl := &Template{Reference: v1alpha2.WorkloadGVK{APIVersion: "apps/v1", Kind: "Deployment"}}
+	name, err := tmpl.WorkloadTypeName(dm)
+	assert.NoError(t, err)
+	assert.Equal(t, "deployments.apps", name)
+
+	dm.MockRESTMapping = func(gk schema.GroupKind, versions ...string) (*meta.RESTMapping, error) {
+		return nil, &meta.NoKindMatchError{GroupKind: gk, SearchedVersions: versions}
+	}
+	tmpl.Name = "webservice"
+	_, err = tmpl.WorkloadTypeName(dm)
+	assert.True(t, meta.IsNoMatchError(errors.Cause(err)))
+	assert.Contains(t, err.Error(), "capability webservice")
+
+	helm := &Template{CapabilityCategory: types.HelmCategory, Helm: &v1alpha2.Helm{}}
+	_, err = helm.WorkloadTypeName(dm)
+	assert.Equal(t, ErrNoWorkloadType, err)
+	terraform := &Template{CapabilityCategory: types.TerraformCategory, Terraform: &TerraformConfiguration{}}
+	_, err = terraform.WorkloadTypeName(dm)
+	assert.Equal(t, ErrNoWorkloadType, err)
+}
+
+func TestLoadTraitTemplateAppliesToWorkloads(t *testing.T) {
+	appliesTo := map[string][]string{
+		"scaler":  {"deployments.apps"},
+		"sidecar": {"*"},
+		"ingress": {"webservice", "*.apps"},
+		"label":   nil,
+	}
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			if o, ok := obj.(*v1alpha2.TraitDefinition); ok {
+				o.Name = key.Name
+				o.Spec.AppliesToWorkloads = appliesTo[key.Name]
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "patch: {}"}}
+			}
+			return nil
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	templates := map[string]*Template{}
+	for name := range appliesTo {
+		tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, name, TraitTemplateKind)
+		assert.NoError(t, err)
+		assert.Equal(t, appliesTo[name], tmpl.AppliesToWorkloads, name)
+		templates[name] = tmpl
+	}
+
+	assert.True(t, templates["scaler"].AppliesTo("worker", "deployments.apps"))
+	assert.False(t, templates["scaler"].AppliesTo("task", "jobs.batch"))
+	assert.True(t, templates["sidecar"].AppliesTo("task", "jobs.batch"))
+	assert.True(t, templates["ingress"].AppliesTo("webservice", "services.serving.knative.dev"))
+	assert.True(t, templates["ingress"].AppliesTo("worker", "statefulsets.apps"))
+	assert.False(t, templates["ingress"].AppliesTo("task", "jobs.batch"))
+	assert.True(t, templates["label"].AppliesTo("task", "jobs.batch"))
+}
+
+func TestLoadTraitTemplateOrder(t *testing.T) {
+	orders := map[string]string{
+		"scaler":  "",
+		"sidecar": "-10",
+		"ingress": " 20 ",
+		"broken":  "first",
+	}
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			if o, ok := obj.(*v1alpha2.TraitDefinition); ok {
+				o.Name = key.Name
+				if order := orders[key.Name]; order != "" {
+					o.Annotations = map[string]string{AnnotationTraitOrder: order}
+				}
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "patch: {}"}}
+			}
+			return nil
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	var templates []*Template
+	for _, name := range []string{"scaler", "sidecar", "ingress"} {
+		tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, name, TraitTemplateKind)
+		assert.NoError(t, err)
+		templates = append(templates, tmpl)
+	}
+	assert.Equal(t, 0, templates[0].Order, "order should default to 0")
+	assert.Equal(t, -10, templates[1].Order)
+	assert.Equal(t, 20, templates[2].Order)
+
+	templates = append(templates, &Template{Name: "autoscaler"})
+	SortTraitTemplates(templates)
+	var names []string
+	for _, tmpl := range templates {
+		names = append(names, tmpl.Name)
+	}
+	assert.Equal(t, []string{"sidecar", "autoscaler", "scaler", "ingress"}, names)
+
+	_, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, "broken", TraitTemplateKind)
+	assert.Contains(t, err.Error(), "invalid annotation trait.oam.dev/order")
+}
+
+func TestTemplateCompatibleWith(t *testing.T) {
+	testCases := map[string]struct {
+		declared   string
+		provided   string
+		compatible bool
+	}{
+		"undeclared":          {declared: "", provided: "v1.0", compatible: true},
+		"same version":        {declared: "v1.2", provided: "v1.2", compatible: true},
+		"older minor":         {declared: "v1.1", provided: "v1.3", compatible: true},
+		"without v prefix":    {declared: "1.1", provided: "v1.1.5", compatible: true},
+		"newer minor":         {declared: "v1.3", provided: "v1.2", compatible: false},
+		"newer major":         {declared: "v2.0", provided: "v1.9", compatible: false},
+		"older major":         {declared: "v1.0", provided: "v2.0", compatible: false},
+		"invalid provided":    {declared: "v1.0", provided: "latest", compatible: false},
+		"invalid declaration": {declared: "v1", provided: "v1.0", compatible: false},
+	}
+	for name, tc := range testCases {
+		tmpl := &Template{TemplateAPIVersion: tc.declared}
+		assert.Equal(t, tc.compatible, tmpl.CompatibleWith(tc.provided), name)
+	}
+
+	versions := map[string]string{"scaler": "v1.0", "sidecar": "v9.0", "broken": "latest"}
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			if o, ok := obj.(*v1alpha2.TraitDefinition); ok {
+				o.Name = key.Name
+				o.Annotations = map[string]string{AnnotationTemplateAPIVersion: versions[key.Name]}
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "patch: {}"}}
+			}
+			return nil
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, "scaler", TraitTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.0", tmpl.TemplateAPIVersion)
+	assert.True(t, tmpl.CompatibleWith(TemplateContextVersion))
+	tmpl, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "sidecar", TraitTemplateKind)
+	assert.NoError(t, err)
+	assert.False(t, tmpl.CompatibleWith(TemplateContextVersion))
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "broken", TraitTemplateKind)
+	assert.Contains(t, err.Error(), "invalid annotation definition.oam.dev/template-api-version")
+}
+
+func TestRequiredTraits(t *testing.T) {
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			if o, ok := obj.(*v1alpha2.ComponentDefinition); ok {
+				o.Name = key.Name
+				o.Annotations = map[string]string{AnnotationRequiredTraits: "scaler, ingress"}
+				o.Spec.Workload.Definition = v1alpha2.WorkloadGVK{APIVersion: "apps/v1", Kind: "Deployment"}
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "output: {}"}}
+			}
+			return nil
+		},
+	}
+	tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, mock.NewMockDiscoveryMapper(), "webservice", ComponentTemplateKind)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"scaler", "ingress"}, tmpl.RequiredTraits)
+
+	assert.NoError(t, ValidateRequiredTraits(tmpl, []string{"ingress", "sidecar", "scaler"}))
+	assert.EqualError(t, ValidateRequiredTraits(tmpl, []string{"scaler"}), "capability webservice: missing required traits: ingress")
+	assert.EqualError(t, ValidateRequiredTraits(tmpl, nil), "capability webservice: missing required traits: scaler, ingress")
+	assert.NoError(t, ValidateRequiredTraits(&Template{}, nil))
+}
+
+func TestNilDiscoveryMapper(t *testing.T) {
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			switch o := obj.(type) {
+			case *v1alpha2.ComponentDefinition:
+				return kerrors.NewNotFound(schema.GroupResource{Group: v1alpha2.Group, Resource: "componentdefinitions"}, key.Name)
+			case *v1alpha2.WorkloadDefinition:
+				o.Spec.Reference = v1alpha2.DefinitionReference{Name: "deployments.apps"}
+			case *v1alpha2.ScopeDefinition:
+				o.Spec.Reference = v1alpha2.DefinitionReference{Name: "healthscopes.core.oam.dev"}
+			}
+			return nil
+		},
+	}
+
+	_, err := GetScopeGVK(context.TODO(), &tclient, nil, "healthscope")
+	assert.Equal(t, ErrNilDiscoveryMapper, errors.Cause(err))
+	assert.EqualError(t, err, "get GVK of ScopeDefinition healthscope: discovery mapper is nil, cannot resolve GVK")
+	_, err = GetComponentWorkloadGVK(context.TODO(), &tclient, nil, "worker")
+	assert.Equal(t, ErrNilDiscoveryMapper, errors.Cause(err))
+	_, err = GetGVKFromDefinition(nil, v1alpha2.DefinitionReference{Name: "deployments.apps"})
+	assert.Equal(t, ErrNilDiscoveryMapper, errors.Cause(err))
+	_, err = ConvertWorkloadGVK2Definition(nil, v1alpha2.WorkloadGVK{APIVersion: "apps/v1", Kind: "Deployment"})
+	assert.Equal(t, ErrNilDiscoveryMapper, errors.Cause(err))
+	tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, nil, "worker", ComponentTemplateKind)
+	assert.NoError(t, err, "the template of a WorkloadDefinition is loaded without its reference")
+	assert.Equal(t, v1alpha2.WorkloadGVK{}, tmpl.Reference)
+
+	gvk, err := GetGVKFromDefinition(nil, v1alpha2.DefinitionReference{})
+	assert.NoError(t, err, "empty references don't need the discovery mapper")
+	assert.Equal(t, schema.GroupVersionKind{}, gvk)
+}
@@ -0,0 +1,59 @@
+package util
+
+import (
+	"context"
+)
+
+// the attributes of the spans of loading templates
+const (
+	SpanAttributeKind    = "kubevela.template.kind"
+	SpanAttributeName    = "kubevela.template.name"
+	SpanAttributeOutcome = "kubevela.template.outcome"
+)
+
+// TemplateTracer starts the spans of loading templates. KubeVela doesn't depend on a tracing library, callers put an
+// adapter of their tracer into the context by WithTemplateTracer, e.g. one starting the spans by an OpenTelemetry
+// tracer, so that the template loads appear in the traces of reconciles.
+type TemplateTracer interface {
+	// Start starts a child span of the span in ctx, it returns the context carrying the new span
+	Start(ctx context.Context, spanName string) (context.Context, TemplateSpan)
+}
+
+// TemplateSpan is a span started by a TemplateTracer
+type TemplateSpan interface {
+	SetAttribute(key, value string)
+	// RecordError records the error the span ends with
+	RecordError(err error)
+	End()
+}
+
+type templateTracerKey struct{}
+
+// WithTemplateTracer returns a context carrying the tracer, LoadTemplate and GetScopeGVK start spans with it
+func WithTemplateTracer(ctx context.Context, tracer TemplateTracer) context.Context {
+	return context.WithValue(ctx, templateTracerKey{}, tracer)
+}
+
+// endSpanFunc ends the span of loading a template with the error it ends with
+type endSpanFunc func(err error)
+
+func endNoSpan(error) {}
+
+// startTemplateSpan starts a span of loading the template of the kind and name if there's a tracer in the context,
+// otherwise the context is returned as is with a no-op end function, so that loading isn't slowed down without tracing.
+func startTemplateSpan(ctx context.Context, spanName string, kind TemplateKind, name string) (context.Context, endSpanFunc) {
+	tracer, ok := ctx.Value(templateTracerKey{}).(TemplateTracer)
+	if !ok || tracer == nil {
+		return ctx, endNoSpan
+	}
+	ctx, span := tracer.Start(ctx, spanName)
+	span.SetAttribute(SpanAttributeKind, kind.String())
+	span.SetAttribute(SpanAttributeName, name)
+	return ctx, func(err error) {
+		span.SetAttribute(SpanAttributeOutcome, templateLoadOutcome(err))
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}
+}
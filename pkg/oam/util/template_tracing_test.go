@@ -0,0 +1,97 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ktypes "k8s.io/apimachinery/pkg/types"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+type recordingTracer struct {
+	spans []*recordingSpan
+}
+
+type recordingSpan struct {
+	name       string
+	parent     *recordingSpan
+	attributes map[string]string
+	err        error
+	ended      bool
+}
+
+type recordingSpanKey struct{}
+
+func (t *recordingTracer) Start(ctx context.Context, spanName string) (context.Context, TemplateSpan) {
+	parent, _ := ctx.Value(recordingSpanKey{}).(*recordingSpan)
+	span := &recordingSpan{name: spanName, parent: parent, attributes: map[string]string{}}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, recordingSpanKey{}, span), span
+}
+
+func (s *recordingSpan) SetAttribute(key, value string) { s.attributes[key] = value }
+func (s *recordingSpan) RecordError(err error)          { s.err = err }
+func (s *recordingSpan) End()                           { s.ended = true }
+
+func TestTemplateTracing(t *testing.T) {
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			if key.Name == "missing" {
+				return kerrors.NewNotFound(schema.GroupResource{}, key.Name)
+			}
+			switch o := obj.(type) {
+			case *v1alpha2.TraitDefinition:
+				o.Name = key.Name
+				o.Spec.Schematic = &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "patch: {}"}}
+			case *v1alpha2.ScopeDefinition:
+				o.Name = key.Name
+				o.Spec.Reference = v1alpha2.DefinitionReference{Name: "healthscopes.core.oam.dev"}
+			}
+			return nil
+		},
+		MockList: test.NewMockListFn(nil),
+	}
+	dm := mock.NewMockDiscoveryMapper()
+	tracer := &recordingTracer{}
+	root := &recordingSpan{name: "reconcile"}
+	ctx := WithTemplateTracer(context.WithValue(context.TODO(), recordingSpanKey{}, root), tracer)
+
+	_, err := LoadTemplateOfKind(ctx, &tclient, dm, "scaler", TraitTemplateKind)
+	assert.NoError(t, err)
+	_, err = LoadTemplateOfKind(ctx, &tclient, dm, "missing", TraitTemplateKind)
+	assert.True(t, kerrors.IsNotFound(errors.Cause(err)))
+	_, err = GetScopeGVK(ctx, &tclient, dm, "healthscope")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, len(tracer.spans))
+	for i, exp := range []struct {
+		name       string
+		attributes map[string]string
+		hasErr     bool
+	}{
+		{name: "LoadTemplate", attributes: map[string]string{SpanAttributeKind: "trait", SpanAttributeName: "scaler", SpanAttributeOutcome: "success"}},
+		{name: "LoadTemplate", attributes: map[string]string{SpanAttributeKind: "trait", SpanAttributeName: "missing", SpanAttributeOutcome: "not_found"}, hasErr: true},
+		{name: "GetScopeGVK", attributes: map[string]string{SpanAttributeKind: "scope", SpanAttributeName: "healthscope", SpanAttributeOutcome: "success"}},
+	} {
+		span := tracer.spans[i]
+		assert.Equal(t, exp.name, span.name)
+		assert.Equal(t, root, span.parent, "spans must be children of the span in the context")
+		assert.Equal(t, exp.attributes, span.attributes)
+		assert.Equal(t, exp.hasErr, span.err != nil)
+		assert.True(t, span.ended, "span %s must be ended", span.name)
+	}
+
+	// without a tracer the context is returned as is
+	ctx = context.TODO()
+	spanCtx, endSpan := startTemplateSpan(ctx, "LoadTemplate", TraitTemplateKind, "scaler")
+	assert.Equal(t, ctx, spanCtx)
+	endSpan(nil)
+}
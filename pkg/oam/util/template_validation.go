@@ -0,0 +1,92 @@
+package util
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+)
+
+// ValidateDefinitionTemplate validates the template of a ComponentDefinition, WorkloadDefinition, TraitDefinition
+// or ScopeDefinition before it's stored, so that an admission webhook only has to return the errors.
+// It creates the template, compiles the CUE template, the health policy and the custom status, and generates the
+// OpenAPI schema of the parameter. Each CUE error is reported on the field of the offending template with its position.
+func ValidateDefinitionTemplate(_ context.Context, def runtime.Object) field.ErrorList {
+	var name string
+	var schematic *v1alpha2.Schematic
+	var status *v1alpha2.Status
+	var extension *runtime.RawExtension
+	switch d := def.(type) {
+	case *v1alpha2.ComponentDefinition:
+		name, schematic, status, extension = d.Name, d.Spec.Schematic, d.Spec.Status, d.Spec.Extension
+	case *v1alpha2.WorkloadDefinition:
+		name, schematic, status, extension = d.Name, d.Spec.Schematic, d.Spec.Status, d.Spec.Extension
+	case *v1alpha2.TraitDefinition:
+		name, schematic, status, extension = d.Name, d.Spec.Schematic, d.Spec.Status, d.Spec.Extension
+	case *v1alpha2.ScopeDefinition:
+		name, schematic, status, extension = d.Name, d.Spec.Schematic, d.Spec.Status, d.Spec.Extension
+	default:
+		return field.ErrorList{field.NotSupported(field.NewPath("kind"), fmt.Sprintf("%T", def),
+			[]string{"ComponentDefinition", "WorkloadDefinition", "TraitDefinition", "ScopeDefinition"})}
+	}
+
+	specPath := field.NewPath("spec")
+	templatePath := specPath.Child("schematic")
+	var files []v1alpha2.CUEFile
+	switch {
+	case schematic != nil && schematic.CUE != nil:
+		files = schematic.CUE.Files
+		templatePath = templatePath.Child("cue", "template")
+	case schematic == nil && extension != nil:
+		templatePath = specPath.Child("extension", DefaultExtensionTemplateKey)
+	}
+
+	var allErrs field.ErrorList
+	tmpl, err := NewTemplateWithOptions(schematic, status, extension, WithCUEValidation())
+	if err != nil {
+		return append(allErrs, templateFieldErrors(templatePath, files, err)...)
+	}
+	statusPath := specPath.Child("status")
+	if err := validateStatusTemplate(tmpl.Health, "isHealth"); err != nil {
+		allErrs = append(allErrs, templateFieldErrors(statusPath.Child("healthPolicy"), nil, err)...)
+	}
+	if err := validateStatusTemplate(tmpl.CustomStatus, "message"); err != nil {
+		allErrs = append(allErrs, templateFieldErrors(statusPath.Child("customStatus"), nil, err)...)
+	}
+	if tmpl.IsCUE() && tmpl.HasParameters() {
+		tmpl.Name = name
+		if _, err := tmpl.InputSchema(); err != nil {
+			allErrs = append(allErrs, field.Invalid(templatePath, "",
+				fmt.Sprintf("cannot generate OpenAPI schema: %v", err)))
+		}
+	}
+	return allErrs
+}
+
+// templateFieldErrors converts the error of a template to field errors, every CUE error of a *TemplateParseError
+// is reported with its position, on the CUE file it's located in if the template is split into files.
+func templateFieldErrors(fldPath *field.Path, files []v1alpha2.CUEFile, err error) field.ErrorList {
+	parseErr, ok := err.(*TemplateParseError)
+	if !ok {
+		return field.ErrorList{field.Invalid(fldPath, "", err.Error())}
+	}
+	var allErrs field.ErrorList
+	for _, pos := range parseErr.Errors {
+		p := fldPath
+		for i, f := range files {
+			if pos.File != "" && f.Name == pos.File {
+				p = field.NewPath("spec", "schematic", "cue", "files").Index(i).Child("content")
+				break
+			}
+		}
+		location := ""
+		if pos.Line > 0 {
+			location = fmt.Sprintf("line %d, column %d", pos.Line, pos.Column)
+		}
+		allErrs = append(allErrs, field.Invalid(p, location, pos.Message))
+	}
+	return allErrs
+}
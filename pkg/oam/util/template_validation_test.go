@@ -0,0 +1,91 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+)
+
+func TestValidateDefinitionTemplate(t *testing.T) {
+	traitDef := func(schematic *v1alpha2.Schematic, status *v1alpha2.Status) *v1alpha2.TraitDefinition {
+		return &v1alpha2.TraitDefinition{ObjectMeta: metav1.ObjectMeta{Name: "scaler"}, Spec: v1alpha2.TraitDefinitionSpec{Schematic: schematic, Status: status}}
+	}
+	cueSchematic := func(template string, files ...v1alpha2.CUEFile) *v1alpha2.Schematic {
+		return &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: template, Files: files}}
+	}
+	testCases := map[string]struct {
+		def  *v1alpha2.TraitDefinition
+		errs field.ErrorList
+	}{
+		"valid": {
+			def: traitDef(cueSchematic(`
+patch: spec: replicas: parameter.replicas
+parameter: {
+	replicas: *1 | int
+}
+`), &v1alpha2.Status{HealthPolicy: "isHealth: true", CustomStatus: `message: "ok"`}),
+		},
+		"broken CUE template": {
+			def: traitDef(cueSchematic(`
+patch: spec: replicas: parameter.replicas
+parameter: {
+	image: string
+`), nil),
+			errs: field.ErrorList{
+				field.Invalid(field.NewPath("spec", "schematic", "cue", "template"), "line 4, column 16", "expected '}', found 'EOF'"),
+			},
+		},
+		"unresolved reference": {
+			def: traitDef(cueSchematic(`patch: spec: replicas: parameter.replicas`), nil),
+			errs: field.ErrorList{
+				field.Invalid(field.NewPath("spec", "schematic", "cue", "template"), "line 1, column 24", `patch.spec.replicas: reference "parameter" not found`),
+			},
+		},
+		"broken CUE file": {
+			def: traitDef(cueSchematic(`patch: spec: replicas: parameter.replicas`,
+				v1alpha2.CUEFile{Name: "parameter.cue", Content: "parameter: {\n\treplicas: *1 | int\n}"},
+				v1alpha2.CUEFile{Name: "labels.cue", Content: "patch: metadata: labels: app: appName"}), nil),
+			errs: field.ErrorList{
+				field.Invalid(field.NewPath("spec", "schematic", "cue", "files").Index(1).Child("content"), "line 1, column 31", `patch.metadata.labels.app: reference "appName" not found`),
+			},
+		},
+		"broken health policy and custom status": {
+			def: traitDef(cueSchematic(`patch: metadata: labels: app: "nginx"`),
+				&v1alpha2.Status{HealthPolicy: "isHealthy: true", CustomStatus: "message: context.output.status."}),
+			errs: field.ErrorList{
+				field.Invalid(field.NewPath("spec", "status", "healthPolicy"), "", "isHealth is not defined"),
+				field.Invalid(field.NewPath("spec", "status", "customStatus"), "line 1, column 32", "expected selector, found 'EOF'"),
+			},
+		},
+		"parameter without schema": {
+			def: traitDef(cueSchematic(`
+patch: spec: replicas: parameter.replicas
+parameter: replicas: *1 | int
+`), nil),
+			errs: field.ErrorList{
+				field.Invalid(field.NewPath("spec", "schematic", "cue", "template"), "",
+					"cannot generate OpenAPI schema: capability scaler doesn't contain section `parmeter`"),
+			},
+		},
+		"multiple schematics": {
+			def: traitDef(&v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: "patch: {}"}, HELM: &v1alpha2.Helm{}}, nil),
+			errs: field.ErrorList{
+				field.Invalid(field.NewPath("spec", "schematic", "cue", "template"), "", "only one schematic can be set, but got cue, helm"),
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.errs, ValidateDefinitionTemplate(context.TODO(), tc.def))
+		})
+	}
+
+	errs := ValidateDefinitionTemplate(context.TODO(), &v1alpha2.Component{})
+	assert.Equal(t, 1, len(errs))
+	assert.Equal(t, field.ErrorTypeNotSupported, errs[0].Type)
+}
@@ -0,0 +1,103 @@
+package util
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam/discoverymapper"
+)
+
+const (
+	// LabelVariantOf marks a definition as a variant of the definition named by the label,
+	// it's loaded instead of that definition for the environment in LabelEnvironment.
+	LabelVariantOf = "definition.oam.dev/variant-of"
+	// LabelEnvironment is the environment which a variant definition is for, e.g. "prod"
+	LabelEnvironment = "definition.oam.dev/environment"
+)
+
+// LoadForEnvironment makes LoadTemplate prefer the variant of the definition for the environment, i.e. the
+// definition labeled with LabelVariantOf the key and LabelEnvironment env, and fall back to the definition
+// named by the key if there's no such variant. The variant is recorded in Template.Variant.
+func LoadForEnvironment(env string) LoadTemplateOption {
+	return func(o *loadTemplateOptions) {
+		o.environment = env
+	}
+}
+
+// loadEnvironmentVariant loads the template from the variant of the definition named key for the environment
+// of the options, the template is nil if there's no environment or no such variant.
+func loadEnvironmentVariant(ctx context.Context, cli client.Reader, dm discoverymapper.DiscoveryMapper, key string,
+	kd TemplateKind, options *loadTemplateOptions) (*Template, *ResolvedDefinition, error) {
+	if options.environment == "" {
+		return nil, nil, nil
+	}
+	variant, err := resolveEnvironmentVariant(ctx, cli, key, kd, options)
+	if err != nil || variant == "" {
+		return nil, nil, err
+	}
+	options.debug().Info("Resolve definition variant", "kind", kd, "name", key, "environment", options.environment, "variant", variant)
+	tmpl, source, err := loadTemplateWithSource(ctx, cli, dm, variant, kd, options)
+	if err != nil {
+		return nil, nil, errors.WithMessagef(err, "LoadTemplate [%s] variant %s for environment %s", key, variant, options.environment)
+	}
+	tmpl.Name = key
+	tmpl.Variant = variant
+	tmpl.Environment = options.environment
+	return tmpl, source, nil
+}
+
+// resolveEnvironmentVariant returns the name of the variant of the definition named key for the environment,
+// it returns an empty name if there's no such variant. The variants in the namespaces to search first take precedence,
+// and an error is returned if a namespace has more than one variant of the definition for the environment.
+func resolveEnvironmentVariant(ctx context.Context, cli client.Reader, key string, kd TemplateKind, options *loadTemplateOptions) (string, error) {
+	var lists []runtime.Object
+	switch kd {
+	case ComponentTemplateKind:
+		lists = append(lists, &v1alpha2.ComponentDefinitionList{})
+		if !options.disableWorkloadFallback {
+			lists = append(lists, &v1alpha2.WorkloadDefinitionList{})
+		}
+	case TraitTemplateKind:
+		lists = append(lists, &v1alpha2.TraitDefinitionList{})
+	case ScopeTemplateKind:
+		lists = append(lists, &v1alpha2.ScopeDefinitionList{})
+	}
+	selector := client.MatchingLabels{LabelVariantOf: key, LabelEnvironment: options.environment}
+	for _, ns := range options.searchNamespaces(ctx) {
+		var variants []string
+		for _, list := range lists {
+			if err := cli.List(ctx, list, client.InNamespace(ns), selector); err != nil {
+				return "", errors.Wrapf(err, "list definition variants in namespace %s", ns)
+			}
+			items, err := meta.ExtractList(list)
+			if err != nil {
+				return "", err
+			}
+			for _, item := range items {
+				def, err := meta.Accessor(item)
+				if err != nil {
+					return "", err
+				}
+				variants = append(variants, def.GetName())
+			}
+		}
+		switch len(variants) {
+		case 0:
+			continue
+		case 1:
+			return variants[0], nil
+		default:
+			sort.Strings(variants)
+			return "", errors.Errorf("found multiple variants of %s for environment %s in namespace %s: %s",
+				key, options.environment, ns, strings.Join(variants, ", "))
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,79 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/stretchr/testify/assert"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
+	"github.com/oam-dev/kubevela/pkg/oam"
+	"github.com/oam-dev/kubevela/pkg/oam/mock"
+)
+
+func TestLoadForEnvironment(t *testing.T) {
+	traitDef := func(name, template string, lbls map[string]string) v1alpha2.TraitDefinition {
+		return v1alpha2.TraitDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: oam.SystemDefinitonNamespace, Labels: lbls},
+			Spec:       v1alpha2.TraitDefinitionSpec{Schematic: &v1alpha2.Schematic{CUE: &v1alpha2.CUE{Template: template}}},
+		}
+	}
+	defs := []v1alpha2.TraitDefinition{
+		traitDef("scaler", "patch: spec: replicas: 1", nil),
+		traitDef("scaler-prod", "patch: spec: replicas: 3", map[string]string{LabelVariantOf: "scaler", LabelEnvironment: "prod"}),
+		traitDef("ingress", "outputs: ingress: {}", nil),
+	}
+	tclient := test.MockClient{
+		MockGet: func(ctx context.Context, key ktypes.NamespacedName, obj runtime.Object) error {
+			for _, def := range defs {
+				if def.Name == key.Name && def.Namespace == key.Namespace {
+					*obj.(*v1alpha2.TraitDefinition) = def
+					return nil
+				}
+			}
+			return kerrors.NewNotFound(schema.GroupResource{}, key.Name)
+		},
+		MockList: func(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+			lo := &client.ListOptions{}
+			lo.ApplyOptions(opts)
+			l := list.(*v1alpha2.TraitDefinitionList)
+			for _, def := range defs {
+				if def.Namespace == lo.Namespace && lo.LabelSelector.Matches(labels.Set(def.Labels)) {
+					l.Items = append(l.Items, def)
+				}
+			}
+			return nil
+		},
+	}
+	dm := mock.NewMockDiscoveryMapper()
+
+	tmpl, err := LoadTemplateOfKind(context.TODO(), &tclient, dm, "scaler", TraitTemplateKind, LoadForEnvironment("prod"))
+	assert.NoError(t, err)
+	assert.Equal(t, "patch: spec: replicas: 3", tmpl.TemplateStr)
+	assert.Equal(t, "scaler", tmpl.Name)
+	assert.Equal(t, "scaler-prod", tmpl.Variant)
+	assert.Equal(t, "prod", tmpl.Environment)
+
+	tmpl, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "scaler", TraitTemplateKind, LoadForEnvironment("dev"))
+	assert.NoError(t, err)
+	assert.Equal(t, "patch: spec: replicas: 1", tmpl.TemplateStr, "should fall back to the default definition")
+	assert.Empty(t, tmpl.Variant)
+	assert.Empty(t, tmpl.Environment)
+
+	tmpl, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "ingress", TraitTemplateKind, LoadForEnvironment("prod"))
+	assert.NoError(t, err)
+	assert.Equal(t, "outputs: ingress: {}", tmpl.TemplateStr)
+	assert.Empty(t, tmpl.Variant)
+
+	defs = append(defs, traitDef("scaler-prod-v2", "patch: spec: replicas: 5", map[string]string{LabelVariantOf: "scaler", LabelEnvironment: "prod"}))
+	_, err = LoadTemplateOfKind(context.TODO(), &tclient, dm, "scaler", TraitTemplateKind, LoadForEnvironment("prod"))
+	assert.EqualError(t, err, "found multiple variants of scaler for environment prod in namespace vela-system: scaler-prod, scaler-prod-v2")
+}
@@ -157,3 +157,16 @@ func UnMarshalStringToTraitDefinition(s string) (*v1alpha2.TraitDefinition, erro
 	}
 	return obj, nil
 }
+
+// UnMarshalStringToScopeDefinition parse a string to a scopeDefinition object
+func UnMarshalStringToScopeDefinition(s string) (*v1alpha2.ScopeDefinition, error) {
+	obj := &v1alpha2.ScopeDefinition{}
+	_body, err := yaml.YAMLToJSON([]byte(s))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(_body, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
@@ -170,7 +170,11 @@ func HandleTemplate(in *runtime.RawExtension, schematic *corev1alpha2.Schematic,
 	tmp.Name = name
 	// if spec.template is not empty it should has the highest priority
 	if schematic != nil && schematic.CUE != nil {
-		tmp.CueTemplate = schematic.CUE.Template
+		tmpl, err := util.NewTemplate(schematic, nil, nil)
+		if err != nil {
+			return types.Capability{}, err
+		}
+		tmp.CueTemplate = tmpl.TemplateStr
 		tmp.CueTemplateURI = ""
 	}
 	if tmp.CueTemplateURI != "" {
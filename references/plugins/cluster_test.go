@@ -5,15 +5,19 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"testing"
 
 	"cuelang.org/go/cue"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/assert"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 
+	corev1alpha2 "github.com/oam-dev/kubevela/apis/core.oam.dev/v1alpha2"
 	"github.com/oam-dev/kubevela/apis/types"
+	"github.com/oam-dev/kubevela/pkg/oam/util"
 )
 
 const (
@@ -192,3 +196,27 @@ var _ = Describe("DefinitionFiles", func() {
 		}
 	})
 })
+
+func TestHandleTemplateOfEncodedTemplate(t *testing.T) {
+	templateStr := "output: {\n\tkind: \"Deployment\"\n}\nparameter: {\n\timage: string\n}\n"
+	encoded, err := util.EncodeTemplate(templateStr)
+	assert.NoError(t, err)
+	capability, err := HandleTemplate(nil, &corev1alpha2.Schematic{CUE: &corev1alpha2.CUE{Template: encoded}}, "webservice")
+	assert.NoError(t, err)
+	assert.Equal(t, templateStr, capability.CueTemplate)
+	assert.Len(t, capability.Parameters, 1)
+	assert.Equal(t, "image", capability.Parameters[0].Name)
+}
+
+func TestHandleTemplateOfCUEFiles(t *testing.T) {
+	schematic := &corev1alpha2.Schematic{CUE: &corev1alpha2.CUE{
+		Template: "output: {\n\tkind: \"Deployment\"\n}\n",
+		Files:    []corev1alpha2.CUEFile{{Name: "parameter.cue", Content: "parameter: {\n\timage: string\n}\n"}},
+	}}
+	capability, err := HandleTemplate(nil, schematic, "webservice")
+	assert.NoError(t, err)
+	assert.Contains(t, capability.CueTemplate, "kind: \"Deployment\"")
+	assert.Contains(t, capability.CueTemplate, "image: string")
+	assert.Len(t, capability.Parameters, 1)
+	assert.Equal(t, "image", capability.Parameters[0].Name)
+}